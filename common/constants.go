@@ -49,6 +49,12 @@ var DefaultCollapseSidebar = false // default value of collapse sidebar
 var SessionSecret = uuid.New().String()
 var CryptoSecret = uuid.New().String()
 
+// CryptoSecretOld 轮换前使用过的 CRYPTO_SECRET，仅用于解密旧数据
+var CryptoSecretOld []string
+
+// ChannelKeyEncryptionEnabled 仅在显式设置 CRYPTO_SECRET 时启用，避免随机密钥导致重启后无法解密
+var ChannelKeyEncryptionEnabled = false
+
 var OptionMap map[string]string
 var OptionMapRWMutex sync.RWMutex
 
@@ -56,6 +62,7 @@ var ItemsPerPage = 10
 var MaxRecentItems = 100
 
 var PasswordLoginEnabled = true
+var PasskeyLoginEnabled = false
 var PasswordRegisterEnabled = true
 var EmailVerificationEnabled = false
 var GitHubOAuthEnabled = false
@@ -65,6 +72,9 @@ var TelegramOAuthEnabled = false
 var TurnstileCheckEnabled = false
 var RegisterEnabled = true
 
+// AdminTwoFARequiredEnabled 要求管理员及以上角色启用两步验证后才能访问管理接口
+var AdminTwoFARequiredEnabled = false
+
 var EmailDomainRestrictionEnabled = false // 是否启用邮箱域名限制
 var EmailAliasRestrictionEnabled = false  // 是否启用邮箱别名限制
 var EmailDomainWhitelist = []string{
@@ -161,6 +171,11 @@ func IsValidateRole(role int) bool {
 	return role == RoleGuestUser || role == RoleCommonUser || role == RoleAdminUser || role == RoleRootUser
 }
 
+// IsTwoFARequiredForRole 判断该角色是否被强制要求启用两步验证
+func IsTwoFARequiredForRole(role int) bool {
+	return AdminTwoFARequiredEnabled && role >= RoleAdminUser
+}
+
 var (
 	FileUploadPermission    = RoleGuestUser
 	FileDownloadPermission  = RoleGuestUser
@@ -263,6 +278,7 @@ const (
 	ChannelTypeXinference     = 47
 	ChannelTypeXai            = 48
 	ChannelTypeGitHub         = 49
+	ChannelTypeKling          = 50
 	ChannelTypeDummy          // this one is only for count, do not add any channel after this
 
 )
@@ -318,4 +334,5 @@ var ChannelBaseURLs = []string{
 	"",                                          //47
 	"https://api.x.ai",                          //48
 	"https://models.github.ai/inference",        //49
+	"https://api.klingai.com",                   //50
 }
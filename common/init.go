@@ -23,6 +23,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -65,9 +66,16 @@ func LoadEnv() {
 	}
 	if os.Getenv("CRYPTO_SECRET") != "" {
 		CryptoSecret = os.Getenv("CRYPTO_SECRET")
+		ChannelKeyEncryptionEnabled = GetEnvOrDefaultBool("CHANNEL_KEY_ENCRYPTION_ENABLED", true)
 	} else {
 		CryptoSecret = SessionSecret
 	}
+	for _, secret := range strings.Split(os.Getenv("CRYPTO_SECRET_OLD"), ",") {
+		secret = strings.TrimSpace(secret)
+		if secret != "" && secret != CryptoSecret {
+			CryptoSecretOld = append(CryptoSecretOld, secret)
+		}
+	}
 	if os.Getenv("SQLITE_PATH") != "" {
 		SQLitePath = os.Getenv("SQLITE_PATH")
 	}
@@ -0,0 +1,117 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package common
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "veloera"
+
+var relayMetricLabelNames = []string{"channel_id", "channel_type", "model", "group", "relay_mode"}
+
+var (
+	relayRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_requests_total",
+		Help:      "Total number of relay requests by result.",
+	}, append(relayMetricLabelNames, "status"))
+	relayRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_request_duration_seconds",
+		Help:      "Duration of successful relay requests.",
+		Buckets:   []float64{0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+	}, relayMetricLabelNames)
+	relayFirstResponseDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_first_response_seconds",
+		Help:      "Time until the first response byte (first token for streams).",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 10, 20, 60},
+	}, relayMetricLabelNames)
+	relayTokensTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_tokens_total",
+		Help:      "Total number of tokens consumed by relay requests.",
+	}, append(relayMetricLabelNames, "type"))
+	relayQuotaTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_quota_total",
+		Help:      "Total quota consumed by relay requests.",
+	}, relayMetricLabelNames)
+	relayRetriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_retries_total",
+		Help:      "Total number of relay retries, labelled by the channel that failed.",
+	}, relayMetricLabelNames)
+	relayUpstreamErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_upstream_errors_total",
+		Help:      "Total number of upstream errors by status code and error code.",
+	}, append(relayMetricLabelNames, "status_code", "code"))
+	relayInflightStreams = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_inflight_streams",
+		Help:      "Number of streaming responses currently being relayed.",
+	})
+)
+
+// RelayMetricLabels 中继指标的公共标签
+type RelayMetricLabels struct {
+	ChannelId   int
+	ChannelType int
+	Model       string
+	Group       string
+	RelayMode   string
+}
+
+func (l RelayMetricLabels) values(extra ...string) []string {
+	return append([]string{strconv.Itoa(l.ChannelId), strconv.Itoa(l.ChannelType), l.Model, l.Group, l.RelayMode}, extra...)
+}
+
+// RecordRelaySuccess 记录一次成功的中继请求，firstResponse 为 0 时不记录首字延迟
+func RecordRelaySuccess(l RelayMetricLabels, duration time.Duration, firstResponse time.Duration, promptTokens int, completionTokens int, quota int) {
+	relayRequestsTotal.WithLabelValues(l.values("success")...).Inc()
+	relayRequestDuration.WithLabelValues(l.values()...).Observe(duration.Seconds())
+	if firstResponse > 0 {
+		relayFirstResponseDuration.WithLabelValues(l.values()...).Observe(firstResponse.Seconds())
+	}
+	relayTokensTotal.WithLabelValues(l.values("prompt")...).Add(float64(promptTokens))
+	relayTokensTotal.WithLabelValues(l.values("completion")...).Add(float64(completionTokens))
+	relayQuotaTotal.WithLabelValues(l.values()...).Add(float64(quota))
+}
+
+// RecordRelayError 记录一次上游返回错误的中继请求
+func RecordRelayError(l RelayMetricLabels, statusCode int, code string) {
+	relayRequestsTotal.WithLabelValues(l.values("error")...).Inc()
+	relayUpstreamErrorsTotal.WithLabelValues(l.values(strconv.Itoa(statusCode), code)...).Inc()
+}
+
+func RecordRelayRetry(l RelayMetricLabels) {
+	relayRetriesTotal.WithLabelValues(l.values()...).Inc()
+}
+
+func IncRelayInflightStreams() {
+	relayInflightStreams.Inc()
+}
+
+func DecRelayInflightStreams() {
+	relayInflightStreams.Dec()
+}
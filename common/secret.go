@@ -0,0 +1,199 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// 信封加密格式：enc:v1:<kek id>:<被 KEK 包裹的数据密钥>:<数据密文>
+// 每个值使用独立的随机数据密钥 (DEK) 加密，DEK 再由 CRYPTO_SECRET 派生的 KEK 加密。
+// 轮换 CRYPTO_SECRET 时只需要用新的 KEK 重新包裹 DEK，数据密文保持不变。
+const encryptedSecretPrefix = "enc:v1:"
+
+var errSecretKeyNotFound = errors.New("no matching crypto secret for encrypted value, check CRYPTO_SECRET and CRYPTO_SECRET_OLD")
+
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, encryptedSecretPrefix)
+}
+
+func deriveKeyEncryptionKey(secret string) []byte {
+	sum := sha256.Sum256([]byte("veloera-kek:" + secret))
+	return sum[:]
+}
+
+func keyEncryptionKeyId(secret string) string {
+	return GenerateHMACWithKey([]byte(secret), "veloera-kek-id")[:12]
+}
+
+func sealAESGCM(key []byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openAESGCM(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+type encryptedSecret struct {
+	keyId      string
+	wrappedKey []byte
+	ciphertext []byte
+}
+
+func parseEncryptedSecret(value string) (*encryptedSecret, error) {
+	parts := strings.Split(strings.TrimPrefix(value, encryptedSecretPrefix), ":")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid encrypted value format")
+	}
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted data key: %w", err)
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted data: %w", err)
+	}
+	return &encryptedSecret{keyId: parts[0], wrappedKey: wrappedKey, ciphertext: ciphertext}, nil
+}
+
+func (s *encryptedSecret) String() string {
+	return encryptedSecretPrefix + s.keyId + ":" +
+		base64.RawStdEncoding.EncodeToString(s.wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(s.ciphertext)
+}
+
+// unwrapDataKey 按 kek id 在当前及旧的 CRYPTO_SECRET 中查找 KEK 并解出数据密钥
+func (s *encryptedSecret) unwrapDataKey() ([]byte, error) {
+	secrets := append([]string{CryptoSecret}, CryptoSecretOld...)
+	for _, secret := range secrets {
+		if keyEncryptionKeyId(secret) != s.keyId {
+			continue
+		}
+		return openAESGCM(deriveKeyEncryptionKey(secret), s.wrappedKey)
+	}
+	return nil, errSecretKeyNotFound
+}
+
+// EncryptSecret 使用当前 CRYPTO_SECRET 对 plaintext 做信封加密，已加密的值原样返回
+func EncryptSecret(plaintext string) (string, error) {
+	if plaintext == "" || IsEncryptedSecret(plaintext) {
+		return plaintext, nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+	ciphertext, err := sealAESGCM(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := sealAESGCM(deriveKeyEncryptionKey(CryptoSecret), dataKey)
+	if err != nil {
+		return "", err
+	}
+	secret := &encryptedSecret{
+		keyId:      keyEncryptionKeyId(CryptoSecret),
+		wrappedKey: wrappedKey,
+		ciphertext: ciphertext,
+	}
+	return secret.String(), nil
+}
+
+// DecryptSecret 解密 EncryptSecret 的输出，未加密的值原样返回
+func DecryptSecret(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	secret, err := parseEncryptedSecret(value)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := secret.unwrapDataKey()
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openAESGCM(dataKey, secret.ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// SecretNeedsRotation 判断加密值是否由旧的 CRYPTO_SECRET 加密
+func SecretNeedsRotation(value string) bool {
+	if !IsEncryptedSecret(value) {
+		return false
+	}
+	secret, err := parseEncryptedSecret(value)
+	if err != nil {
+		return false
+	}
+	return secret.keyId != keyEncryptionKeyId(CryptoSecret)
+}
+
+// RotateSecret 使用当前 CRYPTO_SECRET 重新包裹数据密钥
+func RotateSecret(value string) (string, error) {
+	if !SecretNeedsRotation(value) {
+		return value, nil
+	}
+	secret, err := parseEncryptedSecret(value)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := secret.unwrapDataKey()
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := sealAESGCM(deriveKeyEncryptionKey(CryptoSecret), dataKey)
+	if err != nil {
+		return "", err
+	}
+	secret.keyId = keyEncryptionKeyId(CryptoSecret)
+	secret.wrappedKey = wrappedKey
+	return secret.String(), nil
+}
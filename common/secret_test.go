@@ -0,0 +1,106 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package common
+
+import (
+	"errors"
+	"testing"
+)
+
+func withCryptoSecret(t *testing.T, secret string, old ...string) {
+	t.Helper()
+	prevSecret, prevOld := CryptoSecret, CryptoSecretOld
+	CryptoSecret, CryptoSecretOld = secret, old
+	t.Cleanup(func() {
+		CryptoSecret, CryptoSecretOld = prevSecret, prevOld
+	})
+}
+
+func TestEncryptDecryptSecretRoundTrip(t *testing.T) {
+	withCryptoSecret(t, "secret-a")
+	for _, plaintext := range []string{"sk-test", "sk-a,sk-b\nsk-c", "{\"type\":\"service_account\"}"} {
+		encrypted, err := EncryptSecret(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncryptedSecret(encrypted) || encrypted == plaintext {
+			t.Fatalf("expected %q to be encrypted, got %q", plaintext, encrypted)
+		}
+		// 已加密的值不会被重复加密
+		again, err := EncryptSecret(encrypted)
+		if err != nil || again != encrypted {
+			t.Fatalf("expected encrypted value to be returned unchanged, got %q, %v", again, err)
+		}
+		decrypted, err := DecryptSecret(encrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decrypted != plaintext {
+			t.Fatalf("expected %q, got %q", plaintext, decrypted)
+		}
+	}
+	// 未加密的值原样返回，兼容迁移前的明文数据
+	if value, err := DecryptSecret("sk-plain"); err != nil || value != "sk-plain" {
+		t.Fatalf("expected plaintext passthrough, got %q, %v", value, err)
+	}
+}
+
+func TestDecryptSecretWithWrongKEK(t *testing.T) {
+	withCryptoSecret(t, "secret-a")
+	encrypted, err := EncryptSecret("sk-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	CryptoSecret = "secret-b"
+	if _, err = DecryptSecret(encrypted); !errors.Is(err, errSecretKeyNotFound) {
+		t.Fatalf("expected errSecretKeyNotFound, got %v", err)
+	}
+
+	// kek id 相同但密钥内容被篡改时同样需要报错
+	CryptoSecret = "secret-a"
+	secret, err := parseEncryptedSecret(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret.wrappedKey[len(secret.wrappedKey)-1] ^= 0xff
+	if _, err = DecryptSecret(secret.String()); err == nil {
+		t.Fatal("expected tampered data key to fail decryption")
+	}
+}
+
+func TestRotateSecret(t *testing.T) {
+	withCryptoSecret(t, "secret-a")
+	encrypted, err := EncryptSecret("sk-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	CryptoSecret, CryptoSecretOld = "secret-b", []string{"secret-a"}
+	if !SecretNeedsRotation(encrypted) {
+		t.Fatal("expected value encrypted by old secret to need rotation")
+	}
+	rotated, err := RotateSecret(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if SecretNeedsRotation(rotated) {
+		t.Fatal("expected rotated value to use current secret")
+	}
+	CryptoSecretOld = nil
+	if value, err := DecryptSecret(rotated); err != nil || value != "sk-test" {
+		t.Fatalf("expected rotated value to decrypt with current secret only, got %q, %v", value, err)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package common
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var TracingEnabled = false
+
+var tracer = otel.Tracer("veloera")
+
+// InitTracing 启用 OTLP/HTTP 链路追踪，导出地址等参数通过标准的 OTEL_EXPORTER_OTLP_* 环境变量配置，
+// 默认导出到本地 collector (localhost:4318)
+func InitTracing() {
+	if os.Getenv("ENABLE_TRACING") != "true" {
+		return
+	}
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		SysError("failed to create otlp trace exporter: " + err.Error())
+		return
+	}
+	res, err := resource.New(context.Background(),
+		resource.WithAttributes(semconv.ServiceName("veloera"), semconv.ServiceVersion(Version)),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		SysError("failed to create otel resource: " + err.Error())
+	}
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	))
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	TracingEnabled = true
+	SysLog("tracing enabled")
+}
+
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+func StartSpanWithKind(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// StartGinSpan 以请求上下文为父 span 创建子 span，不修改 c.Request，
+// 用于中间件等只需记录自身耗时的阶段
+func StartGinSpan(c *gin.Context, name string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := StartSpan(c.Request.Context(), name, attrs...)
+	return span
+}
+
+// SetSpanStatusCode 记录 HTTP 状态码，非 2xx 时标记为错误
+func SetSpanStatusCode(span trace.Span, statusCode int, message string) {
+	span.SetAttributes(semconv.HTTPResponseStatusCode(statusCode))
+	if statusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, message)
+	}
+}
+
+// InjectTraceHeaders 将当前 span 以 W3C traceparent 头传递给上游
+func InjectTraceHeaders(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// ExtractTraceContext 从客户端请求头中读取 traceparent
+func ExtractTraceContext(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
@@ -22,4 +22,13 @@ var (
 	ChannelSettingThinkingToContent = "thinking_to_content" // ThinkingToContent
 	ChannelSettingStreamSupport     = "stream_support"      // StreamSupport 控制上游流式请求行为
 	StreamSupportNonStreamOnly      = "NON_STREAM_ONLY"     // StreamSupport 仅非流式请求
+	ChannelSettingAwsModelIds       = "aws_model_ids"       // AwsModelIds AWS 渠道模型名到 Bedrock 模型 ID 或推理配置文件 ARN 的映射
+)
+
+// 上游 HTTP 连接相关的渠道设置
+var (
+	ChannelSettingTimeout       = "timeout"                 // Timeout 整个上游请求（含流式读取）的超时时间，单位秒
+	ChannelSettingHeaderTimeout = "response_header_timeout" // ResponseHeaderTimeout 等待上游响应头的超时时间，单位秒
+	ChannelSettingInsecureTLS   = "insecure_skip_verify"    // InsecureSkipVerify 跳过上游 TLS 证书校验
+	ChannelSettingDisableHTTP2  = "disable_http2"           // DisableHTTP2 强制使用 HTTP/1.1 连接上游
 )
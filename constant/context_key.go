@@ -23,4 +23,13 @@ const (
 	ContextKeyUserStatus       = "user_status"
 	ContextKeyUserEmail        = "user_email"
 	ContextKeyUserGroup        = "user_group"
+	ContextKeyBatchRequest     = "batch_request"
+	ContextKeyStreamDataFilter = "stream_data_filter"
+	ContextKeyUpstreamLatency  = "upstream_latency"
+	ContextKeyChannelKeyHash   = "channel_key_hash"
+	ContextKeyResponseCacheHit = "response_cache_hit"
+	ContextKeyUsageLimit       = "usage_limit"
+	ContextKeyExcludedChannels = "excluded_channels"
+	ContextKeyFallbackFrom     = "model_fallback_from"
+	ContextKeyImageFormat      = "image_response_format"
 )
@@ -32,6 +32,11 @@ var GeminiVisionMaxImageNum int
 var NotifyLimitCount int
 var NotificationLimitDurationMinute int
 var GenerateDefaultToken bool
+var FileStoragePath string
+var MaxFileUploadMB int
+var MetricsEnabled bool
+var MetricsToken string
+var ResponsesStoreDays int
 
 //var GeminiModelMap = map[string]string{
 //	"gemini-1.0-pro": "v1",
@@ -52,6 +57,14 @@ func InitEnv() {
 	NotificationLimitDurationMinute = common.GetEnvOrDefault("NOTIFICATION_LIMIT_DURATION_MINUTE", 10)
 	// GenerateDefaultToken 是否生成初始令牌，默认关闭。
 	GenerateDefaultToken = common.GetEnvOrDefaultBool("GENERATE_DEFAULT_TOKEN", false)
+	// Files / Batch API 上传文件和批处理结果的本地存储目录
+	FileStoragePath = common.GetEnvOrDefaultString("FILE_STORAGE_PATH", "./data/files")
+	MaxFileUploadMB = common.GetEnvOrDefault("MAX_FILE_UPLOAD_MB", 200)
+	// Prometheus /metrics 接口，设置 METRICS_TOKEN 后需要携带 Bearer Token 访问
+	MetricsEnabled = common.GetEnvOrDefaultBool("ENABLE_METRICS", false)
+	MetricsToken = common.GetEnvOrDefaultString("METRICS_TOKEN", "")
+	// /v1/responses 会话在非 OpenAI 渠道上的保存天数，0 表示永久保存
+	ResponsesStoreDays = common.GetEnvOrDefault("RESPONSES_STORE_DAYS", 30)
 
 	//modelVersionMapStr := strings.TrimSpace(os.Getenv("GEMINI_MODEL_MAP"))
 	//if modelVersionMapStr == "" {
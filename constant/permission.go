@@ -0,0 +1,57 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package constant
+
+// 管理后台的细粒度权限，超级管理员始终拥有全部权限
+const (
+	PermissionChannelsRead  = "channels:read"  // 查看渠道、分组与模型列表
+	PermissionChannelsWrite = "channels:write" // 新增、编辑、测试、删除渠道
+	PermissionUsersManage   = "users:manage"   // 管理用户与组织
+	PermissionLogsRead      = "logs:read"      // 查看全站日志、统计与任务记录
+	PermissionLogsWrite     = "logs:write"     // 清理历史日志
+	PermissionBillingManage = "billing:manage" // 管理兑换码
+	PermissionOptionsWrite  = "options:write"  // 修改系统设置、导入导出配置
+)
+
+var AllPermissions = []string{
+	PermissionChannelsRead,
+	PermissionChannelsWrite,
+	PermissionUsersManage,
+	PermissionLogsRead,
+	PermissionLogsWrite,
+	PermissionBillingManage,
+	PermissionOptionsWrite,
+}
+
+// AdminDefaultPermissions 未单独分配权限的管理员所拥有的权限，与引入权限前管理员的能力一致
+var AdminDefaultPermissions = []string{
+	PermissionChannelsRead,
+	PermissionChannelsWrite,
+	PermissionUsersManage,
+	PermissionLogsRead,
+	PermissionLogsWrite,
+	PermissionBillingManage,
+}
+
+func IsValidPermission(permission string) bool {
+	for _, p := range AllPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
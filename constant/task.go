@@ -23,6 +23,20 @@ const (
 	TaskPlatformMidjourney              = "mj"
 )
 
+// 视频生成平台，提交时根据渠道类型选择
+const (
+	TaskPlatformSora  TaskPlatform = "sora"
+	TaskPlatformKling TaskPlatform = "kling"
+)
+
+// VideoTaskPlatforms 通过 /v1/videos 接口提交的任务平台
+var VideoTaskPlatforms = []TaskPlatform{TaskPlatformSora, TaskPlatformKling}
+
+const (
+	VideoActionText2Video  = "TEXT2VIDEO"
+	VideoActionImage2Video = "IMAGE2VIDEO"
+)
+
 const (
 	SunoActionMusic  = "MUSIC"
 	SunoActionLyrics = "LYRICS"
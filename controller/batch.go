@@ -0,0 +1,599 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/dto"
+	"veloera/middleware"
+	"veloera/model"
+	"veloera/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+var batchEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+	"/v1/responses":        true,
+}
+
+const batchMaxValidationErrors = 100
+
+func timestampOrNil(t int64) *int64 {
+	if t == 0 {
+		return nil
+	}
+	return &t
+}
+
+func stringOrNil(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func batchToOpenAI(batch *model.Batch) *dto.OpenAIBatch {
+	openAIBatch := &dto.OpenAIBatch{
+		Id:               batch.BatchId,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileId:     stringOrNil(batch.OutputFileId),
+		ErrorFileId:      stringOrNil(batch.ErrorFileId),
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     timestampOrNil(batch.InProgressAt),
+		ExpiresAt:        timestampOrNil(batch.ExpiresAt),
+		FinalizingAt:     timestampOrNil(batch.FinalizingAt),
+		CompletedAt:      timestampOrNil(batch.CompletedAt),
+		FailedAt:         timestampOrNil(batch.FailedAt),
+		ExpiredAt:        timestampOrNil(batch.ExpiredAt),
+		CancellingAt:     timestampOrNil(batch.CancellingAt),
+		CancelledAt:      timestampOrNil(batch.CancelledAt),
+		RequestCounts: dto.BatchRequestCounts{
+			Total:     batch.RequestTotal,
+			Completed: batch.RequestCompleted,
+			Failed:    batch.RequestFailed,
+		},
+		Metadata: batch.GetMetadata(),
+	}
+	if batch.Errors != "" {
+		var errorData []dto.BatchErrorData
+		if err := json.Unmarshal([]byte(batch.Errors), &errorData); err == nil {
+			openAIBatch.Errors = &dto.BatchErrors{
+				Object: "list",
+				Data:   errorData,
+			}
+		}
+	}
+	return openAIBatch
+}
+
+func CreateBatch(c *gin.Context) {
+	var request dto.BatchCreateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		openAIErrorResponse(c, err, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	if !batchEndpoints[request.Endpoint] {
+		openAIErrorResponse(c, fmt.Errorf("unsupported endpoint: %s", request.Endpoint), "invalid_endpoint", http.StatusBadRequest)
+		return
+	}
+	if request.CompletionWindow != "24h" {
+		openAIErrorResponse(c, errors.New("completion_window must be 24h"), "invalid_completion_window", http.StatusBadRequest)
+		return
+	}
+	// 批处理在服务端执行，令牌的 IP 限制在创建时校验
+	allowIpsMap := c.GetStringMap("allow_ips")
+	if len(allowIpsMap) != 0 {
+		if _, ok := allowIpsMap[c.ClientIP()]; !ok {
+			openAIErrorResponse(c, errors.New("您的 IP 不在令牌允许访问的列表中"), "ip_not_allowed", http.StatusForbidden)
+			return
+		}
+	}
+	userId := c.GetInt("id")
+	inputFile, err := model.GetUserFileByFileId(userId, request.InputFileId)
+	if err != nil {
+		openAIErrorResponse(c, fmt.Errorf("no such file: %s", request.InputFileId), "file_not_found", http.StatusNotFound)
+		return
+	}
+	if inputFile.Purpose != "batch" {
+		openAIErrorResponse(c, errors.New("input file must be uploaded with purpose batch"), "invalid_input_file", http.StatusBadRequest)
+		return
+	}
+	now := common.GetTimestamp()
+	batch := &model.Batch{
+		BatchId:          "batch_" + common.GetUUID(),
+		UserId:           userId,
+		TokenId:          c.GetInt("token_id"),
+		Endpoint:         request.Endpoint,
+		InputFileId:      request.InputFileId,
+		CompletionWindow: request.CompletionWindow,
+		Status:           model.BatchStatusValidating,
+		CreatedAt:        now,
+		ExpiresAt:        now + 24*60*60,
+	}
+	batch.SetMetadata(request.Metadata)
+	if err = batch.Insert(); err != nil {
+		openAIErrorResponse(c, err, "create_batch_failed", http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, batchToOpenAI(batch))
+}
+
+func ListBatches(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	batches, err := model.GetUserBatches(c.GetInt("id"), c.Query("after"), limit+1)
+	if err != nil {
+		openAIErrorResponse(c, err, "list_batches_failed", http.StatusInternalServerError)
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	data := make([]*dto.OpenAIBatch, 0, len(batches))
+	for _, batch := range batches {
+		data = append(data, batchToOpenAI(batch))
+	}
+	response := dto.OpenAIListResponse{
+		Object:  "list",
+		Data:    data,
+		HasMore: hasMore,
+	}
+	if len(data) > 0 {
+		response.FirstId = data[0].Id
+		response.LastId = data[len(data)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func RetrieveBatch(c *gin.Context) {
+	batch, err := model.GetUserBatchByBatchId(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		openAIErrorResponse(c, fmt.Errorf("no such batch: %s", c.Param("id")), "batch_not_found", http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, batchToOpenAI(batch))
+}
+
+func CancelBatch(c *gin.Context) {
+	batch, err := model.GetUserBatchByBatchId(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		openAIErrorResponse(c, fmt.Errorf("no such batch: %s", c.Param("id")), "batch_not_found", http.StatusNotFound)
+		return
+	}
+	for _, from := range []string{model.BatchStatusValidating, model.BatchStatusInProgress} {
+		if batch.Status != from {
+			continue
+		}
+		// 由批处理执行器完成取消并生成已完成部分的结果文件
+		_, err = batch.UpdateStatus(from, map[string]interface{}{
+			"status":        model.BatchStatusCancelling,
+			"cancelling_at": common.GetTimestamp(),
+		})
+		if err != nil {
+			openAIErrorResponse(c, err, "cancel_batch_failed", http.StatusInternalServerError)
+			return
+		}
+		break
+	}
+	if batch.Status != model.BatchStatusCancelling && batch.Status != model.BatchStatusCancelled {
+		openAIErrorResponse(c, fmt.Errorf("cannot cancel a batch with status %s", batch.Status), "invalid_batch_status", http.StatusConflict)
+		return
+	}
+	c.JSON(http.StatusOK, batchToOpenAI(batch))
+}
+
+var runningBatches sync.Map
+
+// RunBatchTasks 轮询未完成的批处理任务并在本节点执行
+func RunBatchTasks() {
+	for {
+		time.Sleep(time.Duration(10) * time.Second)
+		for _, batch := range model.GetUnfinishedBatches(100) {
+			if _, running := runningBatches.LoadOrStore(batch.Id, true); running {
+				continue
+			}
+			batch := batch
+			gopool.Go(func() {
+				defer runningBatches.Delete(batch.Id)
+				processBatch(batch)
+			})
+		}
+	}
+}
+
+func batchResultPath(batch *model.Batch, kind string) string {
+	return filepath.Join(constant.FileStoragePath, fmt.Sprintf("%s_%s.jsonl", batch.BatchId, kind))
+}
+
+func readBatchInput(batch *model.Batch) ([]*dto.BatchRequestLine, []dto.BatchErrorData, error) {
+	inputFile, err := model.GetUserFileByFileId(batch.UserId, batch.InputFileId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("input file %s not found", batch.InputFileId)
+	}
+	f, err := os.Open(inputFile.StoragePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var lines []*dto.BatchRequestLine
+	var validationErrors []dto.BatchErrorData
+	customIds := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1<<20), 100<<20)
+	lineNumber := 0
+	for scanner.Scan() && len(validationErrors) < batchMaxValidationErrors {
+		lineNumber++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		line := &dto.BatchRequestLine{}
+		if err = json.Unmarshal(text, line); err != nil {
+			validationErrors = append(validationErrors, dto.BatchErrorData{Code: "invalid_json_line", Message: "This line is not parseable as valid JSON.", Line: lineNumber})
+			continue
+		}
+		switch {
+		case line.CustomId == "":
+			validationErrors = append(validationErrors, dto.BatchErrorData{Code: "missing_required_parameter", Message: "custom_id is required.", Param: "custom_id", Line: lineNumber})
+		case customIds[line.CustomId]:
+			validationErrors = append(validationErrors, dto.BatchErrorData{Code: "duplicate_custom_id", Message: "The custom_id for this request is a duplicate of another request.", Param: "custom_id", Line: lineNumber})
+		case line.Method != http.MethodPost:
+			validationErrors = append(validationErrors, dto.BatchErrorData{Code: "invalid_method", Message: "Only POST is supported.", Param: "method", Line: lineNumber})
+		case line.Url != batch.Endpoint:
+			validationErrors = append(validationErrors, dto.BatchErrorData{Code: "mismatched_endpoint", Message: fmt.Sprintf("The url must match the batch endpoint %s.", batch.Endpoint), Param: "url", Line: lineNumber})
+		case len(line.Body) == 0 || line.Body[0] != '{':
+			validationErrors = append(validationErrors, dto.BatchErrorData{Code: "invalid_request", Message: "body must be a JSON object.", Param: "body", Line: lineNumber})
+		default:
+			customIds[line.CustomId] = true
+			lines = append(lines, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(validationErrors) == 0 && len(lines) == 0 {
+		validationErrors = append(validationErrors, dto.BatchErrorData{Code: "empty_file", Message: "The input file is empty."})
+	}
+	maxRequests := operation_setting.GetBatchSetting().MaxRequests
+	if maxRequests > 0 && len(lines) > maxRequests {
+		validationErrors = append(validationErrors, dto.BatchErrorData{Code: "too_many_requests", Message: fmt.Sprintf("The batch contains more than %d requests.", maxRequests)})
+	}
+	return lines, validationErrors, nil
+}
+
+// loadBatchResults 读取已写入的结果文件，用于节点重启后继续执行未完成的批处理
+func loadBatchResults(path string, processed map[string]bool) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	count := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1<<20), 100<<20)
+	for scanner.Scan() {
+		var line dto.BatchResponseLine
+		if json.Unmarshal(scanner.Bytes(), &line) == nil && line.CustomId != "" {
+			processed[line.CustomId] = true
+			count++
+		}
+	}
+	return count
+}
+
+type batchResultWriter struct {
+	mutex  sync.Mutex
+	batch  *model.Batch
+	output *os.File
+	errors *os.File
+}
+
+func (w *batchResultWriter) write(line *dto.BatchResponseLine, success bool) {
+	data, err := json.Marshal(line)
+	if err != nil {
+		common.SysError("failed to marshal batch result: " + err.Error())
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	target := w.output
+	if success {
+		w.batch.RequestCompleted++
+	} else {
+		w.batch.RequestFailed++
+		target = w.errors
+	}
+	if _, err = target.Write(append(data, '\n')); err != nil {
+		common.SysError("failed to write batch result: " + err.Error())
+	}
+}
+
+func (w *batchResultWriter) saveRequestCounts() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if err := w.batch.UpdateRequestCounts(); err != nil {
+		common.SysError("failed to update batch request counts: " + err.Error())
+	}
+}
+
+func processBatch(batch *model.Batch) {
+	switch batch.Status {
+	case model.BatchStatusCancelling:
+		finishBatch(batch, model.BatchStatusCancelling, model.BatchStatusCancelled, "cancelled_at")
+		return
+	case model.BatchStatusFinalizing:
+		finishBatch(batch, model.BatchStatusFinalizing, model.BatchStatusCompleted, "completed_at")
+		return
+	}
+
+	lines, validationErrors, err := readBatchInput(batch)
+	if err != nil {
+		validationErrors = []dto.BatchErrorData{{Code: "invalid_input_file", Message: err.Error()}}
+	}
+	if batch.Status == model.BatchStatusValidating {
+		updates := map[string]interface{}{
+			"status":         model.BatchStatusInProgress,
+			"in_progress_at": common.GetTimestamp(),
+			"request_total":  len(lines),
+		}
+		if len(validationErrors) > 0 {
+			errorsJson, _ := json.Marshal(validationErrors)
+			updates = map[string]interface{}{
+				"status":    model.BatchStatusFailed,
+				"failed_at": common.GetTimestamp(),
+				"errors":    string(errorsJson),
+			}
+		}
+		if ok, err := batch.UpdateStatus(model.BatchStatusValidating, updates); err != nil || !ok {
+			// 已被取消，下一轮处理
+			return
+		}
+		if batch.Status == model.BatchStatusFailed {
+			return
+		}
+	} else if len(validationErrors) > 0 {
+		common.SysError(fmt.Sprintf("batch %s input file is no longer valid: %s", batch.BatchId, validationErrors[0].Message))
+		finishBatch(batch, batch.Status, model.BatchStatusFailed, "failed_at")
+		return
+	}
+
+	if err = os.MkdirAll(constant.FileStoragePath, 0755); err != nil {
+		common.SysError("failed to create file storage dir: " + err.Error())
+		return
+	}
+	processed := make(map[string]bool)
+	batch.RequestCompleted = loadBatchResults(batchResultPath(batch, "output"), processed)
+	batch.RequestFailed = loadBatchResults(batchResultPath(batch, "error"), processed)
+	batch.RequestTotal = len(lines)
+
+	writer := &batchResultWriter{batch: batch}
+	writer.output, err = os.OpenFile(batchResultPath(batch, "output"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		common.SysError("failed to open batch output file: " + err.Error())
+		return
+	}
+	defer writer.output.Close()
+	writer.errors, err = os.OpenFile(batchResultPath(batch, "error"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		common.SysError("failed to open batch error file: " + err.Error())
+		return
+	}
+	defer writer.errors.Close()
+
+	// 定时检查取消状态和过期时间，并保存进度
+	var stopStatus atomic.Value
+	done := make(chan struct{})
+	checkStatus := func() {
+		if common.GetTimestamp() > batch.ExpiresAt {
+			stopStatus.Store(model.BatchStatusExpired)
+			return
+		}
+		if status, err := model.GetBatchStatus(batch.Id); err == nil && status == model.BatchStatusCancelling {
+			stopStatus.Store(model.BatchStatusCancelling)
+		}
+	}
+	gopool.Go(func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				checkStatus()
+				writer.saveRequestCounts()
+			}
+		}
+	})
+
+	concurrency := operation_setting.GetBatchSetting().Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, line := range lines {
+		if processed[line.CustomId] {
+			continue
+		}
+		if stopStatus.Load() != nil {
+			break
+		}
+		semaphore <- struct{}{}
+		wg.Add(1)
+		line := line
+		gopool.Go(func() {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			writer.write(executeBatchRequest(batch, line))
+		})
+	}
+	wg.Wait()
+	close(done)
+	writer.saveRequestCounts()
+
+	checkStatus()
+	switch stopStatus.Load() {
+	case model.BatchStatusExpired:
+		finishBatch(batch, model.BatchStatusInProgress, model.BatchStatusExpired, "expired_at")
+	case model.BatchStatusCancelling:
+		finishBatch(batch, model.BatchStatusCancelling, model.BatchStatusCancelled, "cancelled_at")
+	default:
+		ok, err := batch.UpdateStatus(model.BatchStatusInProgress, map[string]interface{}{
+			"status":        model.BatchStatusFinalizing,
+			"finalizing_at": common.GetTimestamp(),
+		})
+		if err != nil || !ok {
+			// 状态已被修改（例如刚好被取消），下一轮处理
+			return
+		}
+		finishBatch(batch, model.BatchStatusFinalizing, model.BatchStatusCompleted, "completed_at")
+	}
+}
+
+// executeBatchRequest 以批处理创建者的令牌走正常的 Distribute 和 Relay 流程执行一行请求
+func executeBatchRequest(batch *model.Batch, line *dto.BatchRequestLine) (*dto.BatchResponseLine, bool) {
+	result := &dto.BatchResponseLine{
+		Id:       "batch_req_" + common.GetUUID(),
+		CustomId: line.CustomId,
+	}
+	token, err := model.GetTokenById(batch.TokenId)
+	if err == nil {
+		token, err = model.ValidateUserToken(token.Key)
+	}
+	if err != nil {
+		result.Error = &dto.BatchErrorData{Code: "invalid_token", Message: err.Error()}
+		return result, false
+	}
+
+	// 批处理只支持非流式请求
+	var body map[string]any
+	if err = json.Unmarshal(line.Body, &body); err != nil {
+		result.Error = &dto.BatchErrorData{Code: "invalid_request", Message: err.Error()}
+		return result, false
+	}
+	delete(body, "stream")
+	delete(body, "stream_options")
+	requestBody, _ := json.Marshal(body)
+
+	requestId := common.GetTimeString() + common.GetRandomString(8)
+	ctx := context.WithValue(context.Background(), common.RequestIdKey, requestId)
+	request, err := http.NewRequestWithContext(ctx, line.Method, line.Url, bytes.NewReader(requestBody))
+	if err != nil {
+		result.Error = &dto.BatchErrorData{Code: "invalid_request", Message: err.Error()}
+		return result, false
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	// 中间件依赖 c.Next() 包裹后续处理，因此通过独立的 engine 组成与 relay 路由相同的处理链
+	recorder := httptest.NewRecorder()
+	engine := gin.New()
+	engine.Any("/*path", func(c *gin.Context) {
+		c.Set(common.RequestIdKey, requestId)
+		c.Set(constant.ContextKeyBatchRequest, true)
+		if statusCode, err := middleware.SetupContextForToken(c, token); err != nil {
+			result.Error = &dto.BatchErrorData{Code: strconv.Itoa(statusCode), Message: err.Error()}
+			c.Abort()
+			return
+		}
+		// IP 限制已在创建批处理时校验
+		c.Set("allow_ips", map[string]any{})
+		c.Set("batch_id", batch.BatchId)
+	}, middleware.TokenRateLimit(), middleware.ModelRequestRateLimit(), middleware.Distribute(), middleware.UsageLimit(), Relay)
+	engine.ServeHTTP(recorder, request)
+	if result.Error != nil {
+		return result, false
+	}
+
+	responseBody := bytes.TrimSpace(recorder.Body.Bytes())
+	if !json.Valid(responseBody) {
+		responseBody, _ = json.Marshal(string(responseBody))
+	}
+	result.Response = &dto.BatchResponseBody{
+		StatusCode: recorder.Code,
+		RequestId:  requestId,
+		Body:       responseBody,
+	}
+	return result, recorder.Code == http.StatusOK
+}
+
+// finishBatch 为结果文件创建文件记录并将批处理切换到最终状态
+func finishBatch(batch *model.Batch, from string, to string, timeField string) {
+	updates := map[string]interface{}{
+		"status":  to,
+		timeField: common.GetTimestamp(),
+	}
+	for kind, field := range map[string]string{"output": "output_file_id", "error": "error_file_id"} {
+		path := batchResultPath(batch, kind)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.Size() == 0 {
+			_ = os.Remove(path)
+			continue
+		}
+		file := &model.File{
+			FileId:      "file-" + common.GetUUID(),
+			UserId:      batch.UserId,
+			Filename:    filepath.Base(path),
+			Purpose:     "batch_output",
+			Bytes:       info.Size(),
+			StoragePath: path,
+			CreatedAt:   common.GetTimestamp(),
+		}
+		if err = file.Insert(); err != nil {
+			common.SysError("failed to save batch result file: " + err.Error())
+			continue
+		}
+		updates[field] = file.FileId
+	}
+	if _, err := batch.UpdateStatus(from, updates); err != nil {
+		common.SysError(fmt.Sprintf("failed to finish batch %s: %s", batch.BatchId, err.Error()))
+		return
+	}
+	common.SysLog(fmt.Sprintf("batch %s %s, completed %d, failed %d", batch.BatchId, to, batch.RequestCompleted, batch.RequestFailed))
+}
@@ -23,6 +23,7 @@ import (
 	"strconv"
 	"strings"
 	"veloera/common"
+	"veloera/constant"
 	"veloera/middleware"
 	"veloera/model"
 
@@ -57,6 +58,19 @@ type OpenAIModelsResponse struct {
 	Success bool          `json:"success"`
 }
 
+// redactChannelKeys 清除返回给管理端的渠道密钥，除非请求显式携带 with_key=true 且拥有渠道写权限
+func redactChannelKeys(c *gin.Context, channels ...*model.Channel) {
+	withKey, _ := strconv.ParseBool(c.Query("with_key"))
+	if withKey && model.UserHasAnyPermission(c.GetInt("id"), c.GetInt("role"), constant.PermissionChannelsWrite) {
+		return
+	}
+	for _, channel := range channels {
+		if channel != nil {
+			channel.Key = ""
+		}
+	}
+}
+
 func GetAllChannels(c *gin.Context) {
 	p, _ := strconv.Atoi(c.Query("p"))
 	pageSize, _ := strconv.Atoi(c.Query("page_size"))
@@ -97,6 +111,7 @@ func GetAllChannels(c *gin.Context) {
 		}
 		channelData = channels
 	}
+	redactChannelKeys(c, channelData...)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -240,6 +255,7 @@ func SearchChannels(c *gin.Context) {
 		}
 		channelData = channels
 	}
+	redactChannelKeys(c, channelData...)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -257,7 +273,9 @@ func GetChannel(c *gin.Context) {
 		})
 		return
 	}
-	channel, err := model.GetChannelById(id, true) // Make sure to get full channel info
+	// 只有显式请求密钥时才读取 key 列，避免无法解密的密钥导致渠道详情无法打开
+	withKey, _ := strconv.ParseBool(c.Query("with_key"))
+	channel, err := model.GetChannelById(id, withKey)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -265,10 +283,12 @@ func GetChannel(c *gin.Context) {
 		})
 		return
 	}
+	// 仅在显式指定 with_key=true 时返回密钥
+	redactChannelKeys(c, channel)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data":    channel, // The key will be included in the response
+		"data":    channel,
 	})
 	return
 }
@@ -566,6 +586,7 @@ func UpdateChannel(c *gin.Context) {
 
 	// refresh prefix cache as channel configuration may change
 	middleware.RefreshPrefixChannelsCache(channel.Group)
+	channel.Key = ""
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -0,0 +1,74 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"veloera/constant"
+	"veloera/dto"
+	"veloera/model"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordChannelHealth 在每次渠道请求结束后同步记录健康度，上游耗时由 DoApiRequest 写入上下文
+func recordChannelHealth(c *gin.Context, channelId int, err *dto.OpenAIErrorWithStatusCode) {
+	latency := c.GetInt64(constant.ContextKeyUpstreamLatency)
+	c.Set(constant.ContextKeyUpstreamLatency, int64(0))
+	if c.GetBool(constant.ContextKeyResponseCacheHit) {
+		// 命中响应缓存的请求没有访问上游
+		model.ReleaseChannelHealth(channelId, c.GetString("original_model"))
+		return
+	}
+	service.RecordChannelHealth(channelId, c.GetString("original_model"), err, latency)
+}
+
+func GetChannelHealth(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Query("channel_id"))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.GetChannelHealthInfos(channelId),
+	})
+}
+
+func ResetChannelHealth(c *gin.Context) {
+	channelId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.ResetChannelHealth(channelId)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetHttpTransportStats 返回上游连接池的统计信息，用于排查连接复用问题
+func GetHttpTransportStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    service.GetHttpTransportStats(),
+	})
+}
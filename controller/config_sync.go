@@ -0,0 +1,489 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"veloera/common"
+	"veloera/middleware"
+	"veloera/model"
+	"veloera/setting"
+	"veloera/setting/model_setting"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// configSnapshotVersion 是导出文件的格式版本，导入时版本不一致直接拒绝
+const configSnapshotVersion = 1
+
+const (
+	configSecretsPlain   = "plain"   // key 明文导出
+	configSecretsRedact  = "redact"  // 不导出 key，导入时保留现有 key
+	configSecretsEncrypt = "encrypt" // key 使用 CRYPTO_SECRET 信封加密导出
+)
+
+// configRatioOptions 这些 option 在快照中以独立字段的形式导出
+var configRatioOptions = []string{"ModelRatio", "CompletionRatio", "ModelPrice", "GroupRatio"}
+
+// configSnapshot 是渠道、倍率与系统设置的声明式快照，ratio / options 为空表示不管理对应配置
+type configSnapshot struct {
+	Version         int                `json:"version" yaml:"version"`
+	ExportedAt      int64              `json:"exported_at" yaml:"exported_at"`
+	Secrets         string             `json:"secrets" yaml:"secrets"`
+	Channels        []configChannel    `json:"channels" yaml:"channels"`
+	ModelRatio      map[string]float64 `json:"model_ratio,omitempty" yaml:"model_ratio,omitempty"`
+	CompletionRatio map[string]float64 `json:"completion_ratio,omitempty" yaml:"completion_ratio,omitempty"`
+	ModelPrice      map[string]float64 `json:"model_price,omitempty" yaml:"model_price,omitempty"`
+	GroupRatio      map[string]float64 `json:"group_ratio,omitempty" yaml:"group_ratio,omitempty"`
+	Options         map[string]string  `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// configChannel 渠道以名称作为跨环境的唯一标识，不导出 id 与余额、用量等运行时状态
+type configChannel struct {
+	Name               string `json:"name" yaml:"name"`
+	Type               int    `json:"type" yaml:"type"`
+	Key                string `json:"key,omitempty" yaml:"key,omitempty"`
+	Status             int    `json:"status" yaml:"status"`
+	Models             string `json:"models" yaml:"models"`
+	Group              string `json:"group" yaml:"group"`
+	Tag                string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	Priority           int64  `json:"priority" yaml:"priority"`
+	Weight             uint   `json:"weight" yaml:"weight"`
+	AutoBan            int    `json:"auto_ban" yaml:"auto_ban"`
+	BaseURL            string `json:"base_url,omitempty" yaml:"base_url,omitempty"`
+	OpenAIOrganization string `json:"openai_organization,omitempty" yaml:"openai_organization,omitempty"`
+	TestModel          string `json:"test_model,omitempty" yaml:"test_model,omitempty"`
+	Other              string `json:"other,omitempty" yaml:"other,omitempty"`
+	OtherInfo          string `json:"other_info,omitempty" yaml:"other_info,omitempty"`
+	ModelMapping       string `json:"model_mapping,omitempty" yaml:"model_mapping,omitempty"`
+	StatusCodeMapping  string `json:"status_code_mapping,omitempty" yaml:"status_code_mapping,omitempty"`
+	ModelPrefix        string `json:"model_prefix,omitempty" yaml:"model_prefix,omitempty"`
+	Setting            string `json:"setting,omitempty" yaml:"setting,omitempty"`
+	ParamOverride      string `json:"param_override,omitempty" yaml:"param_override,omitempty"`
+}
+
+type configChannelChange struct {
+	Action string   `json:"action"` // create / update / delete
+	Id     int      `json:"id,omitempty"`
+	Name   string   `json:"name"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+type configSyncResult struct {
+	DryRun   bool                  `json:"dry_run"`
+	Channels []configChannelChange `json:"channels"`
+	Options  []string              `json:"options"`
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func stringPointer(s string) *string {
+	return &s
+}
+
+func channelToConfig(channel *model.Channel) configChannel {
+	autoBan := 1
+	if channel.AutoBan != nil {
+		autoBan = *channel.AutoBan
+	}
+	return configChannel{
+		Name:               channel.Name,
+		Type:               channel.Type,
+		Key:                channel.Key,
+		Status:             channel.Status,
+		Models:             channel.Models,
+		Group:              channel.Group,
+		Tag:                channel.GetTag(),
+		Priority:           channel.GetPriority(),
+		Weight:             uint(channel.GetWeight()),
+		AutoBan:            autoBan,
+		BaseURL:            channel.GetBaseURL(),
+		OpenAIOrganization: stringValue(channel.OpenAIOrganization),
+		TestModel:          stringValue(channel.TestModel),
+		Other:              channel.Other,
+		OtherInfo:          channel.OtherInfo,
+		ModelMapping:       channel.GetModelMapping(),
+		StatusCodeMapping:  channel.GetStatusCodeMapping(),
+		ModelPrefix:        channel.GetModelPrefix(),
+		Setting:            stringValue(channel.Setting),
+		ParamOverride:      stringValue(channel.ParamOverride),
+	}
+}
+
+// applyConfigToChannel 把快照中的字段写入 channel，运行时状态保持不变
+func applyConfigToChannel(config *configChannel, channel *model.Channel) {
+	channel.Name = config.Name
+	channel.Type = config.Type
+	channel.Key = config.Key
+	channel.Status = config.Status
+	channel.Models = config.Models
+	channel.Group = config.Group
+	if config.Tag == "" {
+		channel.Tag = nil
+	} else {
+		channel.Tag = stringPointer(config.Tag)
+	}
+	channel.Priority = &config.Priority
+	channel.Weight = &config.Weight
+	channel.AutoBan = &config.AutoBan
+	channel.BaseURL = stringPointer(config.BaseURL)
+	channel.OpenAIOrganization = stringPointer(config.OpenAIOrganization)
+	channel.TestModel = stringPointer(config.TestModel)
+	channel.Other = config.Other
+	channel.OtherInfo = config.OtherInfo
+	channel.ModelMapping = stringPointer(config.ModelMapping)
+	channel.StatusCodeMapping = stringPointer(config.StatusCodeMapping)
+	channel.ModelPrefix = stringPointer(config.ModelPrefix)
+	channel.Setting = stringPointer(config.Setting)
+	channel.ParamOverride = stringPointer(config.ParamOverride)
+}
+
+// diffConfigChannel 返回发生变化的字段名（json tag），不会暴露 key 的内容
+func diffConfigChannel(current, desired configChannel) []string {
+	var fields []string
+	cv := reflect.ValueOf(current)
+	dv := reflect.ValueOf(desired)
+	for i := 0; i < cv.NumField(); i++ {
+		if cv.Field(i).Interface() != dv.Field(i).Interface() {
+			name, _, _ := strings.Cut(cv.Type().Field(i).Tag.Get("json"), ",")
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// isSensitiveOption 判断配置项是否为密钥类配置，兼容 SMTPToken 与 oidc.client_secret 两种命名
+func isSensitiveOption(key string) bool {
+	key = strings.ToLower(key)
+	if idx := strings.LastIndexAny(key, "._"); idx >= 0 {
+		key = key[idx+1:]
+	}
+	return strings.HasSuffix(key, "token") || strings.HasSuffix(key, "secret") || strings.HasSuffix(key, "key")
+}
+
+func ratioFromJSON(jsonStr string) (map[string]float64, error) {
+	ratio := make(map[string]float64)
+	err := json.Unmarshal([]byte(jsonStr), &ratio)
+	return ratio, err
+}
+
+func buildConfigSnapshot(secrets string) (*configSnapshot, error) {
+	channels, err := model.GetAllChannels(0, 0, true, true)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &configSnapshot{
+		Version:    configSnapshotVersion,
+		ExportedAt: common.GetTimestamp(),
+		Secrets:    secrets,
+		Channels:   make([]configChannel, 0, len(channels)),
+		Options:    make(map[string]string),
+	}
+	for _, channel := range channels {
+		config := channelToConfig(channel)
+		switch secrets {
+		case configSecretsRedact:
+			config.Key = ""
+		case configSecretsEncrypt:
+			config.Key, err = common.EncryptSecret(config.Key)
+			if err != nil {
+				return nil, err
+			}
+		}
+		snapshot.Channels = append(snapshot.Channels, config)
+	}
+	if snapshot.ModelRatio, err = ratioFromJSON(operation_setting.ModelRatio2JSONString()); err != nil {
+		return nil, err
+	}
+	if snapshot.CompletionRatio, err = ratioFromJSON(operation_setting.CompletionRatio2JSONString()); err != nil {
+		return nil, err
+	}
+	if snapshot.ModelPrice, err = ratioFromJSON(operation_setting.ModelPrice2JSONString()); err != nil {
+		return nil, err
+	}
+	if snapshot.GroupRatio, err = ratioFromJSON(setting.GroupRatio2JSONString()); err != nil {
+		return nil, err
+	}
+	common.OptionMapRWMutex.RLock()
+	for k, v := range common.OptionMap {
+		if isSensitiveOption(k) || common.StringsContains(configRatioOptions, k) {
+			continue
+		}
+		snapshot.Options[k] = v
+	}
+	common.OptionMapRWMutex.RUnlock()
+	return snapshot, nil
+}
+
+func ExportConfig(c *gin.Context) {
+	secrets := c.DefaultQuery("secrets", configSecretsRedact)
+	if secrets != configSecretsPlain && secrets != configSecretsRedact && secrets != configSecretsEncrypt {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "secrets 参数只能是 plain、redact 或 encrypt",
+		})
+		return
+	}
+	snapshot, err := buildConfigSnapshot(secrets)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	filename := fmt.Sprintf("veloera-config-%d", snapshot.ExportedAt)
+	if c.Query("format") == "yaml" {
+		data, err := yaml.Marshal(snapshot)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.yaml", filename))
+		c.Data(http.StatusOK, "application/yaml; charset=utf-8", data)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.json", filename))
+	c.JSON(http.StatusOK, snapshot)
+}
+
+func parseConfigSnapshot(c *gin.Context) (*configSnapshot, error) {
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &configSnapshot{}
+	if c.Query("format") == "yaml" || strings.Contains(c.ContentType(), "yaml") {
+		err = yaml.Unmarshal(data, snapshot)
+	} else {
+		err = json.Unmarshal(data, snapshot)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	if snapshot.Version != configSnapshotVersion {
+		return nil, fmt.Errorf("不支持的配置文件版本: %d", snapshot.Version)
+	}
+	return snapshot, nil
+}
+
+// planChannelSync 计算快照与数据库之间的渠道差异，prune 为 true 时删除快照中不存在的渠道
+func planChannelSync(snapshot *configSnapshot, prune bool) (changes []configChannelChange, creates []*model.Channel, updates []*model.Channel, deleteIds []int, err error) {
+	existing, err := model.GetAllChannels(0, 0, true, true)
+	if err != nil {
+		return
+	}
+	byName := make(map[string]*model.Channel, len(existing))
+	for _, channel := range existing {
+		if _, ok := byName[channel.Name]; ok {
+			err = fmt.Errorf("存在多个名为 %s 的渠道，无法按名称同步，请先重命名", channel.Name)
+			return
+		}
+		byName[channel.Name] = channel
+	}
+	seen := make(map[string]bool, len(snapshot.Channels))
+	for i := range snapshot.Channels {
+		desired := snapshot.Channels[i]
+		if desired.Name == "" {
+			err = fmt.Errorf("第 %d 个渠道缺少名称", i+1)
+			return
+		}
+		if seen[desired.Name] {
+			err = fmt.Errorf("配置文件中渠道名称 %s 重复", desired.Name)
+			return
+		}
+		seen[desired.Name] = true
+		if common.IsEncryptedSecret(desired.Key) {
+			desired.Key, err = common.DecryptSecret(desired.Key)
+			if err != nil {
+				err = fmt.Errorf("渠道 %s 的 key 解密失败: %w", desired.Name, err)
+				return
+			}
+		}
+		current, ok := byName[desired.Name]
+		if !ok {
+			if desired.Key == "" {
+				err = fmt.Errorf("新渠道 %s 缺少 key", desired.Name)
+				return
+			}
+			channel := &model.Channel{CreatedTime: common.GetTimestamp()}
+			applyConfigToChannel(&desired, channel)
+			creates = append(creates, channel)
+			changes = append(changes, configChannelChange{Action: "create", Name: desired.Name})
+			continue
+		}
+		currentConfig := channelToConfig(current)
+		if desired.Key == "" {
+			// 脱敏导出的渠道保留现有 key
+			desired.Key = currentConfig.Key
+		}
+		fields := diffConfigChannel(currentConfig, desired)
+		if len(fields) == 0 {
+			continue
+		}
+		applyConfigToChannel(&desired, current)
+		updates = append(updates, current)
+		changes = append(changes, configChannelChange{Action: "update", Id: current.Id, Name: desired.Name, Fields: fields})
+	}
+	if prune {
+		for _, channel := range existing {
+			if !seen[channel.Name] {
+				deleteIds = append(deleteIds, channel.Id)
+				changes = append(changes, configChannelChange{Action: "delete", Id: channel.Id, Name: channel.Name})
+			}
+		}
+	}
+	return
+}
+
+// planOptionSync 计算需要写入的 option，只处理快照中出现的配置项
+func planOptionSync(snapshot *configSnapshot) (map[string]string, error) {
+	desired := make(map[string]string)
+	ratios := map[string]map[string]float64{
+		"ModelRatio":      snapshot.ModelRatio,
+		"CompletionRatio": snapshot.CompletionRatio,
+		"ModelPrice":      snapshot.ModelPrice,
+		"GroupRatio":      snapshot.GroupRatio,
+	}
+	for key, ratio := range ratios {
+		if ratio == nil {
+			continue
+		}
+		data, err := json.Marshal(ratio)
+		if err != nil {
+			return nil, err
+		}
+		desired[key] = string(data)
+	}
+	if value, ok := desired["GroupRatio"]; ok {
+		if err := setting.CheckGroupRatio(value); err != nil {
+			return nil, err
+		}
+	}
+	common.OptionMapRWMutex.RLock()
+	defer common.OptionMapRWMutex.RUnlock()
+	for key, value := range snapshot.Options {
+		if common.StringsContains(configRatioOptions, key) {
+			return nil, fmt.Errorf("%s 请使用独立的倍率字段配置", key)
+		}
+		if _, ok := common.OptionMap[key]; !ok {
+			return nil, fmt.Errorf("未知的配置项: %s", key)
+		}
+		desired[key] = value
+	}
+	if value, ok := desired["global.model_fallbacks"]; ok {
+		if err := model_setting.CheckModelFallbacks(value); err != nil {
+			return nil, err
+		}
+	}
+	changed := make(map[string]string)
+	for key, value := range desired {
+		current := common.OptionMap[key]
+		if common.StringsContains(configRatioOptions, key) {
+			currentRatio, err := ratioFromJSON(current)
+			if err == nil && reflect.DeepEqual(currentRatio, ratios[key]) {
+				continue
+			}
+		} else if current == value {
+			continue
+		}
+		changed[key] = value
+	}
+	return changed, nil
+}
+
+// ImportConfig 导入配置快照，dry_run=true 时只返回差异，否则在一个事务中应用全部变更
+func ImportConfig(c *gin.Context) {
+	snapshot, err := parseConfigSnapshot(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+	prune, _ := strconv.ParseBool(c.Query("prune"))
+	changes, creates, updates, deleteIds, err := planChannelSync(snapshot, prune)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	options, err := planOptionSync(snapshot)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	result := configSyncResult{
+		DryRun:   dryRun,
+		Channels: changes,
+		Options:  make([]string, 0, len(options)),
+	}
+	if result.Channels == nil {
+		result.Channels = []configChannelChange{}
+	}
+	for key := range options {
+		result.Options = append(result.Options, key)
+	}
+	sort.Strings(result.Options)
+	if !dryRun {
+		if err := model.ApplyConfigSync(creates, updates, deleteIds, options); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "应用配置失败，已回滚: " + err.Error(),
+			})
+			return
+		}
+		// 事务提交后刷新 middleware 中由渠道派生的缓存
+		middleware.RefreshAllPrefixChannelsCache()
+		for _, channel := range updates {
+			middleware.ResetChannelKeyIndex(channel.Id)
+		}
+		for _, id := range deleteIds {
+			middleware.ResetChannelKeyIndex(id)
+		}
+		common.SysLog(fmt.Sprintf("config imported by user %d: %d channel changes, %d option changes", c.GetInt("id"), len(changes), len(options)))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    result,
+	})
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import "testing"
+
+func TestIsSensitiveOption(t *testing.T) {
+	for key, want := range map[string]bool{
+		"SMTPToken":                          true,
+		"GitHubClientSecret":                 true,
+		"TurnstileSecretKey":                 true,
+		"oidc.client_secret":                 true,
+		"OIDC.Client_Secret":                 true,
+		"payment.api_key":                    true,
+		"SMTPServer":                         false,
+		"oidc.client_id":                     false,
+		"general_setting.default_max_tokens": false,
+	} {
+		if got := isSensitiveOption(key); got != want {
+			t.Errorf("isSensitiveOption(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
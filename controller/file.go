@@ -0,0 +1,173 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/dto"
+	"veloera/model"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+var filePurposes = map[string]bool{
+	"batch":        true,
+	"batch_output": false, // 仅由批处理任务生成
+	"assistants":   true,
+	"fine-tune":    true,
+	"vision":       true,
+	"user_data":    true,
+	"evals":        true,
+}
+
+func openAIErrorResponse(c *gin.Context, err error, code string, statusCode int) {
+	openaiErr := service.OpenAIErrorWrapperLocal(err, code, statusCode)
+	openaiErr.Error.Type = "invalid_request_error"
+	c.JSON(openaiErr.StatusCode, gin.H{
+		"error": openaiErr.Error,
+	})
+}
+
+func fileToOpenAI(file *model.File) *dto.OpenAIFile {
+	return &dto.OpenAIFile{
+		Id:        file.FileId,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    "processed",
+	}
+}
+
+func UploadFile(c *gin.Context) {
+	purpose := c.PostForm("purpose")
+	if allowed, ok := filePurposes[purpose]; !ok || !allowed {
+		openAIErrorResponse(c, fmt.Errorf("invalid purpose: %s", purpose), "invalid_purpose", http.StatusBadRequest)
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		openAIErrorResponse(c, errors.New("file is required"), "invalid_file", http.StatusBadRequest)
+		return
+	}
+	if fileHeader.Size > int64(constant.MaxFileUploadMB)<<20 {
+		openAIErrorResponse(c, fmt.Errorf("file size exceeds the limit of %d MB", constant.MaxFileUploadMB), "file_too_large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err = os.MkdirAll(constant.FileStoragePath, 0755); err != nil {
+		common.LogError(c, "failed to create file storage dir: "+err.Error())
+		openAIErrorResponse(c, errors.New("failed to save file"), "save_file_failed", http.StatusInternalServerError)
+		return
+	}
+	fileId := "file-" + common.GetUUID()
+	storagePath := filepath.Join(constant.FileStoragePath, fileId)
+	if err = c.SaveUploadedFile(fileHeader, storagePath); err != nil {
+		common.LogError(c, "failed to save uploaded file: "+err.Error())
+		openAIErrorResponse(c, errors.New("failed to save file"), "save_file_failed", http.StatusInternalServerError)
+		return
+	}
+	file := &model.File{
+		FileId:      fileId,
+		UserId:      c.GetInt("id"),
+		Filename:    filepath.Base(fileHeader.Filename),
+		Purpose:     purpose,
+		Bytes:       fileHeader.Size,
+		StoragePath: storagePath,
+		CreatedAt:   common.GetTimestamp(),
+	}
+	if err = file.Insert(); err != nil {
+		_ = os.Remove(storagePath)
+		openAIErrorResponse(c, err, "save_file_failed", http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, fileToOpenAI(file))
+}
+
+func ListFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
+	files, err := model.GetUserFiles(c.GetInt("id"), c.Query("purpose"), limit)
+	if err != nil {
+		openAIErrorResponse(c, err, "list_files_failed", http.StatusInternalServerError)
+		return
+	}
+	data := make([]*dto.OpenAIFile, 0, len(files))
+	for _, file := range files {
+		data = append(data, fileToOpenAI(file))
+	}
+	c.JSON(http.StatusOK, dto.OpenAIListResponse{
+		Object: "list",
+		Data:   data,
+	})
+}
+
+func getUserFile(c *gin.Context) (*model.File, bool) {
+	file, err := model.GetUserFileByFileId(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		openAIErrorResponse(c, fmt.Errorf("no such file: %s", c.Param("id")), "file_not_found", http.StatusNotFound)
+		return nil, false
+	}
+	return file, true
+}
+
+func RetrieveFile(c *gin.Context) {
+	file, ok := getUserFile(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, fileToOpenAI(file))
+}
+
+func RetrieveFileContent(c *gin.Context) {
+	file, ok := getUserFile(c)
+	if !ok {
+		return
+	}
+	if _, err := os.Stat(file.StoragePath); err != nil {
+		openAIErrorResponse(c, fmt.Errorf("content of file %s is not available", file.FileId), "file_content_not_found", http.StatusNotFound)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Filename))
+	c.File(file.StoragePath)
+}
+
+func DeleteFile(c *gin.Context) {
+	file, ok := getUserFile(c)
+	if !ok {
+		return
+	}
+	if err := file.Delete(); err != nil {
+		openAIErrorResponse(c, err, "delete_file_failed", http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileDeleteResponse{
+		Id:      file.FileId,
+		Object:  "file",
+		Deleted: true,
+	})
+}
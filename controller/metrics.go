@@ -0,0 +1,72 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var channelsDesc = prometheus.NewDesc("veloera_channels", "Number of channels by status.", []string{"status"}, nil)
+
+// channelStatusCollector 在抓取时从数据库统计启用与禁用的渠道数量
+type channelStatusCollector struct{}
+
+func (channelStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- channelsDesc
+}
+
+func (channelStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	counts, err := model.CountChannelsByStatus()
+	if err != nil {
+		common.SysError("failed to count channels for metrics: " + err.Error())
+		return
+	}
+	statusNames := map[int]string{
+		common.ChannelStatusEnabled:          "enabled",
+		common.ChannelStatusManuallyDisabled: "manually_disabled",
+		common.ChannelStatusAutoDisabled:     "auto_disabled",
+	}
+	for status, name := range statusNames {
+		ch <- prometheus.MustNewConstMetric(channelsDesc, prometheus.GaugeValue, float64(counts[status]), name)
+	}
+}
+
+func init() {
+	prometheus.MustRegister(channelStatusCollector{})
+}
+
+var metricsHandler = promhttp.Handler()
+
+func Metrics(c *gin.Context) {
+	if constant.MetricsToken != "" {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(constant.MetricsToken)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+	}
+	metricsHandler.ServeHTTP(c.Writer, c.Request)
+}
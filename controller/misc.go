@@ -56,6 +56,7 @@ func GetStatus(c *gin.Context) {
 			"start_time":                  common.StartTime,
 			"email_verification":          common.EmailVerificationEnabled,
 			"github_oauth":                common.GitHubOAuthEnabled,
+			"passkey_login":               common.PasskeyLoginEnabled,
 			"github_client_id":            common.GitHubClientId,
 			"linuxdo_oauth":               common.LinuxDOOAuthEnabled,
 			"linuxdo_client_id":           common.LinuxDOClientId,
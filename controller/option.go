@@ -23,6 +23,7 @@ import (
 	"veloera/common"
 	"veloera/model"
 	"veloera/setting"
+	"veloera/setting/model_setting"
 	"veloera/setting/system_setting"
 
 	"github.com/gin-gonic/gin"
@@ -126,6 +127,15 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "global.model_fallbacks":
+		err = model_setting.CheckModelFallbacks(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 
 	}
 	err = model.UpdateOption(option.Key, option.Value)
@@ -136,6 +146,12 @@ func UpdateOption(c *gin.Context) {
 		})
 		return
 	}
+	if option.Key == "AdminTwoFARequiredEnabled" && option.Value == "true" {
+		// 吊销开启前未经两步验证生成的管理员访问令牌
+		if err = model.RevokeAdminAccessTokens(); err != nil {
+			common.SysError("failed to revoke admin access tokens: " + err.Error())
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -0,0 +1,677 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"veloera/common"
+	"veloera/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 邀请有效期
+const organizationInvitationValidDays = 7
+
+type organizationMemberRequest struct {
+	UserId         int    `json:"user_id"`
+	Role           string `json:"role"`
+	QuotaLimit     int    `json:"quota_limit"`
+	ResetUsedQuota bool   `json:"reset_used_quota"`
+}
+
+type organizationInvitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// requireOrganizationRole 校验当前用户是路由中组织的成员且角色在 roles 中，roles 为空时只要求是成员
+func requireOrganizationRole(c *gin.Context, roles ...string) (*model.OrganizationMember, bool) {
+	organizationId, _ := strconv.Atoi(c.Param("id"))
+	member, err := model.GetOrganizationMember(organizationId, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "组织不存在或您不是该组织的成员",
+		})
+		return nil, false
+	}
+	if len(roles) > 0 && !common.StringsContains(roles, member.Role) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权进行此操作",
+		})
+		return nil, false
+	}
+	return member, true
+}
+
+func GetSelfOrganizations(c *gin.Context) {
+	orgs, err := model.GetUserOrganizations(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    orgs,
+	})
+}
+
+func GetOrganization(c *gin.Context) {
+	member, ok := requireOrganizationRole(c)
+	if !ok {
+		return
+	}
+	org, err := model.GetOrganizationById(member.OrganizationId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	org.Role = member.Role
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    org,
+	})
+}
+
+func CreateOrganization(c *gin.Context) {
+	var org model.Organization
+	if err := c.ShouldBindJSON(&org); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	org.Name = strings.TrimSpace(org.Name)
+	if org.Name == "" || len(org.Name) > 64 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "组织名称不能为空且不能超过 64 个字符",
+		})
+		return
+	}
+	cleanOrg := model.Organization{
+		Name:          org.Name,
+		OwnerId:       c.GetInt("id"),
+		Status:        common.UserStatusEnabled,
+		DailyBudget:   org.DailyBudget,
+		WeeklyBudget:  org.WeeklyBudget,
+		MonthlyBudget: org.MonthlyBudget,
+	}
+	if err := cleanOrg.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanOrg,
+	})
+}
+
+func UpdateOrganization(c *gin.Context) {
+	member, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	var req model.Organization
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	org, err := model.GetOrganizationById(member.OrganizationId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if name := strings.TrimSpace(req.Name); name != "" && len(name) <= 64 {
+		org.Name = name
+	}
+	org.DailyBudget = req.DailyBudget
+	org.WeeklyBudget = req.WeeklyBudget
+	org.MonthlyBudget = req.MonthlyBudget
+	if err := org.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    org,
+	})
+}
+
+func DeleteOrganization(c *gin.Context) {
+	member, ok := requireOrganizationRole(c, model.OrganizationRoleOwner)
+	if !ok {
+		return
+	}
+	org, err := model.GetOrganizationById(member.OrganizationId)
+	if err == nil {
+		err = org.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// TransferOrganizationQuota 拥有者或财务把个人额度转入组织额度池
+func TransferOrganizationQuota(c *gin.Context) {
+	member, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleBilling)
+	if !ok {
+		return
+	}
+	var req struct {
+		Quota int `json:"quota"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	if err := model.TransferQuotaToOrganization(member.UserId, member.OrganizationId, req.Quota); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordLog(member.UserId, model.LogTypeManage, fmt.Sprintf("向组织 %d 转入额度 %s", member.OrganizationId, common.LogQuota(req.Quota)))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	member, ok := requireOrganizationRole(c)
+	if !ok {
+		return
+	}
+	members, err := model.GetOrganizationMembers(member.OrganizationId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    members,
+	})
+}
+
+func UpdateOrganizationMember(c *gin.Context) {
+	operator, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	var req organizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !model.IsValidOrganizationRole(req.Role) || req.QuotaLimit < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	member, err := model.GetOrganizationMember(operator.OrganizationId, req.UserId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "成员不存在",
+		})
+		return
+	}
+	// 只有拥有者可以修改拥有者或授予拥有者角色
+	if operator.Role != model.OrganizationRoleOwner && (member.Role == model.OrganizationRoleOwner || req.Role == model.OrganizationRoleOwner) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权修改拥有者",
+		})
+		return
+	}
+	if member.UserId == operator.UserId && req.Role != member.Role {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "不能修改自己的角色",
+		})
+		return
+	}
+	member.Role = req.Role
+	member.QuotaLimit = req.QuotaLimit
+	if req.ResetUsedQuota {
+		member.UsedQuota = 0
+	}
+	if err := member.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    member,
+	})
+}
+
+// DeleteOrganizationMember 移除成员，成员也可以通过传入自己的 id 退出组织
+func DeleteOrganizationMember(c *gin.Context) {
+	operator, ok := requireOrganizationRole(c)
+	if !ok {
+		return
+	}
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	if userId != operator.UserId && operator.Role != model.OrganizationRoleOwner && operator.Role != model.OrganizationRoleAdmin {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权进行此操作",
+		})
+		return
+	}
+	member, err := model.GetOrganizationMember(operator.OrganizationId, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "成员不存在",
+		})
+		return
+	}
+	if member.Role == model.OrganizationRoleOwner {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "不能移除组织拥有者",
+		})
+		return
+	}
+	if err := member.Delete(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func GetOrganizationInvitations(c *gin.Context) {
+	member, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	invitations, err := model.GetOrganizationInvitations(member.OrganizationId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    invitations,
+	})
+}
+
+// InviteOrganizationMember 通过邮件邀请成员，受邀用户登录后使用邮件中的邀请码加入
+func InviteOrganizationMember(c *gin.Context) {
+	operator, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	var req organizationInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !strings.Contains(req.Email, "@") || !model.IsValidOrganizationRole(req.Role) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	if req.Role == model.OrganizationRoleOwner {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "不能邀请拥有者",
+		})
+		return
+	}
+	org, err := model.GetOrganizationById(operator.OrganizationId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	invitation := &model.OrganizationInvitation{
+		OrganizationId: org.Id,
+		Email:          req.Email,
+		Role:           req.Role,
+		InviterId:      operator.UserId,
+		ExpiredTime:    common.GetTimestamp() + organizationInvitationValidDays*24*60*60,
+	}
+	if err := invitation.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	subject := fmt.Sprintf("%s 组织邀请", common.SystemName)
+	content := fmt.Sprintf("<p>您好，%s 的用户 %s 邀请您以 %s 角色加入组织「%s」。</p>"+
+		"<p>您的邀请码为: <strong>%s</strong></p>"+
+		"<p>请使用该邮箱对应的账户登录后提交邀请码加入组织，邀请码 %d 天内有效。</p>",
+		common.SystemName, c.GetString("username"), req.Role, org.Name, invitation.Code, organizationInvitationValidDays)
+	if err := common.SendEmail(subject, req.Email, content); err != nil {
+		_ = model.DeleteOrganizationInvitation(org.Id, invitation.Id)
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "发送邀请邮件失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    invitation,
+	})
+}
+
+func DeleteOrganizationInvitation(c *gin.Context) {
+	member, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	invitationId, _ := strconv.Atoi(c.Param("invitation_id"))
+	if err := model.DeleteOrganizationInvitation(member.OrganizationId, invitationId); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func AcceptOrganizationInvitation(c *gin.Context) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	member, err := model.AcceptOrganizationInvitation(req.Code, user.Id, user.Email)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    member,
+	})
+}
+
+func GetOrganizationTokens(c *gin.Context) {
+	member, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleAdmin, model.OrganizationRoleBilling)
+	if !ok {
+		return
+	}
+	p, _ := strconv.Atoi(c.Query("p"))
+	size, _ := strconv.Atoi(c.Query("size"))
+	if p < 0 {
+		p = 0
+	}
+	if size <= 0 {
+		size = common.ItemsPerPage
+	} else if size > 100 {
+		size = 100
+	}
+	tokens, err := model.GetOrganizationTokens(member.OrganizationId, p*size, size)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	for _, token := range tokens {
+		token.Clean()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    tokens,
+	})
+}
+
+func GetOrganizationLogs(c *gin.Context) {
+	member, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleAdmin, model.OrganizationRoleBilling)
+	if !ok {
+		return
+	}
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p < 1 {
+		p = 1
+	}
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	logs, total, err := model.GetOrganizationLogs(member.OrganizationId, logType, startTimestamp, endTimestamp,
+		c.Query("model_name"), c.Query("username"), c.Query("token_name"), (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": map[string]any{
+			"items":     logs,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+func GetOrganizationLogsStat(c *gin.Context) {
+	member, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleAdmin, model.OrganizationRoleBilling)
+	if !ok {
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	stat := model.SumOrganizationUsedQuota(member.OrganizationId, startTimestamp, endTimestamp, c.Query("model_name"), c.Query("username"))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"quota": stat.Quota,
+			"rpm":   stat.Rpm,
+			"tpm":   stat.Tpm,
+		},
+	})
+}
+
+// GetOrganizationMemberUsage 按成员汇总组织的消费，用于账单分摊
+func GetOrganizationMemberUsage(c *gin.Context) {
+	member, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleAdmin, model.OrganizationRoleBilling)
+	if !ok {
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	usages, err := model.GetOrganizationMemberUsage(member.OrganizationId, startTimestamp, endTimestamp, c.Query("model_name"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    usages,
+	})
+}
+
+func GetAllOrganizations(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p < 1 {
+		p = 1
+	}
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	}
+	orgs, total, err := model.GetAllOrganizations((p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": map[string]any{
+			"items":     orgs,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// ManageOrganization 管理员设置组织额度或启用、禁用组织
+func ManageOrganization(c *gin.Context) {
+	var req struct {
+		Id     int  `json:"id"`
+		Quota  *int `json:"quota"`
+		Status int  `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	org, err := model.GetOrganizationById(req.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if req.Quota != nil {
+		if err := model.SetOrganizationQuota(org.Id, *req.Quota); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		model.RecordLog(org.OwnerId, model.LogTypeManage, fmt.Sprintf("管理员将组织 %s 的额度从 %s修改为 %s", org.Name, common.LogQuota(org.Quota), common.LogQuota(*req.Quota)))
+	}
+	if req.Status == common.UserStatusEnabled || req.Status == common.UserStatusDisabled {
+		if err := model.SetOrganizationStatus(org.Id, req.Status); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
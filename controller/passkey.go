@@ -0,0 +1,386 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"veloera/common"
+	"veloera/model"
+	"veloera/setting"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	passkeyRegistrationSessionKey = "passkey_registration"
+	passkeyLoginSessionKey        = "passkey_login"
+)
+
+// passkeyUser 将系统用户适配为 webauthn.User，user handle 使用用户 id
+type passkeyUser struct {
+	user     *model.User
+	passkeys []*model.Passkey
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	return []byte(strconv.Itoa(u.user.Id))
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	if u.user.DisplayName != "" {
+		return u.user.DisplayName
+	}
+	return u.user.Username
+}
+
+func (u *passkeyUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.passkeys))
+	for _, passkey := range u.passkeys {
+		credential, err := passkey.GetCredential()
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to decode passkey %d: %s", passkey.Id, err.Error()))
+			continue
+		}
+		credentials = append(credentials, *credential)
+	}
+	return credentials
+}
+
+func getPasskeyUser(userId int) (*passkeyUser, error) {
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		return nil, err
+	}
+	passkeys, err := model.GetPasskeysByUserId(userId)
+	if err != nil {
+		return nil, err
+	}
+	return &passkeyUser{user: user, passkeys: passkeys}, nil
+}
+
+// newWebAuthn 根据服务器地址生成 Relying Party 配置，服务器地址修改后立即生效
+func newWebAuthn() (*webauthn.WebAuthn, error) {
+	serverUrl, err := url.Parse(setting.ServerAddress)
+	if err != nil || serverUrl.Hostname() == "" {
+		return nil, errors.New("服务器地址配置无效，无法使用通行密钥")
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          serverUrl.Hostname(),
+		RPDisplayName: common.SystemName,
+		RPOrigins:     []string{serverUrl.Scheme + "://" + serverUrl.Host},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login: webauthn.TimeoutConfig{
+				Enforce: true,
+				Timeout: 5 * time.Minute,
+			},
+			Registration: webauthn.TimeoutConfig{
+				Enforce: true,
+				Timeout: 5 * time.Minute,
+			},
+		},
+	})
+}
+
+func savePasskeySession(c *gin.Context, key string, data *webauthn.SessionData) error {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	session := sessions.Default(c)
+	session.Set(key, string(bytes))
+	return session.Save()
+}
+
+// loadPasskeySession 取出并删除会话中保存的 ceremony 数据，保证每个 challenge 只能使用一次
+func loadPasskeySession(c *gin.Context, key string) (*webauthn.SessionData, error) {
+	session := sessions.Default(c)
+	value, ok := session.Get(key).(string)
+	session.Delete(key)
+	if err := session.Save(); err != nil {
+		return nil, err
+	}
+	if !ok || value == "" {
+		return nil, errors.New("通行密钥验证已过期，请重试")
+	}
+	var data webauthn.SessionData
+	if err := json.Unmarshal([]byte(value), &data); err != nil {
+		return nil, err
+	}
+	if !data.Expires.IsZero() && data.Expires.Before(time.Now()) {
+		return nil, errors.New("通行密钥验证已过期，请重试")
+	}
+	return &data, nil
+}
+
+func passkeyError(c *gin.Context, err error) {
+	message := err.Error()
+	var protocolErr *protocol.Error
+	if errors.As(err, &protocolErr) && protocolErr.DevInfo != "" {
+		message = protocolErr.Details + ": " + protocolErr.DevInfo
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": message,
+	})
+}
+
+func GetPasskeys(c *gin.Context) {
+	passkeys, err := model.GetPasskeysByUserId(c.GetInt("id"))
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    passkeys,
+	})
+}
+
+func DeletePasskey(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeletePasskey(id, c.GetInt("id")); err != nil {
+		passkeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// PasskeyReauthRequest 添加通行密钥前需要再次验证身份：启用两步验证时使用验证码，否则使用当前密码
+type PasskeyReauthRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// verifyPasskeyReauth 防止会话被盗用后直接为账号添加持久的登录凭据
+func verifyPasskeyReauth(userId int, req PasskeyReauthRequest) error {
+	twoFA, err := model.GetTwoFAByUserId(userId)
+	if err == nil && twoFA.Enabled {
+		return twoFA.CheckCode(req.Code)
+	}
+	user, err := model.GetUserById(userId, true)
+	if err != nil {
+		return err
+	}
+	if user.Password == "" {
+		return errors.New("请先设置密码或启用两步验证，再添加通行密钥")
+	}
+	if req.Password == "" || !common.ValidatePasswordAndHash(req.Password, user.Password) {
+		return errors.New("密码错误")
+	}
+	return nil
+}
+
+func PasskeyRegisterBegin(c *gin.Context) {
+	var req PasskeyReauthRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		passkeyError(c, errors.New("无效的参数"))
+		return
+	}
+	if err := verifyPasskeyReauth(c.GetInt("id"), req); err != nil {
+		passkeyError(c, err)
+		return
+	}
+	wa, err := newWebAuthn()
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+	user, err := getPasskeyUser(c.GetInt("id"))
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.passkeys))
+	for _, credential := range user.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+	// 要求可发现凭据，登录时无需输入用户名
+	creation, data, err := wa.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+	if err = savePasskeySession(c, passkeyRegistrationSessionKey, data); err != nil {
+		passkeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    creation,
+	})
+}
+
+func PasskeyRegisterFinish(c *gin.Context) {
+	data, err := loadPasskeySession(c, passkeyRegistrationSessionKey)
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+	wa, err := newWebAuthn()
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+	user, err := getPasskeyUser(c.GetInt("id"))
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+	credential, err := wa.FinishRegistration(user, *data, c.Request)
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		name = fmt.Sprintf("Passkey %d", len(user.passkeys)+1)
+	}
+	if len([]rune(name)) > 32 {
+		name = string([]rune(name)[:32])
+	}
+	passkey, err := model.NewPasskey(user.user.Id, name, credential)
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+	if err = passkey.Insert(); err != nil {
+		passkeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    passkey,
+	})
+}
+
+func PasskeyLoginBegin(c *gin.Context) {
+	if !common.PasskeyLoginEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员未开启通过通行密钥登录",
+		})
+		return
+	}
+	wa, err := newWebAuthn()
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+	assertion, data, err := wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationPreferred))
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+	if err = savePasskeySession(c, passkeyLoginSessionKey, data); err != nil {
+		passkeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    assertion,
+	})
+}
+
+func PasskeyLoginFinish(c *gin.Context) {
+	if !common.PasskeyLoginEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员未开启通过通行密钥登录",
+		})
+		return
+	}
+	data, err := loadPasskeySession(c, passkeyLoginSessionKey)
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+	wa, err := newWebAuthn()
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+	var loginUser *passkeyUser
+	var loginPasskey *model.Passkey
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userId, err := strconv.Atoi(string(userHandle))
+		if err != nil {
+			return nil, errors.New("invalid user handle")
+		}
+		passkey, err := model.GetPasskeyByCredentialId(rawID)
+		if err != nil || passkey.UserId != userId {
+			return nil, errors.New("passkey not found")
+		}
+		user, err := getPasskeyUser(userId)
+		if err != nil {
+			return nil, err
+		}
+		loginUser = user
+		loginPasskey = passkey
+		return user, nil
+	}
+	credential, err := wa.FinishDiscoverableLogin(handler, *data, c.Request)
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+	if credential.Authenticator.CloneWarning {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "通行密钥签名计数异常，可能已被复制，请删除后重新注册",
+		})
+		return
+	}
+	if err = loginPasskey.UpdateCredential(credential); err != nil {
+		common.SysError("failed to update passkey: " + err.Error())
+	}
+	if loginUser.user.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "用户已被封禁",
+		})
+		return
+	}
+	setupLogin(loginUser.user, c)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"testing"
+	"time"
+	"veloera/common"
+	"veloera/model"
+
+	"github.com/pquerna/otp/totp"
+)
+
+// 添加通行密钥前必须重新验证身份：未启用两步验证时校验密码，启用后必须使用验证码
+func TestPasskeyRegisterRequiresReauth(t *testing.T) {
+	setupPermissionTestDB(t)
+	if err := model.DB.AutoMigrate(&model.TwoFA{}); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := common.Password2Hash("correct-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := model.User{Id: 3, Username: "user3", Password: hash, Role: common.RoleCommonUser, Status: common.UserStatusEnabled, AffCode: "aff3"}
+	if err = model.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = verifyPasskeyReauth(user.Id, PasskeyReauthRequest{}); err == nil {
+		t.Fatal("expected missing password to be rejected")
+	}
+	if err = verifyPasskeyReauth(user.Id, PasskeyReauthRequest{Password: "wrong-password"}); err == nil {
+		t.Fatal("expected wrong password to be rejected")
+	}
+	if err = verifyPasskeyReauth(user.Id, PasskeyReauthRequest{Password: "correct-password"}); err != nil {
+		t.Fatalf("expected correct password to pass, got %v", err)
+	}
+
+	key, err := model.PrepareTwoFA(user.Id, user.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	twoFA, err := model.GetTwoFAByUserId(user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = twoFA.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	if err = verifyPasskeyReauth(user.Id, PasskeyReauthRequest{Password: "correct-password"}); err == nil {
+		t.Fatal("expected password alone to be rejected once 2FA is enabled")
+	}
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = verifyPasskeyReauth(user.Id, PasskeyReauthRequest{Code: code}); err != nil {
+		t.Fatalf("expected valid 2FA code to pass, got %v", err)
+	}
+}
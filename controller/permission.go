@@ -0,0 +1,123 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UpdateUserPermissionsRequest struct {
+	Id int `json:"id"`
+	// Permissions 为 null 时恢复为角色默认权限
+	Permissions []string `json:"permissions"`
+}
+
+func GetAllPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"permissions":       constant.AllPermissions,
+			"admin_permissions": constant.AdminDefaultPermissions,
+		},
+	})
+}
+
+// GetPermissionAudit 列出所有拥有管理权限的用户及其实际权限
+func GetPermissionAudit(c *gin.Context) {
+	holders, err := model.GetPermissionHolders()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    holders,
+	})
+}
+
+// UpdateUserPermissions 为用户单独分配权限，仅超级管理员可操作
+func UpdateUserPermissions(c *gin.Context) {
+	var req UpdateUserPermissionsRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil || req.Id == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	for _, permission := range req.Permissions {
+		if !constant.IsValidPermission(permission) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "未知的权限：" + permission,
+			})
+			return
+		}
+	}
+	user, err := model.GetUserById(req.Id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "用户不存在",
+		})
+		return
+	}
+	if user.Role >= common.RoleRootUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "超级管理员始终拥有全部权限，无需分配",
+		})
+		return
+	}
+	if user.Role < common.RoleAdminUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "只能为管理员分配权限，请先将该用户提升为管理员",
+		})
+		return
+	}
+	if err = model.UpdateUserPermissions(user.Id, req.Permissions); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	content := "管理员将用户权限恢复为角色默认权限"
+	if req.Permissions != nil {
+		content = fmt.Sprintf("管理员将用户权限修改为 [%s]", strings.Join(req.Permissions, ", "))
+	}
+	model.RecordLog(user.Id, model.LogTypeManage, content)
+	common.SysLog(fmt.Sprintf("user %d updated permissions of user %d: %s", c.GetInt("id"), user.Id, content))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupPermissionTestDB(t *testing.T) {
+	t.Helper()
+	common.RedisEnabled = false
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&model.User{}); err != nil {
+		t.Fatal(err)
+	}
+	model.DB = db
+	model.LOG_DB = db
+}
+
+func manageUserAs(role int, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/user/manage", strings.NewReader(body))
+	c.Set("role", role)
+	ManageUser(c)
+	return w
+}
+
+func TestDemoteRevokesCustomPermissions(t *testing.T) {
+	setupPermissionTestDB(t)
+	admin := model.User{Id: 2, Username: "admin2", Role: common.RoleAdminUser, Status: common.UserStatusEnabled, AffCode: "aff2"}
+	if err := model.DB.Create(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := model.UpdateUserPermissions(admin.Id, []string{constant.PermissionChannelsWrite, constant.PermissionOptionsWrite}); err != nil {
+		t.Fatal(err)
+	}
+	if !model.UserHasAnyPermission(admin.Id, common.RoleAdminUser, constant.PermissionOptionsWrite) {
+		t.Fatal("admin should hold the custom permission before demotion")
+	}
+
+	w := manageUserAs(common.RoleRootUser, `{"id":2,"action":"demote"}`)
+	if !strings.Contains(w.Body.String(), `"success":true`) {
+		t.Fatalf("demote failed: %s", w.Body.String())
+	}
+
+	var demoted model.User
+	model.DB.First(&demoted, admin.Id)
+	if demoted.Role != common.RoleCommonUser {
+		t.Fatalf("expected role %d, got %d", common.RoleCommonUser, demoted.Role)
+	}
+	if demoted.Permissions != "" {
+		t.Fatalf("expected permissions to be cleared, got %q", demoted.Permissions)
+	}
+	for _, permission := range constant.AllPermissions {
+		if model.UserHasAnyPermission(demoted.Id, demoted.Role, permission) {
+			t.Fatalf("demoted user still holds %s", permission)
+		}
+	}
+}
+
+func TestCommonUserIgnoresStaleCustomPermissions(t *testing.T) {
+	permissions := `["channels:write","options:write"]`
+	if got := model.GetEffectivePermissions(common.RoleCommonUser, permissions); len(got) != 0 {
+		t.Fatalf("common user should have no permissions, got %v", got)
+	}
+	if got := model.GetEffectivePermissions(common.RoleAdminUser, permissions); len(got) != 2 {
+		t.Fatalf("admin should use the custom list, got %v", got)
+	}
+}
@@ -97,7 +97,7 @@ func Playground(c *gin.Context) {
 		channel, err = middleware.SelectChannelByPrefix(group, modelPrefix, modelToQuery)
 	} else {
 		// Use normal channel selection
-		channel, err = model.CacheGetRandomSatisfiedChannel(group, modelToQuery, 0)
+		channel, err = model.CacheGetRandomSatisfiedChannel(group, modelToQuery, 0, nil)
 	}
 
 	if err != nil {
@@ -18,6 +18,7 @@ package controller
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -25,6 +26,7 @@ import (
 	"net/http"
 	"strings"
 	"veloera/common"
+	constant2 "veloera/constant"
 	"veloera/dto"
 	"veloera/middleware"
 	"veloera/model"
@@ -37,12 +39,13 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func relayHandler(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 	var err *dto.OpenAIErrorWithStatusCode
 	switch relayMode {
-	case relayconstant.RelayModeImagesGenerations:
+	case relayconstant.RelayModeImagesGenerations, relayconstant.RelayModeImagesEdits, relayconstant.RelayModeImagesVariations:
 		err = relay.ImageHelper(c)
 	case relayconstant.RelayModeAudioSpeech:
 		fallthrough
@@ -112,12 +115,18 @@ func Relay(c *gin.Context) {
 		if openaiErr == nil {
 			return // 成功处理请求，直接返回
 		}
+		if isClientCancelled(c) {
+			// 客户端已断开，上游请求已随之取消，不计入渠道错误也不再重试
+			common.LogInfo(c, "client cancelled the request")
+			return
+		}
 
-		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
+		go processChannelError(c, channel.Id, channel.Type, channel.Name, c.GetString(constant2.ContextKeyChannelKeyHash), channel.GetAutoBan(), openaiErr)
 
 		if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
 			break
 		}
+		service.RecordRelayRetryMetrics(c, channel.Id, channel.Type)
 	}
 	useChannel := c.GetStringSlice("use_channel")
 	if len(useChannel) > 1 {
@@ -126,7 +135,7 @@ func Relay(c *gin.Context) {
 	}
 
 	if openaiErr != nil {
-		if openaiErr.StatusCode == http.StatusTooManyRequests {
+		if openaiErr.StatusCode == http.StatusTooManyRequests && !openaiErr.LocalError {
 			common.LogError(c, fmt.Sprintf("origin 429 error: %s", openaiErr.Error.Message))
 			openaiErr.Error.Message = "当前分组上游负载已饱和，请稍后再试"
 		}
@@ -176,12 +185,18 @@ func WssRelay(c *gin.Context) {
 		if openaiErr == nil {
 			return // 成功处理请求，直接返回
 		}
+		if isClientCancelled(c) {
+			// 客户端已断开，上游请求已随之取消，不计入渠道错误也不再重试
+			common.LogInfo(c, "client cancelled the request")
+			return
+		}
 
-		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
+		go processChannelError(c, channel.Id, channel.Type, channel.Name, c.GetString(constant2.ContextKeyChannelKeyHash), channel.GetAutoBan(), openaiErr)
 
 		if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
 			break
 		}
+		service.RecordRelayRetryMetrics(c, channel.Id, channel.Type)
 	}
 	useChannel := c.GetStringSlice("use_channel")
 	if len(useChannel) > 1 {
@@ -190,7 +205,7 @@ func WssRelay(c *gin.Context) {
 	}
 
 	if openaiErr != nil {
-		if openaiErr.StatusCode == http.StatusTooManyRequests {
+		if openaiErr.StatusCode == http.StatusTooManyRequests && !openaiErr.LocalError {
 			openaiErr.Error.Message = "当前分组上游负载已饱和，请稍后再试"
 		}
 		openaiErr.Error.Message = common.MessageWithRequestId(openaiErr.Error.Message, requestId)
@@ -218,14 +233,20 @@ func RelayClaude(c *gin.Context) {
 		if claudeErr == nil {
 			return // 成功处理请求，直接返回
 		}
+		if isClientCancelled(c) {
+			// 客户端已断开，上游请求已随之取消，不计入渠道错误也不再重试
+			common.LogInfo(c, "client cancelled the request")
+			return
+		}
 
 		openaiErr := service.ClaudeErrorToOpenAIError(claudeErr)
 
-		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
+		go processChannelError(c, channel.Id, channel.Type, channel.Name, c.GetString(constant2.ContextKeyChannelKeyHash), channel.GetAutoBan(), openaiErr)
 
 		if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
 			break
 		}
+		service.RecordRelayRetryMetrics(c, channel.Id, channel.Type)
 	}
 	useChannel := c.GetStringSlice("use_channel")
 	if len(useChannel) > 1 {
@@ -242,25 +263,130 @@ func RelayClaude(c *gin.Context) {
 	}
 }
 
+func RelayGemini(c *gin.Context) {
+	requestId := c.GetString(common.RequestIdKey)
+	group := c.GetString("group")
+	originalModel := c.GetString("original_model")
+	var openaiErr *dto.OpenAIErrorWithStatusCode
+
+	for i := 0; i <= common.RetryTimes; i++ {
+		channel, err := getChannel(c, group, originalModel, i)
+		if err != nil {
+			common.LogError(c, err.Error())
+			openaiErr = service.OpenAIErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
+			break
+		}
+
+		openaiErr = geminiRequest(c, channel)
+
+		if openaiErr == nil {
+			return // 成功处理请求，直接返回
+		}
+		if isClientCancelled(c) {
+			// 客户端已断开，上游请求已随之取消，不计入渠道错误也不再重试
+			common.LogInfo(c, "client cancelled the request")
+			return
+		}
+
+		go processChannelError(c, channel.Id, channel.Type, channel.Name, c.GetString(constant2.ContextKeyChannelKeyHash), channel.GetAutoBan(), openaiErr)
+
+		if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
+			break
+		}
+		service.RecordRelayRetryMetrics(c, channel.Id, channel.Type)
+	}
+	useChannel := c.GetStringSlice("use_channel")
+	if len(useChannel) > 1 {
+		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
+		common.LogInfo(c, retryLogStr)
+	}
+
+	if openaiErr != nil {
+		if openaiErr.StatusCode == http.StatusTooManyRequests && !openaiErr.LocalError {
+			common.LogError(c, fmt.Sprintf("origin 429 error: %s", openaiErr.Error.Message))
+			openaiErr.Error.Message = "当前分组上游负载已饱和，请稍后再试"
+		}
+		openaiErr.Error.Message = common.MessageWithRequestId(openaiErr.Error.Message, requestId)
+		c.JSON(openaiErr.StatusCode, gin.H{
+			"error": service.OpenAIErrorToGeminiError(openaiErr),
+		})
+	}
+}
+
+// isClientCancelled 判断客户端是否已断开连接
+func isClientCancelled(c *gin.Context) bool {
+	return errors.Is(c.Request.Context().Err(), context.Canceled)
+}
+
 func relayRequest(c *gin.Context, relayMode int, channel *model.Channel) *dto.OpenAIErrorWithStatusCode {
 	addUsedChannel(c, channel.Id)
+	endSpan := startAttemptSpan(c, channel)
 	requestBody, _ := common.GetRequestBody(c)
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
-	return relayHandler(c, relayMode)
+	err := relayHandler(c, relayMode)
+	recordChannelHealth(c, channel.Id, err)
+	endSpan(err)
+	return err
 }
 
 func wssRequest(c *gin.Context, ws *websocket.Conn, relayMode int, channel *model.Channel) *dto.OpenAIErrorWithStatusCode {
 	addUsedChannel(c, channel.Id)
+	endSpan := startAttemptSpan(c, channel)
 	requestBody, _ := common.GetRequestBody(c)
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
-	return relay.WssHelper(c, ws)
+	err := relay.WssHelper(c, ws)
+	recordChannelHealth(c, channel.Id, err)
+	endSpan(err)
+	return err
 }
 
 func claudeRequest(c *gin.Context, channel *model.Channel) *dto.ClaudeErrorWithStatusCode {
 	addUsedChannel(c, channel.Id)
+	endSpan := startAttemptSpan(c, channel)
 	requestBody, _ := common.GetRequestBody(c)
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
-	return relay.ClaudeHelper(c)
+	err := relay.ClaudeHelper(c)
+	if err != nil {
+		openaiErr := service.ClaudeErrorToOpenAIError(err)
+		recordChannelHealth(c, channel.Id, openaiErr)
+		endSpan(openaiErr)
+	} else {
+		recordChannelHealth(c, channel.Id, nil)
+		endSpan(nil)
+	}
+	return err
+}
+
+func geminiRequest(c *gin.Context, channel *model.Channel) *dto.OpenAIErrorWithStatusCode {
+	addUsedChannel(c, channel.Id)
+	endSpan := startAttemptSpan(c, channel)
+	requestBody, _ := common.GetRequestBody(c)
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	err := relay.GeminiHelper(c)
+	recordChannelHealth(c, channel.Id, err)
+	endSpan(err)
+	return err
+}
+
+// startAttemptSpan 为每次上游尝试创建 span，返回的函数用于记录结果并恢复父级上下文
+func startAttemptSpan(c *gin.Context, channel *model.Channel) func(err *dto.OpenAIErrorWithStatusCode) {
+	parent := c.Request.Context()
+	ctx, span := common.StartSpan(parent, "relay.attempt",
+		attribute.Int("channel.id", channel.Id),
+		attribute.Int("channel.type", channel.Type),
+		attribute.String("channel.name", channel.Name),
+		attribute.Int("relay.attempt", len(c.GetStringSlice("use_channel"))),
+	)
+	c.Request = c.Request.WithContext(ctx)
+	return func(err *dto.OpenAIErrorWithStatusCode) {
+		if err != nil {
+			common.SetSpanStatusCode(span, err.StatusCode, err.Error.Message)
+		} else {
+			common.SetSpanStatusCode(span, c.Writer.Status(), "")
+		}
+		span.End()
+		c.Request = c.Request.WithContext(parent)
+	}
 }
 
 func addUsedChannel(c *gin.Context, channelId int) {
@@ -283,11 +409,43 @@ func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*m
 			AutoBan: &autoBanInt,
 		}, nil
 	}
-	channel, err := model.CacheGetRandomSatisfiedChannel(group, originalModel, retryCount)
-	if err != nil {
-		return nil, errors.New(fmt.Sprintf("获取重试渠道失败: %s", err.Error()))
-	}
-	middleware.SetupContextForSelectedChannel(c, channel, originalModel)
+	// 排除当前模型下已经尝试过的渠道，剩余渠道按优先级依次尝试
+	excluded, _ := c.Get(constant2.ContextKeyExcludedChannels)
+	excludedChannels, ok := excluded.(map[int]bool)
+	if !ok {
+		excludedChannels = make(map[int]bool)
+		c.Set(constant2.ContextKeyExcludedChannels, excludedChannels)
+	}
+	excludedChannels[c.GetInt("channel_id")] = true
+	// 降级链以用户请求的模型为准
+	requestModel := originalModel
+	if fallbackFrom := c.GetString(constant2.ContextKeyFallbackFrom); fallbackFrom != "" {
+		requestModel = fallbackFrom
+	}
+	currentModel := c.GetString("original_model")
+	// 优先级层级由排除集合推进：同层渠道全部失败后才会落到下一层
+	channel, err := model.CacheGetRandomSatisfiedChannel(group, currentModel, 0, excludedChannels)
+	// 记录本次已尝试过的模型，降级链配置异常（包含自身或重复模型）时避免死循环
+	visited := map[string]bool{requestModel: true, currentModel: true}
+	for err != nil {
+		// 当前模型的渠道已全部尝试过，按降级链切换到下一个模型
+		fallbackModel := model_setting.GetNextFallbackModel(requestModel, currentModel)
+		if fallbackModel == "" || visited[fallbackModel] {
+			return nil, errors.New(fmt.Sprintf("获取重试渠道失败: %s", err.Error()))
+		}
+		visited[fallbackModel] = true
+		common.LogInfo(c, fmt.Sprintf("模型 %s 的渠道均已失败，降级到 %s", currentModel, fallbackModel))
+		currentModel = fallbackModel
+		excludedChannels = make(map[int]bool)
+		c.Set(constant2.ContextKeyExcludedChannels, excludedChannels)
+		channel, err = model.CacheGetRandomSatisfiedChannel(group, currentModel, 0, excludedChannels)
+	}
+	if currentModel != requestModel {
+		// 降级后按实际使用的模型计费和记录日志
+		c.Set(constant2.ContextKeyFallbackFrom, requestModel)
+		c.Set("prefixed_model", "")
+	}
+	middleware.SetupContextForSelectedChannel(c, channel, currentModel)
 	return channel, nil
 }
 
@@ -334,10 +492,15 @@ func shouldRetry(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode, retry
 	return true
 }
 
-func processChannelError(c *gin.Context, channelId int, channelType int, channelName string, autoBan bool, err *dto.OpenAIErrorWithStatusCode) {
+func processChannelError(c *gin.Context, channelId int, channelType int, channelName string, keyHash string, autoBan bool, err *dto.OpenAIErrorWithStatusCode) {
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
 	common.LogError(c, fmt.Sprintf("relay error (channel #%d, status code: %d): %s", channelId, err.StatusCode, err.Error.Message))
+	service.RecordRelayErrorMetrics(c, channelId, channelType, err)
+	// 多 key 渠道的错误只影响出错的 key
+	if service.ProcessChannelKeyError(channelId, keyHash, err) {
+		return
+	}
 	if service.ShouldDisableChannel(channelType, err) && autoBan {
 		service.DisableChannel(channelId, channelName, err.Error.Message)
 	}
@@ -408,16 +571,19 @@ func RelayTask(c *gin.Context) {
 	originalModel := c.GetString("original_model")
 	c.Set("use_channel", []string{fmt.Sprintf("%d", channelId)})
 	taskErr := taskRelayHandler(c, relayMode)
-	if taskErr == nil {
+	if taskErr == nil || relayconstant.IsVideoFetchRelayMode(relayMode) {
+		// 视频查询只读取本地任务记录，无需切换渠道重试
 		retryTimes = 0
 	}
+	excludedChannels := map[int]bool{channelId: true}
 	for i := 0; shouldRetryTaskRelay(c, channelId, taskErr, retryTimes) && i < retryTimes; i++ {
-		channel, err := model.CacheGetRandomSatisfiedChannel(group, originalModel, i)
+		channel, err := model.CacheGetRandomSatisfiedChannel(group, originalModel, 0, excludedChannels)
 		if err != nil {
 			common.LogError(c, fmt.Sprintf("CacheGetRandomSatisfiedChannel failed: %s", err.Error()))
 			break
 		}
 		channelId = channel.Id
+		excludedChannels[channelId] = true
 		useChannel := c.GetStringSlice("use_channel")
 		useChannel = append(useChannel, fmt.Sprintf("%d", channelId))
 		c.Set("use_channel", useChannel)
@@ -446,6 +612,8 @@ func taskRelayHandler(c *gin.Context, relayMode int) *dto.TaskError {
 	switch relayMode {
 	case relayconstant.RelayModeSunoFetch, relayconstant.RelayModeSunoFetchByID:
 		err = relay.RelayTaskFetch(c, relayMode)
+	case relayconstant.RelayModeVideoFetchByID, relayconstant.RelayModeVideoList, relayconstant.RelayModeVideoContent:
+		err = relay.RelayVideoFetch(c, relayMode)
 	default:
 		err = relay.RelayTaskSubmit(c, relayMode)
 	}
@@ -0,0 +1,67 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+	"veloera/common"
+	"veloera/model"
+	"veloera/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// 降级链包含请求模型本身或重复模型时，重试选择渠道必须结束而不是无限循环
+func TestGetChannelStopsOnCyclicFallbackChain(t *testing.T) {
+	common.RedisEnabled = false
+	defer func(enabled bool) { common.MemoryCacheEnabled = enabled }(common.MemoryCacheEnabled)
+	common.MemoryCacheEnabled = false
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&model.Channel{}, &model.Ability{}); err != nil {
+		t.Fatal(err)
+	}
+	model.DB = db
+	settings := model_setting.GetGlobalSettings()
+	defer func(fallbacks map[string][]string) { settings.ModelFallbacks = fallbacks }(settings.ModelFallbacks)
+	// 绕过保存时的校验，模拟升级前已保存的异常配置
+	settings.ModelFallbacks = map[string][]string{"model-a": {"model-b", "model-a", "model-b"}}
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	c.Set("original_model", "model-a")
+	done := make(chan error, 1)
+	go func() {
+		_, err := getChannel(c, "default", "model-a", 1)
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		if err == nil {
+			t.Fatal("expected no channel to be found")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("getChannel did not terminate on a cyclic fallback chain")
+	}
+}
@@ -54,10 +54,12 @@ func UpdateTaskBulk() {
 			taskChannelM := make(map[int][]string)
 			taskM := make(map[string]*model.Task)
 			nullTaskIds := make([]int64, 0)
+			nullTasks := make([]*model.Task, 0)
 			for _, task := range tasks {
 				if task.TaskID == "" {
 					// 统计失败的未完成任务
 					nullTaskIds = append(nullTaskIds, task.ID)
+					nullTasks = append(nullTasks, task)
 					continue
 				}
 				taskM[task.TaskID] = task
@@ -72,6 +74,9 @@ func UpdateTaskBulk() {
 					common.LogError(ctx, fmt.Sprintf("Fix null task_id task error: %v", err))
 				} else {
 					common.LogInfo(ctx, fmt.Sprintf("Fix null task_id task success: %v", nullTaskIds))
+					for _, task := range nullTasks {
+						refundTaskQuota(ctx, task)
+					}
 				}
 			}
 			if len(taskChannelM) == 0 {
@@ -90,6 +95,8 @@ func UpdateTaskByPlatform(platform constant.TaskPlatform, taskChannelM map[int][
 		//_ = UpdateMidjourneyTaskAll(context.Background(), tasks)
 	case constant.TaskPlatformSuno:
 		_ = UpdateSunoTaskAll(context.Background(), taskChannelM, taskM)
+	case constant.TaskPlatformSora, constant.TaskPlatformKling:
+		_ = UpdateVideoTaskAll(context.Background(), platform, taskChannelM, taskM)
 	default:
 		common.SysLog("未知平台")
 	}
@@ -99,7 +106,7 @@ func UpdateSunoTaskAll(ctx context.Context, taskChannelM map[int][]string, taskM
 	for channelId, taskIds := range taskChannelM {
 		err := updateSunoTaskAll(ctx, channelId, taskIds, taskM)
 		if err != nil {
-			common.LogError(ctx, fmt.Sprintf("渠道 #%d 更新异步任务失败: %d", channelId, err.Error()))
+			common.LogError(ctx, fmt.Sprintf("渠道 #%d 更新异步任务失败: %s", channelId, err.Error()))
 		}
 	}
 	return nil
@@ -151,7 +158,7 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 		return err
 	}
 	if !responseItems.IsSuccess() {
-		common.SysLog(fmt.Sprintf("渠道 #%d 未完成的任务有: %d, 成功获取到任务数: %d", channelId, len(taskIds), string(responseBody)))
+		common.SysLog(fmt.Sprintf("渠道 #%d 未完成的任务有: %d, 成功获取到任务数: %s", channelId, len(taskIds), string(responseBody)))
 		return err
 	}
 
@@ -169,20 +176,7 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 		if responseItem.FailReason != "" || task.Status == model.TaskStatusFailure {
 			common.LogInfo(ctx, task.TaskID+" 构建失败，"+task.FailReason)
 			task.Progress = "100%"
-			//err = model.CacheUpdateUserQuota(task.UserId) ?
-			if err != nil {
-				common.LogError(ctx, "error update user quota cache: "+err.Error())
-			} else {
-				quota := task.Quota
-				if quota != 0 {
-					err = model.IncreaseUserQuota(task.UserId, quota, false)
-					if err != nil {
-						common.LogError(ctx, "fail to increase user quota: "+err.Error())
-					}
-					logContent := fmt.Sprintf("异步任务执行失败 %s，补偿 %s", task.TaskID, common.LogQuota(quota))
-					model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
-				}
-			}
+			refundTaskQuota(ctx, task)
 		}
 		if responseItem.Status == model.TaskStatusSuccess {
 			task.Progress = "100%"
@@ -197,6 +191,21 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 	return nil
 }
 
+// refundTaskQuota 异步任务失败时退还预扣的额度
+func refundTaskQuota(ctx context.Context, task *model.Task) {
+	quota := task.Quota
+	if quota == 0 {
+		return
+	}
+	err := model.IncreaseBillingQuota(task.UserId, task.OrganizationId, quota)
+	if err != nil {
+		common.LogError(ctx, "fail to increase user quota: "+err.Error())
+		return
+	}
+	logContent := fmt.Sprintf("异步任务执行失败 %s，补偿 %s", task.TaskID, common.LogQuota(quota))
+	model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
+}
+
 func checkTaskNeedUpdate(oldTask *model.Task, newTask dto.SunoDataResponse) bool {
 
 	if oldTask.SubmitTime != newTask.SubmitTime {
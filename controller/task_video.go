@@ -0,0 +1,166 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/model"
+	"veloera/relay"
+	"veloera/relay/channel"
+	relaycommon "veloera/relay/common"
+	"veloera/service"
+	"veloera/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 结果文件较大，下载超时单独设置
+const videoDownloadTimeout = 10 * time.Minute
+
+func UpdateVideoTaskAll(ctx context.Context, platform constant.TaskPlatform, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
+	for channelId, taskIds := range taskChannelM {
+		err := updateVideoTaskAll(ctx, platform, channelId, taskIds, taskM)
+		if err != nil {
+			common.LogError(ctx, fmt.Sprintf("渠道 #%d 更新视频任务失败: %s", channelId, err.Error()))
+		}
+	}
+	return nil
+}
+
+func updateVideoTaskAll(ctx context.Context, platform constant.TaskPlatform, channelId int, taskIds []string, taskM map[string]*model.Task) error {
+	common.LogInfo(ctx, fmt.Sprintf("渠道 #%d 未完成的视频任务有: %d", channelId, len(taskIds)))
+	if len(taskIds) == 0 {
+		return nil
+	}
+	adaptor := relay.GetTaskAdaptor(platform)
+	if adaptor == nil {
+		return fmt.Errorf("adaptor not found: %s", platform)
+	}
+	ch, err := model.CacheGetChannel(channelId)
+	if err != nil {
+		// 渠道已被删除，任务无法继续查询，按失败处理并退还额度
+		for _, taskId := range taskIds {
+			task := taskM[taskId]
+			task.Status = model.TaskStatusFailure
+			task.Progress = "100%"
+			task.FinishTime = time.Now().Unix()
+			task.FailReason = fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId)
+			refundTaskQuota(ctx, task)
+			if err := task.Update(); err != nil {
+				common.SysError("update video task error: " + err.Error())
+			}
+		}
+		return err
+	}
+	for _, taskId := range taskIds {
+		task := taskM[taskId]
+		taskInfo, err := fetchVideoTask(adaptor, ch, task)
+		if err != nil {
+			common.LogError(ctx, fmt.Sprintf("查询视频任务 %s 失败: %s", taskId, err.Error()))
+			continue
+		}
+		updateVideoTask(ctx, adaptor, ch, task, taskInfo)
+	}
+	return nil
+}
+
+func fetchVideoTask(adaptor channel.TaskAdaptor, ch *model.Channel, task *model.Task) (*relaycommon.TaskInfo, error) {
+	resp, err := adaptor.FetchTask(ch.GetBaseURL(), task.GetChannelKey(ch), map[string]any{
+		"task_id": task.TaskID,
+		"action":  task.Action,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code: %d, body: %s", resp.StatusCode, string(responseBody))
+	}
+	return adaptor.ParseTaskResult(responseBody)
+}
+
+func updateVideoTask(ctx context.Context, adaptor channel.TaskAdaptor, ch *model.Channel, task *model.Task, taskInfo *relaycommon.TaskInfo) {
+	status := model.TaskStatus(taskInfo.Status)
+	if status == model.TaskStatusUnknown || (status == task.Status && taskInfo.Progress == task.Progress) {
+		return
+	}
+	now := time.Now().Unix()
+	if task.StartTime == 0 && status != model.TaskStatusQueued && status != model.TaskStatusSubmitted {
+		task.StartTime = now
+	}
+	task.Status = status
+	if taskInfo.Progress != "" {
+		task.Progress = taskInfo.Progress
+	}
+	switch status {
+	case model.TaskStatusFailure:
+		common.LogInfo(ctx, task.TaskID+" 视频生成失败，"+taskInfo.Reason)
+		task.Progress = "100%"
+		task.FinishTime = now
+		task.FailReason = taskInfo.Reason
+		refundTaskQuota(ctx, task)
+	case model.TaskStatusSuccess:
+		task.Progress = "100%"
+		task.FinishTime = now
+		task.Properties.ResultURL = taskInfo.Url
+	}
+	if err := task.Update(); err != nil {
+		common.SysError("update video task error: " + err.Error())
+		return
+	}
+	if status == model.TaskStatusSuccess && operation_setting.GetVideoSetting().CacheEnabled {
+		gopool.Go(func() {
+			cacheVideoTaskContent(ctx, adaptor, ch, task)
+		})
+	}
+}
+
+// cacheVideoTaskContent 将生成结果下载到本地，之后的下载请求不再依赖上游地址
+func cacheVideoTaskContent(ctx context.Context, adaptor channel.TaskAdaptor, ch *model.Channel, task *model.Task) {
+	downloadCtx, cancel := context.WithTimeout(context.Background(), videoDownloadTimeout)
+	defer cancel()
+	resp, err := adaptor.FetchTaskContent(downloadCtx, ch.GetBaseURL(), task.GetChannelKey(ch), task.TaskID, task.Properties.ResultURL)
+	if err != nil {
+		common.LogError(ctx, fmt.Sprintf("下载视频任务 %s 结果失败: %s", task.TaskID, err.Error()))
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		common.LogError(ctx, fmt.Sprintf("下载视频任务 %s 结果失败，状态码: %d", task.TaskID, resp.StatusCode))
+		return
+	}
+	path, err := service.SaveVideoCache(task.TaskID, resp.Body)
+	if err != nil {
+		common.LogError(ctx, fmt.Sprintf("缓存视频任务 %s 结果失败: %s", task.TaskID, err.Error()))
+		return
+	}
+	properties := task.Properties
+	properties.CacheFile = path
+	if err = model.TaskUpdateProperties(task.ID, properties); err != nil {
+		common.SysError("update video task properties error: " + err.Error())
+	}
+}
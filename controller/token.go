@@ -139,6 +139,16 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	if token.OrganizationId != 0 {
+		member, err := model.GetOrganizationMember(token.OrganizationId, c.GetInt("id"))
+		if err != nil || member.Role == model.OrganizationRoleBilling {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无权在该组织下创建令牌",
+			})
+			return
+		}
+	}
 	key, err := common.GenerateKey()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -165,6 +175,14 @@ func AddToken(c *gin.Context) {
 		ModelLimits:        token.ModelLimits,
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
+		ResponseCache:      token.ResponseCache,
+		TPMLimit:           token.TPMLimit,
+		TPDLimit:           token.TPDLimit,
+		MaxConcurrency:     token.MaxConcurrency,
+		DailyBudget:        token.DailyBudget,
+		WeeklyBudget:       token.WeeklyBudget,
+		MonthlyBudget:      token.MonthlyBudget,
+		OrganizationId:     token.OrganizationId,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -258,6 +276,13 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.ModelLimits = token.ModelLimits
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
+		cleanToken.ResponseCache = token.ResponseCache
+		cleanToken.TPMLimit = token.TPMLimit
+		cleanToken.TPDLimit = token.TPDLimit
+		cleanToken.MaxConcurrency = token.MaxConcurrency
+		cleanToken.DailyBudget = token.DailyBudget
+		cleanToken.WeeklyBudget = token.WeeklyBudget
+		cleanToken.MonthlyBudget = token.MonthlyBudget
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -0,0 +1,284 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package controller
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"veloera/common"
+	"veloera/model"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	pendingTwoFAUserIdKey = "pending_2fa_id"
+	pendingTwoFATimeKey   = "pending_2fa_time"
+
+	// 密码校验通过后，需要在 5 分钟内完成两步验证；失败次数由服务端按用户统计，见 model.TwoFA.CheckCode
+	pendingTwoFAExpireSeconds = 300
+)
+
+type TwoFARequest struct {
+	Code string `json:"code"`
+}
+
+// LoginTwoFA 完成登录流程的第二步：校验 TOTP 验证码或恢复码，通过后创建正式会话
+func LoginTwoFA(c *gin.Context) {
+	var req TwoFARequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "无效的参数",
+			"success": false,
+		})
+		return
+	}
+	session := sessions.Default(c)
+	userId, ok := session.Get(pendingTwoFAUserIdKey).(int)
+	startTime, _ := session.Get(pendingTwoFATimeKey).(int64)
+	if !ok || userId == 0 || common.GetTimestamp()-startTime > pendingTwoFAExpireSeconds {
+		session.Clear()
+		_ = session.Save()
+		c.JSON(http.StatusOK, gin.H{
+			"message": "两步验证已过期，请重新登录",
+			"success": false,
+		})
+		return
+	}
+
+	user, err := model.GetUserById(userId, false)
+	if err != nil || user.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "用户不存在或已被封禁",
+			"success": false,
+		})
+		return
+	}
+	twoFA, err := model.GetTwoFAByUserId(userId)
+	if err != nil || !twoFA.Enabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "两步验证已过期，请重新登录",
+			"success": false,
+		})
+		return
+	}
+	if err = twoFA.CheckCode(req.Code); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	createLoginSession(user, c, true)
+}
+
+func GetTwoFAStatus(c *gin.Context) {
+	enabled := false
+	remaining := 0
+	twoFA, err := model.GetTwoFAByUserId(c.GetInt("id"))
+	if err == nil && twoFA.Enabled {
+		enabled = true
+		remaining = twoFA.RemainingRecoveryCodes()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"enabled":                  enabled,
+			"required":                 common.IsTwoFARequiredForRole(c.GetInt("role")),
+			"recovery_codes_remaining": remaining,
+		},
+	})
+}
+
+// SetupTwoFA 生成新的 TOTP 密钥与二维码，需调用 EnableTwoFA 校验后才会生效
+func SetupTwoFA(c *gin.Context) {
+	key, err := model.PrepareTwoFA(c.GetInt("id"), c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	img, err := key.Image(200, 200)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, img); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"secret":  key.Secret(),
+			"url":     key.URL(),
+			"qr_code": "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+		},
+	})
+}
+
+// EnableTwoFA 使用验证码确认绑定并启用两步验证，返回仅展示一次的恢复码
+func EnableTwoFA(c *gin.Context) {
+	var req TwoFARequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	twoFA, err := model.GetTwoFAByUserId(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "请先生成两步验证密钥",
+		})
+		return
+	}
+	if twoFA.Enabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "两步验证已启用",
+		})
+		return
+	}
+	if !twoFA.ValidateTOTP(req.Code) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "验证码错误",
+		})
+		return
+	}
+	codes, err := twoFA.ResetRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = twoFA.Enable(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// 当前会话已完成验证码校验，视为通过两步验证
+	if !c.GetBool("use_access_token") {
+		session := sessions.Default(c)
+		session.Set("two_fa", true)
+		_ = session.Save()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+func DisableTwoFA(c *gin.Context) {
+	if common.IsTwoFARequiredForRole(c.GetInt("role")) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员要求启用两步验证，无法关闭",
+		})
+		return
+	}
+	twoFA, ok := verifyTwoFARequest(c)
+	if !ok {
+		return
+	}
+	if err := model.DeleteTwoFAByUserId(twoFA.UserId); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func RegenerateTwoFARecoveryCodes(c *gin.Context) {
+	twoFA, ok := verifyTwoFARequest(c)
+	if !ok {
+		return
+	}
+	codes, err := twoFA.ResetRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// verifyTwoFARequest 读取请求中的验证码并校验当前用户的两步验证，失败时已写入响应
+func verifyTwoFARequest(c *gin.Context) (*model.TwoFA, bool) {
+	var req TwoFARequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return nil, false
+	}
+	twoFA, err := model.GetTwoFAByUserId(c.GetInt("id"))
+	if err != nil || !twoFA.Enabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "未启用两步验证",
+		})
+		return nil, false
+	}
+	if err = twoFA.CheckCode(req.Code); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+	return twoFA, true
+}
@@ -96,14 +96,44 @@ func setupLogin(user *model.User, c *gin.Context) {
 		return
 	}
 
+	// 已启用两步验证的用户需要先通过验证码校验，再创建正式会话
+	if model.IsTwoFAEnabled(user.Id) {
+		session.Set(pendingTwoFAUserIdKey, user.Id)
+		session.Set(pendingTwoFATimeKey, common.GetTimestamp())
+		err = session.Save()
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"message": "无法保存会话信息，请重试",
+				"success": false,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "",
+			"success": true,
+			"data": gin.H{
+				"require_2fa": true,
+			},
+		})
+		return
+	}
+	createLoginSession(user, c, false)
+}
+
+// createLoginSession 写入正式的登录会话，twoFA 表示本次登录是否通过了两步验证
+func createLoginSession(user *model.User, c *gin.Context, twoFA bool) {
+	session := sessions.Default(c)
+	session.Clear()
+
 	// Set new session data
 	session.Set("id", user.Id)
 	session.Set("username", user.Username)
 	session.Set("role", user.Role)
 	session.Set("status", user.Status)
 	session.Set("group", user.Group)
+	session.Set("two_fa", twoFA)
 
-	err = session.Save()
+	err := session.Save()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "无法保存会话信息，请重试",
@@ -381,6 +411,26 @@ func GenerateAccessToken(c *gin.Context) {
 		})
 		return
 	}
+	// 生成的系统访问令牌可绕过会话直接调用管理接口，因此同样需要两步验证
+	twoFA, err := model.GetTwoFAByUserId(user.Id)
+	if err == nil && twoFA.Enabled {
+		if err = twoFA.CheckCode(c.Query("code")); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+				"data": gin.H{
+					"require_2fa": true,
+				},
+			})
+			return
+		}
+	} else if common.IsTwoFARequiredForRole(user.Role) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员要求启用两步验证，请先启用两步验证后再生成访问令牌",
+		})
+		return
+	}
 	// get rand int 28-32
 	randI := common.GetRandomInt(4)
 	key, err := common.GenerateRandomKey(29 + randI)
@@ -906,6 +956,15 @@ func ManageUser(c *gin.Context) {
 			return
 		}
 		user.Role = common.RoleCommonUser
+	case "reset_2fa":
+		// 用户丢失验证器与恢复码时，由管理员重置两步验证
+		if err := model.DeleteTwoFAByUserId(user.Id); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	}
 
 	if err := user.Update(false); err != nil {
@@ -915,6 +974,16 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	// 降级或禁用后收回单独分配的权限，避免重新提升时沿用旧权限
+	if req.Action == "demote" || req.Action == "disable" {
+		if err := model.UpdateUserPermissions(user.Id, nil); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
@@ -19,23 +19,54 @@ package dto
 import "encoding/json"
 
 type ImageRequest struct {
-	Model          string          `json:"model"`
-	Prompt         string          `json:"prompt" binding:"required"`
-	N              int             `json:"n,omitempty"`
-	Size           string          `json:"size,omitempty"`
-	Quality        string          `json:"quality,omitempty"`
-	ResponseFormat string          `json:"response_format,omitempty"`
-	Style          string          `json:"style,omitempty"`
-	User           string          `json:"user,omitempty"`
-	ExtraFields    json.RawMessage `json:"extra_fields,omitempty"`
+	Model             string          `json:"model"`
+	Prompt            string          `json:"prompt" binding:"required"`
+	N                 int             `json:"n,omitempty"`
+	Size              string          `json:"size,omitempty"`
+	Quality           string          `json:"quality,omitempty"`
+	ResponseFormat    string          `json:"response_format,omitempty"`
+	Style             string          `json:"style,omitempty"`
+	User              string          `json:"user,omitempty"`
+	Background        string          `json:"background,omitempty"`
+	OutputFormat      string          `json:"output_format,omitempty"`
+	OutputCompression *int            `json:"output_compression,omitempty"`
+	Moderation        string          `json:"moderation,omitempty"`
+	InputFidelity     string          `json:"input_fidelity,omitempty"`
+	ExtraFields       json.RawMessage `json:"extra_fields,omitempty"`
+	// 图片编辑与变体请求通过 multipart 上传的图片
+	Images []ImageFile `json:"-"`
+	Mask   *ImageFile  `json:"-"`
+}
+
+type ImageFile struct {
+	Filename string
+	MimeType string
+	Data     []byte
 }
 
 type ImageResponse struct {
-	Data    []ImageData `json:"data"`
-	Created int64       `json:"created"`
+	Data         []ImageData `json:"data"`
+	Created      int64       `json:"created"`
+	Background   string      `json:"background,omitempty"`
+	OutputFormat string      `json:"output_format,omitempty"`
+	Size         string      `json:"size,omitempty"`
+	Quality      string      `json:"quality,omitempty"`
+	Usage        *ImageUsage `json:"usage,omitempty"`
 }
 type ImageData struct {
-	Url           string `json:"url"`
-	B64Json       string `json:"b64_json"`
-	RevisedPrompt string `json:"revised_prompt"`
+	Url           string `json:"url,omitempty"`
+	B64Json       string `json:"b64_json,omitempty"`
+	RevisedPrompt string `json:"revised_prompt,omitempty"`
+}
+
+type ImageUsage struct {
+	InputTokens        int                     `json:"input_tokens"`
+	OutputTokens       int                     `json:"output_tokens"`
+	TotalTokens        int                     `json:"total_tokens"`
+	InputTokensDetails *ImageInputTokenDetails `json:"input_tokens_details,omitempty"`
+}
+
+type ImageInputTokenDetails struct {
+	TextTokens  int `json:"text_tokens"`
+	ImageTokens int `json:"image_tokens"`
 }
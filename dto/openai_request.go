@@ -381,7 +381,7 @@ type OpenAIResponsesRequest struct {
 	PreviousResponseID string               `json:"previous_response_id,omitempty"`
 	Reasoning          *Reasoning           `json:"reasoning,omitempty"`
 	ServiceTier        string               `json:"service_tier,omitempty"`
-	Store              bool                 `json:"store,omitempty"`
+	Store              *bool                `json:"store,omitempty"`
 	Stream             bool                 `json:"stream,omitempty"`
 	Temperature        float64              `json:"temperature,omitempty"`
 	Text               json.RawMessage      `json:"text,omitempty"`
@@ -392,6 +392,29 @@ type OpenAIResponsesRequest struct {
 	User               string               `json:"user,omitempty"`
 }
 
+// ResponsesInputItem 是 /v1/responses input 数组中的一项，
+// 可能是 message、function_call、function_call_output 或 reasoning
+type ResponsesInputItem struct {
+	Type      string          `json:"type,omitempty"`
+	Role      string          `json:"role,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	CallId    string          `json:"call_id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Arguments string          `json:"arguments,omitempty"`
+	Output    json.RawMessage `json:"output,omitempty"`
+}
+
+type ResponsesInputContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageUrl string `json:"image_url,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	FileId   string `json:"file_id,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Refusal  string `json:"refusal,omitempty"`
+}
+
 type Reasoning struct {
 	Effort  string `json:"effort,omitempty"`
 	Summary string `json:"summary,omitempty"`
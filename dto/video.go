@@ -0,0 +1,86 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package dto
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// VideoRequest OpenAI 风格的视频生成请求，支持 JSON 与 multipart 两种提交方式
+type VideoRequest struct {
+	Model          string      `json:"model"`
+	Prompt         string      `json:"prompt"`
+	NegativePrompt string      `json:"negative_prompt,omitempty"`
+	Seconds        json.Number `json:"seconds,omitempty"`
+	Size           string      `json:"size,omitempty"`
+	// Image 图生视频的首帧图片，可以是 url 或 base64
+	Image string `json:"image,omitempty"`
+	// InputReference multipart 上传的参考图片
+	InputReference *ImageFile `json:"-"`
+}
+
+// HasImage 是否为图生视频请求
+func (r *VideoRequest) HasImage() bool {
+	return r.Image != "" || r.InputReference != nil
+}
+
+// GetSeconds 获取视频时长，未设置时返回默认值
+func (r *VideoRequest) GetSeconds(defaultSeconds int) (int, error) {
+	if r.Seconds == "" {
+		return defaultSeconds, nil
+	}
+	seconds, err := r.Seconds.Int64()
+	if err != nil || seconds <= 0 {
+		return 0, errors.New("seconds must be a positive integer")
+	}
+	return int(seconds), nil
+}
+
+// OpenAIVideo OpenAI 风格的视频任务对象
+type OpenAIVideo struct {
+	ID          string            `json:"id"`
+	Object      string            `json:"object"`
+	Model       string            `json:"model"`
+	Status      string            `json:"status"`
+	Progress    int               `json:"progress"`
+	CreatedAt   int64             `json:"created_at"`
+	CompletedAt int64             `json:"completed_at,omitempty"`
+	Seconds     string            `json:"seconds,omitempty"`
+	Size        string            `json:"size,omitempty"`
+	Error       *OpenAIVideoError `json:"error,omitempty"`
+}
+
+type OpenAIVideoError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type OpenAIVideoList struct {
+	Object  string         `json:"object"`
+	Data    []*OpenAIVideo `json:"data"`
+	FirstId string         `json:"first_id,omitempty"`
+	LastId  string         `json:"last_id,omitempty"`
+	HasMore bool           `json:"has_more"`
+}
+
+const (
+	VideoStatusQueued     = "queued"
+	VideoStatusInProgress = "in_progress"
+	VideoStatusCompleted  = "completed"
+	VideoStatusFailed     = "failed"
+)
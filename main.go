@@ -93,6 +93,7 @@ func main() {
 	operation_setting.InitModelSettings()
 	// Initialize constants
 	constant.InitEnv()
+	common.InitTracing()
 	// Initialize options
 	model.InitOptionMap()
 
@@ -135,6 +136,14 @@ func main() {
 			controller.UpdateTaskBulk()
 		})
 	}
+	if common.IsMasterNode {
+		gopool.Go(func() {
+			controller.RunBatchTasks()
+		})
+		service.StartResponsesStoreCleanup()
+		service.StartVideoCacheCleanup()
+		service.StartBudgetUsageCleanup()
+	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		common.BatchUpdateEnabled = true
 		common.SysLog("batch update enabled with interval " + strconv.Itoa(common.BatchUpdateInterval) + "s")
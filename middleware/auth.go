@@ -17,6 +17,7 @@
 package middleware
 
 import (
+	"errors"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -37,7 +38,7 @@ func validUserInfo(username string, role int) bool {
 	return true
 }
 
-func authHelper(c *gin.Context, minRole int) {
+func authHelper(c *gin.Context, minRole int, permissions ...string) {
 	session := sessions.Default(c)
 	username := session.Get("username")
 	role := session.Get("role")
@@ -124,6 +125,30 @@ func authHelper(c *gin.Context, minRole int) {
 		c.Abort()
 		return
 	}
+	if len(permissions) > 0 && !model.UserHasAnyPermission(id.(int), role.(int), permissions...) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权进行此操作，需要权限 " + strings.Join(permissions, " 或 "),
+		})
+		c.Abort()
+		return
+	}
+	// 管理员强制两步验证时，访问任何需要管理权限的接口都必须通过两步验证，个人设置接口不受影响以便完成绑定；
+	// 使用系统访问令牌时要求该用户已启用两步验证，开启该选项时旧令牌已被吊销
+	if common.AdminTwoFARequiredEnabled && (minRole >= common.RoleAdminUser || len(permissions) > 0) {
+		passed := session.Get("two_fa") == true
+		if useAccessToken {
+			passed = model.IsTwoFAEnabled(id.(int))
+		}
+		if !passed {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无权进行此操作，请先在个人设置中启用两步验证并重新登录",
+			})
+			c.Abort()
+			return
+		}
+	}
 	if !validUserInfo(username.(string), role.(int)) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -169,101 +194,153 @@ func RootAuth() func(c *gin.Context) {
 	}
 }
 
+// PermissionAuth 要求用户拥有任意一个指定权限，超级管理员始终通过
+func PermissionAuth(permissions ...string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, common.RoleCommonUser, permissions...)
+	}
+}
+
 func WssAuth(c *gin.Context) {
 
 }
 
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		// 先检测是否为ws
-		if c.Request.Header.Get("Sec-WebSocket-Protocol") != "" {
-			// Sec-WebSocket-Protocol: realtime, openai-insecure-api-key.sk-xxx, openai-beta.realtime-v1
-			// read sk from Sec-WebSocket-Protocol
-			key := c.Request.Header.Get("Sec-WebSocket-Protocol")
-			parts := strings.Split(key, ",")
-			for _, part := range parts {
-				part = strings.TrimSpace(part)
-				if strings.HasPrefix(part, "openai-insecure-api-key") {
-					key = strings.TrimPrefix(part, "openai-insecure-api-key.")
-					break
-				}
-			}
-			c.Request.Header.Set("Authorization", "Bearer "+key)
-		}
-		// 检查path包含/v1/messages
-		if strings.Contains(c.Request.URL.Path, "/v1/messages") {
-			// 从x-api-key中获取key
-			key := c.Request.Header.Get("x-api-key")
-			if key != "" {
-				c.Request.Header.Set("Authorization", "Bearer "+key)
+		tokenAuth(c)
+		c.Next()
+	}
+}
+
+// tokenAuth 校验令牌并写入上下文，span 只覆盖鉴权本身，不包含后续的 handler
+func tokenAuth(c *gin.Context) {
+	span := common.StartGinSpan(c, "TokenAuth")
+	defer endMiddlewareSpan(c, span)
+	// 先检测是否为ws
+	if c.Request.Header.Get("Sec-WebSocket-Protocol") != "" {
+		// Sec-WebSocket-Protocol: realtime, openai-insecure-api-key.sk-xxx, openai-beta.realtime-v1
+		// read sk from Sec-WebSocket-Protocol
+		key := c.Request.Header.Get("Sec-WebSocket-Protocol")
+		parts := strings.Split(key, ",")
+		for _, part := range parts {
+			part = strings.TrimSpace(part)
+			if strings.HasPrefix(part, "openai-insecure-api-key") {
+				key = strings.TrimPrefix(part, "openai-insecure-api-key.")
+				break
 			}
 		}
-		key := c.Request.Header.Get("Authorization")
-		parts := make([]string, 0)
-		key = strings.TrimPrefix(key, "Bearer ")
-		if key == "" || key == "midjourney-proxy" {
-			key = c.Request.Header.Get("mj-api-secret")
-			key = strings.TrimPrefix(key, "Bearer ")
-			key = strings.TrimPrefix(key, "sk-")
-			parts = strings.Split(key, "-")
-			key = parts[0]
-		} else {
-			key = strings.TrimPrefix(key, "sk-")
-			parts = strings.Split(key, "-")
-			key = parts[0]
+		c.Request.Header.Set("Authorization", "Bearer "+key)
+	}
+	// 检查path包含/v1/messages
+	if strings.Contains(c.Request.URL.Path, "/v1/messages") {
+		// 从x-api-key中获取key
+		key := c.Request.Header.Get("x-api-key")
+		if key != "" {
+			c.Request.Header.Set("Authorization", "Bearer "+key)
 		}
-		token, err := model.ValidateUserToken(key)
-		if token != nil {
-			id := c.GetInt("id")
-			if id == 0 {
-				c.Set("id", token.UserId)
-			}
+	}
+	// gemini 原生接口，从 ?key= 或 x-goog-api-key 中获取key
+	if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models") {
+		key := c.Query("key")
+		if key == "" {
+			key = c.Request.Header.Get("x-goog-api-key")
 		}
-		if err != nil {
-			abortWithOpenAiMessage(c, http.StatusUnauthorized, err.Error())
-			return
+		if key != "" {
+			c.Request.Header.Set("Authorization", "Bearer "+key)
 		}
-		userCache, err := model.GetUserCache(token.UserId)
-		if err != nil {
-			abortWithOpenAiMessage(c, http.StatusInternalServerError, err.Error())
-			return
+	}
+	key := c.Request.Header.Get("Authorization")
+	parts := make([]string, 0)
+	key = strings.TrimPrefix(key, "Bearer ")
+	if key == "" || key == "midjourney-proxy" {
+		key = c.Request.Header.Get("mj-api-secret")
+		key = strings.TrimPrefix(key, "Bearer ")
+		key = strings.TrimPrefix(key, "sk-")
+		parts = strings.Split(key, "-")
+		key = parts[0]
+	} else {
+		key = strings.TrimPrefix(key, "sk-")
+		parts = strings.Split(key, "-")
+		key = parts[0]
+	}
+	token, err := model.ValidateUserToken(key)
+	if token != nil {
+		id := c.GetInt("id")
+		if id == 0 {
+			c.Set("id", token.UserId)
 		}
-		userEnabled := userCache.Status == common.UserStatusEnabled
-		if !userEnabled {
-			abortWithOpenAiMessage(c, http.StatusForbidden, "用户已被封禁")
+	}
+	if err != nil {
+		abortWithOpenAiMessage(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if statusCode, err := SetupContextForToken(c, token); err != nil {
+		abortWithOpenAiMessage(c, statusCode, err.Error())
+		return
+	}
+	if len(parts) > 1 {
+		if model.IsAdmin(token.UserId) {
+			c.Set("specific_channel_id", parts[1])
+		} else {
+			abortWithOpenAiMessage(c, http.StatusForbidden, "普通用户不支持指定渠道")
 			return
 		}
+	}
+}
+
+// SetupContextForToken 将令牌和用户信息写入上下文，供不经过 http 鉴权的请求（如批处理任务）复用
+func SetupContextForToken(c *gin.Context, token *model.Token) (int, error) {
+	userCache, err := model.GetUserCache(token.UserId)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	userEnabled := userCache.Status == common.UserStatusEnabled
+	if !userEnabled {
+		return http.StatusForbidden, errors.New("用户已被封禁")
+	}
 
-		userCache.WriteContext(c)
+	userCache.WriteContext(c)
 
-		c.Set("id", token.UserId)
-		c.Set("token_id", token.Id)
-		c.Set("token_key", token.Key)
-		c.Set("token_name", token.Name)
-		c.Set("token_unlimited_quota", token.UnlimitedQuota)
-		if !token.UnlimitedQuota {
-			c.Set("token_quota", token.RemainQuota)
+	c.Set("id", token.UserId)
+	c.Set("token_id", token.Id)
+	c.Set("token_key", token.Key)
+	c.Set("token_name", token.Name)
+	c.Set("token_unlimited_quota", token.UnlimitedQuota)
+	if !token.UnlimitedQuota {
+		c.Set("token_quota", token.RemainQuota)
+	}
+	c.Set("token_rate_limit_enabled", token.RateLimitEnabled)
+	c.Set("token_rate_limit_period", token.RateLimitPeriod)
+	c.Set("token_rate_limit_count", token.RateLimitCount)
+	c.Set("token_rate_limit_success", token.RateLimitSuccess)
+	if token.ModelLimitsEnabled {
+		c.Set("token_model_limit_enabled", true)
+		c.Set("token_model_limit", token.GetModelLimitsMap())
+	} else {
+		c.Set("token_model_limit_enabled", false)
+	}
+	c.Set("allow_ips", token.GetIpLimitsMap())
+	c.Set("token_group", token.Group)
+	c.Set("token_response_cache", token.ResponseCache)
+	c.Set("token_tpm_limit", token.TPMLimit)
+	c.Set("token_tpd_limit", token.TPDLimit)
+	c.Set("token_max_concurrency", token.MaxConcurrency)
+	c.Set("token_budget", token.GetBudget())
+	if token.OrganizationId != 0 {
+		org, err := model.GetOrganizationById(token.OrganizationId)
+		if err != nil || org.Status != common.UserStatusEnabled {
+			return http.StatusForbidden, errors.New("令牌所属组织不存在或已被禁用")
 		}
-		c.Set("token_rate_limit_enabled", token.RateLimitEnabled)
-		c.Set("token_rate_limit_period", token.RateLimitPeriod)
-		c.Set("token_rate_limit_count", token.RateLimitCount)
-		c.Set("token_rate_limit_success", token.RateLimitSuccess)
-		if token.ModelLimitsEnabled {
-			c.Set("token_model_limit_enabled", true)
-			c.Set("token_model_limit", token.GetModelLimitsMap())
-		} else {
-			c.Set("token_model_limit_enabled", false)
+		member, err := model.GetOrganizationMember(org.Id, token.UserId)
+		if err != nil {
+			return http.StatusForbidden, errors.New("令牌创建者已不是该组织的成员")
 		}
-		c.Set("allow_ips", token.GetIpLimitsMap())
-		c.Set("token_group", token.Group)
-		if len(parts) > 1 {
-			if model.IsAdmin(token.UserId) {
-				c.Set("specific_channel_id", parts[1])
-			} else {
-				abortWithOpenAiMessage(c, http.StatusForbidden, "普通用户不支持指定渠道")
-				return
-			}
+		if member.QuotaLimit > 0 && member.UsedQuota >= member.QuotaLimit {
+			return http.StatusForbidden, errors.New("您在该组织中的额度已用尽")
 		}
-		c.Next()
+		c.Set("organization_id", org.Id)
+		c.Set("organization_name", org.Name)
+		c.Set("organization_budget", org.GetBudget())
 	}
+	return http.StatusOK, nil
 }
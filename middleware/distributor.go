@@ -28,11 +28,14 @@ import (
 	"veloera/constant"
 	"veloera/dto"
 	"veloera/model"
+	relaycommon "veloera/relay/common"
 	relayconstant "veloera/relay/constant"
 	"veloera/service"
 	"veloera/setting"
+	"veloera/setting/model_setting"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ModelRequest struct {
@@ -95,6 +98,50 @@ func ResetChannelKeyIndex(channelId int) {
 	delete(channelKeysHash, channelId)
 }
 
+// selectChannelKey 轮询选择多 key 渠道中的一个 key，跳过冷却中和已禁用的 key，
+// 全部不可用时仍按轮询返回，由上游返回的错误决定后续处理
+func selectChannelKey(channel *model.Channel) string {
+	keys := model.SplitChannelKeys(channel)
+	if len(keys) == 0 {
+		return ""
+	}
+	states := model.GetChannelKeyStates(channel.Id)
+	now := common.GetTimestamp()
+
+	channelKeysMutex.Lock()
+	defer channelKeysMutex.Unlock()
+
+	// Check if keys have changed by comparing with stored hash
+	currentHash := common.GetMD5Hash(channel.Key)
+	storedHash, hashExists := channelKeysHash[channel.Id]
+
+	// Reset index if keys have changed or index doesn't exist
+	index := 0
+	if hashExists && storedHash == currentHash {
+		// Keys haven't changed, use stored index
+		storedIndex, exists := channelKeysIndex[channel.Id]
+		if exists && storedIndex < len(keys) {
+			index = storedIndex
+		}
+	} else {
+		// Keys have changed or this is first use, update hash and reset index
+		channelKeysHash[channel.Id] = currentHash
+	}
+
+	selected := index
+	for i := 0; i < len(keys); i++ {
+		candidate := (index + i) % len(keys)
+		if model.IsChannelKeyAvailable(states, model.GetChannelKeyHash(keys[candidate]), now) {
+			selected = candidate
+			break
+		}
+	}
+
+	// Update index for next use
+	channelKeysIndex[channel.Id] = (selected + 1) % len(keys)
+	return keys[selected]
+}
+
 // RefreshPrefixChannelsCache refreshes prefix cache for one or multiple groups.
 // Groups should be a comma separated string, empty entries are ignored.
 func RefreshPrefixChannelsCache(groups string) {
@@ -107,6 +154,21 @@ func RefreshPrefixChannelsCache(groups string) {
 	}
 }
 
+// RefreshAllPrefixChannelsCache rebuilds the prefix cache of every cached group,
+// used after bulk channel changes (e.g. config sync) where affected groups are not known up front.
+// Groups that are not cached yet are built on first access.
+func RefreshAllPrefixChannelsCache() {
+	prefixChannelsMutex.RLock()
+	groups := make([]string, 0, len(prefixChannelsCache))
+	for group := range prefixChannelsCache {
+		groups = append(groups, group)
+	}
+	prefixChannelsMutex.RUnlock()
+	for _, group := range groups {
+		refreshPrefixChannelsCache(group)
+	}
+}
+
 // refreshPrefixChannelsCache refreshes the prefix channels cache for a given group
 func refreshPrefixChannelsCache(group string) map[string][]*model.Channel {
 	var channels []*model.Channel
@@ -202,125 +264,154 @@ func selectChannelByPrefix(group, prefix, originalModel string) (*model.Channel,
 
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		allowIpsMap := c.GetStringMap("allow_ips")
-		if len(allowIpsMap) != 0 {
-			clientIp := c.ClientIP()
-			if _, ok := allowIpsMap[clientIp]; !ok {
-				abortWithOpenAiMessage(c, http.StatusForbidden, "您的 IP 不在令牌允许访问的列表中")
-				return
+		distribute(c)
+		c.Next()
+	}
+}
+
+// distribute 选择渠道并写入上下文，span 只覆盖渠道选择本身，不包含后续的 handler
+func distribute(c *gin.Context) {
+	span := common.StartGinSpan(c, "Distribute")
+	defer endMiddlewareSpan(c, span)
+	allowIpsMap := c.GetStringMap("allow_ips")
+	if len(allowIpsMap) != 0 {
+		clientIp := c.ClientIP()
+		if _, ok := allowIpsMap[clientIp]; !ok {
+			abortWithOpenAiMessage(c, http.StatusForbidden, "您的 IP 不在令牌允许访问的列表中")
+			return
+		}
+	}
+	var channel *model.Channel
+	channelId, ok := c.Get("specific_channel_id")
+	modelRequest, shouldSelectChannel, err := getModelRequest(c)
+	if err != nil {
+		abortWithOpenAiMessage(c, http.StatusBadRequest, "Invalid request, "+err.Error())
+		return
+	}
+	userGroup := c.GetString(constant.ContextKeyUserGroup)
+	tokenGroup := c.GetString("token_group")
+	if tokenGroup != "" {
+		// check common.UserUsableGroups[userGroup]
+		if _, ok := setting.GetUserUsableGroups(userGroup)[tokenGroup]; !ok {
+			abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("令牌分组 %s 已被禁用", tokenGroup))
+			return
+		}
+		// check group in common.GroupRatio
+		if !setting.ContainsGroupRatio(tokenGroup) {
+			abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("分组 %s 已被弃用", tokenGroup))
+			return
+		}
+		userGroup = tokenGroup
+	}
+	c.Set("group", userGroup)
+
+	// Check if the model has a prefix, which is used for routing
+	originalModel := modelRequest.Model
+	prefixedModel, hasPrefixedModel := c.Get("prefixed_model")
+	modelPrefix := ""
+	prefixedModelStr := ""
+	if hasPrefixedModel {
+		prefixedModelStr = prefixedModel.(string)
+		// Extract prefix from the model name if it exists
+		for prefix := range getPrefixChannels(userGroup) {
+			if prefix != "" && strings.HasPrefix(prefixedModelStr, prefix) {
+				modelPrefix = prefix
+				// Update the model name to strip the prefix for channel selection
+				modelRequest.Model = strings.TrimPrefix(prefixedModelStr, prefix)
+				break
 			}
 		}
-		var channel *model.Channel
-		channelId, ok := c.Get("specific_channel_id")
-		modelRequest, shouldSelectChannel, err := getModelRequest(c)
+	}
+
+	if ok {
+		id, err := strconv.Atoi(channelId.(string))
 		if err != nil {
-			abortWithOpenAiMessage(c, http.StatusBadRequest, "Invalid request, "+err.Error())
+			abortWithOpenAiMessage(c, http.StatusBadRequest, "无效的渠道 Id")
 			return
 		}
-		userGroup := c.GetString(constant.ContextKeyUserGroup)
-		tokenGroup := c.GetString("token_group")
-		if tokenGroup != "" {
-			// check common.UserUsableGroups[userGroup]
-			if _, ok := setting.GetUserUsableGroups(userGroup)[tokenGroup]; !ok {
-				abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("令牌分组 %s 已被禁用", tokenGroup))
-				return
+		channel, err = model.GetChannelById(id, true)
+		if err != nil {
+			abortWithOpenAiMessage(c, http.StatusBadRequest, "无效的渠道 Id")
+			return
+		}
+		if channel.Status != common.ChannelStatusEnabled {
+			abortWithOpenAiMessage(c, http.StatusForbidden, "该渠道已被禁用")
+			return
+		}
+	} else {
+		// Select a channel for the user
+		// check token model mapping
+		modelLimitEnable := c.GetBool("token_model_limit_enabled")
+		if modelLimitEnable {
+			s, ok := c.Get("token_model_limit")
+			var tokenModelLimit map[string]bool
+			if ok {
+				tokenModelLimit = s.(map[string]bool)
+			} else {
+				tokenModelLimit = map[string]bool{}
 			}
-			// check group in common.GroupRatio
-			if !setting.ContainsGroupRatio(tokenGroup) {
-				abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("分组 %s 已被弃用", tokenGroup))
+			if tokenModelLimit != nil {
+				// Check access against the original (prefixed) model name
+				if _, ok := tokenModelLimit[originalModel]; !ok {
+					abortWithOpenAiMessage(c, http.StatusForbidden, "该令牌无权访问模型 "+originalModel)
+					return
+				}
+			} else {
+				// token model limit is empty, all models are not allowed
+				abortWithOpenAiMessage(c, http.StatusForbidden, "该令牌无权访问任何模型")
 				return
 			}
-			userGroup = tokenGroup
 		}
-		c.Set("group", userGroup)
-
-		// Check if the model has a prefix, which is used for routing
-		originalModel := modelRequest.Model
-		prefixedModel, hasPrefixedModel := c.Get("prefixed_model")
-		modelPrefix := ""
-		prefixedModelStr := ""
-		if hasPrefixedModel {
-			prefixedModelStr = prefixedModel.(string)
-			// Extract prefix from the model name if it exists
-			for prefix := range getPrefixChannels(userGroup) {
-				if prefix != "" && strings.HasPrefix(prefixedModelStr, prefix) {
-					modelPrefix = prefix
-					// Update the model name to strip the prefix for channel selection
-					modelRequest.Model = strings.TrimPrefix(prefixedModelStr, prefix)
-					break
+
+		if shouldSelectChannel {
+			// If we have a model prefix, use it to select among specific channels
+			if modelPrefix != "" {
+				channel, err = selectChannelByPrefix(userGroup, modelPrefix, modelRequest.Model)
+			} else {
+				channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, modelRequest.Model, 0, nil)
+				// 请求的模型没有可用渠道时按降级链选择，最多遍历一遍降级链，跳过请求模型本身和重复的模型
+				requestModel := modelRequest.Model
+				visited := map[string]bool{requestModel: true}
+				for _, fallbackModel := range model_setting.GetModelFallbacks(requestModel) {
+					if err == nil {
+						break
+					}
+					if visited[fallbackModel] {
+						continue
+					}
+					visited[fallbackModel] = true
+					channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, fallbackModel, 0, nil)
+					if err == nil {
+						c.Set(constant.ContextKeyFallbackFrom, requestModel)
+						modelRequest.Model = fallbackModel
+					}
 				}
 			}
-		}
 
-		if ok {
-			id, err := strconv.Atoi(channelId.(string))
-			if err != nil {
-				abortWithOpenAiMessage(c, http.StatusBadRequest, "无效的渠道 Id")
-				return
-			}
-			channel, err = model.GetChannelById(id, true)
 			if err != nil {
-				abortWithOpenAiMessage(c, http.StatusBadRequest, "无效的渠道 Id")
+				message := fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道", userGroup, originalModel)
+				// 如果错误，但是渠道不为空，说明是数据库一致性问题
+				if channel != nil {
+					common.SysError(fmt.Sprintf("渠道不存在：%d", channel.Id))
+					message = "数据库一致性已被破坏，请联系管理员"
+				}
+				// 如果错误，而且渠道为空，说明是没有可用渠道
+				abortWithOpenAiMessage(c, http.StatusServiceUnavailable, message)
 				return
 			}
-			if channel.Status != common.ChannelStatusEnabled {
-				abortWithOpenAiMessage(c, http.StatusForbidden, "该渠道已被禁用")
+			if channel == nil {
+				abortWithOpenAiMessage(c, http.StatusServiceUnavailable, fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道（数据库一致性已被破坏）", userGroup, originalModel))
 				return
 			}
-		} else {
-			// Select a channel for the user
-			// check token model mapping
-			modelLimitEnable := c.GetBool("token_model_limit_enabled")
-			if modelLimitEnable {
-				s, ok := c.Get("token_model_limit")
-				var tokenModelLimit map[string]bool
-				if ok {
-					tokenModelLimit = s.(map[string]bool)
-				} else {
-					tokenModelLimit = map[string]bool{}
-				}
-				if tokenModelLimit != nil {
-					// Check access against the original (prefixed) model name
-					if _, ok := tokenModelLimit[originalModel]; !ok {
-						abortWithOpenAiMessage(c, http.StatusForbidden, "该令牌无权访问模型 "+originalModel)
-						return
-					}
-				} else {
-					// token model limit is empty, all models are not allowed
-					abortWithOpenAiMessage(c, http.StatusForbidden, "该令牌无权访问任何模型")
-					return
-				}
-			}
-
-			if shouldSelectChannel {
-				// If we have a model prefix, use it to select among specific channels
-				if modelPrefix != "" {
-					channel, err = selectChannelByPrefix(userGroup, modelPrefix, modelRequest.Model)
-				} else {
-					channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, modelRequest.Model, 0)
-				}
-
-				if err != nil {
-					message := fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道", userGroup, originalModel)
-					// 如果错误，但是渠道不为空，说明是数据库一致性问题
-					if channel != nil {
-						common.SysError(fmt.Sprintf("渠道不存在：%d", channel.Id))
-						message = "数据库一致性已被破坏，请联系管理员"
-					}
-					// 如果错误，而且渠道为空，说明是没有可用渠道
-					abortWithOpenAiMessage(c, http.StatusServiceUnavailable, message)
-					return
-				}
-				if channel == nil {
-					abortWithOpenAiMessage(c, http.StatusServiceUnavailable, fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道（数据库一致性已被破坏）", userGroup, originalModel))
-					return
-				}
-			}
 		}
-		c.Set(constant.ContextKeyRequestStartTime, time.Now())
-		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
-		c.Next()
 	}
+	c.Set(constant.ContextKeyRequestStartTime, time.Now())
+	SetupContextForSelectedChannel(c, channel, modelRequest.Model)
+	span.SetAttributes(
+		attribute.String("relay.model", modelRequest.Model),
+		attribute.String("relay.group", c.GetString("group")),
+		attribute.Int("channel.id", c.GetInt("channel_id")),
+	)
 }
 
 func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
@@ -366,6 +457,17 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 		}
 		c.Set("platform", string(constant.TaskPlatformSuno))
 		c.Set("relay_mode", relayMode)
+	} else if strings.Contains(c.Request.URL.Path, "/v1/videos") {
+		relayMode := relayconstant.Path2RelayVideo(c.Request.Method, c.Request.URL.Path)
+		if relayconstant.IsVideoFetchRelayMode(relayMode) {
+			shouldSelectChannel = false
+		} else {
+			err = common.UnmarshalBodyReusable(c, &modelRequest)
+			// multipart 提交时模型在表单中
+			modelRequest.Model = common.GetStringIfEmpty(modelRequest.Model, c.PostForm("model"))
+			modelRequest.Model = common.GetStringIfEmpty(modelRequest.Model, "sora-2")
+		}
+		c.Set("relay_mode", relayMode)
 	} else if !strings.HasPrefix(c.Request.URL.Path, "/v1/audio/transcriptions") {
 		err = common.UnmarshalBodyReusable(c, &modelRequest)
 	}
@@ -376,6 +478,10 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 		//wss://api.openai.com/v1/realtime?model=gpt-4o-realtime-preview-2024-10-01
 		modelRequest.Model = c.Query("model")
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models") {
+		// gemini 原生接口的模型名在路径中
+		modelRequest.Model, _ = relaycommon.GetGeminiModelAndAction(c.Param("path"))
+	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/moderations") {
 		if modelRequest.Model == "" {
 			modelRequest.Model = "text-moderation-stable"
@@ -389,6 +495,11 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/generations") {
 		modelRequest.Model = common.GetStringIfEmpty(modelRequest.Model, "dall-e")
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/edits") || strings.HasPrefix(c.Request.URL.Path, "/v1/images/variations") {
+		// 图片编辑与变体请求为 multipart 格式
+		modelRequest.Model = common.GetStringIfEmpty(modelRequest.Model, c.PostForm("model"))
+		modelRequest.Model = common.GetStringIfEmpty(modelRequest.Model, "dall-e-2")
+	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/audio") {
 		relayMode := relayconstant.RelayModeAudioSpeech
 		if strings.HasPrefix(c.Request.URL.Path, "/v1/audio/speech") {
@@ -420,6 +531,7 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 		return
 	}
 	c.Set("channel_id", channel.Id)
+	c.Set(constant.ContextKeyChannelKeyHash, "")
 	c.Set("channel_name", channel.Name)
 	c.Set("channel_type", channel.Type)
 	c.Set("channel_create_time", channel.CreatedTime)
@@ -443,36 +555,9 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	if channel.Type == 41 {
 		c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
 	} else if strings.Contains(channel.Key, ",") {
-		keys := strings.Split(channel.Key, ",")
-
-		// Get current index for this channel using round-robin
-		channelKeysMutex.Lock()
-
-		// Check if keys have changed by comparing with stored hash
-		currentHash := common.GetMD5Hash(channel.Key)
-		storedHash, hashExists := channelKeysHash[channel.Id]
-
-		// Reset index if keys have changed or index doesn't exist
-		index := 0
-		if hashExists && storedHash == currentHash {
-			// Keys haven't changed, use stored index
-			storedIndex, exists := channelKeysIndex[channel.Id]
-			if exists && storedIndex < len(keys) {
-				index = storedIndex
-			}
-		} else {
-			// Keys have changed or this is first use, update hash and reset index
-			channelKeysHash[channel.Id] = currentHash
-		}
-
-		// Select key at current index
-		selectedKey := keys[index]
-
-		// Update index for next use
-		channelKeysIndex[channel.Id] = (index + 1) % len(keys)
-		channelKeysMutex.Unlock()
-
-		c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", strings.TrimSpace(selectedKey)))
+		selectedKey := selectChannelKey(channel)
+		c.Set(constant.ContextKeyChannelKeyHash, model.GetChannelKeyHash(selectedKey))
+		c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", selectedKey))
 	} else {
 		c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
 	}
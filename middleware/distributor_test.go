@@ -0,0 +1,59 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package middleware
+
+import (
+	"testing"
+	"veloera/common"
+	"veloera/model"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// 配置同步等批量变更后，已缓存分组的前缀缓存需要立即重建，而不是等到一小时后过期
+func TestRefreshAllPrefixChannelsCache(t *testing.T) {
+	common.RedisEnabled = false
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&model.Channel{}); err != nil {
+		t.Fatal(err)
+	}
+	model.DB = db
+	prefix := "old/"
+	channel := model.Channel{Id: 1, Name: "prefixed", Status: common.ChannelStatusEnabled, Group: "default", Models: "gpt-4o", ModelPrefix: &prefix}
+	if err = db.Create(&channel).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := GetPrefixChannels("default")["old/"]; !ok {
+		t.Fatal("expected prefix to be cached")
+	}
+
+	if err = db.Model(&model.Channel{}).Where("id = ?", 1).Update("model_prefix", "new/").Error; err != nil {
+		t.Fatal(err)
+	}
+	RefreshAllPrefixChannelsCache()
+	prefixes := GetPrefixChannels("default")
+	if _, ok := prefixes["old/"]; ok {
+		t.Fatal("expected stale prefix to be removed")
+	}
+	if _, ok := prefixes["new/"]; !ok {
+		t.Fatal("expected new prefix to be cached")
+	}
+}
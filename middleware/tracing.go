@@ -0,0 +1,64 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package middleware
+
+import (
+	"strings"
+	"veloera/common"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing 为中继请求创建根 span，客户端携带 traceparent 时沿用其链路
+func Tracing() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if !common.TracingEnabled {
+			c.Next()
+			return
+		}
+		ctx := common.ExtractTraceContext(c.Request.Context(), c.Request.Header)
+		ctx, span := common.StartSpanWithKind(ctx, c.Request.Method+" "+c.FullPath(), trace.SpanKindServer,
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", c.FullPath()),
+			attribute.String("request.id", c.GetString(common.RequestIdKey)),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		span.SetAttributes(
+			attribute.Int("user.id", c.GetInt("id")),
+			attribute.Int("token.id", c.GetInt("token_id")),
+			attribute.String("relay.group", c.GetString("group")),
+			attribute.String("relay.model", c.GetString("original_model")),
+			attribute.String("relay.channels", strings.Join(c.GetStringSlice("use_channel"), ",")),
+		)
+		common.SetSpanStatusCode(span, c.Writer.Status(), c.Errors.String())
+	}
+}
+
+// endMiddlewareSpan 结束中间件阶段的 span，由中间件的处理函数 defer 调用，
+// 处理函数返回后才调用 c.Next()，因此 span 不包含后续的 handler；提前 abort 时记录状态码
+func endMiddlewareSpan(c *gin.Context, span trace.Span) {
+	if c.IsAborted() {
+		common.SetSpanStatusCode(span, c.Writer.Status(), c.Errors.String())
+	}
+	span.End()
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package middleware
+
+import (
+	"veloera/common"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UsageLimit 按令牌、用户分组和模型限制 TPM/TPD 与并发请求数，需要在 Distribute 之后使用
+func UsageLimit() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		defer service.ReleaseUsageLimit(c)
+		if openaiErr := service.AcquireUsageLimit(c); openaiErr != nil {
+			openaiErr.Error.Message = common.MessageWithRequestId(openaiErr.Error.Message, c.GetString(common.RequestIdKey))
+			c.JSON(openaiErr.StatusCode, gin.H{
+				"error": openaiErr.Error,
+			})
+			c.Abort()
+			common.LogError(c.Request.Context(), openaiErr.Error.Message)
+			return
+		}
+		c.Next()
+	}
+}
@@ -56,16 +56,20 @@ func GetAllEnableAbilities() []Ability {
 	return abilities
 }
 
-func getPriority(group string, model string, retry int) (int, error) {
+func getPriority(group string, model string, retry int, excludedIds []int) (int, error) {
 	trueVal := "1"
 	if common.UsingPostgreSQL {
 		trueVal = "true"
 	}
 
 	var priorities []int
-	err := DB.Model(&Ability{}).
+	query := DB.Model(&Ability{}).
 		Select("DISTINCT(priority)").
-		Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model).
+		Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
+	if len(excludedIds) > 0 {
+		query = query.Where("channel_id not in ?", excludedIds)
+	}
+	err := query.
 		Order("priority DESC").              // 按优先级降序排序
 		Pluck("priority", &priorities).Error // Pluck用于将查询的结果直接扫描到一个切片中
 
@@ -90,30 +94,45 @@ func getPriority(group string, model string, retry int) (int, error) {
 	return priorityToUse, nil
 }
 
-func getChannelQuery(group string, model string, retry int) *gorm.DB {
+// getChannelQuery 查询第 retry 个优先级的渠道，excludedIds 中的渠道不参与选择。
+// 传入 excludedIds 时忽略 retry，直接使用剩余渠道中的最高优先级，避免跳过从未尝试过的高优先级渠道
+func getChannelQuery(group string, model string, retry int, excludedIds []int) *gorm.DB {
 	trueVal := "1"
 	if common.UsingPostgreSQL {
 		trueVal = "true"
 	}
 	maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
+	if len(excludedIds) > 0 {
+		maxPrioritySubQuery = maxPrioritySubQuery.Where("channel_id not in ?", excludedIds)
+	}
 	channelQuery := DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal+" and priority = (?)", group, model, maxPrioritySubQuery)
-	if retry != 0 {
-		priority, err := getPriority(group, model, retry)
+	if retry != 0 && len(excludedIds) == 0 {
+		priority, err := getPriority(group, model, retry, excludedIds)
 		if err != nil {
-			common.SysError(fmt.Sprintf("Get priority failed: %s", err.Error()))
+			// 排除已失败的渠道后没有剩余渠道属于正常情况
+			if len(excludedIds) == 0 {
+				common.SysError(fmt.Sprintf("Get priority failed: %s", err.Error()))
+			}
 		} else {
 			channelQuery = DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal+" and priority = ?", group, model, priority)
 		}
 	}
+	if len(excludedIds) > 0 {
+		channelQuery = channelQuery.Where("channel_id not in ?", excludedIds)
+	}
 
 	return channelQuery
 }
 
-func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel, error) {
+func GetRandomSatisfiedChannel(group string, model string, retry int, excluded map[int]bool) (*Channel, error) {
 	var abilities []Ability
 
 	var err error = nil
-	channelQuery := getChannelQuery(group, model, retry)
+	excludedIds := make([]int, 0, len(excluded))
+	for id := range excluded {
+		excludedIds = append(excludedIds, id)
+	}
+	channelQuery := getChannelQuery(group, model, retry, excludedIds)
 	if common.UsingSQLite || common.UsingPostgreSQL {
 		err = channelQuery.Order("weight DESC").Find(&abilities).Error
 	} else {
@@ -124,17 +143,23 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	}
 	channel := Channel{}
 	if len(abilities) > 0 {
+		// 过滤掉熔断中的渠道，剩余渠道按健康分调整权重
+		channelIds := make([]int, 0, len(abilities))
+		for _, ability_ := range abilities {
+			channelIds = append(channelIds, ability_.ChannelId)
+		}
+		_, scores := filterHealthyChannels(channelIds, model)
 		// Randomly choose one
-		weightSum := uint(0)
+		weightSum := 0
 		for _, ability_ := range abilities {
-			weightSum += ability_.Weight + 10
+			weightSum += abilityHealthWeight(ability_, scores)
 		}
 		// Randomly choose one
-		weight := common.GetRandomInt(int(weightSum))
+		weight := common.GetRandomInt(weightSum)
 		for _, ability_ := range abilities {
-			weight -= int(ability_.Weight) + 10
+			weight -= abilityHealthWeight(ability_, scores)
 			//log.Printf("weight: %d, ability weight: %d", weight, *ability_.Weight)
-			if weight <= 0 {
+			if weight < 0 {
 				channel.Id = ability_.ChannelId
 				break
 			}
@@ -142,10 +167,20 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	} else {
 		return nil, errors.New("channel not found")
 	}
+	acquireChannelHealth(channel.Id, model)
 	err = DB.First(&channel, "id = ?", channel.Id).Error
 	return &channel, err
 }
 
+// abilityHealthWeight 熔断中的渠道权重为 0，健康分按百分比缩放
+func abilityHealthWeight(ability Ability, scores map[int]float64) int {
+	score, ok := scores[ability.ChannelId]
+	if !ok {
+		return 0
+	}
+	return int(float64(ability.Weight+10) * score * 100)
+}
+
 func (channel *Channel) AddAbilities() error {
 	models_ := strings.Split(channel.Models, ",")
 	groups_ := strings.Split(channel.Group, ",")
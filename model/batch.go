@@ -0,0 +1,152 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"veloera/common"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+type Batch struct {
+	Id               int    `json:"id"`
+	BatchId          string `json:"batch_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id"`
+	Endpoint         string `json:"endpoint"`
+	InputFileId      string `json:"input_file_id" gorm:"type:varchar(64)"`
+	OutputFileId     string `json:"output_file_id" gorm:"type:varchar(64)"`
+	ErrorFileId      string `json:"error_file_id" gorm:"type:varchar(64)"`
+	CompletionWindow string `json:"completion_window"`
+	Status           string `json:"status" gorm:"type:varchar(20);index"`
+	Errors           string `json:"errors" gorm:"type:text"`   // 校验失败的错误列表，json
+	Metadata         string `json:"metadata" gorm:"type:text"` // json
+	RequestTotal     int    `json:"request_total"`
+	RequestCompleted int    `json:"request_completed"`
+	RequestFailed    int    `json:"request_failed"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint"`
+	InProgressAt     int64  `json:"in_progress_at" gorm:"bigint"`
+	ExpiresAt        int64  `json:"expires_at" gorm:"bigint"`
+	FinalizingAt     int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt      int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt         int64  `json:"failed_at" gorm:"bigint"`
+	ExpiredAt        int64  `json:"expired_at" gorm:"bigint"`
+	CancellingAt     int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt      int64  `json:"cancelled_at" gorm:"bigint"`
+}
+
+func (batch *Batch) Insert() error {
+	return DB.Create(batch).Error
+}
+
+func (batch *Batch) IsFinished() bool {
+	switch batch.Status {
+	case BatchStatusFailed, BatchStatusCompleted, BatchStatusExpired, BatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func (batch *Batch) GetMetadata() map[string]string {
+	metadata := make(map[string]string)
+	if batch.Metadata != "" {
+		_ = json.Unmarshal([]byte(batch.Metadata), &metadata)
+	}
+	return metadata
+}
+
+func (batch *Batch) SetMetadata(metadata map[string]string) {
+	if len(metadata) == 0 {
+		batch.Metadata = ""
+		return
+	}
+	b, _ := json.Marshal(metadata)
+	batch.Metadata = string(b)
+}
+
+// UpdateStatus 仅当批处理仍处于 from 状态时才切换状态，避免覆盖并发的取消操作
+func (batch *Batch) UpdateStatus(from string, updates map[string]interface{}) (bool, error) {
+	result := DB.Model(&Batch{}).Where("id = ? AND status = ?", batch.Id, from).Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	return true, DB.First(batch, batch.Id).Error
+}
+
+func (batch *Batch) UpdateRequestCounts() error {
+	return DB.Model(&Batch{}).Where("id = ?", batch.Id).Updates(map[string]interface{}{
+		"request_total":     batch.RequestTotal,
+		"request_completed": batch.RequestCompleted,
+		"request_failed":    batch.RequestFailed,
+	}).Error
+}
+
+func GetBatchStatus(id int) (string, error) {
+	var status string
+	err := DB.Model(&Batch{}).Where("id = ?", id).Select("status").Scan(&status).Error
+	return status, err
+}
+
+func GetUserBatchByBatchId(userId int, batchId string) (*Batch, error) {
+	if batchId == "" {
+		return nil, errors.New("batch id 为空！")
+	}
+	var batch Batch
+	err := DB.Where("user_id = ? AND batch_id = ?", userId, batchId).First(&batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// GetUserBatches 按创建时间倒序列出批处理，after 为上一页最后一个 batch id
+func GetUserBatches(userId int, after string, limit int) (batches []*Batch, err error) {
+	query := DB.Where("user_id = ?", userId)
+	if after != "" {
+		var afterBatch Batch
+		if err = DB.Where("user_id = ? AND batch_id = ?", userId, after).First(&afterBatch).Error; err == nil {
+			query = query.Where("id < ?", afterBatch.Id)
+		}
+	}
+	err = query.Order("id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+func GetUnfinishedBatches(limit int) []*Batch {
+	var batches []*Batch
+	err := DB.Where("status IN ?", []string{BatchStatusValidating, BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling}).
+		Order("id asc").Limit(limit).Find(&batches).Error
+	if err != nil {
+		common.SysError("failed to get unfinished batches: " + err.Error())
+		return nil
+	}
+	return batches
+}
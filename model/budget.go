@@ -0,0 +1,68 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"errors"
+	"veloera/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BudgetUsage 记录某个预算周期内的消费额度，Id 由预算对象、周期类型和周期起始日期组成，
+// 例如 token:12:monthly:20261001，进入新周期后自然使用新的记录
+type BudgetUsage struct {
+	Id        string `json:"id" gorm:"primaryKey;type:varchar(128)"`
+	Used      int64  `json:"used" gorm:"bigint;default:0"`
+	UpdatedAt int64  `json:"updated_at" gorm:"bigint;index"`
+}
+
+func GetBudgetUsage(id string) (int64, error) {
+	var usage BudgetUsage
+	err := DB.Where("id = ?", id).First(&usage).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	return usage.Used, err
+}
+
+// IncreaseBudgetUsage 原子地累加消费额度并返回累加后的值
+func IncreaseBudgetUsage(id string, delta int64) (int64, error) {
+	var usage BudgetUsage
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		now := common.GetTimestamp()
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"used":       gorm.Expr("used + ?", delta),
+				"updated_at": now,
+			}),
+		}).Create(&BudgetUsage{Id: id, Used: delta, UpdatedAt: now}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).First(&usage).Error
+	})
+	return usage.Used, err
+}
+
+// DeleteBudgetUsagesBefore 清理早于 timestamp 未更新的预算记录
+func DeleteBudgetUsagesBefore(timestamp int64) (int64, error) {
+	result := DB.Where("updated_at < ?", timestamp).Delete(&BudgetUsage{})
+	return result.RowsAffected, result.Error
+}
@@ -34,7 +34,10 @@ var channelSyncLock sync.RWMutex
 func InitChannelCache() {
 	newChannelId2channel := make(map[int]*Channel)
 	var channels []*Channel
-	DB.Where("status = ?", common.ChannelStatusEnabled).Find(&channels)
+	if err := DB.Where("status = ?", common.ChannelStatusEnabled).Find(&channels).Error; err != nil {
+		// 通常是渠道密钥无法解密，解密失败的渠道 key 为空，不会把密文发往上游
+		common.SysError("failed to load channels: " + err.Error())
+	}
 	for _, channel := range channels {
 		newChannelId2channel[channel.Id] = channel
 	}
@@ -77,6 +80,7 @@ func InitChannelCache() {
 	group2model2channels = newGroup2model2channels
 	channelsIDM = newChannelsIDM
 	channelSyncLock.Unlock()
+	initChannelKeyCache()
 	common.SysLog("channels synced from database")
 }
 
@@ -88,7 +92,9 @@ func SyncChannelCache(frequency int) {
 	}
 }
 
-func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Channel, error) {
+// CacheGetRandomSatisfiedChannel 按优先级和权重随机选择渠道，retry 表示使用第几个优先级，
+// excluded 中的渠道（通常是本次请求已失败的渠道）不参与选择
+func CacheGetRandomSatisfiedChannel(group string, model string, retry int, excluded map[int]bool) (*Channel, error) {
 	if strings.HasPrefix(model, "gpt-4-gizmo") {
 		model = "gpt-4-gizmo-*"
 	}
@@ -98,15 +104,40 @@ func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Cha
 
 	// if memory cache is disabled, get channel directly from database
 	if !common.MemoryCacheEnabled {
-		return GetRandomSatisfiedChannel(group, model, retry)
+		return GetRandomSatisfiedChannel(group, model, retry, excluded)
 	}
 	channelSyncLock.RLock()
 	defer channelSyncLock.RUnlock()
 	channels := group2model2channels[group][model]
+	if len(excluded) > 0 {
+		candidates := make([]*Channel, 0, len(channels))
+		for _, channel := range channels {
+			if !excluded[channel.Id] {
+				candidates = append(candidates, channel)
+			}
+		}
+		channels = candidates
+	}
 	if len(channels) == 0 {
 		return nil, errors.New("channel not found")
 	}
 
+	// 过滤掉熔断中的渠道，剩余渠道按健康分调整权重
+	channelIds := make([]int, 0, len(channels))
+	for _, channel := range channels {
+		channelIds = append(channelIds, channel.Id)
+	}
+	healthyIds, scores := filterHealthyChannels(channelIds, model)
+	if len(healthyIds) != len(channels) {
+		healthyChannels := make([]*Channel, 0, len(healthyIds))
+		for _, id := range healthyIds {
+			if channel, ok := channelsIDM[id]; ok {
+				healthyChannels = append(healthyChannels, channel)
+			}
+		}
+		channels = healthyChannels
+	}
+
 	uniquePriorities := make(map[int]bool)
 	for _, channel := range channels {
 		uniquePriorities[int(channel.GetPriority())] = true
@@ -117,6 +148,10 @@ func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Cha
 	}
 	sort.Sort(sort.Reverse(sort.IntSlice(sortedUniquePriorities)))
 
+	// 传入排除集合时，已失败的渠道已被剔除，剩余渠道中的最高优先级即为下一个应尝试的层级
+	if len(excluded) > 0 {
+		retry = 0
+	}
 	if retry >= len(uniquePriorities) {
 		retry = len(uniquePriorities) - 1
 	}
@@ -133,20 +168,27 @@ func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Cha
 	// 平滑系数
 	smoothingFactor := 10
 	// Calculate the total weight of all channels up to endIdx
-	totalWeight := 0
+	totalWeight := 0.0
 	for _, channel := range targetChannels {
-		totalWeight += channel.GetWeight() + smoothingFactor
+		totalWeight += float64(channel.GetWeight()+smoothingFactor) * scores[channel.Id]
 	}
 	// Generate a random value in the range [0, totalWeight)
-	randomWeight := rand.Intn(totalWeight)
+	randomWeight := rand.Float64() * totalWeight
 
 	// Find a channel based on its weight
 	for _, channel := range targetChannels {
-		randomWeight -= channel.GetWeight() + smoothingFactor
+		randomWeight -= float64(channel.GetWeight()+smoothingFactor) * scores[channel.Id]
 		if randomWeight < 0 {
+			acquireChannelHealth(channel.Id, model)
 			return channel, nil
 		}
 	}
+	// 浮点误差导致未选中时返回最后一个渠道
+	if len(targetChannels) > 0 {
+		channel := targetChannels[len(targetChannels)-1]
+		acquireChannelHealth(channel.Id, model)
+		return channel, nil
+	}
 	// return null if no channel is not found
 	return nil, errors.New("channel not found")
 }
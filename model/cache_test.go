@@ -0,0 +1,80 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"testing"
+	"veloera/common"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupPriorityTestDB(t *testing.T) {
+	t.Helper()
+	common.RedisEnabled = false
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&Channel{}, &Ability{}, &ChannelKey{}); err != nil {
+		t.Fatal(err)
+	}
+	DB = db
+	LOG_DB = db
+	initCol()
+	// 两个高优先级渠道 + 一个低优先级渠道
+	for _, ch := range []struct {
+		id       int
+		priority int64
+	}{{1, 10}, {2, 10}, {3, 0}} {
+		priority := ch.priority
+		channel := Channel{Id: ch.id, Name: "test", Key: "sk-test", Status: common.ChannelStatusEnabled, Group: "default", Models: "gpt-4o", Priority: &priority}
+		if err = DB.Create(&channel).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err = DB.Create(&Ability{Group: "default", Model: "gpt-4o", ChannelId: ch.id, Enabled: true, Priority: &priority}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// 排除一个高优先级渠道后，即使调用方传入了非零 retry，也应继续使用同层的另一个渠道，而不是跳到低优先级层级
+func TestRetryStaysInTierUntilExhausted(t *testing.T) {
+	setupPriorityTestDB(t)
+	defer func(enabled bool) { common.MemoryCacheEnabled = enabled }(common.MemoryCacheEnabled)
+	for _, memoryCache := range []bool{true, false} {
+		common.MemoryCacheEnabled = memoryCache
+		if memoryCache {
+			InitChannelCache()
+		}
+		channel, err := CacheGetRandomSatisfiedChannel("default", "gpt-4o", 1, map[int]bool{1: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if channel.Id != 2 {
+			t.Fatalf("memory cache %v: expected channel 2 in the same tier, got %d", memoryCache, channel.Id)
+		}
+		channel, err = CacheGetRandomSatisfiedChannel("default", "gpt-4o", 2, map[int]bool{1: true, 2: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if channel.Id != 3 {
+			t.Fatalf("memory cache %v: expected fallback to channel 3, got %d", memoryCache, channel.Id)
+		}
+	}
+}
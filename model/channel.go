@@ -28,7 +28,7 @@ import (
 type Channel struct {
 	Id                 int     `json:"id"`
 	Type               int     `json:"type" gorm:"default:0"`
-	Key                string  `json:"key" gorm:"not null"`
+	Key                string  `json:"key" gorm:"not null;serializer:channel_secret"`
 	OpenAIOrganization *string `json:"openai_organization"`
 	TestModel          *string `json:"test_model"`
 	Status             int     `json:"status" gorm:"default:1"`
@@ -130,6 +130,15 @@ func GetChannelsByTag(tag string, idSort bool) ([]*Channel, error) {
 	return channels, err
 }
 
+// channelKeywordCondition 按 id、名称或完整 key 搜索渠道。
+// 启用渠道密钥加密后数据库中只保存密文，无法按 key 匹配，此时只按 id 和名称搜索
+func channelKeywordCondition(keyword string) (string, []interface{}) {
+	if common.ChannelKeyEncryptionEnabled {
+		return "(id = ? OR name LIKE ?)", []interface{}{common.String2Int(keyword), "%" + keyword + "%"}
+	}
+	return "(id = ? OR name LIKE ? OR " + keyCol + " = ?)", []interface{}{common.String2Int(keyword), "%" + keyword + "%", keyword}
+}
+
 func SearchChannels(keyword string, group string, model string, idSort bool) ([]*Channel, error) {
 	var channels []*Channel
 	modelsCol := "`models`"
@@ -151,6 +160,7 @@ func SearchChannels(keyword string, group string, model string, idSort bool) ([]
 	// 构造WHERE子句
 	var whereClause string
 	var args []interface{}
+	keywordCondition, keywordArgs := channelKeywordCondition(keyword)
 	if group != "" && group != "null" {
 		var groupCondition string
 		if common.UsingMySQL {
@@ -159,11 +169,11 @@ func SearchChannels(keyword string, group string, model string, idSort bool) ([]
 			// sqlite, PostgreSQL
 			groupCondition = `(',' || ` + groupCol + ` || ',') LIKE ?`
 		}
-		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+model+"%", "%,"+group+",%")
+		whereClause = keywordCondition + " AND " + modelsCol + ` LIKE ? AND ` + groupCondition
+		args = append(keywordArgs, "%"+model+"%", "%,"+group+",%")
 	} else {
-		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ?) AND " + modelsCol + " LIKE ?"
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+model+"%")
+		whereClause = keywordCondition + " AND " + modelsCol + " LIKE ?"
+		args = append(keywordArgs, "%"+model+"%")
 	}
 
 	// 执行查询
@@ -303,7 +313,10 @@ func (channel *Channel) Delete() error {
 		return err
 	}
 	err = channel.DeleteAbilities()
-	return err
+	if err != nil {
+		return err
+	}
+	return DeleteChannelKeys(channel.Id)
 }
 
 var channelStatusLock sync.Mutex
@@ -478,6 +491,7 @@ func SearchTags(keyword string, group string, model string, idSort bool) ([]*str
 	// 构造WHERE子句
 	var whereClause string
 	var args []interface{}
+	keywordCondition, keywordArgs := channelKeywordCondition(keyword)
 	if group != "" && group != "null" {
 		var groupCondition string
 		if common.UsingMySQL {
@@ -486,11 +500,11 @@ func SearchTags(keyword string, group string, model string, idSort bool) ([]*str
 			// sqlite, PostgreSQL
 			groupCondition = `(',' || ` + groupCol + ` || ',') LIKE ?`
 		}
-		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+model+"%", "%,"+group+",%")
+		whereClause = keywordCondition + " AND " + modelsCol + ` LIKE ? AND ` + groupCondition
+		args = append(keywordArgs, "%"+model+"%", "%,"+group+",%")
 	} else {
-		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ?) AND " + modelsCol + " LIKE ?"
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+model+"%")
+		whereClause = keywordCondition + " AND " + modelsCol + " LIKE ?"
+		args = append(keywordArgs, "%"+model+"%")
 	}
 
 	subQuery := baseQuery.Where(whereClause, args...).
@@ -586,3 +600,20 @@ func BatchSetChannelTag(ids []int, tag *string) error {
 	// 提交事务
 	return tx.Commit().Error
 }
+
+// CountChannelsByStatus 按状态统计渠道数量
+func CountChannelsByStatus() (map[int]int64, error) {
+	var rows []struct {
+		Status int
+		Count  int64
+	}
+	err := DB.Model(&Channel{}).Select("status, count(*) as count").Group("status").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
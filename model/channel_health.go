@@ -0,0 +1,412 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"veloera/setting/operation_setting"
+)
+
+// 渠道健康度只保存在当前节点的内存中，按渠道和渠道+模型两个维度统计，
+// 熔断状态: closed 正常 -> open 熔断，从渠道池中移除 -> half_open 放行少量探测请求 -> closed
+const (
+	CircuitStateClosed   = "closed"
+	CircuitStateOpen     = "open"
+	CircuitStateHalfOpen = "half_open"
+)
+
+const channelHealthBucketCount = 10
+
+type ChannelResult struct {
+	Success     bool
+	RateLimited bool
+	LatencyMs   int64
+}
+
+type channelHealthBucket struct {
+	index        int64
+	requests     int
+	failures     int
+	rateLimited  int
+	latencySum   int64
+	latencyCount int
+}
+
+type channelHealth struct {
+	mutex               sync.Mutex
+	buckets             [channelHealthBucketCount]channelHealthBucket
+	state               string
+	consecutiveFailures int
+	openedAt            time.Time
+	openDuration        time.Duration
+	trips               int
+	probes              int
+	probeStartedAt      time.Time
+	halfOpenSuccesses   int
+}
+
+type ChannelHealthInfo struct {
+	ChannelId           int     `json:"channel_id"`
+	Model               string  `json:"model,omitempty"`
+	State               string  `json:"state"`
+	Score               float64 `json:"score"`
+	Requests            int     `json:"requests"`
+	Failures            int     `json:"failures"`
+	RateLimited         int     `json:"rate_limited"`
+	AvgLatencyMs        int64   `json:"avg_latency_ms"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	OpenUntil           int64   `json:"open_until,omitempty"`
+}
+
+var channelHealthMap sync.Map
+
+func channelHealthKey(channelId int, modelName string) string {
+	if modelName == "" {
+		return strconv.Itoa(channelId)
+	}
+	return fmt.Sprintf("%d:%s", channelId, modelName)
+}
+
+func getChannelHealth(key string, create bool) *channelHealth {
+	if value, ok := channelHealthMap.Load(key); ok {
+		return value.(*channelHealth)
+	}
+	if !create {
+		return nil
+	}
+	value, _ := channelHealthMap.LoadOrStore(key, &channelHealth{state: CircuitStateClosed})
+	return value.(*channelHealth)
+}
+
+func bucketDuration(setting *operation_setting.ChannelHealthSetting) time.Duration {
+	windowSeconds := setting.WindowSeconds
+	if windowSeconds < channelHealthBucketCount {
+		windowSeconds = channelHealthBucketCount
+	}
+	return time.Duration(windowSeconds) * time.Second / channelHealthBucketCount
+}
+
+// summary 汇总滑动窗口内的统计，调用方需持有锁
+func (h *channelHealth) summary(now time.Time, setting *operation_setting.ChannelHealthSetting) (requests, failures, rateLimited int, avgLatency int64) {
+	current := now.UnixNano() / int64(bucketDuration(setting))
+	var latencySum int64
+	latencyCount := 0
+	for _, bucket := range h.buckets {
+		if current-bucket.index >= channelHealthBucketCount {
+			continue
+		}
+		requests += bucket.requests
+		failures += bucket.failures
+		rateLimited += bucket.rateLimited
+		latencySum += bucket.latencySum
+		latencyCount += bucket.latencyCount
+	}
+	if latencyCount > 0 {
+		avgLatency = latencySum / int64(latencyCount)
+	}
+	return
+}
+
+func (h *channelHealth) errorRate(requests, failures, rateLimited int, setting *operation_setting.ChannelHealthSetting) float64 {
+	if requests == 0 {
+		return 0
+	}
+	weighted := float64(failures-rateLimited) + float64(rateLimited)*setting.RateLimitPenalty
+	return weighted / float64(requests)
+}
+
+func (h *channelHealth) open(now time.Time, setting *operation_setting.ChannelHealthSetting) {
+	h.trips++
+	duration := time.Duration(setting.OpenSeconds) * time.Second
+	for i := 1; i < h.trips && duration < time.Duration(setting.MaxOpenSeconds)*time.Second; i++ {
+		duration *= 2
+	}
+	if maxDuration := time.Duration(setting.MaxOpenSeconds) * time.Second; maxDuration > 0 && duration > maxDuration {
+		duration = maxDuration
+	}
+	h.state = CircuitStateOpen
+	h.openedAt = now
+	h.openDuration = duration
+	h.probes = 0
+	h.halfOpenSuccesses = 0
+}
+
+func (h *channelHealth) close() {
+	h.state = CircuitStateClosed
+	h.trips = 0
+	h.probes = 0
+	h.halfOpenSuccesses = 0
+	h.consecutiveFailures = 0
+	h.buckets = [channelHealthBucketCount]channelHealthBucket{}
+}
+
+func (h *channelHealth) record(result ChannelResult, now time.Time, setting *operation_setting.ChannelHealthSetting) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	index := now.UnixNano() / int64(bucketDuration(setting))
+	bucket := &h.buckets[index%channelHealthBucketCount]
+	if bucket.index != index {
+		*bucket = channelHealthBucket{index: index}
+	}
+	bucket.requests++
+	if result.LatencyMs > 0 {
+		bucket.latencySum += result.LatencyMs
+		bucket.latencyCount++
+	}
+	if h.state == CircuitStateHalfOpen && h.probes > 0 {
+		h.probes--
+	}
+	if result.Success {
+		h.consecutiveFailures = 0
+		if h.state == CircuitStateHalfOpen {
+			h.halfOpenSuccesses++
+			if h.halfOpenSuccesses >= setting.HalfOpenSuccesses {
+				h.close()
+			}
+		}
+		return
+	}
+	bucket.failures++
+	if result.RateLimited {
+		bucket.rateLimited++
+	}
+	h.consecutiveFailures++
+	switch h.state {
+	case CircuitStateHalfOpen:
+		// 探测失败，重新熔断并延长等待时间
+		h.open(now, setting)
+	case CircuitStateClosed:
+		if setting.ConsecutiveFailures > 0 && h.consecutiveFailures >= setting.ConsecutiveFailures {
+			h.open(now, setting)
+			return
+		}
+		requests, failures, rateLimited, _ := h.summary(now, setting)
+		if requests >= setting.MinRequests && h.errorRate(requests, failures, rateLimited, setting) >= setting.ErrorRateThreshold {
+			h.open(now, setting)
+		}
+	}
+}
+
+// available 判断是否可以把请求分配给该渠道，调用方需持有锁
+func (h *channelHealth) available(now time.Time, setting *operation_setting.ChannelHealthSetting) bool {
+	switch h.state {
+	case CircuitStateOpen:
+		if now.Before(h.openedAt.Add(h.openDuration)) {
+			return false
+		}
+		return setting.HalfOpenProbes > 0
+	case CircuitStateHalfOpen:
+		// 探测请求长时间没有结果时释放名额
+		if h.probes > 0 && now.Sub(h.probeStartedAt) > h.openDuration+time.Minute {
+			h.probes = 0
+		}
+		return h.probes < setting.HalfOpenProbes
+	}
+	return true
+}
+
+func (h *channelHealth) acquire(now time.Time, setting *operation_setting.ChannelHealthSetting) {
+	if h.state == CircuitStateOpen && !now.Before(h.openedAt.Add(h.openDuration)) {
+		h.state = CircuitStateHalfOpen
+		h.halfOpenSuccesses = 0
+		h.probes = 0
+	}
+	if h.state == CircuitStateHalfOpen {
+		h.probes++
+		h.probeStartedAt = now
+	}
+}
+
+// release 归还半开状态下占用的探测名额
+func (h *channelHealth) release() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.state == CircuitStateHalfOpen && h.probes > 0 {
+		h.probes--
+	}
+}
+
+func (h *channelHealth) score(now time.Time, setting *operation_setting.ChannelHealthSetting) float64 {
+	requests, failures, rateLimited, avgLatency := h.summary(now, setting)
+	score := 1.0
+	if requests > 0 {
+		score -= h.errorRate(requests, failures, rateLimited, setting)
+	}
+	if setting.SlowLatencyMs > 0 && avgLatency > int64(setting.SlowLatencyMs) {
+		score *= float64(setting.SlowLatencyMs) / float64(avgLatency)
+	}
+	if h.state != CircuitStateClosed {
+		score *= 0.5
+	}
+	// 保留最低权重，避免健康度恢复后长时间选不到
+	if score < 0.05 {
+		score = 0.05
+	}
+	return score
+}
+
+func (h *channelHealth) info(now time.Time, setting *operation_setting.ChannelHealthSetting) ChannelHealthInfo {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	requests, failures, rateLimited, avgLatency := h.summary(now, setting)
+	info := ChannelHealthInfo{
+		State:               h.state,
+		Score:               h.score(now, setting),
+		Requests:            requests,
+		Failures:            failures,
+		RateLimited:         rateLimited,
+		AvgLatencyMs:        avgLatency,
+		ConsecutiveFailures: h.consecutiveFailures,
+	}
+	if h.state == CircuitStateOpen {
+		info.OpenUntil = h.openedAt.Add(h.openDuration).Unix()
+	}
+	return info
+}
+
+// RecordChannelResult 记录一次渠道请求的结果，同时更新渠道和渠道+模型两个维度的健康度
+func RecordChannelResult(channelId int, modelName string, result ChannelResult) {
+	setting := operation_setting.GetChannelHealthSetting()
+	if !setting.Enabled {
+		return
+	}
+	now := time.Now()
+	getChannelHealth(channelHealthKey(channelId, ""), true).record(result, now, setting)
+	if modelName != "" {
+		getChannelHealth(channelHealthKey(channelId, modelName), true).record(result, now, setting)
+	}
+}
+
+// channelHealthWeight 返回渠道当前是否可用以及用于加权随机的健康分
+func channelHealthWeight(channelId int, modelName string, now time.Time, setting *operation_setting.ChannelHealthSetting) (bool, float64) {
+	score := 1.0
+	for _, key := range []string{channelHealthKey(channelId, ""), channelHealthKey(channelId, modelName)} {
+		health := getChannelHealth(key, false)
+		if health == nil {
+			continue
+		}
+		health.mutex.Lock()
+		available := health.available(now, setting)
+		if s := health.score(now, setting); s < score {
+			score = s
+		}
+		health.mutex.Unlock()
+		if !available {
+			return false, 0
+		}
+	}
+	return true, score
+}
+
+// acquireChannelHealth 渠道被选中时调用，半开状态下占用探测名额
+func acquireChannelHealth(channelId int, modelName string) {
+	setting := operation_setting.GetChannelHealthSetting()
+	if !setting.Enabled {
+		return
+	}
+	now := time.Now()
+	for _, key := range []string{channelHealthKey(channelId, ""), channelHealthKey(channelId, modelName)} {
+		if health := getChannelHealth(key, false); health != nil {
+			health.mutex.Lock()
+			health.acquire(now, setting)
+			health.mutex.Unlock()
+		}
+	}
+}
+
+// ReleaseChannelHealth 请求没有访问上游或结果不计入健康度时调用，归还 acquireChannelHealth 占用的探测名额
+func ReleaseChannelHealth(channelId int, modelName string) {
+	setting := operation_setting.GetChannelHealthSetting()
+	if !setting.Enabled {
+		return
+	}
+	for _, key := range []string{channelHealthKey(channelId, ""), channelHealthKey(channelId, modelName)} {
+		if health := getChannelHealth(key, false); health != nil {
+			health.release()
+		}
+	}
+}
+
+// filterHealthyChannels 过滤掉熔断中的渠道并返回对应的健康分，全部熔断时返回全部渠道，避免因熔断导致无渠道可用
+func filterHealthyChannels(channelIds []int, modelName string) ([]int, map[int]float64) {
+	setting := operation_setting.GetChannelHealthSetting()
+	scores := make(map[int]float64, len(channelIds))
+	if !setting.Enabled {
+		for _, id := range channelIds {
+			scores[id] = 1
+		}
+		return channelIds, scores
+	}
+	now := time.Now()
+	healthy := make([]int, 0, len(channelIds))
+	for _, id := range channelIds {
+		available, score := channelHealthWeight(id, modelName, now, setting)
+		if available {
+			healthy = append(healthy, id)
+			scores[id] = score
+		}
+	}
+	if len(healthy) == 0 {
+		for _, id := range channelIds {
+			scores[id] = 1
+		}
+		return channelIds, scores
+	}
+	return healthy, scores
+}
+
+// GetChannelHealthInfos 返回当前节点上所有渠道的健康度，channelId 为 0 时返回全部
+func GetChannelHealthInfos(channelId int) []ChannelHealthInfo {
+	setting := operation_setting.GetChannelHealthSetting()
+	now := time.Now()
+	infos := make([]ChannelHealthInfo, 0)
+	channelHealthMap.Range(func(key, value any) bool {
+		idStr, modelName, _ := strings.Cut(key.(string), ":")
+		id, _ := strconv.Atoi(idStr)
+		if channelId != 0 && id != channelId {
+			return true
+		}
+		info := value.(*channelHealth).info(now, setting)
+		info.ChannelId = id
+		info.Model = modelName
+		infos = append(infos, info)
+		return true
+	})
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].ChannelId != infos[j].ChannelId {
+			return infos[i].ChannelId < infos[j].ChannelId
+		}
+		return infos[i].Model < infos[j].Model
+	})
+	return infos
+}
+
+// ResetChannelHealth 清除渠道的健康度统计和熔断状态，例如管理员手动启用渠道后
+func ResetChannelHealth(channelId int) {
+	prefix := strconv.Itoa(channelId) + ":"
+	channelHealthMap.Range(func(key, value any) bool {
+		if k := key.(string); k == strconv.Itoa(channelId) || strings.HasPrefix(k, prefix) {
+			channelHealthMap.Delete(key)
+		}
+		return true
+	})
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"testing"
+	"time"
+	"veloera/setting/operation_setting"
+)
+
+// 半开状态的探测请求没有计入结果时也要归还名额，否则渠道会一直被排除
+func TestReleaseChannelHealthFreesHalfOpenProbe(t *testing.T) {
+	setting := operation_setting.GetChannelHealthSetting()
+	old := *setting
+	t.Cleanup(func() {
+		*setting = old
+		ResetChannelHealth(9001)
+	})
+	setting.Enabled = true
+	setting.ConsecutiveFailures = 1
+	setting.OpenSeconds = 0
+	setting.HalfOpenProbes = 1
+
+	RecordChannelResult(9001, "gpt-4o", ChannelResult{Success: false})
+	acquireChannelHealth(9001, "gpt-4o")
+	if available, _ := channelHealthWeight(9001, "gpt-4o", time.Now(), setting); available {
+		t.Fatal("probe slot should be taken after acquire")
+	}
+	ReleaseChannelHealth(9001, "gpt-4o")
+	if available, _ := channelHealthWeight(9001, "gpt-4o", time.Now(), setting); !available {
+		t.Fatal("probe slot should be released")
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"veloera/common"
+)
+
+// 多 key 渠道中单个 key 的状态，只为冷却中或已禁用的 key 保存记录，启用 key 即删除记录
+const (
+	ChannelKeyStatusActive      = "active"
+	ChannelKeyStatusCoolingDown = "cooling_down"
+	ChannelKeyStatusDisabled    = "disabled"
+
+	// ChannelKeysDisabledReason 全部 key 被禁用导致渠道被自动禁用时的原因前缀，重新启用 key 时据此恢复渠道
+	ChannelKeysDisabledReason = "all keys disabled: "
+)
+
+type ChannelKey struct {
+	Id            int    `json:"id"`
+	ChannelId     int    `json:"channel_id" gorm:"uniqueIndex:idx_channel_key_hash"`
+	KeyHash       string `json:"-" gorm:"type:varchar(64);uniqueIndex:idx_channel_key_hash"`
+	Disabled      bool   `json:"disabled"`
+	Reason        string `json:"reason" gorm:"type:varchar(255)"`
+	CooldownUntil int64  `json:"cooldown_until" gorm:"bigint"`
+	UpdatedTime   int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// ChannelKeyInfo 返回给管理端的 key 状态，使用 key 在渠道中的序号标识，不返回 key 的摘要
+type ChannelKeyInfo struct {
+	Index         int    `json:"index"`
+	Key           string `json:"key"`
+	Status        string `json:"status"`
+	Reason        string `json:"reason"`
+	CooldownUntil int64  `json:"cooldown_until"`
+	UpdatedTime   int64  `json:"updated_time"`
+}
+
+var (
+	channelKeysLock  sync.RWMutex
+	channelKeysCache = make(map[int]map[string]*ChannelKey) // channel_id -> key_hash -> state
+)
+
+// GetChannelKeyHash 用于标识多 key 渠道中的单个 key，key 顺序变化时不受影响。
+// 使用 CRYPTO_SECRET 作为 HMAC 密钥，数据库泄露时无法通过摘要反查 key
+func GetChannelKeyHash(key string) string {
+	return common.GenerateHMAC(strings.TrimSpace(key))
+}
+
+// legacyChannelKeyHashes 返回 key 在旧版本（MD5）及旧 CRYPTO_SECRET 下的摘要，用于迁移已有的 key 状态
+func legacyChannelKeyHashes(key string) []string {
+	key = strings.TrimSpace(key)
+	hashes := []string{common.GetMD5Hash(key)}
+	for _, secret := range common.CryptoSecretOld {
+		hashes = append(hashes, common.GenerateHMACWithKey([]byte(secret), key))
+	}
+	return hashes
+}
+
+// GetChannelKeyHashes 按序号返回渠道中 key 的摘要，序号越界时返回错误
+func GetChannelKeyHashes(channel *Channel, indexes []int) ([]string, error) {
+	keys := SplitChannelKeys(channel)
+	hashes := make([]string, 0, len(indexes))
+	for _, index := range indexes {
+		if index < 0 || index >= len(keys) {
+			return nil, fmt.Errorf("invalid key index: %d", index)
+		}
+		hashes = append(hashes, GetChannelKeyHash(keys[index]))
+	}
+	return hashes, nil
+}
+
+// MigrateChannelKeyHashes 将以旧摘要保存的 key 状态更新为当前摘要，避免升级或轮换 CRYPTO_SECRET 后已禁用的 key 被重新启用
+func MigrateChannelKeyHashes() error {
+	var channelIds []int
+	if err := DB.Model(&ChannelKey{}).Distinct("channel_id").Pluck("channel_id", &channelIds).Error; err != nil {
+		return err
+	}
+	migrated := 0
+	for _, channelId := range channelIds {
+		channel, err := GetChannelById(channelId, true)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to migrate key states of channel #%d: %s", channelId, err.Error()))
+			continue
+		}
+		for _, key := range SplitChannelKeys(channel) {
+			result := DB.Model(&ChannelKey{}).
+				Where("channel_id = ? AND key_hash IN ?", channelId, legacyChannelKeyHashes(key)).
+				Update("key_hash", GetChannelKeyHash(key))
+			if result.Error != nil {
+				common.SysError(fmt.Sprintf("failed to migrate key states of channel #%d: %s", channelId, result.Error.Error()))
+				continue
+			}
+			migrated += int(result.RowsAffected)
+		}
+	}
+	if migrated > 0 {
+		common.SysLog(fmt.Sprintf("channel key states: %d migrated", migrated))
+	}
+	return nil
+}
+
+// SplitChannelKeys 按逗号拆分多 key 渠道的 key
+func SplitChannelKeys(channel *Channel) []string {
+	keys := strings.Split(channel.Key, ",")
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key != "" {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+func (k *ChannelKey) Status(now int64) string {
+	if k == nil {
+		return ChannelKeyStatusActive
+	}
+	if k.Disabled {
+		return ChannelKeyStatusDisabled
+	}
+	if k.CooldownUntil > now {
+		return ChannelKeyStatusCoolingDown
+	}
+	return ChannelKeyStatusActive
+}
+
+func initChannelKeyCache() {
+	var keys []*ChannelKey
+	if err := DB.Find(&keys).Error; err != nil {
+		common.SysError("failed to load channel keys: " + err.Error())
+		return
+	}
+	newCache := make(map[int]map[string]*ChannelKey)
+	for _, key := range keys {
+		if newCache[key.ChannelId] == nil {
+			newCache[key.ChannelId] = make(map[string]*ChannelKey)
+		}
+		newCache[key.ChannelId][key.KeyHash] = key
+	}
+	channelKeysLock.Lock()
+	channelKeysCache = newCache
+	channelKeysLock.Unlock()
+}
+
+// GetChannelKeyStates 返回渠道中非正常状态的 key，开启内存缓存时从缓存读取
+func GetChannelKeyStates(channelId int) map[string]*ChannelKey {
+	states := make(map[string]*ChannelKey)
+	if common.MemoryCacheEnabled {
+		channelKeysLock.RLock()
+		defer channelKeysLock.RUnlock()
+		for hash, key := range channelKeysCache[channelId] {
+			keyCopy := *key
+			states[hash] = &keyCopy
+		}
+		return states
+	}
+	var keys []*ChannelKey
+	if err := DB.Where("channel_id = ?", channelId).Find(&keys).Error; err != nil {
+		common.SysError("failed to load channel keys: " + err.Error())
+		return states
+	}
+	for _, key := range keys {
+		states[key.KeyHash] = key
+	}
+	return states
+}
+
+func saveChannelKey(key *ChannelKey) error {
+	key.UpdatedTime = common.GetTimestamp()
+	if len(key.Reason) > 255 {
+		key.Reason = key.Reason[:255]
+	}
+	var existing ChannelKey
+	err := DB.Where("channel_id = ? AND key_hash = ?", key.ChannelId, key.KeyHash).First(&existing).Error
+	if err == nil {
+		key.Id = existing.Id
+		err = DB.Save(key).Error
+	} else {
+		err = DB.Create(key).Error
+	}
+	if err != nil {
+		return err
+	}
+	channelKeysLock.Lock()
+	if channelKeysCache[key.ChannelId] == nil {
+		channelKeysCache[key.ChannelId] = make(map[string]*ChannelKey)
+	}
+	keyCopy := *key
+	channelKeysCache[key.ChannelId][key.KeyHash] = &keyCopy
+	channelKeysLock.Unlock()
+	return nil
+}
+
+// CoolDownChannelKey 使 key 在 until 之前不再被选中
+func CoolDownChannelKey(channelId int, keyHash string, until int64, reason string) error {
+	states := GetChannelKeyStates(channelId)
+	if state, ok := states[keyHash]; ok && state.Disabled {
+		return nil
+	}
+	return saveChannelKey(&ChannelKey{
+		ChannelId:     channelId,
+		KeyHash:       keyHash,
+		Reason:        reason,
+		CooldownUntil: until,
+	})
+}
+
+// DisableChannelKey 禁用 key，需要管理员手动启用
+func DisableChannelKey(channelId int, keyHash string, reason string) error {
+	return saveChannelKey(&ChannelKey{
+		ChannelId: channelId,
+		KeyHash:   keyHash,
+		Disabled:  true,
+		Reason:    reason,
+	})
+}
+
+// EnableChannelKeys 启用指定的 key，keyHashes 为空时启用渠道的全部 key
+func EnableChannelKeys(channelId int, keyHashes []string) error {
+	query := DB.Where("channel_id = ?", channelId)
+	if len(keyHashes) > 0 {
+		query = query.Where("key_hash IN ?", keyHashes)
+	}
+	if err := query.Delete(&ChannelKey{}).Error; err != nil {
+		return err
+	}
+	channelKeysLock.Lock()
+	defer channelKeysLock.Unlock()
+	if len(keyHashes) == 0 {
+		delete(channelKeysCache, channelId)
+		return nil
+	}
+	for _, hash := range keyHashes {
+		delete(channelKeysCache[channelId], hash)
+	}
+	return nil
+}
+
+// DeleteChannelKeys 删除渠道时清理 key 状态
+func DeleteChannelKeys(channelId int) error {
+	return EnableChannelKeys(channelId, nil)
+}
+
+// IsChannelKeyAvailable 判断 key 是否可以被选中
+func IsChannelKeyAvailable(states map[string]*ChannelKey, keyHash string, now int64) bool {
+	return states[keyHash].Status(now) == ChannelKeyStatusActive
+}
+
+// GetChannelKeyInfos 返回渠道中每个 key 的状态，key 只显示首尾几位
+func GetChannelKeyInfos(channel *Channel) []ChannelKeyInfo {
+	states := GetChannelKeyStates(channel.Id)
+	now := common.GetTimestamp()
+	keys := SplitChannelKeys(channel)
+	infos := make([]ChannelKeyInfo, 0, len(keys))
+	for i, key := range keys {
+		state := states[GetChannelKeyHash(key)]
+		info := ChannelKeyInfo{
+			Index:  i,
+			Key:    maskChannelKey(key),
+			Status: state.Status(now),
+		}
+		if state != nil {
+			info.Reason = state.Reason
+			info.CooldownUntil = state.CooldownUntil
+			info.UpdatedTime = state.UpdatedTime
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func maskChannelKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:4] + strings.Repeat("*", 4) + key[len(key)-4:]
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"testing"
+	"veloera/common"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// 升级前以 MD5 保存的 key 状态在迁移后仍然生效
+func TestMigrateChannelKeyHashes(t *testing.T) {
+	common.RedisEnabled = false
+	common.MemoryCacheEnabled = false
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&Channel{}, &ChannelKey{}); err != nil {
+		t.Fatal(err)
+	}
+	DB = db
+	channel := Channel{Id: 1, Name: "multi", Key: "sk-a,sk-b"}
+	if err = DB.Create(&channel).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = DB.Create(&ChannelKey{ChannelId: 1, KeyHash: common.GetMD5Hash("sk-b"), Disabled: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = MigrateChannelKeyHashes(); err != nil {
+		t.Fatal(err)
+	}
+	infos := GetChannelKeyInfos(&channel)
+	if infos[0].Status != ChannelKeyStatusActive || infos[1].Status != ChannelKeyStatusDisabled {
+		t.Fatalf("expected only the second key to be disabled, got %+v", infos)
+	}
+	hashes, err := GetChannelKeyHashes(&channel, []int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashes[0] == common.GetMD5Hash("sk-b") {
+		t.Fatal("expected key hash to be keyed by CRYPTO_SECRET")
+	}
+	if _, err = GetChannelKeyHashes(&channel, []int{2}); err == nil {
+		t.Fatal("expected out of range index to be rejected")
+	}
+}
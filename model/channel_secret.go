@@ -0,0 +1,108 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"veloera/common"
+
+	"gorm.io/gorm/schema"
+)
+
+// ChannelSecretSerializer 在读写数据库时透明地加解密渠道密钥，
+// 内存中的 Channel.Key 始终为明文，数据库中保存 common.EncryptSecret 的输出
+type ChannelSecretSerializer struct{}
+
+func init() {
+	schema.RegisterSerializer("channel_secret", ChannelSecretSerializer{})
+}
+
+func (ChannelSecretSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		return fmt.Errorf("unsupported channel key type: %T", dbValue)
+	}
+	plaintext, err := common.DecryptSecret(value)
+	if err != nil {
+		// 不能回退为密文，否则密文会被当作 key 发往上游或返回给前端
+		return fmt.Errorf("failed to decrypt channel key: %w", err)
+	}
+	field.ReflectValueOf(ctx, dst).SetString(plaintext)
+	return nil
+}
+
+func (ChannelSecretSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, _ := fieldValue.(string)
+	if !common.ChannelKeyEncryptionEnabled {
+		return value, nil
+	}
+	return common.EncryptSecret(value)
+}
+
+type channelSecretRow struct {
+	Id  int
+	Key string
+}
+
+// MigrateChannelKeyEncryption 加密数据库中仍为明文的渠道密钥，
+// 并将旧 CRYPTO_SECRET 加密的密钥轮换到当前 CRYPTO_SECRET
+func MigrateChannelKeyEncryption() error {
+	if !common.ChannelKeyEncryptionEnabled {
+		return nil
+	}
+	var rows []channelSecretRow
+	// 直接读取原始列，绕过 serializer
+	err := DB.Table("channels").Select("id, " + keyCol).Find(&rows).Error
+	if err != nil {
+		return err
+	}
+	encrypted, rotated := 0, 0
+	for _, row := range rows {
+		var value string
+		switch {
+		case row.Key == "":
+			continue
+		case !common.IsEncryptedSecret(row.Key):
+			value, err = common.EncryptSecret(row.Key)
+			encrypted++
+		case common.SecretNeedsRotation(row.Key):
+			value, err = common.RotateSecret(row.Key)
+			rotated++
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("channel #%d: %w", row.Id, err)
+		}
+		err = DB.Table("channels").Where("id = ?", row.Id).Update("key", value).Error
+		if err != nil {
+			return fmt.Errorf("channel #%d: %w", row.Id, err)
+		}
+	}
+	if encrypted > 0 || rotated > 0 {
+		common.SysLog(fmt.Sprintf("channel key encryption: %d encrypted, %d rotated", encrypted, rotated))
+	}
+	return nil
+}
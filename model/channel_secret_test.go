@@ -0,0 +1,112 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"testing"
+	"veloera/common"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupChannelSecretTestDB(t *testing.T) {
+	t.Helper()
+	common.RedisEnabled = false
+	prevEnabled, prevSecret, prevOld := common.ChannelKeyEncryptionEnabled, common.CryptoSecret, common.CryptoSecretOld
+	common.ChannelKeyEncryptionEnabled, common.CryptoSecret, common.CryptoSecretOld = true, "secret-a", nil
+	t.Cleanup(func() {
+		common.ChannelKeyEncryptionEnabled, common.CryptoSecret, common.CryptoSecretOld = prevEnabled, prevSecret, prevOld
+	})
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&Channel{}); err != nil {
+		t.Fatal(err)
+	}
+	DB = db
+	initCol()
+}
+
+func rawChannelKey(t *testing.T, id int) string {
+	t.Helper()
+	var row channelSecretRow
+	if err := DB.Table("channels").Select("id, "+keyCol).Where("id = ?", id).Find(&row).Error; err != nil {
+		t.Fatal(err)
+	}
+	return row.Key
+}
+
+func TestMigrateChannelKeyEncryptionIsIdempotent(t *testing.T) {
+	setupChannelSecretTestDB(t)
+	// 模拟启用加密前写入的明文密钥
+	if err := DB.Table("channels").Create(map[string]interface{}{"id": 1, "name": "plain", "key": "sk-plain"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateChannelKeyEncryption(); err != nil {
+		t.Fatal(err)
+	}
+	first := rawChannelKey(t, 1)
+	if !common.IsEncryptedSecret(first) {
+		t.Fatalf("expected key to be encrypted after migration, got %q", first)
+	}
+	if err := MigrateChannelKeyEncryption(); err != nil {
+		t.Fatal(err)
+	}
+	if second := rawChannelKey(t, 1); second != first {
+		t.Fatalf("expected second migration to leave key unchanged, got %q", second)
+	}
+	channel, err := GetChannelById(1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channel.Key != "sk-plain" {
+		t.Fatalf("expected decrypted key, got %q", channel.Key)
+	}
+
+	// 轮换 CRYPTO_SECRET 后迁移只重新包裹一次
+	common.CryptoSecret, common.CryptoSecretOld = "secret-b", []string{"secret-a"}
+	if err = MigrateChannelKeyEncryption(); err != nil {
+		t.Fatal(err)
+	}
+	rotated := rawChannelKey(t, 1)
+	if rotated == first || common.SecretNeedsRotation(rotated) {
+		t.Fatalf("expected key to be rotated to current secret, got %q", rotated)
+	}
+	if err = MigrateChannelKeyEncryption(); err != nil {
+		t.Fatal(err)
+	}
+	if again := rawChannelKey(t, 1); again != rotated {
+		t.Fatalf("expected rotated key to stay unchanged, got %q", again)
+	}
+}
+
+func TestChannelKeyDecryptFailureDoesNotLeakCiphertext(t *testing.T) {
+	setupChannelSecretTestDB(t)
+	if err := DB.Create(&Channel{Id: 1, Name: "encrypted", Key: "sk-secret"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	common.CryptoSecret = "secret-b"
+	channel, err := GetChannelById(1, true)
+	if err == nil {
+		t.Fatal("expected decrypt failure to be reported")
+	}
+	if channel != nil && channel.Key != "" {
+		t.Fatalf("expected no key after decrypt failure, got %q", channel.Key)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"veloera/common"
+
+	"gorm.io/gorm"
+)
+
+// configSyncChannelColumns 是配置同步时允许覆盖的渠道字段，不包含余额、用量、测速等运行时状态
+var configSyncChannelColumns = []string{
+	"type", "key", "open_ai_organization", "test_model", "status", "name", "weight",
+	"base_url", "other", "models", "group", "model_mapping", "status_code_mapping",
+	"priority", "auto_ban", "other_info", "tag", "setting", "param_override", "model_prefix",
+}
+
+// ApplyConfigSync 在同一个事务中创建、更新、删除渠道并重建对应的 abilities，同时写入 options，
+// 任一步失败则全部回滚；事务提交后再刷新内存中的 option 与 model 包内由渠道派生的缓存，
+// 前缀缓存位于 middleware，由调用方刷新
+func ApplyConfigSync(creates []*Channel, updates []*Channel, deleteIds []int, options map[string]string) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		for _, channel := range creates {
+			if err := tx.Create(channel).Error; err != nil {
+				return err
+			}
+			if err := channel.UpdateAbilities(tx); err != nil {
+				return err
+			}
+		}
+		for _, channel := range updates {
+			if err := tx.Model(channel).Select(configSyncChannelColumns).Updates(channel).Error; err != nil {
+				return err
+			}
+			if err := channel.UpdateAbilities(tx); err != nil {
+				return err
+			}
+		}
+		if len(deleteIds) > 0 {
+			if err := tx.Where("id in (?)", deleteIds).Delete(&Channel{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("channel_id in (?)", deleteIds).Delete(&Ability{}).Error; err != nil {
+				return err
+			}
+		}
+		for key, value := range options {
+			if err := tx.Save(&Option{Key: key, Value: value}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range deleteIds {
+		if err := DeleteChannelKeys(id); err != nil {
+			common.SysError("failed to delete channel keys: " + err.Error())
+		}
+		ResetChannelHealth(id)
+	}
+	for key, value := range options {
+		if err := updateOptionMap(key, value); err != nil {
+			common.SysError("failed to update option map: " + err.Error())
+		}
+	}
+	if common.MemoryCacheEnabled {
+		InitChannelCache()
+	}
+	InvalidatePricing()
+	return nil
+}
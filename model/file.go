@@ -0,0 +1,73 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"errors"
+	"os"
+	"veloera/common"
+)
+
+type File struct {
+	Id          int    `json:"id"`
+	FileId      string `json:"file_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	Filename    string `json:"filename"`
+	Purpose     string `json:"purpose" gorm:"type:varchar(32);index"`
+	Bytes       int64  `json:"bytes"`
+	StoragePath string `json:"-"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint"`
+}
+
+func (file *File) Insert() error {
+	return DB.Create(file).Error
+}
+
+// Delete 删除文件记录和磁盘上的文件
+func (file *File) Delete() error {
+	err := DB.Delete(file).Error
+	if err != nil {
+		return err
+	}
+	if file.StoragePath != "" {
+		if err = os.Remove(file.StoragePath); err != nil && !os.IsNotExist(err) {
+			common.SysError("failed to remove file " + file.StoragePath + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+func GetUserFileByFileId(userId int, fileId string) (*File, error) {
+	if fileId == "" {
+		return nil, errors.New("file id 为空！")
+	}
+	var file File
+	err := DB.Where("user_id = ? AND file_id = ?", userId, fileId).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+func GetUserFiles(userId int, purpose string, limit int) (files []*File, err error) {
+	query := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	err = query.Order("id desc").Limit(limit).Find(&files).Error
+	return files, err
+}
@@ -48,6 +48,7 @@ type Log struct {
 	TokenId          int    `json:"token_id" gorm:"default:0;index"`
 	Group            string `json:"group" gorm:"index"`
 	Other            string `json:"other"`
+	OrganizationId   int    `json:"organization_id" gorm:"default:0;index"`
 }
 
 const (
@@ -164,6 +165,7 @@ func RecordConsumeLog(c *gin.Context, userId int, channelId int, promptTokens in
 		IsStream:         isStream,
 		Group:            group,
 		Other:            otherStr,
+		OrganizationId:   c.GetInt("organization_id"),
 	}
 	err := LOG_DB.Create(log).Error
 	if err != nil {
@@ -364,3 +366,88 @@ func DeleteOldLog(targetTimestamp int64) (int64, error) {
 	result := LOG_DB.Where("created_at < ?", targetTimestamp).Delete(&Log{})
 	return result.RowsAffected, result.Error
 }
+
+func GetOrganizationLogs(organizationId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int) (logs []*Log, total int64, err error) {
+	tx := LOG_DB.Where("logs.organization_id = ?", organizationId)
+	if logType != LogTypeUnknown {
+		tx = tx.Where("logs.type = ?", logType)
+	}
+	if modelName != "" {
+		tx = tx.Where("logs.model_name like ?", modelName)
+	}
+	if username != "" {
+		tx = tx.Where("logs.username = ?", username)
+	}
+	if tokenName != "" {
+		tx = tx.Where("logs.token_name = ?", tokenName)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("logs.created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("logs.created_at <= ?", endTimestamp)
+	}
+	err = tx.Model(&Log{}).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("logs.id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	formatUserLogs(logs)
+	return logs, total, err
+}
+
+// OrganizationMemberUsage 组织内单个成员的用量汇总
+type OrganizationMemberUsage struct {
+	UserId           int    `json:"user_id"`
+	Username         string `json:"username"`
+	Quota            int    `json:"quota"`
+	Count            int    `json:"count"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+}
+
+// GetOrganizationMemberUsage 按成员汇总组织令牌产生的消费
+func GetOrganizationMemberUsage(organizationId int, startTimestamp int64, endTimestamp int64, modelName string) (usages []*OrganizationMemberUsage, err error) {
+	tx := LOG_DB.Table("logs").
+		Select("user_id, username, sum(quota) quota, count(*) count, sum(prompt_tokens) prompt_tokens, sum(completion_tokens) completion_tokens").
+		Where("organization_id = ? and type = ?", organizationId, LogTypeConsume)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if modelName != "" {
+		tx = tx.Where("model_name like ?", modelName)
+	}
+	err = tx.Group("user_id, username").Order("quota desc").Scan(&usages).Error
+	return usages, err
+}
+
+func SumOrganizationUsedQuota(organizationId int, startTimestamp int64, endTimestamp int64, modelName string, username string) (stat Stat) {
+	tx := LOG_DB.Table("logs").Select("sum(quota) quota").Where("organization_id = ? and type = ?", organizationId, LogTypeConsume)
+	rpmTpmQuery := LOG_DB.Table("logs").Select("count(*) rpm, sum(prompt_tokens) + sum(completion_tokens) tpm").
+		Where("organization_id = ? and type = ?", organizationId, LogTypeConsume)
+	if username != "" {
+		tx = tx.Where("username = ?", username)
+		rpmTpmQuery = rpmTpmQuery.Where("username = ?", username)
+	}
+	if modelName != "" {
+		tx = tx.Where("model_name like ?", modelName)
+		rpmTpmQuery = rpmTpmQuery.Where("model_name like ?", modelName)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	// 只统计最近60秒的rpm和tpm
+	rpmTpmQuery = rpmTpmQuery.Where("created_at >= ?", time.Now().Add(-60*time.Second).Unix())
+	tx.Scan(&stat)
+	rpmTpmQuery.Scan(&stat)
+	return stat
+}
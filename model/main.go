@@ -270,6 +270,16 @@ func migrateDB() error {
 		&QuotaData{},
 		&Task{},
 		&Setup{},
+		&File{},
+		&Batch{},
+		&ChannelKey{},
+		&StoredResponse{},
+		&BudgetUsage{},
+		&Organization{},
+		&OrganizationMember{},
+		&OrganizationInvitation{},
+		&TwoFA{},
+		&Passkey{},
 	}
 
 	for _, model := range modelsToMigrate {
@@ -285,6 +295,12 @@ func migrateDB() error {
 	}
 
 	common.SysLog("database migrated")
+	if err := MigrateChannelKeyEncryption(); err != nil {
+		common.SysError("failed to encrypt channel keys: " + err.Error())
+	}
+	if err := MigrateChannelKeyHashes(); err != nil {
+		common.SysError("failed to migrate channel key states: " + err.Error())
+	}
 	return nil
 }
 
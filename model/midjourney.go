@@ -37,6 +37,8 @@ type Midjourney struct {
 	Quota       int    `json:"quota"`
 	Buttons     string `json:"buttons"`
 	Properties  string `json:"properties"`
+	// OrganizationId 组织令牌提交的任务，失败时退还到组织额度池
+	OrganizationId int `json:"organization_id" gorm:"default:0"`
 }
 
 // TaskQueryParams 用于包含所有搜索条件的结构体，可以根据需求添加更多字段
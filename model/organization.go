@@ -0,0 +1,340 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"errors"
+	"fmt"
+	"veloera/common"
+	"veloera/setting/operation_setting"
+
+	"gorm.io/gorm"
+)
+
+// 组织成员角色
+const (
+	OrganizationRoleOwner   = "owner"   // 拥有者，可管理一切，包括删除组织
+	OrganizationRoleAdmin   = "admin"   // 管理员，可管理成员与令牌
+	OrganizationRoleMember  = "member"  // 普通成员，可创建组织令牌
+	OrganizationRoleBilling = "billing" // 财务，可查看用量并为组织充值
+)
+
+// Organization 组织拥有独立的额度池，组织令牌产生的消费从额度池扣除
+type Organization struct {
+	Id            int    `json:"id"`
+	Name          string `json:"name" gorm:"type:varchar(64);index"`
+	OwnerId       int    `json:"owner_id" gorm:"index"`
+	Status        int    `json:"status" gorm:"type:int;default:1"`
+	Quota         int    `json:"quota" gorm:"type:int;default:0"`
+	UsedQuota     int    `json:"used_quota" gorm:"type:int;default:0"`
+	DailyBudget   int    `json:"daily_budget" gorm:"type:int;default:0"`   // 每日消费上限，0 表示不限制
+	WeeklyBudget  int    `json:"weekly_budget" gorm:"type:int;default:0"`  // 每周消费上限，0 表示不限制
+	MonthlyBudget int    `json:"monthly_budget" gorm:"type:int;default:0"` // 每月消费上限，0 表示不限制
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+	Role          string `json:"role,omitempty" gorm:"-:all"` // 当前用户在组织中的角色，仅用于返回
+}
+
+type OrganizationMember struct {
+	Id             int    `json:"id"`
+	OrganizationId int    `json:"organization_id" gorm:"uniqueIndex:idx_organization_user"`
+	UserId         int    `json:"user_id" gorm:"uniqueIndex:idx_organization_user;index"`
+	Role           string `json:"role" gorm:"type:varchar(16)"`
+	QuotaLimit     int    `json:"quota_limit" gorm:"type:int;default:0"` // 成员最多可使用的组织额度，0 表示不限制
+	UsedQuota      int    `json:"used_quota" gorm:"type:int;default:0"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+	Username       string `json:"username" gorm:"->;-:migration"`
+	Email          string `json:"email" gorm:"->;-:migration"`
+}
+
+// OrganizationInvitation 通过邮件发出的成员邀请，受邀用户使用邀请码加入
+type OrganizationInvitation struct {
+	Id             int    `json:"id"`
+	OrganizationId int    `json:"organization_id" gorm:"index"`
+	Email          string `json:"email" gorm:"type:varchar(64);index"`
+	Role           string `json:"role" gorm:"type:varchar(16)"`
+	Code           string `json:"-" gorm:"type:varchar(32);uniqueIndex"`
+	InviterId      int    `json:"inviter_id"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+	ExpiredTime    int64  `json:"expired_time" gorm:"bigint"`
+}
+
+func IsValidOrganizationRole(role string) bool {
+	switch role {
+	case OrganizationRoleOwner, OrganizationRoleAdmin, OrganizationRoleMember, OrganizationRoleBilling:
+		return true
+	}
+	return false
+}
+
+func (org *Organization) GetBudget() operation_setting.Budget {
+	return operation_setting.Budget{
+		Daily:   org.DailyBudget,
+		Weekly:  org.WeeklyBudget,
+		Monthly: org.MonthlyBudget,
+	}
+}
+
+// Insert 创建组织并把 ownerId 加入为拥有者
+func (org *Organization) Insert() error {
+	org.CreatedTime = common.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{
+			OrganizationId: org.Id,
+			UserId:         org.OwnerId,
+			Role:           OrganizationRoleOwner,
+			CreatedTime:    org.CreatedTime,
+		}).Error
+	})
+}
+
+func (org *Organization) Update() error {
+	return DB.Model(org).Select("name", "daily_budget", "weekly_budget", "monthly_budget").Updates(org).Error
+}
+
+// Delete 删除组织、成员与邀请，组织令牌转为普通令牌并禁用，额度池中剩余的额度退还给拥有者
+func (org *Organization) Delete() error {
+	var current Organization
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&current, "id = ?", org.Id).Error; err != nil {
+			return err
+		}
+		if current.Quota > 0 {
+			if err := tx.Model(&User{}).Where("id = ?", current.OwnerId).Update("quota", gorm.Expr("quota + ?", current.Quota)).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("organization_id = ?", org.Id).Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("organization_id = ?", org.Id).Delete(&OrganizationInvitation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Token{}).Where("organization_id = ?", org.Id).Updates(map[string]interface{}{
+			"organization_id": 0,
+			"status":          common.TokenStatusDisabled,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(org).Error
+	})
+	if err != nil || current.Quota <= 0 {
+		return err
+	}
+	RecordLog(current.OwnerId, LogTypeSystem, fmt.Sprintf("删除组织 %s，剩余额度 %s 已退还", current.Name, common.LogQuota(current.Quota)))
+	return invalidateUserCache(current.OwnerId)
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	org := Organization{Id: id}
+	err := DB.First(&org, "id = ?", id).Error
+	return &org, err
+}
+
+func GetAllOrganizations(startIdx int, num int) (orgs []*Organization, total int64, err error) {
+	err = DB.Model(&Organization{}).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	return orgs, total, err
+}
+
+// GetUserOrganizations 返回用户加入的所有组织，并带上用户在组织中的角色
+func GetUserOrganizations(userId int) ([]*Organization, error) {
+	var members []*OrganizationMember
+	if err := DB.Where("user_id = ?", userId).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return []*Organization{}, nil
+	}
+	roles := make(map[int]string, len(members))
+	ids := make([]int, 0, len(members))
+	for _, member := range members {
+		roles[member.OrganizationId] = member.Role
+		ids = append(ids, member.OrganizationId)
+	}
+	var orgs []*Organization
+	if err := DB.Where("id in (?)", ids).Order("id desc").Find(&orgs).Error; err != nil {
+		return nil, err
+	}
+	for _, org := range orgs {
+		org.Role = roles[org.Id]
+	}
+	return orgs, nil
+}
+
+func GetOrganizationMember(organizationId int, userId int) (*OrganizationMember, error) {
+	var member OrganizationMember
+	err := DB.Where("organization_id = ? and user_id = ?", organizationId, userId).First(&member).Error
+	return &member, err
+}
+
+func GetOrganizationMembers(organizationId int) ([]*OrganizationMember, error) {
+	var members []*OrganizationMember
+	err := DB.Table("organization_members").
+		Select("organization_members.*, users.username, users.email").
+		Joins("left join users on users.id = organization_members.user_id").
+		Where("organization_members.organization_id = ?", organizationId).
+		Order("organization_members.id asc").
+		Find(&members).Error
+	return members, err
+}
+
+func (member *OrganizationMember) Update() error {
+	return DB.Model(member).Select("role", "quota_limit", "used_quota").Updates(member).Error
+}
+
+func (member *OrganizationMember) Delete() error {
+	return DB.Delete(member).Error
+}
+
+func (invitation *OrganizationInvitation) Insert() error {
+	invitation.Code = common.GetRandomString(32)
+	invitation.CreatedTime = common.GetTimestamp()
+	return DB.Create(invitation).Error
+}
+
+func GetOrganizationInvitations(organizationId int) ([]*OrganizationInvitation, error) {
+	var invitations []*OrganizationInvitation
+	err := DB.Where("organization_id = ? and expired_time > ?", organizationId, common.GetTimestamp()).
+		Order("id desc").Find(&invitations).Error
+	return invitations, err
+}
+
+func DeleteOrganizationInvitation(organizationId int, id int) error {
+	return DB.Where("organization_id = ? and id = ?", organizationId, id).Delete(&OrganizationInvitation{}).Error
+}
+
+// AcceptOrganizationInvitation 校验邀请码与邮箱后把用户加入组织，邀请码只能使用一次
+func AcceptOrganizationInvitation(code string, userId int, email string) (*OrganizationMember, error) {
+	var member *OrganizationMember
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var invitation OrganizationInvitation
+		if err := tx.Where("code = ?", code).First(&invitation).Error; err != nil {
+			return errors.New("邀请不存在或已被使用")
+		}
+		if invitation.ExpiredTime < common.GetTimestamp() {
+			return errors.New("邀请已过期")
+		}
+		if invitation.Email != email {
+			return errors.New("该邀请不属于当前账户的邮箱")
+		}
+		var count int64
+		if err := tx.Model(&OrganizationMember{}).Where("organization_id = ? and user_id = ?", invitation.OrganizationId, userId).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errors.New("您已经是该组织的成员")
+		}
+		member = &OrganizationMember{
+			OrganizationId: invitation.OrganizationId,
+			UserId:         userId,
+			Role:           invitation.Role,
+			CreatedTime:    common.GetTimestamp(),
+		}
+		if err := tx.Create(member).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&invitation).Error
+	})
+	return member, err
+}
+
+// TransferQuotaToOrganization 从用户个人额度向组织额度池转入额度
+func TransferQuotaToOrganization(userId int, organizationId int, quota int) error {
+	if quota <= 0 {
+		return errors.New("转入额度必须大于 0")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? and quota >= ?", userId, quota).Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("用户额度不足")
+		}
+		return tx.Model(&Organization{}).Where("id = ?", organizationId).Update("quota", gorm.Expr("quota + ?", quota)).Error
+	})
+	if err != nil {
+		return err
+	}
+	return invalidateUserCache(userId)
+}
+
+func SetOrganizationQuota(organizationId int, quota int) error {
+	return DB.Model(&Organization{}).Where("id = ?", organizationId).Update("quota", quota).Error
+}
+
+func SetOrganizationStatus(organizationId int, status int) error {
+	return DB.Model(&Organization{}).Where("id = ?", organizationId).Update("status", status).Error
+}
+
+func GetOrganizationQuota(organizationId int) (quota int, err error) {
+	err = DB.Model(&Organization{}).Where("id = ?", organizationId).Select("quota").Find(&quota).Error
+	return quota, err
+}
+
+// GetBillingQuota 返回请求的计费额度，组织令牌使用组织额度池，否则使用用户额度
+func GetBillingQuota(userId int, organizationId int) (int, error) {
+	if organizationId != 0 {
+		return GetOrganizationQuota(organizationId)
+	}
+	return GetUserQuota(userId, false)
+}
+
+// DecreaseBillingQuota 扣除计费额度，组织令牌同时累计成员在组织内的用量
+func DecreaseBillingQuota(userId int, organizationId int, quota int) error {
+	if organizationId == 0 {
+		return DecreaseUserQuota(userId, quota)
+	}
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return updateOrganizationUsage(userId, organizationId, quota)
+}
+
+// IncreaseBillingQuota 退还计费额度
+func IncreaseBillingQuota(userId int, organizationId int, quota int) error {
+	if organizationId == 0 {
+		return IncreaseUserQuota(userId, quota, false)
+	}
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return updateOrganizationUsage(userId, organizationId, -quota)
+}
+
+func updateOrganizationUsage(userId int, organizationId int, delta int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Organization{}).Where("id = ?", organizationId).Updates(map[string]interface{}{
+			"quota":      gorm.Expr("quota - ?", delta),
+			"used_quota": gorm.Expr("used_quota + ?", delta),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&OrganizationMember{}).Where("organization_id = ? and user_id = ?", organizationId, userId).
+			Update("used_quota", gorm.Expr("used_quota + ?", delta)).Error
+	})
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"testing"
+	"veloera/common"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// 删除组织时额度池中剩余的额度应退还给拥有者并记录日志
+func TestDeleteOrganizationRefundsQuotaToOwner(t *testing.T) {
+	common.RedisEnabled = false
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&User{}, &Token{}, &Log{}, &Organization{}, &OrganizationMember{}, &OrganizationInvitation{}); err != nil {
+		t.Fatal(err)
+	}
+	DB = db
+	LOG_DB = db
+	owner := User{Id: 1, Username: "owner", Quota: 100}
+	if err = db.Create(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+	org := &Organization{Name: "team", OwnerId: owner.Id}
+	if err = org.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	if err = SetOrganizationQuota(org.Id, 500); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = org.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.First(&owner, owner.Id).Error; err != nil {
+		t.Fatal(err)
+	}
+	if owner.Quota != 600 {
+		t.Fatalf("owner quota = %d, want 600", owner.Quota)
+	}
+	var count int64
+	db.Model(&Organization{}).Where("id = ?", org.Id).Count(&count)
+	if count != 0 {
+		t.Fatal("organization was not deleted")
+	}
+	db.Model(&Log{}).Where("user_id = ? and type = ?", owner.Id, LogTypeSystem).Count(&count)
+	if count != 1 {
+		t.Fatalf("refund log count = %d, want 1", count)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"veloera/common"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// Passkey 保存用户注册的 WebAuthn 凭据，一个用户可以注册多个
+type Passkey struct {
+	Id           int    `json:"id"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	Name         string `json:"name" gorm:"type:varchar(64)"`
+	CredentialId string `json:"-" gorm:"type:varchar(255);uniqueIndex"` // base64url 编码的凭据 id
+	Credential   string `json:"-" gorm:"type:text"`                     // json 序列化的 webauthn.Credential
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	LastUsedTime int64  `json:"last_used_time" gorm:"bigint"`
+}
+
+func EncodePasskeyCredentialId(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+func NewPasskey(userId int, name string, credential *webauthn.Credential) (*Passkey, error) {
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return nil, err
+	}
+	return &Passkey{
+		UserId:       userId,
+		Name:         name,
+		CredentialId: EncodePasskeyCredentialId(credential.ID),
+		Credential:   string(data),
+		CreatedTime:  common.GetTimestamp(),
+	}, nil
+}
+
+func (passkey *Passkey) Insert() error {
+	return DB.Create(passkey).Error
+}
+
+func (passkey *Passkey) GetCredential() (*webauthn.Credential, error) {
+	var credential webauthn.Credential
+	if err := json.Unmarshal([]byte(passkey.Credential), &credential); err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// UpdateCredential 登录成功后保存新的签名计数并记录使用时间
+func (passkey *Passkey) UpdateCredential(credential *webauthn.Credential) error {
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return err
+	}
+	passkey.Credential = string(data)
+	passkey.LastUsedTime = common.GetTimestamp()
+	return DB.Model(&Passkey{}).Where("id = ?", passkey.Id).Updates(map[string]interface{}{
+		"credential":     passkey.Credential,
+		"last_used_time": passkey.LastUsedTime,
+	}).Error
+}
+
+func GetPasskeysByUserId(userId int) ([]*Passkey, error) {
+	var passkeys []*Passkey
+	err := DB.Where("user_id = ?", userId).Order("id asc").Find(&passkeys).Error
+	return passkeys, err
+}
+
+func GetPasskeyByCredentialId(credentialId []byte) (*Passkey, error) {
+	var passkey Passkey
+	err := DB.Where("credential_id = ?", EncodePasskeyCredentialId(credentialId)).First(&passkey).Error
+	if err != nil {
+		return nil, err
+	}
+	return &passkey, nil
+}
+
+func DeletePasskey(id int, userId int) error {
+	result := DB.Where("id = ? AND user_id = ?", id, userId).Delete(&Passkey{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("通行密钥不存在")
+	}
+	return nil
+}
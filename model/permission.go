@@ -0,0 +1,131 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"encoding/json"
+	"veloera/common"
+	"veloera/constant"
+)
+
+// GetEffectivePermissions 计算用户实际拥有的权限：
+// 超级管理员拥有全部权限；管理员使用单独分配的权限，未分配时使用默认管理员权限；
+// 普通用户始终没有管理权限，即使残留了单独分配的权限
+func GetEffectivePermissions(role int, permissions string) []string {
+	if role >= common.RoleRootUser {
+		return constant.AllPermissions
+	}
+	if role < common.RoleAdminUser {
+		return []string{}
+	}
+	if permissions == "" {
+		return constant.AdminDefaultPermissions
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(permissions), &list); err != nil {
+		common.SysError("failed to unmarshal user permissions: " + err.Error())
+		return []string{}
+	}
+	effective := make([]string, 0, len(list))
+	for _, permission := range list {
+		if constant.IsValidPermission(permission) {
+			effective = append(effective, permission)
+		}
+	}
+	return effective
+}
+
+// UserHasAnyPermission 判断用户是否拥有 permissions 中的任意一个权限
+func UserHasAnyPermission(userId int, role int, permissions ...string) bool {
+	if role >= common.RoleRootUser {
+		return true
+	}
+	user, err := GetUserCache(userId)
+	if err != nil {
+		return false
+	}
+	for _, owned := range GetEffectivePermissions(role, user.Permissions) {
+		for _, permission := range permissions {
+			if owned == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// UpdateUserPermissions 为用户单独分配权限，permissions 为 nil 时恢复为角色默认权限
+func UpdateUserPermissions(userId int, permissions []string) error {
+	value := ""
+	if permissions != nil {
+		data, err := json.Marshal(permissions)
+		if err != nil {
+			return err
+		}
+		value = string(data)
+	}
+	err := DB.Model(&User{}).Where("id = ?", userId).Update("permissions", value).Error
+	if err != nil {
+		return err
+	}
+	return invalidateUserCache(userId)
+}
+
+// RevokeAdminAccessTokens 清除所有管理员的系统访问令牌，
+// 开启管理员强制两步验证后，之前未经两步验证生成的令牌必须重新生成
+func RevokeAdminAccessTokens() error {
+	return DB.Model(&User{}).Where("role >= ? AND access_token IS NOT NULL", common.RoleAdminUser).
+		Update("access_token", nil).Error
+}
+
+type PermissionHolder struct {
+	Id          int      `json:"id"`
+	Username    string   `json:"username"`
+	DisplayName string   `json:"display_name"`
+	Role        int      `json:"role"`
+	Status      int      `json:"status"`
+	Custom      bool     `json:"custom"` // 是否单独分配了权限
+	Permissions []string `json:"permissions"`
+}
+
+// GetPermissionHolders 列出所有拥有管理权限的用户及其实际权限，用于权限审计
+func GetPermissionHolders() ([]PermissionHolder, error) {
+	var users []User
+	err := DB.Select("id", "username", "display_name", "role", "status", "permissions").
+		Where("role >= ?", common.RoleAdminUser).
+		Order("role desc, id asc").Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	holders := make([]PermissionHolder, 0, len(users))
+	for _, user := range users {
+		permissions := GetEffectivePermissions(user.Role, user.Permissions)
+		if len(permissions) == 0 {
+			continue
+		}
+		holders = append(holders, PermissionHolder{
+			Id:          user.Id,
+			Username:    user.Username,
+			DisplayName: user.DisplayName,
+			Role:        user.Role,
+			Status:      user.Status,
+			Custom:      user.Permissions != "" && user.Role < common.RoleRootUser,
+			Permissions: permissions,
+		})
+	}
+	return holders, nil
+}
@@ -60,6 +60,13 @@ func GetPricing() []Pricing {
 	return pricingMap
 }
 
+// InvalidatePricing 使定价缓存失效，下次读取时根据最新的 abilities 重建
+func InvalidatePricing() {
+	updatePricingLock.Lock()
+	lastGetPricingTime = time.Time{}
+	updatePricingLock.Unlock()
+}
+
 func updatePricing() {
 	//modelRatios := common.GetModelRatios()
 	enableAbilities := GetAllEnableAbilities()
@@ -0,0 +1,57 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"errors"
+	"veloera/common"
+)
+
+// StoredResponse 保存 /v1/responses 的会话，供 previous_response_id 续接使用。
+// 每条记录只保存本轮新增的输入与输出消息，完整会话通过 PreviousResponseId 向前回溯得到。
+type StoredResponse struct {
+	Id                 string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId             int    `json:"user_id" gorm:"index"`
+	PreviousResponseId string `json:"previous_response_id" gorm:"type:varchar(64)"`
+	Model              string `json:"model"`
+	Messages           string `json:"messages" gorm:"type:text"` // json
+	CreatedAt          int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (response *StoredResponse) Insert() error {
+	if response.CreatedAt == 0 {
+		response.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(response).Error
+}
+
+func GetUserStoredResponse(userId int, id string) (*StoredResponse, error) {
+	if id == "" {
+		return nil, errors.New("response id 为空！")
+	}
+	var response StoredResponse
+	err := DB.Where("user_id = ? AND id = ?", userId, id).First(&response).Error
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func DeleteStoredResponsesBefore(targetTimestamp int64) (int64, error) {
+	result := DB.Where("created_at < ?", targetTimestamp).Delete(&StoredResponse{})
+	return result.RowsAffected, result.Error
+}
@@ -53,6 +53,8 @@ type Task struct {
 	FinishTime int64                 `json:"finish_time" gorm:"index"`
 	Progress   string                `json:"progress" gorm:"type:varchar(20);index"`
 	Properties Properties            `json:"properties" gorm:"type:json"`
+	// OrganizationId 组织令牌提交的任务，失败时退还到组织额度池
+	OrganizationId int `json:"organization_id" gorm:"default:0"`
 
 	Data json.RawMessage `json:"data" gorm:"type:json"`
 }
@@ -69,6 +71,35 @@ func (t *Task) GetData(v any) error {
 
 type Properties struct {
 	Input string `json:"input"`
+	// ResultURL 上游返回的结果地址，可能会过期
+	ResultURL string `json:"result_url,omitempty"`
+	// CacheFile 结果下载到本地后的缓存路径
+	CacheFile string `json:"cache_file,omitempty"`
+	// KeyHash 提交任务时使用的渠道 key，多 key 渠道查询任务需要使用同一个 key
+	KeyHash string `json:"key_hash,omitempty"`
+}
+
+// GetChannelKey 获取提交任务时使用的渠道 key，找不到时使用第一个 key
+func (t *Task) GetChannelKey(channel *Channel) string {
+	keys := SplitChannelKeys(channel)
+	if len(keys) == 0 {
+		return channel.Key
+	}
+	if t.Properties.KeyHash == "" {
+		return keys[0]
+	}
+	for _, key := range keys {
+		if GetChannelKeyHash(key) == t.Properties.KeyHash {
+			return key
+		}
+		// 升级前提交的任务使用旧摘要
+		for _, hash := range legacyChannelKeyHashes(key) {
+			if hash == t.Properties.KeyHash {
+				return key
+			}
+		}
+	}
+	return keys[0]
 }
 
 func (m *Properties) Scan(val interface{}) error {
@@ -95,12 +126,13 @@ type SyncTaskQueryParams struct {
 
 func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.TaskRelayInfo) *Task {
 	t := &Task{
-		UserId:     relayInfo.UserId,
-		SubmitTime: time.Now().Unix(),
-		Status:     TaskStatusNotStart,
-		Progress:   "0%",
-		ChannelId:  relayInfo.ChannelId,
-		Platform:   platform,
+		UserId:         relayInfo.UserId,
+		OrganizationId: relayInfo.OrganizationId,
+		SubmitTime:     time.Now().Unix(),
+		Status:         TaskStatusNotStart,
+		Progress:       "0%",
+		ChannelId:      relayInfo.ChannelId,
+		Platform:       platform,
 	}
 	return t
 }
@@ -226,6 +258,17 @@ func GetByTaskId(userId int, taskId string) (*Task, bool, error) {
 	return task, exist, err
 }
 
+// GetUserTasksByPlatforms 按 id 倒序分页获取用户在指定平台的任务，afterId 大于 0 时只返回更早的任务
+func GetUserTasksByPlatforms(userId int, platforms []constant.TaskPlatform, afterId int64, limit int) ([]*Task, error) {
+	var tasks []*Task
+	query := DB.Where("user_id = ? and platform in (?)", userId, platforms)
+	if afterId > 0 {
+		query = query.Where("id < ?", afterId)
+	}
+	err := query.Order("id desc").Limit(limit).Find(&tasks).Error
+	return tasks, err
+}
+
 func GetByTaskIds(userId int, taskIds []any) ([]*Task, error) {
 	if len(taskIds) == 0 {
 		return nil, nil
@@ -244,6 +287,10 @@ func TaskUpdateProgress(id int64, progress string) error {
 	return DB.Model(&Task{}).Where("id = ?", id).Update("progress", progress).Error
 }
 
+func TaskUpdateProperties(id int64, properties Properties) error {
+	return DB.Model(&Task{}).Where("id = ?", id).Update("properties", properties).Error
+}
+
 func (Task *Task) Insert() error {
 	var err error
 	err = DB.Create(Task).Error
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"strings"
 	"veloera/common"
+	"veloera/setting/operation_setting"
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"gorm.io/gorm"
@@ -46,6 +47,14 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
+	ResponseCache      bool           `json:"response_cache" gorm:"default:false"`
+	TPMLimit           int            `json:"tpm_limit" gorm:"default:0"`             // 每分钟 token 数限制，0 表示不限制
+	TPDLimit           int            `json:"tpd_limit" gorm:"default:0"`             // 每天 token 数限制，0 表示不限制
+	MaxConcurrency     int            `json:"max_concurrency" gorm:"default:0"`       // 最大并发请求数，0 表示不限制
+	DailyBudget        int            `json:"daily_budget" gorm:"default:0"`          // 每日消费上限，0 表示不限制
+	WeeklyBudget       int            `json:"weekly_budget" gorm:"default:0"`         // 每周消费上限，0 表示不限制
+	MonthlyBudget      int            `json:"monthly_budget" gorm:"default:0"`        // 每月消费上限，0 表示不限制
+	OrganizationId     int            `json:"organization_id" gorm:"default:0;index"` // 所属组织，消费从组织额度池扣除，0 表示个人令牌
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -53,6 +62,14 @@ func (token *Token) Clean() {
 	token.Key = ""
 }
 
+func (token *Token) GetBudget() operation_setting.Budget {
+	return operation_setting.Budget{
+		Daily:   token.DailyBudget,
+		Weekly:  token.WeeklyBudget,
+		Monthly: token.MonthlyBudget,
+	}
+}
+
 func (token *Token) GetIpLimitsMap() map[string]any {
 	// delete empty spaces
 	//split with \n
@@ -82,6 +99,12 @@ func GetAllUserTokens(userId int, startIdx int, num int) ([]*Token, error) {
 	return tokens, err
 }
 
+func GetOrganizationTokens(organizationId int, startIdx int, num int) ([]*Token, error) {
+	var tokens []*Token
+	err := DB.Where("organization_id = ?", organizationId).Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error
+	return tokens, err
+}
+
 func SearchUserTokens(userId int, keyword string, token string) (tokens []*Token, err error) {
 	if token != "" {
 		token = strings.Trim(token, "sk-")
@@ -205,7 +228,8 @@ func (token *Token) Update() (err error) {
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
 		"rate_limit_enabled", "rate_limit_period", "rate_limit_count", "rate_limit_success",
-		"model_limits_enabled", "model_limits", "allow_ips", "group").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "response_cache",
+		"tpm_limit", "tpd_limit", "max_concurrency", "daily_budget", "weekly_budget", "monthly_budget").Updates(token).Error
 	return err
 }
 
@@ -0,0 +1,327 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"veloera/common"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	twoFAPeriod            = 30
+	twoFARecoveryCodeCount = 10
+
+	// 连续失败 5 次后锁定 15 分钟，计数保存在服务端，按用户维度生效
+	twoFAMaxFailures     = 5
+	twoFALockoutDuration = 15 * time.Minute
+)
+
+var (
+	ErrTwoFALocked      = errors.New("两步验证失败次数过多，请稍后再试")
+	ErrTwoFACodeInvalid = errors.New("验证码错误")
+)
+
+type twoFAFailureRecord struct {
+	count    int
+	expireAt time.Time
+}
+
+var (
+	twoFAFailures     = make(map[int]*twoFAFailureRecord)
+	twoFAFailuresLock sync.Mutex
+)
+
+// TwoFA 保存用户的 TOTP 两步验证配置。
+// Secret 复用渠道密钥的加密 serializer；恢复码只保存 sha256 摘要，明文仅在生成时返回一次。
+type TwoFA struct {
+	Id            int    `json:"id"`
+	UserId        int    `json:"user_id" gorm:"uniqueIndex"`
+	Secret        string `json:"-" gorm:"type:text;serializer:channel_secret"`
+	Enabled       bool   `json:"enabled" gorm:"default:false"`
+	RecoveryCodes string `json:"-" gorm:"type:text"` // json 数组，元素为恢复码的 sha256
+	LastUsedStep  int64  `json:"-" gorm:"bigint;default:0"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+}
+
+func GetTwoFAByUserId(userId int) (*TwoFA, error) {
+	if userId == 0 {
+		return nil, errors.New("用户 id 为空")
+	}
+	var twoFA TwoFA
+	err := DB.Where("user_id = ?", userId).First(&twoFA).Error
+	if err != nil {
+		return nil, err
+	}
+	return &twoFA, nil
+}
+
+func IsTwoFAEnabled(userId int) bool {
+	twoFA, err := GetTwoFAByUserId(userId)
+	return err == nil && twoFA.Enabled
+}
+
+// PrepareTwoFA 为用户生成新的 TOTP 密钥，在用户使用验证码确认之前保持未启用状态
+func PrepareTwoFA(userId int, accountName string) (*otp.Key, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      common.SystemName,
+		AccountName: accountName,
+		Period:      twoFAPeriod,
+	})
+	if err != nil {
+		return nil, err
+	}
+	twoFA, err := GetTwoFAByUserId(userId)
+	if err != nil {
+		twoFA = &TwoFA{UserId: userId}
+	} else if twoFA.Enabled {
+		return nil, errors.New("两步验证已启用，请先关闭后再重新设置")
+	}
+	twoFA.Secret = key.Secret()
+	twoFA.RecoveryCodes = ""
+	twoFA.LastUsedStep = 0
+	twoFA.CreatedTime = common.GetTimestamp()
+	if err = DB.Save(twoFA).Error; err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func DeleteTwoFAByUserId(userId int) error {
+	return DB.Where("user_id = ?", userId).Delete(&TwoFA{}).Error
+}
+
+// Verify 校验 6 位 TOTP 验证码或一次性恢复码
+func (twoFA *TwoFA) Verify(code string) bool {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return false
+	}
+	if len(code) == 6 && isDigits(code) {
+		return twoFA.ValidateTOTP(code)
+	}
+	return twoFA.UseRecoveryCode(code)
+}
+
+// CheckCode 在 Verify 的基础上统计失败次数，失败次数达到上限后，锁定期内即使验证码正确也会被拒绝
+func (twoFA *TwoFA) CheckCode(code string) error {
+	if IsTwoFALocked(twoFA.UserId) {
+		return ErrTwoFALocked
+	}
+	if !twoFA.Verify(code) {
+		if recordTwoFAFailure(twoFA.UserId) >= twoFAMaxFailures {
+			return ErrTwoFALocked
+		}
+		return ErrTwoFACodeInvalid
+	}
+	resetTwoFAFailures(twoFA.UserId)
+	return nil
+}
+
+// ValidateTOTP 允许前后各一个周期的时钟偏差，同一周期的验证码只能使用一次
+func (twoFA *TwoFA) ValidateTOTP(code string) bool {
+	if twoFA.Secret == "" {
+		return false
+	}
+	step := time.Now().Unix() / twoFAPeriod
+	for _, s := range []int64{step - 1, step, step + 1} {
+		if s <= twoFA.LastUsedStep {
+			continue
+		}
+		expected, err := totp.GenerateCodeCustom(twoFA.Secret, time.Unix(s*twoFAPeriod, 0), totp.ValidateOpts{
+			Period:    twoFAPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+			continue
+		}
+		// 条件更新防止并发请求重复使用同一验证码
+		result := DB.Model(&TwoFA{}).Where("id = ? AND last_used_step < ?", twoFA.Id, s).Update("last_used_step", s)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return false
+		}
+		twoFA.LastUsedStep = s
+		return true
+	}
+	return false
+}
+
+// UseRecoveryCode 校验恢复码，校验成功后该恢复码立即作废
+func (twoFA *TwoFA) UseRecoveryCode(code string) bool {
+	hashes := twoFA.recoveryCodeHashes()
+	if len(hashes) == 0 {
+		return false
+	}
+	target := hashRecoveryCode(code)
+	for i, hash := range hashes {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(target)) != 1 {
+			continue
+		}
+		remaining := append(hashes[:i:i], hashes[i+1:]...)
+		data, err := json.Marshal(remaining)
+		if err != nil {
+			return false
+		}
+		result := DB.Model(&TwoFA{}).Where("id = ? AND recovery_codes = ?", twoFA.Id, twoFA.RecoveryCodes).Update("recovery_codes", string(data))
+		if result.Error != nil || result.RowsAffected == 0 {
+			return false
+		}
+		twoFA.RecoveryCodes = string(data)
+		return true
+	}
+	return false
+}
+
+// RemainingRecoveryCodes 返回尚未使用的恢复码数量
+func (twoFA *TwoFA) RemainingRecoveryCodes() int {
+	return len(twoFA.recoveryCodeHashes())
+}
+
+// ResetRecoveryCodes 生成一组新的恢复码并覆盖旧的恢复码，返回明文供用户保存
+func (twoFA *TwoFA) ResetRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, twoFARecoveryCodeCount)
+	hashes := make([]string, 0, twoFARecoveryCodeCount)
+	for i := 0; i < twoFARecoveryCodeCount; i++ {
+		raw, err := common.GenerateRandomCharsKey(10)
+		if err != nil {
+			return nil, err
+		}
+		raw = strings.ToLower(raw)
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	data, err := json.Marshal(hashes)
+	if err != nil {
+		return nil, err
+	}
+	twoFA.RecoveryCodes = string(data)
+	if err = DB.Model(&TwoFA{}).Where("id = ?", twoFA.Id).Update("recovery_codes", twoFA.RecoveryCodes).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (twoFA *TwoFA) Enable() error {
+	twoFA.Enabled = true
+	return DB.Model(&TwoFA{}).Where("id = ?", twoFA.Id).Update("enabled", true).Error
+}
+
+func (twoFA *TwoFA) recoveryCodeHashes() []string {
+	if twoFA.RecoveryCodes == "" {
+		return nil
+	}
+	var hashes []string
+	if err := json.Unmarshal([]byte(twoFA.RecoveryCodes), &hashes); err != nil {
+		common.SysError("failed to unmarshal 2fa recovery codes: " + err.Error())
+		return nil
+	}
+	return hashes
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func twoFAFailureKey(userId int) string {
+	return fmt.Sprintf("2fa_failures:%d", userId)
+}
+
+// IsTwoFALocked 判断用户是否因两步验证失败次数过多而处于锁定期
+func IsTwoFALocked(userId int) bool {
+	if common.RedisEnabled {
+		count, err := common.RDB.Get(context.Background(), twoFAFailureKey(userId)).Int()
+		return err == nil && count >= twoFAMaxFailures
+	}
+	twoFAFailuresLock.Lock()
+	defer twoFAFailuresLock.Unlock()
+	record, ok := twoFAFailures[userId]
+	if !ok {
+		return false
+	}
+	if time.Now().After(record.expireAt) {
+		delete(twoFAFailures, userId)
+		return false
+	}
+	return record.count >= twoFAMaxFailures
+}
+
+// recordTwoFAFailure 累加失败次数并返回累加后的值，锁定期从第一次失败开始计算
+func recordTwoFAFailure(userId int) int {
+	if common.RedisEnabled {
+		ctx := context.Background()
+		key := twoFAFailureKey(userId)
+		count, err := common.RDB.Incr(ctx, key).Result()
+		if err != nil {
+			common.SysError("failed to record 2fa failure: " + err.Error())
+			return 0
+		}
+		if count == 1 {
+			common.RDB.Expire(ctx, key, twoFALockoutDuration)
+		}
+		return int(count)
+	}
+	twoFAFailuresLock.Lock()
+	defer twoFAFailuresLock.Unlock()
+	record, ok := twoFAFailures[userId]
+	if !ok || time.Now().After(record.expireAt) {
+		record = &twoFAFailureRecord{expireAt: time.Now().Add(twoFALockoutDuration)}
+		twoFAFailures[userId] = record
+	}
+	record.count++
+	return record.count
+}
+
+func resetTwoFAFailures(userId int) {
+	if common.RedisEnabled {
+		if err := common.RedisDel(twoFAFailureKey(userId)); err != nil {
+			common.SysError("failed to reset 2fa failures: " + err.Error())
+		}
+		return
+	}
+	twoFAFailuresLock.Lock()
+	delete(twoFAFailures, userId)
+	twoFAFailuresLock.Unlock()
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"veloera/common"
+
+	"github.com/glebarez/sqlite"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+// 失败次数保存在服务端，客户端重放会话无法重置计数；锁定期内正确的验证码同样会被拒绝
+func TestTwoFALockoutIsServerSide(t *testing.T) {
+	common.RedisEnabled = false
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&TwoFA{}); err != nil {
+		t.Fatal(err)
+	}
+	DB = db
+	key, err := PrepareTwoFA(1, "user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	twoFA, err := GetTwoFAByUserId(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < twoFAMaxFailures; i++ {
+		if err = twoFA.CheckCode("000000x"); !errors.Is(err, ErrTwoFACodeInvalid) {
+			t.Fatalf("attempt %d: expected invalid code error, got %v", i, err)
+		}
+	}
+	if err = twoFA.CheckCode("000000x"); !errors.Is(err, ErrTwoFALocked) {
+		t.Fatalf("expected lockout after %d failures, got %v", twoFAMaxFailures, err)
+	}
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 重新读取记录，模拟新的请求
+	twoFA, _ = GetTwoFAByUserId(1)
+	if err = twoFA.CheckCode(code); !errors.Is(err, ErrTwoFALocked) {
+		t.Fatalf("expected valid code to be rejected while locked, got %v", err)
+	}
+	if IsTwoFALocked(2) {
+		t.Fatal("lockout must be scoped to a single user")
+	}
+
+	// 锁定期结束后恢复正常校验，成功后计数清零
+	twoFAFailuresLock.Lock()
+	twoFAFailures[1].expireAt = time.Now().Add(-time.Second)
+	twoFAFailuresLock.Unlock()
+	if err = twoFA.CheckCode(code); err != nil {
+		t.Fatalf("expected valid code to pass after lockout expired, got %v", err)
+	}
+	if IsTwoFALocked(1) {
+		t.Fatal("expected failures to be reset after a successful verification")
+	}
+}
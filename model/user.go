@@ -58,17 +58,25 @@ type User struct {
 	LinuxDOId        string         `json:"linux_do_id" gorm:"column:linux_do_id;index"`
 	Setting          string         `json:"setting" gorm:"type:text;column:setting"`
 	LastCheckInTime  *time.Time     `json:"last_check_in_time" gorm:"column:last_check_in_time"` // 上次签到时间
+	DailyBudget      int            `json:"daily_budget" gorm:"type:int;default:0"`              // 每日消费上限，0 表示不限制
+	WeeklyBudget     int            `json:"weekly_budget" gorm:"type:int;default:0"`             // 每周消费上限，0 表示不限制
+	MonthlyBudget    int            `json:"monthly_budget" gorm:"type:int;default:0"`            // 每月消费上限，0 表示不限制
+	Permissions      string         `json:"permissions" gorm:"type:text"`                        // json 数组，为空时使用角色默认权限
 }
 
 func (user *User) ToBaseUser() *UserBase {
 	cache := &UserBase{
-		Id:       user.Id,
-		Group:    user.Group,
-		Quota:    user.Quota,
-		Status:   user.Status,
-		Username: user.Username,
-		Setting:  user.Setting,
-		Email:    user.Email,
+		Id:            user.Id,
+		Group:         user.Group,
+		Quota:         user.Quota,
+		Status:        user.Status,
+		Username:      user.Username,
+		Setting:       user.Setting,
+		Email:         user.Email,
+		DailyBudget:   user.DailyBudget,
+		WeeklyBudget:  user.WeeklyBudget,
+		MonthlyBudget: user.MonthlyBudget,
+		Permissions:   user.Permissions,
 	}
 	return cache
 }
@@ -418,10 +426,13 @@ func (user *User) Edit(updatePassword bool) error {
 
 	newUser := *user
 	updates := map[string]interface{}{
-		"username":     newUser.Username,
-		"display_name": newUser.DisplayName,
-		"group":        newUser.Group,
-		"quota":        newUser.Quota,
+		"username":       newUser.Username,
+		"display_name":   newUser.DisplayName,
+		"group":          newUser.Group,
+		"quota":          newUser.Quota,
+		"daily_budget":   newUser.DailyBudget,
+		"weekly_budget":  newUser.WeeklyBudget,
+		"monthly_budget": newUser.MonthlyBudget,
 	}
 	if updatePassword {
 		updates["password"] = newUser.Password
@@ -23,19 +23,24 @@ import (
 	"time"
 	"veloera/common"
 	"veloera/constant"
+	"veloera/setting/operation_setting"
 
 	"github.com/bytedance/gopkg/util/gopool"
 )
 
 // UserBase struct remains the same as it represents the cached data structure
 type UserBase struct {
-	Id       int    `json:"id"`
-	Group    string `json:"group"`
-	Email    string `json:"email"`
-	Quota    int    `json:"quota"`
-	Status   int    `json:"status"`
-	Username string `json:"username"`
-	Setting  string `json:"setting"`
+	Id            int    `json:"id"`
+	Group         string `json:"group"`
+	Email         string `json:"email"`
+	Quota         int    `json:"quota"`
+	Status        int    `json:"status"`
+	Username      string `json:"username"`
+	Setting       string `json:"setting"`
+	DailyBudget   int    `json:"daily_budget"`
+	WeeklyBudget  int    `json:"weekly_budget"`
+	MonthlyBudget int    `json:"monthly_budget"`
+	Permissions   string `json:"permissions"`
 }
 
 func (user *UserBase) WriteContext(c *gin.Context) {
@@ -45,6 +50,15 @@ func (user *UserBase) WriteContext(c *gin.Context) {
 	c.Set(constant.ContextKeyUserEmail, user.Email)
 	c.Set("username", user.Username)
 	c.Set(constant.ContextKeyUserSetting, user.GetSetting())
+	c.Set("user_budget", user.GetBudget())
+}
+
+func (user *UserBase) GetBudget() operation_setting.Budget {
+	return operation_setting.Budget{
+		Daily:   user.DailyBudget,
+		Weekly:  user.WeeklyBudget,
+		Monthly: user.MonthlyBudget,
+	}
 }
 
 func (user *UserBase) GetSetting() map[string]interface{} {
@@ -118,17 +132,7 @@ func GetUserCache(userId int) (userCache *UserBase, err error) {
 	}
 
 	// Create cache object from user data
-	userCache = &UserBase{
-		Id:       user.Id,
-		Group:    user.Group,
-		Quota:    user.Quota,
-		Status:   user.Status,
-		Username: user.Username,
-		Setting:  user.Setting,
-		Email:    user.Email,
-	}
-
-	return userCache, nil
+	return user.ToBaseUser(), nil
 }
 
 func cacheGetUserBase(userId int) (*UserBase, error) {
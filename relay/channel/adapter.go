@@ -17,6 +17,7 @@
 package channel
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
 	"io"
 	"net/http"
@@ -59,4 +60,8 @@ type TaskAdaptor interface {
 
 	// FetchTask
 	FetchTask(baseUrl, key string, body map[string]any) (*http.Response, error)
+	// ParseTaskResult 将 FetchTask 返回的单个任务解析为统一格式
+	ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error)
+	// FetchTaskContent 获取任务生成的结果文件
+	FetchTaskContent(ctx context.Context, baseUrl, key, taskID, url string) (*http.Response, error)
 }
@@ -17,13 +17,19 @@
 package channel
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	"net/http"
+	"time"
 	common2 "veloera/common"
+	constant2 "veloera/constant"
 	"veloera/relay/common"
 	"veloera/relay/constant"
 	"veloera/service"
@@ -51,7 +57,7 @@ func DoApiRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 	if common2.DebugEnabled {
 		println("fullRequestURL:", fullRequestURL)
 	}
-	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("new request failed: %w", err)
 	}
@@ -71,7 +77,7 @@ func DoFormRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBod
 	if err != nil {
 		return nil, fmt.Errorf("get request url failed: %w", err)
 	}
-	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("new request failed: %w", err)
 	}
@@ -100,6 +106,7 @@ func DoWssRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 		return nil, fmt.Errorf("setup request header failed: %w", err)
 	}
 	targetHeader.Set("Content-Type", c.Request.Header.Get("Content-Type"))
+	common2.InjectTraceHeaders(c.Request.Context(), targetHeader)
 	targetConn, _, err := websocket.DefaultDialer.Dial(fullRequestURL, targetHeader)
 	if err != nil {
 		return nil, fmt.Errorf("dial failed to %s: %w", fullRequestURL, err)
@@ -111,20 +118,32 @@ func DoWssRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 }
 
 func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http.Response, error) {
-	var client *http.Client
-	var err error
-	if proxyURL, ok := info.ChannelSetting["proxy"]; ok {
-		client, err = service.NewProxyHttpClient(proxyURL.(string))
-		if err != nil {
-			return nil, fmt.Errorf("new proxy http client failed: %w", err)
-		}
-	} else {
-		client = service.GetHttpClient()
-	}
+	// 按渠道的代理、TLS 与超时设置复用连接池
+	client, err := service.GetChannelHttpClient(info.ChannelSetting)
+	if err != nil {
+		return nil, fmt.Errorf("new channel http client failed: %w", err)
+	}
+	ctx, span := common2.StartSpanWithKind(c.Request.Context(), "upstream.request", trace.SpanKindClient,
+		attribute.Int("channel.id", info.ChannelId),
+		attribute.Int("channel.type", info.ChannelType),
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Host),
+	)
+	defer span.End()
+	// 将 traceparent 传递给上游
+	common2.InjectTraceHeaders(ctx, req.Header)
+	startTime := time.Now()
 	resp, err := client.Do(req)
+	// 记录上游响应头返回的耗时，用于渠道健康度统计
+	c.Set(constant2.ContextKeyUpstreamLatency, time.Since(startTime).Milliseconds())
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
+	if resp != nil {
+		common2.SetSpanStatusCode(span, resp.StatusCode, resp.Status)
+	}
 	if resp == nil {
 		return nil, errors.New("resp is nil")
 	}
@@ -138,7 +157,7 @@ func DoTaskApiRequest(a TaskAdaptor, c *gin.Context, info *common.TaskRelayInfo,
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("new request failed: %w", err)
 	}
@@ -156,3 +175,18 @@ func DoTaskApiRequest(a TaskAdaptor, c *gin.Context, info *common.TaskRelayInfo,
 	}
 	return resp, nil
 }
+
+// DoTaskFetchRequest 查询异步任务状态，在请求的超时时间内读完响应体，调用方可以在取消 context 后继续读取
+func DoTaskFetchRequest(req *http.Request) (*http.Response, error) {
+	resp, err := service.GetHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
@@ -22,8 +22,10 @@ import (
 	"io"
 	"net/http"
 	"veloera/dto"
+	"veloera/relay/channel"
 	"veloera/relay/channel/claude"
 	relaycommon "veloera/relay/common"
+	"veloera/relay/constant"
 	"veloera/setting/model_setting"
 )
 
@@ -36,6 +38,9 @@ type Adaptor struct {
 }
 
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (any, error) {
+	if !isAwsClaudeModel(info, request.Model) {
+		return channel.ConvertClaudeRequest(a, c, info, request)
+	}
 	c.Set("request_model", request.Model)
 	c.Set("converted_request", request)
 	return request, nil
@@ -68,6 +73,12 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
+	if !isAwsClaudeModel(info, request.Model) {
+		// 非 Anthropic 模型使用 Converse，在 DoResponse 中转换为 Converse 请求
+		c.Set("request_model", request.Model)
+		c.Set("converted_request", request)
+		return request, nil
+	}
 
 	var claudeReq *dto.ClaudeRequest
 	var err error
@@ -85,13 +96,13 @@ func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dt
 }
 
 func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+	c.Set("request_model", request.Model)
+	c.Set("converted_request", &request)
+	return request, nil
 }
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
-	// TODO implement me
-	return nil, errors.New("not implemented")
+	return channel.ConvertResponsesRequest(a, c, info, &request)
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
@@ -99,6 +110,22 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *dto.OpenAIErrorWithStatusCode) {
+	if info.RelayMode == constant.RelayModeEmbeddings {
+		err, usage = awsEmbeddingHandler(c, info)
+		return
+	}
+	if request, _ := c.Get("converted_request"); request != nil {
+		if _, ok := request.(*dto.GeneralOpenAIRequest); ok {
+			return channel.DoClaudeResponse(c, info, func() (any, *dto.OpenAIErrorWithStatusCode) {
+				if info.IsStream {
+					err, usage = awsConverseStreamHandler(c, info)
+				} else {
+					err, usage = awsConverseHandler(c, info)
+				}
+				return usage, err
+			})
+		}
+	}
 	if info.IsStream {
 		err, usage = awsStreamHandler(c, resp, info, a.RequestMode)
 	} else {
@@ -0,0 +1,445 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package aws
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"veloera/common"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	"veloera/relay/helper"
+	"veloera/service"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// requestOpenAI2Converse 将 OpenAI chat 请求转换为 Bedrock Converse 请求，
+// Converse 对所有模型家族（Llama、Mistral、Nova、Cohere、DeepSeek 等）使用统一的格式
+func requestOpenAI2Converse(request *dto.GeneralOpenAIRequest, modelId string) (*bedrockruntime.ConverseInput, error) {
+	input := &bedrockruntime.ConverseInput{
+		ModelId: aws.String(modelId),
+	}
+
+	inferenceConfig := &types.InferenceConfiguration{}
+	maxTokens := request.MaxTokens
+	if request.MaxCompletionTokens > maxTokens {
+		maxTokens = request.MaxCompletionTokens
+	}
+	if maxTokens > 0 {
+		inferenceConfig.MaxTokens = aws.Int32(int32(maxTokens))
+	}
+	if request.Temperature != nil {
+		inferenceConfig.Temperature = aws.Float32(float32(*request.Temperature))
+	}
+	if request.TopP > 0 {
+		inferenceConfig.TopP = aws.Float32(float32(request.TopP))
+	}
+	switch stop := request.Stop.(type) {
+	case string:
+		inferenceConfig.StopSequences = []string{stop}
+	case []any:
+		for _, s := range stop {
+			if str, ok := s.(string); ok {
+				inferenceConfig.StopSequences = append(inferenceConfig.StopSequences, str)
+			}
+		}
+	}
+	input.InferenceConfig = inferenceConfig
+
+	for _, message := range request.Messages {
+		switch message.Role {
+		case "system", "developer":
+			if text := message.StringContent(); text != "" {
+				input.System = append(input.System, &types.SystemContentBlockMemberText{Value: text})
+			}
+		case "tool":
+			block := &types.ContentBlockMemberToolResult{
+				Value: types.ToolResultBlock{
+					ToolUseId: aws.String(message.ToolCallId),
+					Content: []types.ToolResultContentBlock{
+						&types.ToolResultContentBlockMemberText{Value: message.StringContent()},
+					},
+				},
+			}
+			input.Messages = appendConverseContent(input.Messages, types.ConversationRoleUser, block)
+		case "assistant":
+			if text := message.StringContent(); text != "" {
+				input.Messages = appendConverseContent(input.Messages, types.ConversationRoleAssistant, &types.ContentBlockMemberText{Value: text})
+			}
+			for _, toolCall := range message.ParseToolCalls() {
+				arguments := make(map[string]any)
+				if toolCall.Function.Arguments != "" {
+					if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &arguments); err != nil {
+						return nil, fmt.Errorf("tool call arguments of %s is not a json object", toolCall.Function.Name)
+					}
+				}
+				input.Messages = appendConverseContent(input.Messages, types.ConversationRoleAssistant, &types.ContentBlockMemberToolUse{
+					Value: types.ToolUseBlock{
+						ToolUseId: aws.String(toolCall.ID),
+						Name:      aws.String(toolCall.Function.Name),
+						Input:     document.NewLazyDocument(arguments),
+					},
+				})
+			}
+		default:
+			blocks, err := converseUserContent(&message)
+			if err != nil {
+				return nil, err
+			}
+			input.Messages = appendConverseContent(input.Messages, types.ConversationRoleUser, blocks...)
+		}
+	}
+
+	toolChoice, useTools := converseToolChoice(request.ToolChoice)
+	if len(request.Tools) > 0 && useTools {
+		toolConfig := &types.ToolConfiguration{ToolChoice: toolChoice}
+		for _, tool := range request.Tools {
+			parameters := tool.Function.Parameters
+			if parameters == nil {
+				parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			spec := types.ToolSpecification{
+				Name:        aws.String(tool.Function.Name),
+				InputSchema: &types.ToolInputSchemaMemberJson{Value: document.NewLazyDocument(parameters)},
+			}
+			if tool.Function.Description != "" {
+				spec.Description = aws.String(tool.Function.Description)
+			}
+			toolConfig.Tools = append(toolConfig.Tools, &types.ToolMemberToolSpec{Value: spec})
+		}
+		input.ToolConfig = toolConfig
+	}
+	return input, nil
+}
+
+// appendConverseContent 追加内容块，Converse 要求 user 与 assistant 交替出现，相同角色的连续消息会被合并
+func appendConverseContent(messages []types.Message, role types.ConversationRole, blocks ...types.ContentBlock) []types.Message {
+	if len(blocks) == 0 {
+		return messages
+	}
+	if len(messages) > 0 && messages[len(messages)-1].Role == role {
+		messages[len(messages)-1].Content = append(messages[len(messages)-1].Content, blocks...)
+		return messages
+	}
+	return append(messages, types.Message{Role: role, Content: blocks})
+}
+
+func converseUserContent(message *dto.Message) ([]types.ContentBlock, error) {
+	if message.IsStringContent() {
+		if text := message.StringContent(); text != "" {
+			return []types.ContentBlock{&types.ContentBlockMemberText{Value: text}}, nil
+		}
+		return nil, nil
+	}
+	blocks := make([]types.ContentBlock, 0)
+	for _, content := range message.ParseContent() {
+		switch content.Type {
+		case dto.ContentTypeText:
+			if content.Text != "" {
+				blocks = append(blocks, &types.ContentBlockMemberText{Value: content.Text})
+			}
+		case dto.ContentTypeImageURL:
+			imageUrl := content.GetImageMedia()
+			var mimeType, base64Data string
+			if strings.HasPrefix(imageUrl.Url, "http") {
+				fileData, err := service.GetFileBase64FromUrl(imageUrl.Url)
+				if err != nil {
+					return nil, fmt.Errorf("get file base64 from url failed: %s", err.Error())
+				}
+				mimeType, base64Data = fileData.MimeType, fileData.Base64Data
+			} else {
+				_, format, data, err := service.DecodeBase64ImageData(imageUrl.Url)
+				if err != nil {
+					return nil, err
+				}
+				mimeType, base64Data = "image/"+format, data
+			}
+			imageBytes, err := base64.StdEncoding.DecodeString(base64Data)
+			if err != nil {
+				return nil, errors.Wrap(err, "decode image")
+			}
+			blocks = append(blocks, &types.ContentBlockMemberImage{
+				Value: types.ImageBlock{
+					Format: types.ImageFormat(strings.TrimPrefix(mimeType, "image/")),
+					Source: &types.ImageSourceMemberBytes{Value: imageBytes},
+				},
+			})
+		default:
+			return nil, fmt.Errorf("content type %s is not supported by bedrock converse", content.Type)
+		}
+	}
+	return blocks, nil
+}
+
+// converseToolChoice 转换 tool_choice，返回 false 表示不应携带工具（tool_choice 为 none）
+func converseToolChoice(toolChoice any) (types.ToolChoice, bool) {
+	switch choice := toolChoice.(type) {
+	case string:
+		switch choice {
+		case "none":
+			return nil, false
+		case "required":
+			return &types.ToolChoiceMemberAny{}, true
+		}
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			if name, ok := function["name"].(string); ok && name != "" {
+				return &types.ToolChoiceMemberTool{Value: types.SpecificToolChoice{Name: aws.String(name)}}, true
+			}
+		}
+	}
+	return &types.ToolChoiceMemberAuto{}, true
+}
+
+func converseFinishReason(stopReason types.StopReason) string {
+	switch stopReason {
+	case types.StopReasonToolUse:
+		return "tool_calls"
+	case types.StopReasonMaxTokens:
+		return "length"
+	case types.StopReasonContentFiltered, types.StopReasonGuardrailIntervened:
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+func converseUsage(tokenUsage *types.TokenUsage) *dto.Usage {
+	usage := &dto.Usage{}
+	if tokenUsage == nil {
+		return usage
+	}
+	usage.PromptTokens = int(aws.ToInt32(tokenUsage.InputTokens))
+	usage.CompletionTokens = int(aws.ToInt32(tokenUsage.OutputTokens))
+	usage.TotalTokens = int(aws.ToInt32(tokenUsage.TotalTokens))
+	usage.PromptTokensDetails.CachedTokens = int(aws.ToInt32(tokenUsage.CacheReadInputTokens))
+	usage.PromptTokensDetails.CachedCreationTokens = int(aws.ToInt32(tokenUsage.CacheWriteInputTokens))
+	return usage
+}
+
+func converseDocumentString(doc document.Interface) string {
+	if doc == nil {
+		return "{}"
+	}
+	data, err := doc.MarshalSmithyDocument()
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+func getConverseRequest(c *gin.Context, info *relaycommon.RelayInfo, region string) (*bedrockruntime.ConverseInput, error) {
+	request, ok := c.Get("converted_request")
+	if !ok {
+		return nil, errors.New("request not found")
+	}
+	openAIRequest, ok := request.(*dto.GeneralOpenAIRequest)
+	if !ok {
+		return nil, errors.New("invalid converse request")
+	}
+	return requestOpenAI2Converse(openAIRequest, awsModelID(info, c.GetString("request_model"), region))
+}
+
+func awsConverseHandler(c *gin.Context, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	awsCli, err := newAwsClient(c, info)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "newAwsClient")), nil
+	}
+	converseInput, err := getConverseRequest(c, info, awsCli.Options().Region)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "convert request")), nil
+	}
+	converseOutput, err := awsCli.Converse(c.Request.Context(), converseInput)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "Converse")), nil
+	}
+
+	message := dto.Message{Role: "assistant"}
+	var textBuilder, reasoningBuilder strings.Builder
+	toolCalls := make([]dto.ToolCallResponse, 0)
+	if output, ok := converseOutput.Output.(*types.ConverseOutputMemberMessage); ok {
+		for _, block := range output.Value.Content {
+			switch v := block.(type) {
+			case *types.ContentBlockMemberText:
+				textBuilder.WriteString(v.Value)
+			case *types.ContentBlockMemberReasoningContent:
+				if reasoningText, ok := v.Value.(*types.ReasoningContentBlockMemberReasoningText); ok {
+					reasoningBuilder.WriteString(aws.ToString(reasoningText.Value.Text))
+				}
+			case *types.ContentBlockMemberToolUse:
+				toolCalls = append(toolCalls, dto.ToolCallResponse{
+					ID:   aws.ToString(v.Value.ToolUseId),
+					Type: "function",
+					Function: dto.FunctionResponse{
+						Name:      aws.ToString(v.Value.Name),
+						Arguments: converseDocumentString(v.Value.Input),
+					},
+				})
+			}
+		}
+	}
+	message.SetStringContent(textBuilder.String())
+	message.ReasoningContent = reasoningBuilder.String()
+	if len(toolCalls) > 0 {
+		message.SetToolCalls(toolCalls)
+	}
+
+	usage := converseUsage(converseOutput.Usage)
+	response := dto.OpenAITextResponse{
+		Id:      fmt.Sprintf("chatcmpl-%s", common.GetUUID()),
+		Model:   info.UpstreamModelName,
+		Object:  "chat.completion",
+		Created: common.GetTimestamp(),
+		Choices: []dto.OpenAITextResponseChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: converseFinishReason(converseOutput.StopReason),
+		}},
+		Usage: *usage,
+	}
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(http.StatusOK)
+	_, _ = c.Writer.Write(responseBody)
+	return nil, usage
+}
+
+func awsConverseStreamHandler(c *gin.Context, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	awsCli, err := newAwsClient(c, info)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "newAwsClient")), nil
+	}
+	converseInput, err := getConverseRequest(c, info, awsCli.Options().Region)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "convert request")), nil
+	}
+	awsResp, err := awsCli.ConverseStream(c.Request.Context(), &bedrockruntime.ConverseStreamInput{
+		ModelId:         converseInput.ModelId,
+		Messages:        converseInput.Messages,
+		System:          converseInput.System,
+		InferenceConfig: converseInput.InferenceConfig,
+		ToolConfig:      converseInput.ToolConfig,
+	})
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "ConverseStream")), nil
+	}
+	stream := awsResp.GetStream()
+	defer stream.Close()
+
+	helper.SetEventStreamHeaders(c)
+	responseId := fmt.Sprintf("chatcmpl-%s", common.GetUUID())
+	createdTime := common.GetTimestamp()
+	usage := &dto.Usage{}
+	var responseText strings.Builder
+	// Converse 的 content block index 到 OpenAI tool_calls index 的映射
+	toolIndexes := make(map[int32]int)
+
+	sendDelta := func(delta dto.ChatCompletionsStreamResponseChoiceDelta, finishReason *string) {
+		response := dto.ChatCompletionsStreamResponse{
+			Id:      responseId,
+			Object:  "chat.completion.chunk",
+			Created: createdTime,
+			Model:   info.UpstreamModelName,
+			Choices: []dto.ChatCompletionsStreamResponseChoice{{
+				Index:        0,
+				Delta:        delta,
+				FinishReason: finishReason,
+			}},
+		}
+		if err := helper.ObjectData(c, response); err != nil {
+			common.LogError(c, "send_stream_response_failed: "+err.Error())
+		}
+	}
+
+	for event := range stream.Events() {
+		info.SetFirstResponseTime()
+		switch v := event.(type) {
+		case *types.ConverseStreamOutputMemberMessageStart:
+			sendDelta(dto.ChatCompletionsStreamResponseChoiceDelta{Role: "assistant"}, nil)
+		case *types.ConverseStreamOutputMemberContentBlockStart:
+			if toolUse, ok := v.Value.Start.(*types.ContentBlockStartMemberToolUse); ok {
+				index := len(toolIndexes)
+				toolIndexes[aws.ToInt32(v.Value.ContentBlockIndex)] = index
+				toolCall := dto.ToolCallResponse{
+					ID:   aws.ToString(toolUse.Value.ToolUseId),
+					Type: "function",
+					Function: dto.FunctionResponse{
+						Name: aws.ToString(toolUse.Value.Name),
+					},
+				}
+				toolCall.SetIndex(index)
+				sendDelta(dto.ChatCompletionsStreamResponseChoiceDelta{ToolCalls: []dto.ToolCallResponse{toolCall}}, nil)
+			}
+		case *types.ConverseStreamOutputMemberContentBlockDelta:
+			switch delta := v.Value.Delta.(type) {
+			case *types.ContentBlockDeltaMemberText:
+				responseText.WriteString(delta.Value)
+				content := delta.Value
+				sendDelta(dto.ChatCompletionsStreamResponseChoiceDelta{Content: &content}, nil)
+			case *types.ContentBlockDeltaMemberReasoningContent:
+				if reasoning, ok := delta.Value.(*types.ReasoningContentBlockDeltaMemberText); ok {
+					responseText.WriteString(reasoning.Value)
+					reasoningContent := reasoning.Value
+					sendDelta(dto.ChatCompletionsStreamResponseChoiceDelta{ReasoningContent: &reasoningContent}, nil)
+				}
+			case *types.ContentBlockDeltaMemberToolUse:
+				arguments := aws.ToString(delta.Value.Input)
+				responseText.WriteString(arguments)
+				toolCall := dto.ToolCallResponse{
+					Type: "function",
+					Function: dto.FunctionResponse{
+						Arguments: arguments,
+					},
+				}
+				toolCall.SetIndex(toolIndexes[aws.ToInt32(v.Value.ContentBlockIndex)])
+				sendDelta(dto.ChatCompletionsStreamResponseChoiceDelta{ToolCalls: []dto.ToolCallResponse{toolCall}}, nil)
+			}
+		case *types.ConverseStreamOutputMemberMessageStop:
+			finishReason := converseFinishReason(v.Value.StopReason)
+			sendDelta(dto.ChatCompletionsStreamResponseChoiceDelta{}, &finishReason)
+		case *types.ConverseStreamOutputMemberMetadata:
+			usage = converseUsage(v.Value.Usage)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return wrapErr(errors.Wrap(err, "ConverseStream")), nil
+	}
+
+	if usage.CompletionTokens == 0 {
+		usage, _ = service.ResponseText2Usage(responseText.String(), info.UpstreamModelName, info.PromptTokens)
+	}
+	if info.ShouldIncludeUsage {
+		response := helper.GenerateFinalUsageResponse(responseId, createdTime, info.UpstreamModelName, *usage)
+		if err := helper.ObjectData(c, response); err != nil {
+			common.SysError("send final response failed: " + err.Error())
+		}
+	}
+	helper.Done(c)
+	return nil, usage
+}
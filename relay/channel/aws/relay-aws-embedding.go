@@ -0,0 +1,170 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package aws
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	"veloera/service"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type awsTitanEmbeddingRequest struct {
+	InputText  string `json:"inputText"`
+	Dimensions int    `json:"dimensions,omitempty"`
+}
+
+type awsTitanEmbeddingResponse struct {
+	Embedding           []float64 `json:"embedding"`
+	InputTextTokenCount int       `json:"inputTextTokenCount"`
+}
+
+type awsCohereEmbeddingRequest struct {
+	Texts     []string `json:"texts"`
+	InputType string   `json:"input_type"`
+	Truncate  string   `json:"truncate,omitempty"`
+}
+
+type awsCohereEmbeddingResponse struct {
+	// embed v3 返回二维数组，指定 embedding_types 时返回 {"float": [...]}
+	Embeddings json.RawMessage `json:"embeddings"`
+}
+
+func (r *awsCohereEmbeddingResponse) floatEmbeddings() ([][]float64, error) {
+	var embeddings [][]float64
+	if err := json.Unmarshal(r.Embeddings, &embeddings); err == nil {
+		return embeddings, nil
+	}
+	var typedEmbeddings struct {
+		Float [][]float64 `json:"float"`
+	}
+	if err := json.Unmarshal(r.Embeddings, &typedEmbeddings); err != nil {
+		return nil, err
+	}
+	return typedEmbeddings.Float, nil
+}
+
+// awsEmbeddingHandler 通过 InvokeModel 调用 Titan 或 Cohere 的嵌入模型，并转换为 OpenAI embeddings 格式
+func awsEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	awsCli, err := newAwsClient(c, info)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "newAwsClient")), nil
+	}
+	request, ok := c.Get("converted_request")
+	if !ok {
+		return wrapErr(errors.New("request not found")), nil
+	}
+	embeddingRequest, ok := request.(*dto.EmbeddingRequest)
+	if !ok {
+		return wrapErr(errors.New("invalid embedding request")), nil
+	}
+	inputs := embeddingRequest.ParseInput()
+	if len(inputs) == 0 {
+		return service.OpenAIErrorWrapperLocal(errors.New("input is empty"), "invalid_request", http.StatusBadRequest), nil
+	}
+	awsModelId := awsModelID(info, c.GetString("request_model"), awsCli.Options().Region)
+
+	usage := &dto.Usage{}
+	response := dto.OpenAIEmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.OpenAIEmbeddingResponseItem, 0, len(inputs)),
+		Model:  info.UpstreamModelName,
+	}
+	invoke := func(body any) ([]byte, error) {
+		requestBody, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		awsResp, err := awsCli.InvokeModel(c.Request.Context(), &bedrockruntime.InvokeModelInput{
+			ModelId:     aws.String(awsModelId),
+			Accept:      aws.String("application/json"),
+			ContentType: aws.String("application/json"),
+			Body:        requestBody,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return awsResp.Body, nil
+	}
+
+	if strings.Contains(awsModelId, "cohere.") {
+		// Cohere 一次请求支持多条文本，但不返回 token 用量
+		responseBody, err := invoke(&awsCohereEmbeddingRequest{
+			Texts:     inputs,
+			InputType: "search_document",
+			Truncate:  "END",
+		})
+		if err != nil {
+			return wrapErr(errors.Wrap(err, "InvokeModel")), nil
+		}
+		var cohereResponse awsCohereEmbeddingResponse
+		if err = json.Unmarshal(responseBody, &cohereResponse); err != nil {
+			return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+		}
+		embeddings, err := cohereResponse.floatEmbeddings()
+		if err != nil {
+			return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+		}
+		for i, embedding := range embeddings {
+			response.Data = append(response.Data, dto.OpenAIEmbeddingResponseItem{
+				Object:    "embedding",
+				Index:     i,
+				Embedding: embedding,
+			})
+		}
+		usage.PromptTokens = info.PromptTokens
+	} else {
+		// Titan 每次请求只接受一条文本
+		for i, input := range inputs {
+			responseBody, err := invoke(&awsTitanEmbeddingRequest{
+				InputText:  input,
+				Dimensions: embeddingRequest.Dimensions,
+			})
+			if err != nil {
+				return wrapErr(errors.Wrap(err, "InvokeModel")), nil
+			}
+			var titanResponse awsTitanEmbeddingResponse
+			if err = json.Unmarshal(responseBody, &titanResponse); err != nil {
+				return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+			}
+			response.Data = append(response.Data, dto.OpenAIEmbeddingResponseItem{
+				Object:    "embedding",
+				Index:     i,
+				Embedding: titanResponse.Embedding,
+			})
+			usage.PromptTokens += titanResponse.InputTextTokenCount
+		}
+	}
+	usage.TotalTokens = usage.PromptTokens
+	response.Usage = *usage
+
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(http.StatusOK)
+	_, _ = c.Writer.Write(responseBody)
+	return nil, usage
+}
@@ -24,11 +24,13 @@ import (
 	"net/http"
 	"strings"
 	"veloera/common"
+	"veloera/constant"
 	"veloera/dto"
 	"veloera/relay/channel/claude"
 	relaycommon "veloera/relay/common"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
@@ -58,8 +60,14 @@ func newAwsClient(c *gin.Context, info *relaycommon.RelayInfo) (*bedrockruntime.
 }
 
 func wrapErr(err error) *dto.OpenAIErrorWithStatusCode {
+	statusCode := http.StatusInternalServerError
+	// 保留 Bedrock 返回的状态码，例如 400 参数错误、429 限流
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) && responseErr.HTTPStatusCode() > 0 {
+		statusCode = responseErr.HTTPStatusCode()
+	}
 	return &dto.OpenAIErrorWithStatusCode{
-		StatusCode: http.StatusInternalServerError,
+		StatusCode: statusCode,
 		Error: dto.OpenAIError{
 			Message: fmt.Sprintf("%s", err.Error()),
 		},
@@ -88,12 +96,37 @@ func awsModelCrossRegion(awsModelId, awsRegionPrefix string) string {
 	return modelPrefix + "." + awsModelId
 }
 
-func awsModelID(requestModel string) (string, error) {
+// awsBaseModelID 优先使用渠道设置 aws_model_ids 中配置的模型 ID 或推理配置文件 ARN，
+// 其次是内置的 Claude 模型映射，都没有时直接把模型名当作 Bedrock 模型 ID
+func awsBaseModelID(info *relaycommon.RelayInfo, requestModel string) (string, bool) {
+	if modelIds, ok := info.ChannelSetting[constant.ChannelSettingAwsModelIds].(map[string]interface{}); ok {
+		if modelId, ok := modelIds[requestModel].(string); ok && modelId != "" {
+			return modelId, true
+		}
+	}
 	if awsModelID, ok := awsModelIDMap[requestModel]; ok {
-		return awsModelID, nil
+		return awsModelID, false
+	}
+	return requestModel, false
+}
+
+// awsModelID 返回最终请求的模型 ID，内置模型会根据区域自动使用跨区域推理配置文件
+func awsModelID(info *relaycommon.RelayInfo, requestModel string, region string) string {
+	awsModelId, configured := awsBaseModelID(info, requestModel)
+	if configured {
+		return awsModelId
 	}
+	awsRegionPrefix := awsRegionPrefix(region)
+	if awsModelCanCrossRegion(awsModelId, awsRegionPrefix) {
+		awsModelId = awsModelCrossRegion(awsModelId, awsRegionPrefix)
+	}
+	return awsModelId
+}
 
-	return requestModel, nil
+// isAwsClaudeModel Anthropic 模型继续使用 InvokeModel 原生 messages 格式，其余模型走 Converse
+func isAwsClaudeModel(info *relaycommon.RelayInfo, requestModel string) bool {
+	awsModelId, _ := awsBaseModelID(info, requestModel)
+	return strings.Contains(awsModelId, "anthropic.")
 }
 
 func awsHandler(c *gin.Context, info *relaycommon.RelayInfo, requestMode int) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
@@ -102,16 +135,7 @@ func awsHandler(c *gin.Context, info *relaycommon.RelayInfo, requestMode int) (*
 		return wrapErr(errors.Wrap(err, "newAwsClient")), nil
 	}
 
-	awsModelId, err := awsModelID(c.GetString("request_model"))
-	if err != nil {
-		return wrapErr(errors.Wrap(err, "awsModelID")), nil
-	}
-
-	awsRegionPrefix := awsRegionPrefix(awsCli.Options().Region)
-	canCrossRegion := awsModelCanCrossRegion(awsModelId, awsRegionPrefix)
-	if canCrossRegion {
-		awsModelId = awsModelCrossRegion(awsModelId, awsRegionPrefix)
-	}
+	awsModelId := awsModelID(info, c.GetString("request_model"), awsCli.Options().Region)
 
 	awsReq := &bedrockruntime.InvokeModelInput{
 		ModelId:     aws.String(awsModelId),
@@ -153,16 +177,7 @@ func awsStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 		return wrapErr(errors.Wrap(err, "newAwsClient")), nil
 	}
 
-	awsModelId, err := awsModelID(c.GetString("request_model"))
-	if err != nil {
-		return wrapErr(errors.Wrap(err, "awsModelID")), nil
-	}
-
-	awsRegionPrefix := awsRegionPrefix(awsCli.Options().Region)
-	canCrossRegion := awsModelCanCrossRegion(awsModelId, awsRegionPrefix)
-	if canCrossRegion {
-		awsModelId = awsModelCrossRegion(awsModelId, awsRegionPrefix)
-	}
+	awsModelId := awsModelID(info, c.GetString("request_model"), awsCli.Options().Region)
 
 	awsReq := &bedrockruntime.InvokeModelWithResponseStreamInput{
 		ModelId:     aws.String(awsModelId),
@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"strings"
 	"veloera/common"
+	"veloera/constant"
 	"veloera/dto"
 	relaycommon "veloera/relay/common"
 	"veloera/relay/helper"
@@ -42,6 +43,8 @@ func stopReasonClaude2OpenAI(reason string) string {
 		return "max_tokens"
 	case "tool_use":
 		return "tool_calls"
+	case "refusal":
+		return constant.FinishReasonContentFilter
 	default:
 		return reason
 	}
@@ -452,6 +455,21 @@ type ClaudeResponseInfo struct {
 	Usage        *dto.Usage
 }
 
+// writeClaudeStreamText 累计流式响应中的文本、推理内容和工具调用参数，用于估算补全 tokens
+func writeClaudeStreamText(claudeInfo *ClaudeResponseInfo, claudeResponse *dto.ClaudeResponse) {
+	if claudeResponse.ContentBlock != nil && claudeResponse.ContentBlock.Type == "tool_use" {
+		claudeInfo.ResponseText.WriteString(claudeResponse.ContentBlock.Name)
+	}
+	if claudeResponse.Delta == nil {
+		return
+	}
+	claudeInfo.ResponseText.WriteString(claudeResponse.Delta.GetText())
+	claudeInfo.ResponseText.WriteString(claudeResponse.Delta.Thinking)
+	if claudeResponse.Delta.PartialJson != nil {
+		claudeInfo.ResponseText.WriteString(*claudeResponse.Delta.PartialJson)
+	}
+}
+
 func FormatClaudeResponseInfo(requestMode int, claudeResponse *dto.ClaudeResponse, oaiResponse *dto.ChatCompletionsStreamResponse, claudeInfo *ClaudeResponseInfo) bool {
 	if claudeResponse.Type == "message_start" {
 		// message_start, 获取usage
@@ -459,9 +477,7 @@ func FormatClaudeResponseInfo(requestMode int, claudeResponse *dto.ClaudeRespons
 		claudeInfo.Model = claudeResponse.Message.Model
 		claudeInfo.Usage.PromptTokens = claudeResponse.Message.Usage.InputTokens
 	} else if claudeResponse.Type == "content_block_delta" {
-		if claudeResponse.Delta.Text != nil {
-			claudeInfo.ResponseText.WriteString(*claudeResponse.Delta.Text)
-		}
+		writeClaudeStreamText(claudeInfo, claudeResponse)
 	} else if claudeResponse.Type == "message_delta" {
 		claudeInfo.Usage.CompletionTokens = claudeResponse.Usage.OutputTokens
 		if claudeResponse.Usage.InputTokens > 0 {
@@ -469,6 +485,7 @@ func FormatClaudeResponseInfo(requestMode int, claudeResponse *dto.ClaudeRespons
 		}
 		claudeInfo.Usage.TotalTokens = claudeInfo.Usage.PromptTokens + claudeResponse.Usage.OutputTokens
 	} else if claudeResponse.Type == "content_block_start" {
+		writeClaudeStreamText(claudeInfo, claudeResponse)
 	} else {
 		return false
 	}
@@ -505,8 +522,8 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 			claudeInfo.Usage.PromptTokensDetails.CachedTokens = claudeResponse.Message.Usage.CacheReadInputTokens
 			claudeInfo.Usage.PromptTokensDetails.CachedCreationTokens = claudeResponse.Message.Usage.CacheCreationInputTokens
 			claudeInfo.Usage.CompletionTokens = claudeResponse.Message.Usage.OutputTokens
-		} else if claudeResponse.Type == "content_block_delta" {
-			claudeInfo.ResponseText.WriteString(claudeResponse.Delta.GetText())
+		} else if claudeResponse.Type == "content_block_delta" || claudeResponse.Type == "content_block_start" {
+			writeClaudeStreamText(claudeInfo, &claudeResponse)
 		} else if claudeResponse.Type == "message_delta" {
 			if claudeResponse.Usage.InputTokens > 0 {
 				// 不叠加，只取最新的
@@ -516,7 +533,7 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 			claudeInfo.Usage.TotalTokens = claudeInfo.Usage.PromptTokens + claudeInfo.Usage.CompletionTokens
 		}
 		helper.ClaudeChunkData(c, claudeResponse, data)
-	} else if info.RelayFormat == relaycommon.RelayFormatOpenAI {
+	} else if info.RelayFormat == relaycommon.RelayFormatOpenAI || info.RelayFormat == relaycommon.RelayFormatGemini {
 		response := StreamResponseClaude2OpenAI(requestMode, &claudeResponse)
 
 		if !FormatClaudeResponseInfo(requestMode, &claudeResponse, response, claudeInfo) {
@@ -534,19 +551,10 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 func HandleStreamFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, claudeInfo *ClaudeResponseInfo, requestMode int) {
 	if info.RelayFormat == relaycommon.RelayFormatClaude {
 		// 说明流模式建立失败，可能为官方出错
-		if claudeInfo.Usage.PromptTokens == 0 {
-			//usage.PromptTokens = info.PromptTokens
-		}
-		if claudeInfo.Usage.CompletionTokens == 0 {
-			claudeInfo.Usage, _ = service.ResponseText2Usage(claudeInfo.ResponseText.String(), info.UpstreamModelName, claudeInfo.Usage.PromptTokens)
-		}
-	} else if info.RelayFormat == relaycommon.RelayFormatOpenAI {
-		if claudeInfo.Usage.PromptTokens == 0 {
-			//上游出错
-		}
-		if claudeInfo.Usage.CompletionTokens == 0 {
-			claudeInfo.Usage, _ = service.ResponseText2Usage(claudeInfo.ResponseText.String(), info.UpstreamModelName, claudeInfo.Usage.PromptTokens)
-		}
+		claudeInfo.Usage = service.SettleStreamUsage(info, claudeInfo.Usage, claudeInfo.ResponseText.String(), 0)
+	} else if info.RelayFormat == relaycommon.RelayFormatOpenAI || info.RelayFormat == relaycommon.RelayFormatGemini {
+		// 上游未返回 usage（例如流被中断）时按已下发内容估算
+		claudeInfo.Usage = service.SettleStreamUsage(info, claudeInfo.Usage, claudeInfo.ResponseText.String(), 0)
 		if info.ShouldIncludeUsage {
 			response := helper.GenerateFinalUsageResponse(claudeInfo.ResponseId, claudeInfo.Created, info.UpstreamModelName, *claudeInfo.Usage)
 			err := helper.ObjectData(c, response)
@@ -605,7 +613,7 @@ func HandleClaudeResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 	claudeInfo.Usage.PromptTokensDetails.CachedCreationTokens = claudeResponse.Usage.CacheCreationInputTokens
 	var responseData []byte
 	switch info.RelayFormat {
-	case relaycommon.RelayFormatOpenAI:
+	case relaycommon.RelayFormatOpenAI, relaycommon.RelayFormatGemini:
 		openaiResponse := ResponseClaude2OpenAI(requestMode, &claudeResponse)
 		openaiResponse.Usage = *claudeInfo.Usage
 		responseData, err = json.Marshal(openaiResponse)
@@ -0,0 +1,56 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package channel
+
+import (
+	"github.com/gin-gonic/gin"
+	"veloera/dto"
+	"veloera/relay/common"
+	"veloera/relay/constant"
+	"veloera/service"
+)
+
+// ConvertClaudeRequest converts a claude messages request into an openai chat completion request
+// and hands it to the adaptor's own openai conversion, so any chat completion adaptor can serve /v1/messages.
+func ConvertClaudeRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, request *dto.ClaudeRequest) (any, error) {
+	openAIRequest, err := service.ClaudeToOpenAIRequest(*request, info)
+	if err != nil {
+		return nil, err
+	}
+	if openAIRequest.Stream && info.SupportStreamOptions {
+		openAIRequest.StreamOptions = &dto.StreamOptions{
+			IncludeUsage: true,
+		}
+	}
+	// from here on the upstream request is a plain chat completion
+	info.RelayMode = constant.RelayModeChatCompletions
+	info.RequestURLPath = "/v1/chat/completions"
+	return a.ConvertOpenAIRequest(c, info, openAIRequest)
+}
+
+// DoClaudeResponse runs a response handler that writes the openai chat completion format and
+// translates its output into the claude messages format when the request came in via /v1/messages.
+func DoClaudeResponse(c *gin.Context, info *common.RelayInfo, handler func() (any, *dto.OpenAIErrorWithStatusCode)) (any, *dto.OpenAIErrorWithStatusCode) {
+	if info.RelayFormat != common.RelayFormatClaude {
+		return handler()
+	}
+	writer := service.NewOpenAI2ClaudeWriter(c, info)
+	usage, err := handler()
+	textUsage, _ := usage.(*dto.Usage)
+	writer.Finish(textUsage, err)
+	return usage, err
+}
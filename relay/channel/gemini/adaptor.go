@@ -23,9 +23,11 @@ import (
 	"io"
 	"net/http"
 	"veloera/common"
+	"veloera/constant"
 	"veloera/dto"
 	"veloera/relay/channel"
 	relaycommon "veloera/relay/common"
+	relayconstant "veloera/relay/constant"
 	"veloera/service"
 	"veloera/setting/model_setting"
 
@@ -37,10 +39,8 @@ import (
 type Adaptor struct {
 }
 
-func (a *Adaptor) ConvertClaudeRequest(*gin.Context, *relaycommon.RelayInfo, *dto.ClaudeRequest) (any, error) {
-	//TODO implement me
-	panic("implement me")
-	return nil, nil
+func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (any, error) {
+	return channel.ConvertClaudeRequest(a, c, info, request)
 }
 
 func (a *Adaptor) ConvertAudioRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.AudioRequest) (io.Reader, error) {
@@ -49,36 +49,17 @@ func (a *Adaptor) ConvertAudioRequest(c *gin.Context, info *relaycommon.RelayInf
 }
 
 func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
+	if IsGeminiImageModel(info.UpstreamModelName) {
+		return ImageRequest2GeminiChat(request, info.RelayMode), nil
+	}
 	if !strings.HasPrefix(info.UpstreamModelName, "imagen") {
 		return nil, errors.New("not supported model for image generation")
 	}
-
-	// convert size to aspect ratio
-	aspectRatio := "1:1" // default aspect ratio
-	switch request.Size {
-	case "1024x1024":
-		aspectRatio = "1:1"
-	case "1024x1792":
-		aspectRatio = "9:16"
-	case "1792x1024":
-		aspectRatio = "16:9"
+	// Gemini API 的 imagen 仅支持文生图，编辑需要通过 Vertex 渠道
+	if info.RelayMode != relayconstant.RelayModeImagesGenerations {
+		return nil, errors.New("imagen on gemini api only supports image generation")
 	}
-
-	// build gemini imagen request
-	geminiRequest := GeminiImageRequest{
-		Instances: []GeminiImageInstance{
-			{
-				Prompt: request.Prompt,
-			},
-		},
-		Parameters: GeminiImageParameters{
-			SampleCount:      request.N,
-			AspectRatio:      aspectRatio,
-			PersonGeneration: "allow_adult", // default allow adult
-		},
-	}
-
-	return geminiRequest, nil
+	return ImageRequest2Imagen(request, info.RelayMode)
 }
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
@@ -172,8 +153,7 @@ func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.Rela
 }
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
-	// TODO implement me
-	return nil, errors.New("not implemented")
+	return channel.ConvertResponsesRequest(a, c, info, &request)
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
@@ -181,7 +161,21 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *dto.OpenAIErrorWithStatusCode) {
-	if strings.HasPrefix(info.UpstreamModelName, "imagen") {
+	if info.RelayFormat == relaycommon.RelayFormatGemini {
+		if info.IsStream {
+			err, usage = GeminiNativeStreamHandler(c, resp, info)
+		} else {
+			err, usage = GeminiNativeHandler(c, resp, info)
+		}
+		return
+	}
+	return channel.DoClaudeResponse(c, info, func() (any, *dto.OpenAIErrorWithStatusCode) {
+		return a.doResponse(c, resp, info)
+	})
+}
+
+func (a *Adaptor) doResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *dto.OpenAIErrorWithStatusCode) {
+	if strings.HasPrefix(info.UpstreamModelName, "imagen") || relayconstant.IsImageRelayMode(info.RelayMode) {
 		return GeminiImageHandler(c, resp, info)
 	}
 
@@ -224,10 +218,6 @@ func GeminiImageHandler(c *gin.Context, resp *http.Response, info *relaycommon.R
 		return nil, service.OpenAIErrorWrapper(jsonErr, "unmarshal_response_body_failed", http.StatusInternalServerError)
 	}
 
-	if len(geminiResponse.Predictions) == 0 {
-		return nil, service.OpenAIErrorWrapper(errors.New("no images generated"), "no_images", http.StatusBadRequest)
-	}
-
 	// convert to openai format response
 	openAIResponse := dto.ImageResponse{
 		Created: common.GetTimestamp(),
@@ -242,6 +232,25 @@ func GeminiImageHandler(c *gin.Context, resp *http.Response, info *relaycommon.R
 			B64Json: prediction.BytesBase64Encoded,
 		})
 	}
+	// gemini 图片模型的图片位于 candidates 的 inlineData 中
+	for _, candidate := range geminiResponse.Candidates {
+		for _, part := range candidate.Content.Parts {
+			if part.InlineData == nil || !strings.HasPrefix(part.InlineData.MimeType, "image/") {
+				continue
+			}
+			openAIResponse.Data = append(openAIResponse.Data, dto.ImageData{
+				B64Json: part.InlineData.Data,
+			})
+		}
+	}
+
+	if len(openAIResponse.Data) == 0 {
+		return nil, service.OpenAIErrorWrapper(errors.New("no images generated"), "no_images", http.StatusBadRequest)
+	}
+
+	if normalizeErr := service.NormalizeImageResponse(&openAIResponse, c.GetString(constant.ContextKeyImageFormat)); normalizeErr != nil {
+		return nil, service.OpenAIErrorWrapper(normalizeErr, "normalize_image_response_failed", http.StatusInternalServerError)
+	}
 
 	jsonResponse, jsonErr := json.Marshal(openAIResponse)
 	if jsonErr != nil {
@@ -262,6 +271,13 @@ func GeminiImageHandler(c *gin.Context, resp *http.Response, info *relaycommon.R
 		CompletionTokens: 0,                             // image generation does not calculate completion tokens
 		TotalTokens:      imageTokens * generatedImages,
 	}
+	if geminiResponse.UsageMetadata.TotalTokenCount > 0 {
+		usage = &dto.Usage{
+			PromptTokens:     geminiResponse.UsageMetadata.PromptTokenCount,
+			CompletionTokens: geminiResponse.UsageMetadata.CandidatesTokenCount + geminiResponse.UsageMetadata.ThoughtsTokenCount,
+			TotalTokens:      geminiResponse.UsageMetadata.TotalTokenCount,
+		}
+	}
 
 	return usage, nil
 }
@@ -0,0 +1,268 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package gemini
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"veloera/common"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type streamToolCall struct {
+	name      string
+	arguments strings.Builder
+}
+
+// OpenAI2GeminiWriter replaces the gin response writer while an adaptor that only speaks the
+// openai chat completions format handles a native gemini request. Everything the adaptor writes
+// (a json body or an SSE stream) is translated into the gemini generateContent format on the fly.
+type OpenAI2GeminiWriter struct {
+	gin.ResponseWriter
+	c      *gin.Context
+	info   *relaycommon.RelayInfo
+	buffer bytes.Buffer
+	status int
+
+	// gemini sends whole function calls, so streamed tool call arguments are collected
+	// until the stream finishes
+	toolCalls    []*streamToolCall
+	finishReason string
+	usage        *dto.Usage
+	sendCount    int
+}
+
+func NewOpenAI2GeminiWriter(c *gin.Context, info *relaycommon.RelayInfo) *OpenAI2GeminiWriter {
+	w := &OpenAI2GeminiWriter{
+		ResponseWriter: c.Writer,
+		c:              c,
+		info:           info,
+		status:         http.StatusOK,
+	}
+	c.Writer = w
+	return w
+}
+
+func (w *OpenAI2GeminiWriter) isStream() bool {
+	return strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+}
+
+func (w *OpenAI2GeminiWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+	if w.isStream() {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *OpenAI2GeminiWriter) WriteHeaderNow() {
+	if w.isStream() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *OpenAI2GeminiWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if w.isStream() {
+		w.convertStreamLines(false)
+	}
+	return len(data), nil
+}
+
+func (w *OpenAI2GeminiWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *OpenAI2GeminiWriter) Flush() {
+	if w.isStream() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// convertStreamLines converts every complete SSE line in the buffer, the trailing partial line is kept
+// until more data arrives (or flushed when all is true)
+func (w *OpenAI2GeminiWriter) convertStreamLines(all bool) {
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			if !all {
+				rest := line + w.buffer.String()
+				w.buffer.Reset()
+				w.buffer.WriteString(rest)
+				return
+			}
+			if line != "" {
+				w.convertStreamLine(line)
+			}
+			return
+		}
+		w.convertStreamLine(line)
+	}
+}
+
+func (w *OpenAI2GeminiWriter) convertStreamLine(line string) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, ":") {
+		// keep alive comments are ignored by the gemini sdks, pass them through
+		_, _ = w.ResponseWriter.WriteString(line + "\n\n")
+		w.ResponseWriter.Flush()
+		return
+	}
+	if !strings.HasPrefix(line, "data:") {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "" || strings.HasPrefix(data, "[DONE]") {
+		return
+	}
+	var streamResponse dto.ChatCompletionsStreamResponse
+	if err := common.DecodeJsonStr(data, &streamResponse); err != nil {
+		common.LogError(w.c, "error unmarshalling stream response: "+err.Error())
+		return
+	}
+	if service.ValidUsage(streamResponse.Usage) {
+		w.usage = streamResponse.Usage
+	}
+	parts := make([]GeminiPart, 0)
+	for _, choice := range streamResponse.Choices {
+		if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+			parts = append(parts, GeminiPart{Text: reasoning, Thought: true})
+		}
+		if text := choice.Delta.GetContentString(); text != "" {
+			parts = append(parts, GeminiPart{Text: text})
+		}
+		for _, toolCall := range choice.Delta.ToolCalls {
+			w.collectToolCall(toolCall)
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			w.finishReason = *choice.FinishReason
+		}
+	}
+	if len(parts) > 0 {
+		w.writeGeminiChunk(parts, nil)
+	}
+}
+
+func (w *OpenAI2GeminiWriter) collectToolCall(toolCall dto.ToolCallResponse) {
+	var current *streamToolCall
+	if toolCall.Index != nil {
+		for len(w.toolCalls) <= *toolCall.Index {
+			w.toolCalls = append(w.toolCalls, &streamToolCall{})
+		}
+		current = w.toolCalls[*toolCall.Index]
+	} else if toolCall.ID != "" || len(w.toolCalls) == 0 {
+		current = &streamToolCall{}
+		w.toolCalls = append(w.toolCalls, current)
+	} else {
+		current = w.toolCalls[len(w.toolCalls)-1]
+	}
+	if toolCall.Function.Name != "" {
+		current.name = toolCall.Function.Name
+	}
+	current.arguments.WriteString(toolCall.Function.Arguments)
+}
+
+func (w *OpenAI2GeminiWriter) writeGeminiChunk(parts []GeminiPart, usage *dto.Usage) {
+	candidate := GeminiChatCandidate{
+		Content: GeminiChatContent{
+			Role:  "model",
+			Parts: parts,
+		},
+	}
+	response := GeminiChatResponse{
+		Candidates:   []GeminiChatCandidate{candidate},
+		ModelVersion: w.info.UpstreamModelName,
+	}
+	if usage != nil {
+		finishReason := finishReasonOpenAI2Gemini(w.finishReason)
+		response.Candidates[0].FinishReason = &finishReason
+		response.UsageMetadata = usageOpenAI2Gemini(usage)
+	}
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		common.SysError("error marshalling gemini response: " + err.Error())
+		return
+	}
+	w.sendCount++
+	_, _ = w.ResponseWriter.WriteString(fmt.Sprintf("data: %s\r\n\r\n", jsonData))
+	w.ResponseWriter.Flush()
+}
+
+// Finish restores the original writer and emits whatever is still pending: the last chunk of a
+// stream with the collected function calls, finish reason and usage, or the converted body of a
+// non-stream response. When the handler failed before writing anything the original writer is
+// restored untouched so the caller can render the error.
+func (w *OpenAI2GeminiWriter) Finish(usage *dto.Usage, openaiErr *dto.OpenAIErrorWithStatusCode) {
+	w.c.Writer = w.ResponseWriter
+	if w.isStream() {
+		w.convertStreamLines(true)
+		if openaiErr != nil && w.sendCount == 0 && len(w.toolCalls) == 0 {
+			return
+		}
+		if usage == nil {
+			usage = w.usage
+		}
+		if usage == nil {
+			usage = &dto.Usage{}
+		}
+		parts := make([]GeminiPart, 0, len(w.toolCalls))
+		for _, toolCall := range w.toolCalls {
+			parts = append(parts, GeminiPart{
+				FunctionCall: &FunctionCall{
+					FunctionName: toolCall.name,
+					Arguments:    toolCallArguments2Gemini(toolCall.arguments.String()),
+				},
+			})
+		}
+		w.writeGeminiChunk(parts, usage)
+		return
+	}
+	if openaiErr != nil || w.buffer.Len() == 0 {
+		return
+	}
+
+	body := w.buffer.Bytes()
+	var openAIResponse dto.OpenAITextResponse
+	if err := common.DecodeJson(body, &openAIResponse); err != nil || w.status != http.StatusOK {
+		// not a chat completion, pass it through as is
+		w.ResponseWriter.WriteHeader(w.status)
+		_, _ = w.ResponseWriter.Write(body)
+		return
+	}
+	if usage != nil && openAIResponse.Usage.TotalTokens == 0 {
+		openAIResponse.Usage = *usage
+	}
+	geminiResponse := ResponseOpenAI2Gemini(&openAIResponse)
+	geminiResponse.ModelVersion = w.info.UpstreamModelName
+	geminiBody, err := json.Marshal(geminiResponse)
+	if err != nil {
+		common.SysError("error marshalling gemini response: " + err.Error())
+		return
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(geminiBody)
+}
@@ -16,12 +16,50 @@
 // along with this program. If not, see <https://www.gnu.org/licenses/>.
 package gemini
 
+import "encoding/json"
+
 type GeminiChatRequest struct {
 	Contents           []GeminiChatContent        `json:"contents"`
 	SafetySettings     []GeminiChatSafetySettings `json:"safety_settings,omitempty"`
 	GenerationConfig   GeminiChatGenerationConfig `json:"generation_config,omitempty"`
 	Tools              []GeminiChatTool           `json:"tools,omitempty"`
 	SystemInstructions *GeminiChatContent         `json:"system_instruction,omitempty"`
+	ToolConfig         *GeminiToolConfig          `json:"toolConfig,omitempty"`
+}
+
+// UnmarshalJSON accepts both the snake_case keys we send upstream and the camelCase keys
+// used by the google sdks when a request comes in through the native gemini api
+func (r *GeminiChatRequest) UnmarshalJSON(data []byte) error {
+	type geminiChatRequest GeminiChatRequest
+	var request struct {
+		geminiChatRequest
+		SafetySettings    []GeminiChatSafetySettings  `json:"safetySettings"`
+		GenerationConfig  *GeminiChatGenerationConfig `json:"generationConfig"`
+		SystemInstruction *GeminiChatContent          `json:"systemInstruction"`
+	}
+	if err := json.Unmarshal(data, &request); err != nil {
+		return err
+	}
+	*r = GeminiChatRequest(request.geminiChatRequest)
+	if request.SafetySettings != nil {
+		r.SafetySettings = request.SafetySettings
+	}
+	if request.GenerationConfig != nil {
+		r.GenerationConfig = *request.GenerationConfig
+	}
+	if request.SystemInstruction != nil {
+		r.SystemInstructions = request.SystemInstruction
+	}
+	return nil
+}
+
+type GeminiToolConfig struct {
+	FunctionCallingConfig *GeminiFunctionCallingConfig `json:"functionCallingConfig,omitempty"`
+}
+
+type GeminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode,omitempty"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
 }
 
 type GeminiThinkingConfig struct {
@@ -49,8 +87,10 @@ type GeminiFunctionResponseContent struct {
 }
 
 type FunctionResponse struct {
-	Name     string                        `json:"name"`
-	Response GeminiFunctionResponseContent `json:"response"`
+	Name string `json:"name"`
+	// Response is a GeminiFunctionResponseContent when we build the request, but any json object
+	// when it comes from a native gemini client
+	Response any `json:"response"`
 }
 
 type GeminiPartExecutableCode struct {
@@ -130,6 +170,7 @@ type GeminiChatResponse struct {
 	Candidates     []GeminiChatCandidate    `json:"candidates"`
 	PromptFeedback GeminiChatPromptFeedback `json:"promptFeedback"`
 	UsageMetadata  GeminiUsageMetadata      `json:"usageMetadata"`
+	ModelVersion   string                   `json:"modelVersion,omitempty"`
 }
 
 type GeminiUsageMetadata struct {
@@ -146,17 +187,39 @@ type GeminiImageRequest struct {
 }
 
 type GeminiImageInstance struct {
-	Prompt string `json:"prompt"`
+	Prompt          string                 `json:"prompt"`
+	ReferenceImages []GeminiReferenceImage `json:"referenceImages,omitempty"`
+}
+
+// GeminiReferenceImage Vertex Imagen 编辑接口的参考图片
+type GeminiReferenceImage struct {
+	ReferenceType   string                 `json:"referenceType"`
+	ReferenceId     int                    `json:"referenceId"`
+	ReferenceImage  GeminiImageBytes       `json:"referenceImage"`
+	MaskImageConfig *GeminiMaskImageConfig `json:"maskImageConfig,omitempty"`
+}
+
+type GeminiImageBytes struct {
+	BytesBase64Encoded string `json:"bytesBase64Encoded"`
+}
+
+type GeminiMaskImageConfig struct {
+	MaskMode string  `json:"maskMode"`
+	Dilation float64 `json:"dilation,omitempty"`
 }
 
 type GeminiImageParameters struct {
 	SampleCount      int    `json:"sampleCount,omitempty"`
 	AspectRatio      string `json:"aspectRatio,omitempty"`
 	PersonGeneration string `json:"personGeneration,omitempty"`
+	EditMode         string `json:"editMode,omitempty"`
 }
 
 type GeminiImageResponse struct {
 	Predictions []GeminiImagePrediction `json:"predictions"`
+	// gemini 图片模型通过 generateContent 返回图片
+	Candidates    []GeminiChatCandidate `json:"candidates"`
+	UsageMetadata GeminiUsageMetadata   `json:"usageMetadata"`
 }
 
 type GeminiImagePrediction struct {
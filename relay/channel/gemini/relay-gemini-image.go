@@ -0,0 +1,167 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package gemini
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"veloera/dto"
+	"veloera/relay/constant"
+)
+
+// IsGeminiImageModel 判断是否为通过 generateContent 输出图片的 gemini 模型
+func IsGeminiImageModel(model string) bool {
+	return strings.HasPrefix(model, "gemini") && strings.Contains(model, "image")
+}
+
+func imageSizeToAspectRatio(size string) string {
+	switch size {
+	case "1024x1792":
+		return "9:16"
+	case "1792x1024":
+		return "16:9"
+	case "1024x1536":
+		return "3:4"
+	case "1536x1024":
+		return "4:3"
+	}
+	return "1:1"
+}
+
+// ImageRequest2Imagen 将 OpenAI 图片请求转换为 Imagen predict 请求，编辑请求使用参考图片
+func ImageRequest2Imagen(request dto.ImageRequest, relayMode int) (*GeminiImageRequest, error) {
+	if relayMode == constant.RelayModeImagesVariations {
+		return nil, errors.New("imagen does not support image variations")
+	}
+	imagenRequest := &GeminiImageRequest{
+		Instances: []GeminiImageInstance{
+			{
+				Prompt: request.Prompt,
+			},
+		},
+		Parameters: GeminiImageParameters{
+			SampleCount:      request.N,
+			AspectRatio:      imageSizeToAspectRatio(request.Size),
+			PersonGeneration: "allow_adult", // default allow adult
+		},
+	}
+	if relayMode != constant.RelayModeImagesEdits {
+		return imagenRequest, nil
+	}
+	if len(request.Images) != 1 {
+		return nil, errors.New("imagen edits require exactly one image")
+	}
+	// 编辑模式不支持设置宽高比，输出与原图一致
+	imagenRequest.Parameters.AspectRatio = ""
+	instance := &imagenRequest.Instances[0]
+	instance.ReferenceImages = append(instance.ReferenceImages, GeminiReferenceImage{
+		ReferenceType: "REFERENCE_TYPE_RAW",
+		ReferenceId:   1,
+		ReferenceImage: GeminiImageBytes{
+			BytesBase64Encoded: base64.StdEncoding.EncodeToString(request.Images[0].Data),
+		},
+	})
+	if request.Mask != nil {
+		mask, err := convertAlphaMask(request.Mask.Data)
+		if err != nil {
+			return nil, err
+		}
+		instance.ReferenceImages = append(instance.ReferenceImages, GeminiReferenceImage{
+			ReferenceType: "REFERENCE_TYPE_MASK",
+			ReferenceId:   2,
+			ReferenceImage: GeminiImageBytes{
+				BytesBase64Encoded: base64.StdEncoding.EncodeToString(mask),
+			},
+			MaskImageConfig: &GeminiMaskImageConfig{
+				MaskMode: "MASK_MODE_USER_PROVIDED",
+			},
+		})
+		imagenRequest.Parameters.EditMode = "EDIT_MODE_INPAINT_INSERTION"
+	}
+	return imagenRequest, nil
+}
+
+// convertAlphaMask OpenAI 的蒙版以透明区域表示需要编辑的部分，Imagen 需要白色表示编辑区域的黑白蒙版
+func convertAlphaMask(data []byte) ([]byte, error) {
+	src, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("mask must be a valid png image")
+	}
+	bounds := src.Bounds()
+	mask := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			_, _, _, alpha := src.At(x, y).RGBA()
+			if alpha == 0 {
+				mask.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, mask); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ImageRequest2GeminiChat 将 OpenAI 图片请求转换为 gemini 图片模型的 generateContent 请求
+func ImageRequest2GeminiChat(request dto.ImageRequest, relayMode int) *GeminiChatRequest {
+	prompt := request.Prompt
+	if relayMode == constant.RelayModeImagesVariations {
+		prompt = "Create a variation of this image."
+	}
+	parts := []GeminiPart{
+		{
+			Text: prompt,
+		},
+	}
+	for _, image := range request.Images {
+		parts = append(parts, GeminiPart{
+			InlineData: &GeminiInlineData{
+				MimeType: image.MimeType,
+				Data:     base64.StdEncoding.EncodeToString(image.Data),
+			},
+		})
+	}
+	if request.Mask != nil {
+		// gemini 不支持蒙版参数，以附加图片和说明的形式传递
+		parts = append(parts, GeminiPart{
+			Text: "The next image is a mask: only change the areas that are transparent in the mask.",
+		}, GeminiPart{
+			InlineData: &GeminiInlineData{
+				MimeType: request.Mask.MimeType,
+				Data:     base64.StdEncoding.EncodeToString(request.Mask.Data),
+			},
+		})
+	}
+	return &GeminiChatRequest{
+		Contents: []GeminiChatContent{
+			{
+				Role:  "user",
+				Parts: parts,
+			},
+		},
+		GenerationConfig: GeminiChatGenerationConfig{
+			ResponseModalities: []string{"TEXT", "IMAGE"},
+		},
+	}
+}
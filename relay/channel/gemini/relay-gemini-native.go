@@ -0,0 +1,414 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"veloera/common"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	"veloera/relay/helper"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GeminiNativeStreamHandler relays a gemini SSE stream to a native gemini client as is,
+// only reading the usage metadata on the way through
+func GeminiNativeStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	extractGeminiInputContent(info)
+
+	var usage = &dto.Usage{}
+	var imageCount int
+	var responseText strings.Builder
+
+	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
+		var geminiResponse GeminiChatResponse
+		err := common.DecodeJsonStr(data, &geminiResponse)
+		if err != nil {
+			common.LogError(c, "error unmarshalling stream response: "+err.Error())
+			return false
+		}
+		for _, candidate := range geminiResponse.Candidates {
+			for _, part := range candidate.Content.Parts {
+				if part.InlineData != nil && strings.HasPrefix(part.InlineData.MimeType, "image") {
+					imageCount++
+				} else if part.FunctionCall != nil {
+					writeFunctionCallText(&responseText, part.FunctionCall)
+				} else if part.Text != "" {
+					responseText.WriteString(part.Text)
+				}
+			}
+		}
+		if geminiResponse.UsageMetadata.TotalTokenCount != 0 {
+			usage.PromptTokens = geminiResponse.UsageMetadata.PromptTokenCount
+			usage.CompletionTokens = geminiResponse.UsageMetadata.CandidatesTokenCount
+			usage.CompletionTokenDetails.ReasoningTokens = geminiResponse.UsageMetadata.ThoughtsTokenCount
+		}
+		err = helper.StringData(c, data)
+		if err != nil {
+			common.LogError(c, err.Error())
+		}
+		return true
+	})
+
+	if imageCount != 0 && usage.CompletionTokens == 0 {
+		usage.CompletionTokens = imageCount * 258
+	}
+	// 上游没有返回 usage 时按文本估算
+	usage = service.SettleStreamUsage(info, usage, responseText.String(), 0)
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	usage.PromptTokensDetails.TextTokens = usage.PromptTokens
+	info.Other["output_content"] = responseText.String()
+	return nil, usage
+}
+
+// GeminiNativeHandler relays a gemini generateContent response to a native gemini client as is
+func GeminiNativeHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	extractGeminiInputContent(info)
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var geminiResponse GeminiChatResponse
+	err = json.Unmarshal(responseBody, &geminiResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	extractGeminiOutputContent(info, &geminiResponse)
+
+	usage := buildGeminiUsage(&geminiResponse)
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(responseBody)
+	return nil, usage
+}
+
+// GeminiRequest2OpenAI converts a native gemini generateContent request into an openai chat
+// completion request, so that the request can be served by any chat completion adaptor
+func GeminiRequest2OpenAI(request *GeminiChatRequest, model string, stream bool) (*dto.GeneralOpenAIRequest, error) {
+	config := request.GenerationConfig
+	openAIRequest := &dto.GeneralOpenAIRequest{
+		Model:       model,
+		Stream:      stream,
+		Temperature: config.Temperature,
+		TopP:        config.TopP,
+		TopK:        int(config.TopK),
+		MaxTokens:   config.MaxOutputTokens,
+		N:           config.CandidateCount,
+		Seed:        float64(config.Seed),
+	}
+	if len(config.StopSequences) > 0 {
+		openAIRequest.Stop = config.StopSequences
+	}
+	if config.ResponseMimeType == "application/json" {
+		if config.ResponseSchema != nil {
+			openAIRequest.ResponseFormat = &dto.ResponseFormat{
+				Type: "json_schema",
+				JsonSchema: &dto.FormatJsonSchema{
+					Name:   "response",
+					Schema: lowerSchemaTypes(config.ResponseSchema),
+				},
+			}
+		} else {
+			openAIRequest.ResponseFormat = &dto.ResponseFormat{Type: "json_object"}
+		}
+	}
+
+	for _, tool := range request.Tools {
+		if tool.FunctionDeclarations == nil {
+			continue
+		}
+		declarationsJson, err := json.Marshal(tool.FunctionDeclarations)
+		if err != nil {
+			return nil, err
+		}
+		var declarations []dto.FunctionRequest
+		if err = json.Unmarshal(declarationsJson, &declarations); err != nil {
+			return nil, fmt.Errorf("invalid function declarations: %s", err.Error())
+		}
+		for _, declaration := range declarations {
+			declaration.Parameters = lowerSchemaTypes(declaration.Parameters)
+			openAIRequest.Tools = append(openAIRequest.Tools, dto.ToolCallRequest{
+				Type:     "function",
+				Function: declaration,
+			})
+		}
+	}
+	if len(openAIRequest.Tools) > 0 && request.ToolConfig != nil && request.ToolConfig.FunctionCallingConfig != nil {
+		callingConfig := request.ToolConfig.FunctionCallingConfig
+		switch strings.ToUpper(callingConfig.Mode) {
+		case "AUTO":
+			openAIRequest.ToolChoice = "auto"
+		case "NONE":
+			openAIRequest.ToolChoice = "none"
+		case "ANY":
+			openAIRequest.ToolChoice = "required"
+			if len(callingConfig.AllowedFunctionNames) == 1 {
+				openAIRequest.ToolChoice = map[string]any{
+					"type": "function",
+					"function": map[string]any{
+						"name": callingConfig.AllowedFunctionNames[0],
+					},
+				}
+			}
+		}
+	}
+
+	if request.SystemInstructions != nil {
+		var systemContent []string
+		for _, part := range request.SystemInstructions.Parts {
+			if part.Text != "" {
+				systemContent = append(systemContent, part.Text)
+			}
+		}
+		if len(systemContent) > 0 {
+			message := dto.Message{Role: "system"}
+			message.SetStringContent(strings.Join(systemContent, "\n"))
+			openAIRequest.Messages = append(openAIRequest.Messages, message)
+		}
+	}
+
+	// gemini 的 functionResponse 没有 id，按函数名依次匹配 functionCall 生成的 id
+	toolCallIds := make(map[string][]string)
+	for _, content := range request.Contents {
+		role := "user"
+		if content.Role == "model" {
+			role = "assistant"
+		}
+		var mediaContents []dto.MediaContent
+		var toolCalls []dto.ToolCallRequest
+		var reasoning strings.Builder
+		hasMedia := false
+		for _, part := range content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				arguments, err := json.Marshal(part.FunctionCall.Arguments)
+				if err != nil {
+					return nil, err
+				}
+				if part.FunctionCall.Arguments == nil {
+					arguments = []byte("{}")
+				}
+				id := fmt.Sprintf("call_%s", common.GetUUID())
+				toolCallIds[part.FunctionCall.FunctionName] = append(toolCallIds[part.FunctionCall.FunctionName], id)
+				toolCalls = append(toolCalls, dto.ToolCallRequest{
+					ID:   id,
+					Type: "function",
+					Function: dto.FunctionRequest{
+						Name:      part.FunctionCall.FunctionName,
+						Arguments: string(arguments),
+					},
+				})
+			case part.FunctionResponse != nil:
+				name := part.FunctionResponse.Name
+				id := fmt.Sprintf("call_%s", common.GetUUID())
+				if ids := toolCallIds[name]; len(ids) > 0 {
+					id = ids[0]
+					toolCallIds[name] = ids[1:]
+				}
+				response, err := json.Marshal(part.FunctionResponse.Response)
+				if err != nil {
+					return nil, err
+				}
+				toolMessage := dto.Message{
+					Role:       "tool",
+					Name:       &name,
+					ToolCallId: id,
+				}
+				toolMessage.SetStringContent(string(response))
+				openAIRequest.Messages = append(openAIRequest.Messages, toolMessage)
+			case part.Thought:
+				reasoning.WriteString(part.Text)
+			case part.InlineData != nil:
+				hasMedia = true
+				mediaContents = append(mediaContents, geminiInlineData2MediaContent(part.InlineData))
+			case part.FileData != nil:
+				hasMedia = true
+				mediaContents = append(mediaContents, dto.MediaContent{
+					Type: dto.ContentTypeImageURL,
+					ImageUrl: &dto.MessageImageUrl{
+						Url:      part.FileData.FileUri,
+						Detail:   "auto",
+						MimeType: part.FileData.MimeType,
+					},
+				})
+			case part.Text != "":
+				mediaContents = append(mediaContents, dto.MediaContent{
+					Type: dto.ContentTypeText,
+					Text: part.Text,
+				})
+			}
+		}
+		if len(mediaContents) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+		message := dto.Message{
+			Role:             role,
+			ReasoningContent: reasoning.String(),
+		}
+		if hasMedia && role == "user" {
+			message.SetMediaContent(mediaContents)
+		} else {
+			var text strings.Builder
+			for _, mediaContent := range mediaContents {
+				text.WriteString(mediaContent.Text)
+			}
+			message.SetStringContent(text.String())
+		}
+		if len(toolCalls) > 0 {
+			message.SetToolCalls(toolCalls)
+		}
+		openAIRequest.Messages = append(openAIRequest.Messages, message)
+	}
+	return openAIRequest, nil
+}
+
+func geminiInlineData2MediaContent(data *GeminiInlineData) dto.MediaContent {
+	switch {
+	case strings.HasPrefix(data.MimeType, "image/"):
+		return dto.MediaContent{
+			Type: dto.ContentTypeImageURL,
+			ImageUrl: &dto.MessageImageUrl{
+				Url:      fmt.Sprintf("data:%s;base64,%s", data.MimeType, data.Data),
+				Detail:   "auto",
+				MimeType: data.MimeType,
+			},
+		}
+	case strings.HasPrefix(data.MimeType, "audio/"):
+		return dto.MediaContent{
+			Type: dto.ContentTypeInputAudio,
+			InputAudio: &dto.MessageInputAudio{
+				Data:   data.Data,
+				Format: strings.TrimPrefix(data.MimeType, "audio/"),
+			},
+		}
+	default:
+		return dto.MediaContent{
+			Type: dto.ContentTypeFile,
+			File: &dto.MessageFile{
+				FileData: fmt.Sprintf("data:%s;base64,%s", data.MimeType, data.Data),
+			},
+		}
+	}
+}
+
+// lowerSchemaTypes converts the upper case openapi types used by gemini ("OBJECT", "STRING", ...)
+// into the json schema types expected by openai compatible upstreams
+func lowerSchemaTypes(schema any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, value := range v {
+			if key == "type" {
+				if typeName, ok := value.(string); ok {
+					result[key] = strings.ToLower(typeName)
+					continue
+				}
+			}
+			result[key] = lowerSchemaTypes(value)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, value := range v {
+			result[i] = lowerSchemaTypes(value)
+		}
+		return result
+	default:
+		return schema
+	}
+}
+
+func finishReasonOpenAI2Gemini(reason string) string {
+	switch reason {
+	case "length", "max_tokens":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+func usageOpenAI2Gemini(usage *dto.Usage) GeminiUsageMetadata {
+	return GeminiUsageMetadata{
+		PromptTokenCount:     usage.PromptTokens,
+		CandidatesTokenCount: usage.CompletionTokens,
+		TotalTokenCount:      usage.PromptTokens + usage.CompletionTokens,
+		ThoughtsTokenCount:   usage.CompletionTokenDetails.ReasoningTokens,
+	}
+}
+
+func toolCallArguments2Gemini(arguments string) any {
+	args := map[string]any{}
+	if arguments != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return map[string]any{}
+		}
+	}
+	return args
+}
+
+// ResponseOpenAI2Gemini converts an openai chat completion into a gemini generateContent response
+func ResponseOpenAI2Gemini(openAIResponse *dto.OpenAITextResponse) *GeminiChatResponse {
+	geminiResponse := &GeminiChatResponse{
+		Candidates:    make([]GeminiChatCandidate, 0, len(openAIResponse.Choices)),
+		UsageMetadata: usageOpenAI2Gemini(&openAIResponse.Usage),
+	}
+	for _, choice := range openAIResponse.Choices {
+		parts := make([]GeminiPart, 0)
+		reasoning := choice.Message.ReasoningContent
+		if reasoning == "" {
+			reasoning = choice.Message.Reasoning
+		}
+		if reasoning != "" {
+			parts = append(parts, GeminiPart{Text: reasoning, Thought: true})
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			parts = append(parts, GeminiPart{Text: text})
+		}
+		for _, toolCall := range choice.Message.ParseToolCalls() {
+			parts = append(parts, GeminiPart{
+				FunctionCall: &FunctionCall{
+					FunctionName: toolCall.Function.Name,
+					Arguments:    toolCallArguments2Gemini(toolCall.Function.Arguments),
+				},
+			})
+		}
+		finishReason := finishReasonOpenAI2Gemini(choice.FinishReason)
+		geminiResponse.Candidates = append(geminiResponse.Candidates, GeminiChatCandidate{
+			Content: GeminiChatContent{
+				Role:  "model",
+				Parts: parts,
+			},
+			FinishReason: &finishReason,
+			Index:        int64(choice.Index),
+		})
+	}
+	return geminiResponse
+}
@@ -200,6 +200,16 @@ func extractGeminiOutputContent(info *relaycommon.RelayInfo, response *GeminiCha
 	}
 }
 
+// writeFunctionCallText 将函数调用名称与参数写入 builder，用于估算补全 tokens
+func writeFunctionCallText(builder *strings.Builder, call *FunctionCall) {
+	builder.WriteString(call.FunctionName)
+	if call.Arguments != nil {
+		if args, err := json.Marshal(call.Arguments); err == nil {
+			builder.Write(args)
+		}
+	}
+}
+
 func extractGeminiStreamContent(info *relaycommon.RelayInfo, accumulatedContent string, accumulatedThinking string, accumulatedFunctionCalls []interface{}, accumulatedSafetyRatings []interface{}, accumulatedCodeExecutions []interface{}, multimodalSummary map[string]interface{}) {
 	if info.Other == nil {
 		info.Other = make(map[string]interface{})
@@ -365,15 +375,16 @@ func CovertGemini2OpenAI(textRequest dto.GeneralOpenAIRequest, info *relaycommon
 				name = val
 			}
 			content := common.StrToMap(message.StringContent())
-			functionResp := &FunctionResponse{
-				Name: name,
-				Response: GeminiFunctionResponseContent{
-					Name:    name,
-					Content: content,
-				},
+			responseContent := GeminiFunctionResponseContent{
+				Name:    name,
+				Content: content,
 			}
 			if content == nil {
-				functionResp.Response.Content = message.StringContent()
+				responseContent.Content = message.StringContent()
+			}
+			functionResp := &FunctionResponse{
+				Name:     name,
+				Response: responseContent,
 			}
 			*parts = append(*parts, GeminiPart{
 				FunctionResponse: functionResp,
@@ -907,6 +918,7 @@ func GeminiChatStreamHandler(c *gin.Context, resp *http.Response, info *relaycom
 
 	var accumulatedContent strings.Builder
 	var accumulatedThinking strings.Builder
+	var toolCallText strings.Builder
 	var accumulatedFunctionCalls []interface{}
 	var accumulatedSafetyRatings []interface{}
 	var accumulatedCodeExecutions []interface{}
@@ -936,6 +948,7 @@ func GeminiChatStreamHandler(c *gin.Context, resp *http.Response, info *relaycom
 
 			for _, part := range candidate.Content.Parts {
 				if part.FunctionCall != nil {
+					writeFunctionCallText(&toolCallText, part.FunctionCall)
 					accumulatedFunctionCalls = append(accumulatedFunctionCalls, map[string]interface{}{
 						"name":      part.FunctionCall.FunctionName,
 						"arguments": part.FunctionCall.Arguments,
@@ -1006,6 +1019,8 @@ func GeminiChatStreamHandler(c *gin.Context, resp *http.Response, info *relaycom
 			usage.CompletionTokens = imageCount * 258
 		}
 	}
+	// 上游没有返回 usage（例如流被中断）时按已下发内容估算
+	usage = service.SettleStreamUsage(info, usage, accumulatedContent.String()+accumulatedThinking.String()+toolCallText.String(), 0)
 
 	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
 	usage.PromptTokensDetails.TextTokens = usage.PromptTokens
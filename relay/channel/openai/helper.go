@@ -33,7 +33,7 @@ import (
 func handleStreamFormat(c *gin.Context, info *relaycommon.RelayInfo, data string, forceFormat bool, thinkToContent bool) error {
 	info.SendResponseCount++
 	switch info.RelayFormat {
-	case relaycommon.RelayFormatOpenAI:
+	case relaycommon.RelayFormatOpenAI, relaycommon.RelayFormatGemini:
 		return sendStreamData(c, info, data, forceFormat, thinkToContent)
 	case relaycommon.RelayFormatClaude:
 		return handleClaudeFormat(c, data, info)
@@ -179,7 +179,7 @@ func handleFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, lastStream
 	usage *dto.Usage, containStreamUsage bool) {
 
 	switch info.RelayFormat {
-	case relaycommon.RelayFormatOpenAI:
+	case relaycommon.RelayFormatOpenAI, relaycommon.RelayFormatGemini:
 		if info.ShouldIncludeUsage && !containStreamUsage {
 			response := helper.GenerateFinalUsageResponse(responseId, createAt, model, *usage)
 			response.SetSystemFingerprint(systemFingerprint)
@@ -189,15 +189,12 @@ func handleFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, lastStream
 
 	case relaycommon.RelayFormatClaude:
 		info.ClaudeConvertInfo.Done = true
-		var streamResponse dto.ChatCompletionsStreamResponse
-		if err := json.Unmarshal(common.StringToByteSlice(lastStreamData), &streamResponse); err != nil {
-			common.SysError("error unmarshalling stream response: " + err.Error())
-			return
-		}
-
 		info.ClaudeConvertInfo.Usage = usage
+		if info.SendResponseCount == 0 {
+			info.SendResponseCount = 1
+		}
 
-		claudeResponses := service.StreamResponseOpenAI2Claude(&streamResponse, info)
+		claudeResponses := service.StreamResponseOpenAI2Claude(&dto.ChatCompletionsStreamResponse{}, info)
 		for _, resp := range claudeResponses {
 			helper.ClaudeData(c, *resp)
 		}
@@ -0,0 +1,143 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package openai
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// isGptImageModel gpt-image 系列模型始终返回 b64_json，且不接受 response_format 参数
+func isGptImageModel(model string) bool {
+	return strings.HasPrefix(model, "gpt-image")
+}
+
+// buildImageEditForm 将图片编辑与变体请求重新构造为 multipart 请求体
+func buildImageEditForm(c *gin.Context, request dto.ImageRequest) (io.Reader, error) {
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+
+	fields := map[string]string{
+		"model":           request.Model,
+		"prompt":          request.Prompt,
+		"size":            request.Size,
+		"quality":         request.Quality,
+		"response_format": request.ResponseFormat,
+		"user":            request.User,
+		"background":      request.Background,
+		"output_format":   request.OutputFormat,
+		"moderation":      request.Moderation,
+		"input_fidelity":  request.InputFidelity,
+	}
+	if request.N > 0 {
+		fields["n"] = strconv.Itoa(request.N)
+	}
+	if request.OutputCompression != nil {
+		fields["output_compression"] = strconv.Itoa(*request.OutputCompression)
+	}
+	for key, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	imageField := "image"
+	if len(request.Images) > 1 {
+		imageField = "image[]"
+	}
+	for _, image := range request.Images {
+		if err := writeImageFormFile(writer, imageField, image); err != nil {
+			return nil, err
+		}
+	}
+	if request.Mask != nil {
+		if err := writeImageFormFile(writer, "mask", *request.Mask); err != nil {
+			return nil, err
+		}
+	}
+
+	// 关闭 multipart 编写器以设置分界线
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	return &requestBody, nil
+}
+
+func writeImageFormFile(writer *multipart.Writer, field string, image dto.ImageFile) error {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, field, strings.ReplaceAll(image.Filename, `"`, "")))
+	header.Set("Content-Type", image.MimeType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("create form file failed: %w", err)
+	}
+	_, err = part.Write(image.Data)
+	return err
+}
+
+// OpenaiImageHandler 解析图片响应，并按客户端请求的 response_format 统一返回格式
+func OpenaiImageHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var imageResponse dto.ImageResponse
+	err = common.DecodeJson(responseBody, &imageResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = service.NormalizeImageResponse(&imageResponse, c.GetString(constant.ContextKeyImageFormat))
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "normalize_image_response_failed", http.StatusInternalServerError), nil
+	}
+	jsonResponse, err := common.EncodeJson(imageResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(jsonResponse)
+
+	usage := &dto.Usage{}
+	if imageResponse.Usage != nil {
+		usage.PromptTokens = imageResponse.Usage.InputTokens
+		usage.CompletionTokens = imageResponse.Usage.OutputTokens
+		usage.TotalTokens = imageResponse.Usage.TotalTokens
+	}
+	return nil, usage
+}
@@ -186,8 +186,10 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 	}
 
 	if shouldSendLastResp {
-		sendStreamData(c, info, lastStreamData, forceFormat, thinkToContent)
-		//err = handleStreamFormat(c, info, lastStreamData, forceFormat, thinkToContent)
+		err = handleStreamFormat(c, info, lastStreamData, forceFormat, thinkToContent)
+		if err != nil {
+			common.SysError("error handling stream format: " + err.Error())
+		}
 	}
 
 	// 处理token计算
@@ -274,10 +276,9 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 		return nil, zeroUsage
 	}
 
-	if !containStreamUsage {
-		usage, _ = service.ResponseText2Usage(responseText, info.UpstreamModelName, info.PromptTokens)
-		usage.CompletionTokens += toolCount * 7
-	} else {
+	// 上游未返回 usage 或 usage 异常时按已下发内容估算
+	usage = service.SettleStreamUsage(info, usage, responseText, toolCount)
+	if containStreamUsage {
 		if info.ChannelType == common.ChannelTypeDeepSeek {
 			if usage.PromptCacheHitTokens != 0 {
 				usage.PromptTokensDetails.CachedTokens = usage.PromptCacheHitTokens
@@ -382,7 +383,7 @@ func OpenaiHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayI
 	info.Other["output_content"] = outputContent // 保存输出内容
 
 	switch info.RelayFormat {
-	case relaycommon.RelayFormatOpenAI:
+	case relaycommon.RelayFormatOpenAI, relaycommon.RelayFormatGemini:
 		break
 	case relaycommon.RelayFormatClaude:
 		claudeResp := service.ResponseOpenAI2Claude(&simpleResponse, info)
@@ -951,6 +952,18 @@ func BuildStreamChunkFromTextResponse(simpleResponse *dto.OpenAITextResponse) dt
 		choice.FinishReason = &finishReason
 		choice.Delta.Role = "assistant"
 		choice.Delta.SetContentString(ch.Message.StringContent())
+		if ch.Message.ReasoningContent != "" {
+			choice.Delta.SetReasoningContent(ch.Message.ReasoningContent)
+		}
+		if ch.Message.ToolCalls != nil {
+			var toolCalls []dto.ToolCallResponse
+			if err := json.Unmarshal(ch.Message.ToolCalls, &toolCalls); err == nil {
+				for j := range toolCalls {
+					toolCalls[j].SetIndex(j)
+				}
+				choice.Delta.ToolCalls = toolCalls
+			}
+		}
 		streamResp.Choices[i] = choice
 	}
 	return streamResp
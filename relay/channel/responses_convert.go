@@ -0,0 +1,43 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package channel
+
+import (
+	"github.com/gin-gonic/gin"
+	"veloera/dto"
+	"veloera/relay/common"
+	"veloera/relay/constant"
+	"veloera/service"
+)
+
+// ConvertResponsesRequest 把 /v1/responses 请求转换为 chat completions 请求后交给渠道自身的 openai 转换，
+// 使所有支持 chat completions 的渠道都能处理 /v1/responses，上游响应由 service.OpenAI2ResponsesWriter 转换回来
+func ConvertResponsesRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, request *dto.OpenAIResponsesRequest) (any, error) {
+	openAIRequest, err := service.ResponsesToOpenAIRequest(*request, info)
+	if err != nil {
+		return nil, err
+	}
+	if openAIRequest.Stream && info.SupportStreamOptions {
+		openAIRequest.StreamOptions = &dto.StreamOptions{
+			IncludeUsage: true,
+		}
+	}
+	// 之后按普通的 chat completions 请求处理
+	info.RelayMode = constant.RelayModeChatCompletions
+	info.RequestURLPath = "/v1/chat/completions"
+	return a.ConvertOpenAIRequest(c, info, openAIRequest)
+}
@@ -0,0 +1,307 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package kling
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"veloera/constant"
+	"veloera/dto"
+	"veloera/model"
+	"veloera/relay/channel"
+	relaycommon "veloera/relay/common"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// https://app.klingai.com/global/dev/document-api/apiReference/model/textToVideo
+
+const defaultSeconds = 5
+
+type TaskAdaptor struct {
+	ChannelType int
+}
+
+func (a *TaskAdaptor) Init(info *relaycommon.TaskRelayInfo) {
+	a.ChannelType = info.ChannelType
+}
+
+func (a *TaskAdaptor) ValidateRequestAndSetAction(c *gin.Context, info *relaycommon.TaskRelayInfo) *dto.TaskError {
+	videoRequest, err := service.GetVideoRequest(c)
+	if err != nil {
+		return service.TaskErrorWrapperLocal(err, "invalid_request", http.StatusBadRequest)
+	}
+	info.Duration, _ = videoRequest.GetSeconds(defaultSeconds)
+	if info.Duration != 5 && info.Duration != 10 {
+		return service.TaskErrorWrapperLocal(errors.New("kling only supports 5 or 10 seconds"), "invalid_request", http.StatusBadRequest)
+	}
+	info.Action = constant.VideoActionText2Video
+	if videoRequest.HasImage() {
+		info.Action = constant.VideoActionImage2Video
+	}
+	return nil
+}
+
+func (a *TaskAdaptor) BuildRequestURL(info *relaycommon.TaskRelayInfo) (string, error) {
+	return fmt.Sprintf("%s/v1/videos/%s", info.BaseUrl, strings.ToLower(info.Action)), nil
+}
+
+func (a *TaskAdaptor) BuildRequestHeader(c *gin.Context, req *http.Request, info *relaycommon.TaskRelayInfo) error {
+	token, err := getKlingToken(info.ApiKey)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.TaskRelayInfo) (io.Reader, error) {
+	videoRequest, err := service.GetVideoRequest(c)
+	if err != nil {
+		return nil, err
+	}
+	klingRequest := VideoRequest{
+		ModelName:      info.UpstreamModelName,
+		Prompt:         videoRequest.Prompt,
+		NegativePrompt: videoRequest.NegativePrompt,
+		Mode:           "std",
+		Duration:       strconv.Itoa(info.Duration),
+	}
+	if info.Action == constant.VideoActionImage2Video {
+		// 图生视频的宽高比与首帧图片一致
+		klingRequest.Image, err = getKlingImage(videoRequest)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		klingRequest.AspectRatio = sizeToAspectRatio(videoRequest.Size)
+	}
+	data, err := json.Marshal(klingRequest)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+func (a *TaskAdaptor) DoRequest(c *gin.Context, info *relaycommon.TaskRelayInfo, requestBody io.Reader) (*http.Response, error) {
+	return channel.DoTaskApiRequest(a, c, info, requestBody)
+}
+
+func (a *TaskAdaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.TaskRelayInfo) (taskID string, taskData []byte, taskErr *dto.TaskError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	var klingResponse Response
+	err = json.Unmarshal(responseBody, &klingResponse)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	if klingResponse.Code != 0 || klingResponse.Data == nil || klingResponse.Data.TaskId == "" {
+		taskErr = service.TaskErrorWrapper(errors.New(klingResponse.Message), strconv.Itoa(klingResponse.Code), http.StatusInternalServerError)
+		return
+	}
+
+	video := dto.OpenAIVideo{
+		ID:        klingResponse.Data.TaskId,
+		Object:    "video",
+		Model:     info.OriginModelName,
+		Status:    dto.VideoStatusQueued,
+		CreatedAt: time.Now().Unix(),
+		Seconds:   strconv.Itoa(info.Duration),
+	}
+	if klingResponse.Data.CreatedAt > 0 {
+		// 可灵返回的时间戳为毫秒
+		video.CreatedAt = klingResponse.Data.CreatedAt / 1000
+	}
+	if videoRequest, err := service.GetVideoRequest(c); err == nil {
+		video.Size = videoRequest.Size
+	}
+	taskData, err = json.Marshal(video)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", taskData)
+	return video.ID, taskData, nil
+}
+
+func (a *TaskAdaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *TaskAdaptor) GetChannelName() string {
+	return ChannelName
+}
+
+func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http.Response, error) {
+	taskID, ok := body["task_id"].(string)
+	if !ok {
+		return nil, errors.New("invalid task_id")
+	}
+	action, _ := body["action"].(string)
+	if action == "" {
+		action = constant.VideoActionText2Video
+	}
+	token, err := getKlingToken(key)
+	if err != nil {
+		return nil, err
+	}
+	requestUrl := fmt.Sprintf("%s/v1/videos/%s/%s", baseUrl, strings.ToLower(action), taskID)
+	// 设置超时时间
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return channel.DoTaskFetchRequest(req)
+}
+
+func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error) {
+	var klingResponse Response
+	if err := json.Unmarshal(respBody, &klingResponse); err != nil {
+		return nil, err
+	}
+	if klingResponse.Code != 0 || klingResponse.Data == nil {
+		return nil, fmt.Errorf("kling query failed: %s", klingResponse.Message)
+	}
+	data := klingResponse.Data
+	taskInfo := &relaycommon.TaskInfo{
+		TaskID: data.TaskId,
+	}
+	switch data.TaskStatus {
+	case TaskStatusSubmitted:
+		taskInfo.Status = model.TaskStatusQueued
+		taskInfo.Progress = "0%"
+	case TaskStatusProcessing:
+		// 可灵不返回具体进度
+		taskInfo.Status = model.TaskStatusInProgress
+		taskInfo.Progress = "50%"
+	case TaskStatusSucceed:
+		taskInfo.Status = model.TaskStatusSuccess
+		taskInfo.Progress = "100%"
+		if data.TaskResult != nil && len(data.TaskResult.Videos) > 0 {
+			taskInfo.Url = data.TaskResult.Videos[0].Url
+		}
+	case TaskStatusFailed:
+		taskInfo.Status = model.TaskStatusFailure
+		taskInfo.Progress = "100%"
+		taskInfo.Reason = data.TaskStatusMsg
+		if taskInfo.Reason == "" {
+			taskInfo.Reason = "video generation failed"
+		}
+	default:
+		taskInfo.Status = model.TaskStatusUnknown
+	}
+	return taskInfo, nil
+}
+
+func (a *TaskAdaptor) FetchTaskContent(ctx context.Context, baseUrl, key, taskID, url string) (*http.Response, error) {
+	if url == "" {
+		return nil, errors.New("video url is empty")
+	}
+	// 结果地址是带签名的公开链接，无需鉴权
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return service.GetHttpClient().Do(req)
+}
+
+var klingTokens sync.Map
+
+type klingTokenData struct {
+	Token      string
+	ExpiryTime time.Time
+}
+
+// getKlingToken 密钥格式为 AccessKey|SecretKey，使用 SecretKey 签发 JWT；不含分隔符时视为已签发的 token
+func getKlingToken(apiKey string) (string, error) {
+	split := strings.Split(apiKey, "|")
+	if len(split) != 2 {
+		return apiKey, nil
+	}
+	if data, ok := klingTokens.Load(apiKey); ok {
+		tokenData := data.(klingTokenData)
+		// 提前一分钟刷新，避免请求途中过期
+		if time.Now().Add(time.Minute).Before(tokenData.ExpiryTime) {
+			return tokenData.Token, nil
+		}
+	}
+	now := time.Now()
+	expiryTime := now.Add(30 * time.Minute)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": split[0],
+		"exp": expiryTime.Unix(),
+		"nbf": now.Add(-5 * time.Second).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(split[1]))
+	if err != nil {
+		return "", err
+	}
+	klingTokens.Store(apiKey, klingTokenData{
+		Token:      tokenString,
+		ExpiryTime: expiryTime,
+	})
+	return tokenString, nil
+}
+
+// getKlingImage 可灵接受图片 url 或不带前缀的 base64
+func getKlingImage(videoRequest *dto.VideoRequest) (string, error) {
+	if videoRequest.InputReference != nil {
+		return base64.StdEncoding.EncodeToString(videoRequest.InputReference.Data), nil
+	}
+	if strings.HasPrefix(videoRequest.Image, "http://") || strings.HasPrefix(videoRequest.Image, "https://") {
+		return videoRequest.Image, nil
+	}
+	_, data, err := service.DecodeBase64FileData(videoRequest.Image)
+	return data, err
+}
+
+// sizeToAspectRatio 将 OpenAI 风格的尺寸转换为宽高比，也可以直接传入宽高比
+func sizeToAspectRatio(size string) string {
+	if size == "16:9" || size == "9:16" || size == "1:1" {
+		return size
+	}
+	var width, height int
+	if _, err := fmt.Sscanf(size, "%dx%d", &width, &height); err != nil || width <= 0 || height <= 0 {
+		return "16:9"
+	}
+	if width > height {
+		return "16:9"
+	} else if width < height {
+		return "9:16"
+	}
+	return "1:1"
+}
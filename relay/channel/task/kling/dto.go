@@ -0,0 +1,60 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package kling
+
+type VideoRequest struct {
+	ModelName      string `json:"model_name"`
+	Prompt         string `json:"prompt,omitempty"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+	Image          string `json:"image,omitempty"`
+	Mode           string `json:"mode,omitempty"`
+	AspectRatio    string `json:"aspect_ratio,omitempty"`
+	Duration       string `json:"duration,omitempty"`
+}
+
+type Response struct {
+	Code      int       `json:"code"`
+	Message   string    `json:"message"`
+	RequestId string    `json:"request_id"`
+	Data      *TaskData `json:"data"`
+}
+
+type TaskData struct {
+	TaskId        string      `json:"task_id"`
+	TaskStatus    string      `json:"task_status"`
+	TaskStatusMsg string      `json:"task_status_msg"`
+	CreatedAt     int64       `json:"created_at"`
+	UpdatedAt     int64       `json:"updated_at"`
+	TaskResult    *TaskResult `json:"task_result"`
+}
+
+type TaskResult struct {
+	Videos []Video `json:"videos"`
+}
+
+type Video struct {
+	Id       string `json:"id"`
+	Url      string `json:"url"`
+	Duration string `json:"duration"`
+}
+
+const (
+	TaskStatusSubmitted  = "submitted"
+	TaskStatusProcessing = "processing"
+	TaskStatusSucceed    = "succeed"
+	TaskStatusFailed     = "failed"
+)
@@ -0,0 +1,230 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package sora
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"time"
+	"veloera/constant"
+	"veloera/dto"
+	"veloera/model"
+	"veloera/relay/channel"
+	relaycommon "veloera/relay/common"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 未指定时长时 sora 默认生成 4 秒视频
+const defaultSeconds = 4
+
+// TaskAdaptor OpenAI 兼容的 /v1/videos 接口
+type TaskAdaptor struct {
+	ChannelType int
+	contentType string
+}
+
+func (a *TaskAdaptor) Init(info *relaycommon.TaskRelayInfo) {
+	a.ChannelType = info.ChannelType
+}
+
+func (a *TaskAdaptor) ValidateRequestAndSetAction(c *gin.Context, info *relaycommon.TaskRelayInfo) *dto.TaskError {
+	videoRequest, err := service.GetVideoRequest(c)
+	if err != nil {
+		return service.TaskErrorWrapperLocal(err, "invalid_request", http.StatusBadRequest)
+	}
+	info.Duration, _ = videoRequest.GetSeconds(defaultSeconds)
+	info.Action = constant.VideoActionText2Video
+	if videoRequest.HasImage() {
+		info.Action = constant.VideoActionImage2Video
+	}
+	return nil
+}
+
+func (a *TaskAdaptor) BuildRequestURL(info *relaycommon.TaskRelayInfo) (string, error) {
+	return fmt.Sprintf("%s/v1/videos", info.BaseUrl), nil
+}
+
+func (a *TaskAdaptor) BuildRequestHeader(c *gin.Context, req *http.Request, info *relaycommon.TaskRelayInfo) error {
+	req.Header.Set("Content-Type", a.contentType)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+info.ApiKey)
+	return nil
+}
+
+func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.TaskRelayInfo) (io.Reader, error) {
+	videoRequest, err := service.GetVideoRequest(c)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]string{
+		"model":   info.UpstreamModelName,
+		"prompt":  videoRequest.Prompt,
+		"seconds": strconv.Itoa(info.Duration),
+		"size":    videoRequest.Size,
+	}
+	if !videoRequest.HasImage() {
+		a.contentType = "application/json"
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(data), nil
+	}
+
+	// 参考图片只能以 multipart 的 input_reference 字段上传
+	image, err := service.GetVideoReferenceImage(videoRequest)
+	if err != nil {
+		return nil, err
+	}
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+	for key, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(key, value); err != nil {
+			return nil, err
+		}
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="input_reference"; filename="%s"`, image.Filename))
+	header.Set("Content-Type", image.MimeType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = part.Write(image.Data); err != nil {
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	a.contentType = writer.FormDataContentType()
+	return &requestBody, nil
+}
+
+func (a *TaskAdaptor) DoRequest(c *gin.Context, info *relaycommon.TaskRelayInfo, requestBody io.Reader) (*http.Response, error) {
+	return channel.DoTaskApiRequest(a, c, info, requestBody)
+}
+
+func (a *TaskAdaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.TaskRelayInfo) (taskID string, taskData []byte, taskErr *dto.TaskError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	var video dto.OpenAIVideo
+	err = json.Unmarshal(responseBody, &video)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	if video.ID == "" {
+		taskErr = service.TaskErrorWrapper(fmt.Errorf("task id is empty: %s", string(responseBody)), "invalid_response", http.StatusInternalServerError)
+		return
+	}
+
+	video.Object = "video"
+	video.Model = info.OriginModelName
+	video.Seconds = strconv.Itoa(info.Duration)
+	if video.CreatedAt == 0 {
+		video.CreatedAt = time.Now().Unix()
+	}
+	taskData, err = json.Marshal(video)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", taskData)
+	return video.ID, taskData, nil
+}
+
+func (a *TaskAdaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *TaskAdaptor) GetChannelName() string {
+	return ChannelName
+}
+
+func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http.Response, error) {
+	taskID, ok := body["task_id"].(string)
+	if !ok {
+		return nil, errors.New("invalid task_id")
+	}
+	requestUrl := fmt.Sprintf("%s/v1/videos/%s", baseUrl, taskID)
+	// 设置超时时间
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	return channel.DoTaskFetchRequest(req)
+}
+
+func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error) {
+	var video dto.OpenAIVideo
+	if err := json.Unmarshal(respBody, &video); err != nil {
+		return nil, err
+	}
+	taskInfo := &relaycommon.TaskInfo{
+		TaskID:   video.ID,
+		Progress: fmt.Sprintf("%d%%", video.Progress),
+	}
+	switch video.Status {
+	case dto.VideoStatusQueued:
+		taskInfo.Status = model.TaskStatusQueued
+	case dto.VideoStatusInProgress:
+		taskInfo.Status = model.TaskStatusInProgress
+	case dto.VideoStatusCompleted:
+		taskInfo.Status = model.TaskStatusSuccess
+		taskInfo.Progress = "100%"
+	case dto.VideoStatusFailed:
+		taskInfo.Status = model.TaskStatusFailure
+		taskInfo.Progress = "100%"
+		taskInfo.Reason = "video generation failed"
+		if video.Error != nil && video.Error.Message != "" {
+			taskInfo.Reason = video.Error.Message
+		}
+	default:
+		taskInfo.Status = model.TaskStatusUnknown
+	}
+	return taskInfo, nil
+}
+
+func (a *TaskAdaptor) FetchTaskContent(ctx context.Context, baseUrl, key, taskID, url string) (*http.Response, error) {
+	// 结果需要携带渠道密钥通过 content 接口下载
+	requestUrl := fmt.Sprintf("%s/v1/videos/%s/content", baseUrl, taskID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	return service.GetHttpClient().Do(req)
+}
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"io"
@@ -170,6 +171,15 @@ func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http
 	return resp, nil
 }
 
+func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error) {
+	// suno 任务按批次查询，由 controller 直接解析
+	return nil, errors.New("not implemented")
+}
+
+func (a *TaskAdaptor) FetchTaskContent(ctx context.Context, baseUrl, key, taskID, url string) (*http.Response, error) {
+	return nil, errors.New("not implemented")
+}
+
 func actionValidate(c *gin.Context, sunoRequest *dto.SunoSubmitReq, action string) (err error) {
 	switch action {
 	case constant.SunoActionMusic:
@@ -30,12 +30,14 @@ import (
 	"veloera/relay/channel/gemini"
 	"veloera/relay/channel/openai"
 	relaycommon "veloera/relay/common"
+	relayconstant "veloera/relay/constant"
 )
 
 const (
 	RequestModeClaude = 1
 	RequestModeGemini = 2
 	RequestModeLlama  = 3
+	RequestModeImagen = 4
 )
 
 var claudeModelMap = map[string]string{
@@ -57,6 +59,9 @@ type Adaptor struct {
 }
 
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (any, error) {
+	if a.RequestMode != RequestModeClaude {
+		return channel.ConvertClaudeRequest(a, c, info, request)
+	}
 	if v, ok := claudeModelMap[info.UpstreamModelName]; ok {
 		c.Set("request_model", v)
 	} else {
@@ -72,8 +77,13 @@ func (a *Adaptor) ConvertAudioRequest(c *gin.Context, info *relaycommon.RelayInf
 }
 
 func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+	if a.RequestMode == RequestModeImagen {
+		return gemini.ImageRequest2Imagen(request, info.RelayMode)
+	}
+	if a.RequestMode == RequestModeGemini && gemini.IsGeminiImageModel(info.UpstreamModelName) {
+		return gemini.ImageRequest2GeminiChat(request, info.RelayMode), nil
+	}
+	return nil, errors.New("not supported model for image generation")
 }
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
@@ -83,6 +93,8 @@ func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
 		a.RequestMode = RequestModeGemini
 	} else if strings.Contains(info.UpstreamModelName, "llama") {
 		a.RequestMode = RequestModeLlama
+	} else if strings.HasPrefix(info.UpstreamModelName, "imagen") {
+		a.RequestMode = RequestModeImagen
 	}
 }
 
@@ -94,8 +106,10 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 	region := GetModelRegion(info.ApiVersion, info.OriginModelName)
 	a.AccountCredentials = *adc
 	suffix := ""
-	if a.RequestMode == RequestModeGemini {
-		if info.IsStream {
+	if a.RequestMode == RequestModeGemini || a.RequestMode == RequestModeImagen {
+		if a.RequestMode == RequestModeImagen {
+			suffix = "predict"
+		} else if info.IsStream {
 			suffix = "streamGenerateContent?alt=sse"
 		} else {
 			suffix = "generateContent"
@@ -192,8 +206,7 @@ func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.Rela
 }
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
-	// TODO implement me
-	return nil, errors.New("not implemented")
+	return channel.ConvertResponsesRequest(a, c, info, &request)
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
@@ -201,6 +214,26 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *dto.OpenAIErrorWithStatusCode) {
+	if a.RequestMode == RequestModeImagen || relayconstant.IsImageRelayMode(info.RelayMode) {
+		return gemini.GeminiImageHandler(c, resp, info)
+	}
+	if a.RequestMode != RequestModeGemini {
+		return a.doResponse(c, resp, info)
+	}
+	if info.RelayFormat == relaycommon.RelayFormatGemini {
+		if info.IsStream {
+			err, usage = gemini.GeminiNativeStreamHandler(c, resp, info)
+		} else {
+			err, usage = gemini.GeminiNativeHandler(c, resp, info)
+		}
+		return
+	}
+	return channel.DoClaudeResponse(c, info, func() (any, *dto.OpenAIErrorWithStatusCode) {
+		return a.doResponse(c, resp, info)
+	})
+}
+
+func (a *Adaptor) doResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *dto.OpenAIErrorWithStatusCode) {
 	if info.IsStream {
 		switch a.RequestMode {
 		case RequestModeClaude:
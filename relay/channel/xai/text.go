@@ -54,7 +54,6 @@ func xAIStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 	usage := &dto.Usage{}
 	var responseTextBuilder strings.Builder
 	var toolCount int
-	var containStreamUsage bool
 
 	helper.SetEventStreamHeaders(c)
 
@@ -68,7 +67,6 @@ func xAIStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 
 		// 把 xAI 的usage转换为 OpenAI 的usage
 		if xAIResp.Usage != nil {
-			containStreamUsage = true
 			usage.PromptTokens = xAIResp.Usage.PromptTokens
 			usage.TotalTokens = xAIResp.Usage.TotalTokens
 			usage.CompletionTokens = usage.TotalTokens - usage.PromptTokens
@@ -83,10 +81,7 @@ func xAIStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 		return true
 	})
 
-	if !containStreamUsage {
-		usage, _ = service.ResponseText2Usage(responseTextBuilder.String(), info.UpstreamModelName, info.PromptTokens)
-		usage.CompletionTokens += toolCount * 7
-	}
+	usage = service.SettleStreamUsage(info, usage, responseTextBuilder.String(), toolCount)
 
 	helper.Done(c)
 	err := resp.Body.Close()
@@ -156,7 +156,9 @@ func ClaudeHelper(c *gin.Context) (claudeError *dto.ClaudeErrorWithStatusCode) {
 		}
 	}
 
+	sensitiveWriter := service.SetupCompletionSensitiveCheck(c, relayInfo)
 	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	sensitiveWriter.Finish()
 	//log.Printf("usage: %v", usage)
 	if openaiErr != nil {
 		// reset status code 重置状态码
@@ -49,9 +49,18 @@ type ClaudeConvertInfo struct {
 	Done             bool
 }
 
+// ResponsesConvertInfo 记录 /v1/responses 请求被转换为 chat completions 时的上下文，
+// 用于把上游的 chat 响应还原为 responses 格式并保存会话
+type ResponsesConvertInfo struct {
+	ResponseId    string
+	Request       *dto.OpenAIResponsesRequest
+	InputMessages []dto.Message // 本轮新增的输入消息（不含 instructions 与历史会话）
+}
+
 const (
 	RelayFormatOpenAI = "openai"
 	RelayFormatClaude = "claude"
+	RelayFormatGemini = "gemini"
 )
 
 type RerankerInfo struct {
@@ -67,6 +76,7 @@ type RelayInfo struct {
 	UserId            int
 	Group             string
 	TokenUnlimited    bool
+	OrganizationId    int
 	StartTime         time.Time
 	FirstResponseTime time.Time
 	isFirstResponse   bool
@@ -106,9 +116,13 @@ type RelayInfo struct {
 	ChannelCreateTime    int64
 	PromptMessages       interface{}            // 保存请求的消息内容
 	Other                map[string]interface{} // 用于存储额外信息，如输入输出内容
+	UsageSource          string                 // usage 来源，upstream 或 estimated
+	ClientCancelled      bool                   // 客户端在响应完成前断开连接
+	StreamCompleted      bool                   // 流式响应已正常结束（收到 [DONE] 或 finish_reason 且未超时）
 	ThinkingContentInfo
 	*ClaudeConvertInfo
 	*RerankerInfo
+	ResponsesConvertInfo *ResponsesConvertInfo
 }
 
 // 定义支持流式选项的通道类型
@@ -143,6 +157,13 @@ func GenRelayInfoClaude(c *gin.Context) *RelayInfo {
 	return info
 }
 
+func GenRelayInfoGemini(c *gin.Context) *RelayInfo {
+	info := GenRelayInfo(c)
+	info.RelayFormat = RelayFormatGemini
+	info.ShouldIncludeUsage = false
+	return info
+}
+
 func GenRelayInfoRerank(c *gin.Context, req *dto.RerankRequest) *RelayInfo {
 	info := GenRelayInfo(c)
 	info.RelayMode = relayconstant.RelayModeRerank
@@ -194,6 +215,7 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 		UserId:            userId,
 		Group:             group,
 		TokenUnlimited:    tokenUnlimited,
+		OrganizationId:    c.GetInt("organization_id"),
 		StartTime:         startTime,
 		FirstResponseTime: startTime.Add(-time.Second),
 		OriginModelName:   originalModel,                 // Use the prefixed model name for display
@@ -261,10 +283,22 @@ type TaskRelayInfo struct {
 	*RelayInfo
 	Action       string
 	OriginTaskID string
+	// Duration 视频时长（秒），用于按秒计费
+	Duration int
 
 	ConsumeQuota bool
 }
 
+// TaskInfo 适配器解析上游任务查询结果后的统一格式
+type TaskInfo struct {
+	TaskID   string
+	Status   string
+	Progress string
+	Reason   string
+	// Url 生成结果的上游地址，可能需要鉴权或会过期
+	Url string
+}
+
 func GenTaskRelayInfo(c *gin.Context) *TaskRelayInfo {
 	info := &TaskRelayInfo{
 		RelayInfo: GenRelayInfo(c),
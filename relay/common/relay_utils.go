@@ -48,3 +48,13 @@ func GetAPIVersion(c *gin.Context) string {
 	}
 	return apiVersion
 }
+
+// GetGeminiModelAndAction splits the "{model}:{action}" tail of a native gemini path such as
+// /v1beta/models/gemini-2.0-flash:streamGenerateContent
+func GetGeminiModelAndAction(path string) (string, string) {
+	path = strings.TrimPrefix(path, "/")
+	if idx := strings.LastIndex(path, ":"); idx >= 0 {
+		return path[:idx], path[idx+1:]
+	}
+	return path, ""
+}
@@ -58,6 +58,14 @@ const (
 	RelayModeResponses
 
 	RelayModeRealtime
+
+	RelayModeImagesEdits
+	RelayModeImagesVariations
+
+	RelayModeVideoSubmit
+	RelayModeVideoFetchByID
+	RelayModeVideoList
+	RelayModeVideoContent
 )
 
 func Path2RelayMode(path string) int {
@@ -74,6 +82,10 @@ func Path2RelayMode(path string) int {
 		relayMode = RelayModeModerations
 	} else if strings.HasPrefix(path, "/v1/images/generations") {
 		relayMode = RelayModeImagesGenerations
+	} else if strings.HasPrefix(path, "/v1/images/edits") {
+		relayMode = RelayModeImagesEdits
+	} else if strings.HasPrefix(path, "/v1/images/variations") {
+		relayMode = RelayModeImagesVariations
 	} else if strings.HasPrefix(path, "/v1/edits") {
 		relayMode = RelayModeEdits
 	} else if strings.HasPrefix(path, "/v1/responses") {
@@ -92,6 +104,11 @@ func Path2RelayMode(path string) int {
 	return relayMode
 }
 
+// IsImageRelayMode 判断是否为图片生成、编辑或变体请求
+func IsImageRelayMode(relayMode int) bool {
+	return relayMode == RelayModeImagesGenerations || relayMode == RelayModeImagesEdits || relayMode == RelayModeImagesVariations
+}
+
 func Path2RelayModeMidjourney(path string) int {
 	relayMode := RelayModeUnknown
 	if strings.HasSuffix(path, "/mj/submit/action") {
@@ -142,3 +159,22 @@ func Path2RelaySuno(method, path string) int {
 	}
 	return relayMode
 }
+
+func Path2RelayVideo(method, path string) int {
+	relayMode := RelayModeUnknown
+	if method == http.MethodPost {
+		relayMode = RelayModeVideoSubmit
+	} else if strings.HasSuffix(path, "/content") {
+		relayMode = RelayModeVideoContent
+	} else if strings.Contains(path, "/v1/videos/") {
+		relayMode = RelayModeVideoFetchByID
+	} else {
+		relayMode = RelayModeVideoList
+	}
+	return relayMode
+}
+
+// IsVideoFetchRelayMode 查询类视频请求无需选择渠道
+func IsVideoFetchRelayMode(relayMode int) bool {
+	return relayMode == RelayModeVideoFetchByID || relayMode == RelayModeVideoList || relayMode == RelayModeVideoContent
+}
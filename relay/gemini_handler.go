@@ -0,0 +1,220 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"veloera/common"
+	"veloera/dto"
+	"veloera/relay/channel/gemini"
+	relaycommon "veloera/relay/common"
+	relayconstant "veloera/relay/constant"
+	"veloera/relay/helper"
+	"veloera/service"
+	"veloera/setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getAndValidateGeminiRequest(c *gin.Context, relayInfo *relaycommon.RelayInfo) (*gemini.GeminiChatRequest, error) {
+	_, action := relaycommon.GetGeminiModelAndAction(c.Param("path"))
+	switch action {
+	case "generateContent":
+		relayInfo.IsStream = false
+	case "streamGenerateContent":
+		relayInfo.IsStream = true
+	default:
+		return nil, fmt.Errorf("unsupported action: %s", action)
+	}
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, err
+	}
+	textRequest := &gemini.GeminiChatRequest{}
+	if err = json.Unmarshal(requestBody, textRequest); err != nil {
+		return nil, err
+	}
+	if len(textRequest.Contents) == 0 {
+		return nil, errors.New("field contents is required")
+	}
+	relayInfo.PromptMessages = textRequest.Contents
+	return textRequest, nil
+}
+
+// isGeminiNativeChannel 渠道本身支持 gemini 原生格式时直接透传请求
+func isGeminiNativeChannel(info *relaycommon.RelayInfo) bool {
+	switch info.ChannelType {
+	case common.ChannelTypeGemini:
+		return true
+	case common.ChannelTypeVertexAi:
+		return strings.HasPrefix(info.UpstreamModelName, "gemini")
+	}
+	return false
+}
+
+func GeminiHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
+
+	relayInfo := relaycommon.GenRelayInfoGemini(c)
+
+	// get & validate textRequest 获取并验证文本请求
+	textRequest, err := getAndValidateGeminiRequest(c, relayInfo)
+	if err != nil {
+		common.LogError(c, fmt.Sprintf("getAndValidateGeminiRequest failed: %s", err.Error()))
+		return service.OpenAIErrorWrapperLocal(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+
+	promptText := getGeminiPromptText(textRequest)
+	if setting.ShouldCheckPromptSensitiveWithGroup(c.GetString("token_group")) {
+		words, err := service.CheckSensitiveInput(promptText)
+		if err != nil {
+			common.LogWarn(c, fmt.Sprintf("user sensitive words detected: %s", strings.Join(words, ", ")))
+			return service.OpenAIErrorWrapperLocal(err, "sensitive_words_detected", http.StatusBadRequest)
+		}
+	}
+
+	err = helper.ModelMappedHelper(c, relayInfo)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
+	}
+
+	promptTokens, err := service.CountTextToken(strings.Join(promptText, "\n"), relayInfo.UpstreamModelName)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
+	}
+	relayInfo.PromptTokens = promptTokens
+
+	priceData, err := helper.ModelPriceHelper(c, relayInfo, promptTokens, int(textRequest.GenerationConfig.MaxOutputTokens))
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_price_error", http.StatusInternalServerError)
+	}
+
+	// pre-consume quota 预消耗配额
+	preConsumedQuota, userQuota, openaiErr := preConsumeQuota(c, priceData.ShouldPreConsumedQuota, relayInfo)
+	if openaiErr != nil {
+		return openaiErr
+	}
+	defer func() {
+		if openaiErr != nil {
+			returnPreConsumedQuota(c, relayInfo, userQuota, preConsumedQuota)
+		}
+	}()
+
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(relayInfo)
+
+	var requestBody io.Reader
+	nativeChannel := isGeminiNativeChannel(relayInfo)
+	if nativeChannel {
+		body, err := common.GetRequestBody(c)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "get_request_body_failed", http.StatusInternalServerError)
+		}
+		requestBody = bytes.NewBuffer(body)
+	} else {
+		// 其他渠道转换为 openai 格式
+		openAIRequest, err := gemini.GeminiRequest2OpenAI(textRequest, relayInfo.UpstreamModelName, relayInfo.IsStream)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusBadRequest)
+		}
+		if openAIRequest.Stream && relayInfo.SupportStreamOptions {
+			openAIRequest.StreamOptions = &dto.StreamOptions{
+				IncludeUsage: true,
+			}
+		}
+		relayInfo.RelayMode = relayconstant.RelayModeChatCompletions
+		relayInfo.RequestURLPath = "/v1/chat/completions"
+		relayInfo.PromptMessages = openAIRequest.Messages
+		convertedRequest, err := adaptor.ConvertOpenAIRequest(c, relayInfo, openAIRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+		jsonData, err := json.Marshal(convertedRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+		}
+		requestBody = bytes.NewBuffer(jsonData)
+	}
+	if common.DebugEnabled {
+		println("requestBody: ", requestBody.(*bytes.Buffer).String())
+	}
+
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+	var httpResp *http.Response
+	resp, err := adaptor.DoRequest(c, relayInfo, requestBody)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+
+	if resp != nil {
+		httpResp = resp.(*http.Response)
+		relayInfo.IsStream = relayInfo.IsStream || strings.HasPrefix(httpResp.Header.Get("Content-Type"), "text/event-stream")
+		if httpResp.StatusCode != http.StatusOK {
+			openaiErr = service.RelayErrorHandler(httpResp, false)
+			// reset status code 重置状态码
+			service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+			return openaiErr
+		}
+	}
+
+	var usage any
+	sensitiveWriter := service.SetupCompletionSensitiveCheck(c, relayInfo)
+	if nativeChannel {
+		usage, openaiErr = adaptor.DoResponse(c, httpResp, relayInfo)
+	} else {
+		writer := gemini.NewOpenAI2GeminiWriter(c, relayInfo)
+		usage, openaiErr = adaptor.DoResponse(c, httpResp, relayInfo)
+		textUsage, _ := usage.(*dto.Usage)
+		writer.Finish(textUsage, openaiErr)
+	}
+	sensitiveWriter.Finish()
+	if openaiErr != nil {
+		// reset status code 重置状态码
+		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+		return openaiErr
+	}
+	postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
+	return nil
+}
+
+// getGeminiPromptText 收集请求中的文本，用于敏感词检查和计算 promptTokens
+func getGeminiPromptText(request *gemini.GeminiChatRequest) []string {
+	var texts []string
+	if request.SystemInstructions != nil {
+		for _, part := range request.SystemInstructions.Parts {
+			if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+	}
+	for _, content := range request.Contents {
+		for _, part := range content.Parts {
+			if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+	}
+	return texts
+}
@@ -55,6 +55,10 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 
 	modelPrice, usePrice := operation_setting.GetModelPrice(modelNameForPrice, false)
 	groupRatio := setting.GetGroupRatio(info.Group)
+	if c.GetBool(constant2.ContextKeyBatchRequest) {
+		// 批处理请求按折扣计费
+		groupRatio *= operation_setting.GetBatchSetting().DiscountRatio
+	}
 	var preConsumedQuota int
 	var modelRatio float64
 	var completionRatio float64
@@ -24,6 +24,7 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"veloera/common"
 	"veloera/constant"
@@ -31,6 +32,7 @@ import (
 	"veloera/setting/operation_setting"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -39,6 +41,23 @@ const (
 	DefaultPingInterval      = 10 * time.Second
 )
 
+// StreamDataFilter 在上游数据交给 dataHandler 之前进行过滤，通过 constant.ContextKeyStreamDataFilter 设置到上下文中
+type StreamDataFilter interface {
+	// Filter 接收一条上游数据，返回当前可以下发的数据，stop 为 true 时不再读取上游
+	Filter(data string) (ready []string, stop bool)
+	// Flush 上游正常结束时返回仍在缓存中的数据
+	Flush() []string
+}
+
+func getStreamDataFilter(c *gin.Context) StreamDataFilter {
+	if value, exists := c.Get(constant.ContextKeyStreamDataFilter); exists {
+		if filter, ok := value.(StreamDataFilter); ok {
+			return filter
+		}
+	}
+	return nil
+}
+
 func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo, dataHandler func(data string) bool) {
 
 	if resp == nil || dataHandler == nil {
@@ -47,6 +66,15 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 
 	defer resp.Body.Close()
 
+	common.IncRelayInflightStreams()
+	defer common.DecRelayInflightStreams()
+
+	span := common.StartGinSpan(c, "relay.stream",
+		attribute.Int("channel.id", info.ChannelId),
+		attribute.String("relay.model", info.UpstreamModelName),
+	)
+	defer span.End()
+
 	streamingTimeout := time.Duration(constant.StreamingTimeout) * time.Second
 	if strings.HasPrefix(info.UpstreamModelName, "o1") || strings.HasPrefix(info.UpstreamModelName, "o3") {
 		// twice timeout for thinking model
@@ -59,6 +87,10 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		ticker     = time.NewTicker(streamingTimeout)
 		pingTicker *time.Ticker
 		writeMutex sync.Mutex // Mutex to protect concurrent writes
+		filter     = getStreamDataFilter(c)
+		finished   bool        // 处理函数已返回，不再回调 dataHandler
+		completed  atomic.Bool // 上游已发出 [DONE] 或 finish_reason
+		timedOut   bool
 	)
 
 	generalSettings := operation_setting.GetGeneralSetting()
@@ -83,7 +115,8 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 	scanner.Split(bufio.ScanLines)
 	SetEventStreamHeaders(c)
 
-	ctx, cancel := context.WithCancel(context.Background())
+	// 跟随客户端请求的 context，客户端断开时停止读取上游
+	ctx, cancel := context.WithCancel(c.Request.Context())
 	defer cancel()
 
 	ctx = context.WithValue(ctx, "stop_chan", stopChan)
@@ -116,6 +149,7 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 	}
 
 	common.RelayCtxGo(ctx, func() {
+		handlerStopped := false
 		for scanner.Scan() {
 			ticker.Reset(streamingTimeout)
 			data := scanner.Text()
@@ -132,19 +166,57 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 			data = data[5:]
 			data = strings.TrimLeft(data, " ")
 			data = strings.TrimSuffix(data, "\"")
+			if strings.HasPrefix(data, "[DONE]") || streamDataHasFinishReason(data) {
+				completed.Store(true)
+			}
 			if !strings.HasPrefix(data, "[DONE]") {
 				info.SetFirstResponseTime()
 				writeMutex.Lock() // Lock before writing
-				success := dataHandler(data)
+				if finished {
+					writeMutex.Unlock()
+					break
+				}
+				success := true
+				if filter == nil {
+					success = dataHandler(data)
+				} else {
+					ready, stop := filter.Filter(data)
+					for _, item := range ready {
+						if !dataHandler(item) {
+							success = false
+							break
+						}
+					}
+					if stop {
+						// 过滤器要求终止，不再读取上游
+						success = false
+					}
+				}
 				writeMutex.Unlock() // Unlock after writing
 				if !success {
+					handlerStopped = true
+					break
+				}
+			}
+		}
+
+		// 上游结束后下发过滤器中缓存的数据
+		if filter != nil && !handlerStopped {
+			writeMutex.Lock()
+			if finished {
+				writeMutex.Unlock()
+				return
+			}
+			for _, item := range filter.Flush() {
+				if !dataHandler(item) {
 					break
 				}
 			}
+			writeMutex.Unlock()
 		}
 
 		if err := scanner.Err(); err != nil {
-			if err != io.EOF {
+			if err != io.EOF && ctx.Err() == nil {
 				common.LogError(c, "scanner error: "+err.Error())
 			}
 		}
@@ -156,9 +228,47 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 	case <-ticker.C:
 		// 超时处理逻辑
 		common.LogError(c, "streaming timeout")
+		timedOut = true
 		common.SafeSendBool(stopChan, true)
 	case <-stopChan:
 		// 正常结束
 		common.LogInfo(c, "streaming finished")
+	case <-ctx.Done():
+	}
+	if c.Request.Context().Err() != nil {
+		// 客户端断开，上游请求随之取消，按已下发的内容结算
+		info.ClientCancelled = true
+		common.LogInfo(c, "client disconnected, settling partial stream")
+	}
+	// 只有上游明确结束且未超时、客户端未断开时才视为完整响应
+	info.StreamCompleted = completed.Load() && !timedOut && !info.ClientCancelled
+
+	// 之后不再回调 dataHandler，调用方可以安全地读取已累计的内容进行结算
+	writeMutex.Lock()
+	finished = true
+	writeMutex.Unlock()
+}
+
+var streamFinishReasonKeys = []string{`"finish_reason"`, `"finishReason"`, `"stop_reason"`}
+
+// streamDataHasFinishReason 判断一条流式数据是否携带了非空的结束原因
+func streamDataHasFinishReason(data string) bool {
+	for _, key := range streamFinishReasonKeys {
+		rest := data
+		for {
+			idx := strings.Index(rest, key)
+			if idx < 0 {
+				break
+			}
+			rest = strings.TrimLeft(rest[idx+len(key):], " ")
+			if !strings.HasPrefix(rest, ":") {
+				continue
+			}
+			value := strings.TrimLeft(rest[1:], " ")
+			if strings.HasPrefix(value, "\"") && !strings.HasPrefix(value, "\"\"") {
+				return true
+			}
+		}
 	}
+	return false
 }
@@ -24,14 +24,18 @@ import (
 	"github.com/gin-gonic/gin"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"veloera/common"
+	"veloera/constant"
 	"veloera/dto"
 	"veloera/model"
 	relaycommon "veloera/relay/common"
+	relayconstant "veloera/relay/constant"
 	"veloera/relay/helper"
 	"veloera/service"
 	"veloera/setting"
+	"veloera/setting/operation_setting"
 )
 
 func getAndValidImageRequest(c *gin.Context, info *relaycommon.RelayInfo) (*dto.ImageRequest, error) {
@@ -76,13 +80,108 @@ func getAndValidImageRequest(c *gin.Context, info *relaycommon.RelayInfo) (*dto.
 	//if imageRequest.N != 0 && (imageRequest.N < 1 || imageRequest.N > 10) {
 	//	return service.OpenAIErrorWrapper(errors.New("n must be between 1 and 10"), "invalid_field_value", http.StatusBadRequest)
 	//}
+	if err := checkImagePromptSensitive(c, imageRequest.Prompt); err != nil {
+		return nil, err
+	}
+	return imageRequest, nil
+}
+
+func checkImagePromptSensitive(c *gin.Context, prompt string) error {
 	tokenGroup := c.GetString("token_group")
-	if setting.ShouldCheckPromptSensitiveWithGroup(tokenGroup) {
-		words, err := service.CheckSensitiveInput(imageRequest.Prompt)
+	if prompt != "" && setting.ShouldCheckPromptSensitiveWithGroup(tokenGroup) {
+		words, err := service.CheckSensitiveInput(prompt)
 		if err != nil {
 			common.LogWarn(c, fmt.Sprintf("user sensitive words detected: %s", strings.Join(words, ",")))
+			return err
+		}
+	}
+	return nil
+}
+
+// getAndValidImageEditRequest 解析 multipart 格式的图片编辑与变体请求
+func getAndValidImageEditRequest(c *gin.Context, info *relaycommon.RelayInfo) (*dto.ImageRequest, error) {
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "multipart/form-data") {
+		return nil, errors.New("content type must be multipart/form-data")
+	}
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, fmt.Errorf("parse multipart form failed: %w", err)
+	}
+	formValue := func(key string) string {
+		if values := form.Value[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	imageRequest := &dto.ImageRequest{
+		Model:          formValue("model"),
+		Prompt:         formValue("prompt"),
+		Size:           formValue("size"),
+		Quality:        formValue("quality"),
+		ResponseFormat: formValue("response_format"),
+		User:           formValue("user"),
+		Background:     formValue("background"),
+		OutputFormat:   formValue("output_format"),
+		Moderation:     formValue("moderation"),
+		InputFidelity:  formValue("input_fidelity"),
+	}
+	if n := formValue("n"); n != "" {
+		imageRequest.N, err = strconv.Atoi(n)
+		if err != nil || imageRequest.N < 1 || imageRequest.N > 10 {
+			return nil, errors.New("n must be between 1 and 10")
+		}
+	}
+	if compression := formValue("output_compression"); compression != "" {
+		value, err := strconv.Atoi(compression)
+		if err != nil {
+			return nil, errors.New("output_compression must be an integer")
+		}
+		imageRequest.OutputCompression = &value
+	}
+
+	// gpt-image-1 支持多张输入图片，按 image[] 或重复的 image 字段上传
+	fileHeaders := append(form.File["image"], form.File["image[]"]...)
+	if len(fileHeaders) == 0 {
+		return nil, errors.New("image is required")
+	}
+	for _, fileHeader := range fileHeaders {
+		imageFile, err := service.ReadImageFile(fileHeader)
+		if err != nil {
 			return nil, err
 		}
+		imageRequest.Images = append(imageRequest.Images, *imageFile)
+	}
+	if masks := form.File["mask"]; len(masks) > 0 {
+		imageRequest.Mask, err = service.ReadImageFile(masks[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if imageRequest.N == 0 {
+		imageRequest.N = 1
+	}
+	if imageRequest.Model == "" {
+		imageRequest.Model = "dall-e-2"
+	}
+	if info.RelayMode == relayconstant.RelayModeImagesVariations {
+		if len(imageRequest.Images) != 1 {
+			return nil, errors.New("variations require exactly one image")
+		}
+		imageRequest.Prompt = ""
+	} else {
+		if imageRequest.Prompt == "" {
+			return nil, errors.New("prompt is required")
+		}
+		if imageRequest.Model == "dall-e-2" && len(imageRequest.Images) > 1 {
+			return nil, errors.New("dall-e-2 only supports one input image")
+		}
+	}
+	if imageRequest.Size == "" {
+		imageRequest.Size = "1024x1024"
+	}
+	if err := checkImagePromptSensitive(c, imageRequest.Prompt); err != nil {
+		return nil, err
 	}
 	return imageRequest, nil
 }
@@ -90,7 +189,13 @@ func getAndValidImageRequest(c *gin.Context, info *relaycommon.RelayInfo) (*dto.
 func ImageHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 	relayInfo := relaycommon.GenRelayInfo(c)
 
-	imageRequest, err := getAndValidImageRequest(c, relayInfo)
+	var imageRequest *dto.ImageRequest
+	var err error
+	if relayInfo.RelayMode == relayconstant.RelayModeImagesGenerations {
+		imageRequest, err = getAndValidImageRequest(c, relayInfo)
+	} else {
+		imageRequest, err = getAndValidImageEditRequest(c, relayInfo)
+	}
 	if err != nil {
 		common.LogError(c, fmt.Sprintf("getAndValidImageRequest failed: %s", err.Error()))
 		return service.OpenAIErrorWrapper(err, "invalid_image_request", http.StatusBadRequest)
@@ -113,27 +218,11 @@ func ImageHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		priceData.ModelPrice = 0.0025 * priceData.ModelRatio
 	}
 
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	userQuota, err := model.GetBillingQuota(relayInfo.UserId, relayInfo.OrganizationId)
 
-	sizeRatio := 1.0
-	// Size
-	if imageRequest.Size == "256x256" {
-		sizeRatio = 0.4
-	} else if imageRequest.Size == "512x512" {
-		sizeRatio = 0.45
-	} else if imageRequest.Size == "1024x1024" {
-		sizeRatio = 1
-	} else if imageRequest.Size == "1024x1792" || imageRequest.Size == "1792x1024" {
-		sizeRatio = 2
-	}
-
-	qualityRatio := 1.0
-	if imageRequest.Model == "dall-e-3" && imageRequest.Quality == "hd" {
-		qualityRatio = 2.0
-		if imageRequest.Size == "1024x1792" || imageRequest.Size == "1792x1024" {
-			qualityRatio = 1.5
-		}
-	}
+	// 按尺寸与品质调整单张价格
+	sizeRatio := operation_setting.GetImageSizeRatio(imageRequest.Model, imageRequest.Size)
+	qualityRatio := operation_setting.GetImageQualityRatio(imageRequest.Model, imageRequest.Quality, imageRequest.Size)
 
 	priceData.ModelPrice *= sizeRatio * qualityRatio * float64(imageRequest.N)
 	quota := int(priceData.ModelPrice * priceData.GroupRatio * common.QuotaPerUnit)
@@ -155,11 +244,17 @@ func ImageHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
 	}
 
-	jsonData, err := json.Marshal(convertedRequest)
-	if err != nil {
-		return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+	if reader, ok := convertedRequest.(io.Reader); ok {
+		// 图片编辑与变体请求由适配器构造 multipart 请求体
+		requestBody = reader
+	} else {
+		jsonData, err := json.Marshal(convertedRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+		}
+		requestBody = bytes.NewBuffer(jsonData)
 	}
-	requestBody = bytes.NewBuffer(jsonData)
+	c.Set(constant.ContextKeyImageFormat, imageRequest.ResponseFormat)
 
 	statusCodeMappingStr := c.GetString("status_code_mapping")
 
@@ -191,12 +286,15 @@ func ImageHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		TotalTokens:  imageRequest.N,
 	}
 
-	quality := "standard"
-	if imageRequest.Quality == "hd" {
-		quality = "hd"
+	quality := imageRequest.Quality
+	if quality == "" {
+		quality = "standard"
 	}
 
 	logContent := fmt.Sprintf("大小 %s, 品质 %s", imageRequest.Size, quality)
+	if len(imageRequest.Images) > 0 {
+		logContent += fmt.Sprintf(", 输入图片 %d 张", len(imageRequest.Images))
+	}
 	postConsumeQuota(c, relayInfo, usage, 0, userQuota, priceData, logContent)
 	return nil
 }
@@ -186,7 +186,7 @@ func RelaySwapFace(c *gin.Context) *dto.MidjourneyResponse {
 	}
 	groupRatio := setting.GetGroupRatio(group)
 	ratio := modelPrice * groupRatio
-	userQuota, err := model.GetUserQuota(userId, false)
+	userQuota, err := model.GetBillingQuota(userId, c.GetInt("organization_id"))
 	if err != nil {
 		return &dto.MidjourneyResponse{
 			Code:        4,
@@ -201,6 +201,12 @@ func RelaySwapFace(c *gin.Context) *dto.MidjourneyResponse {
 			Description: "quota_not_enough",
 		}
 	}
+	if openaiErr := service.CheckBudget(c, quota); openaiErr != nil {
+		return &dto.MidjourneyResponse{
+			Code:        4,
+			Description: "budget_exceeded",
+		}
+	}
 	requestURL := getMjRequestPath(c.Request.URL.String())
 	baseURL := c.GetString("base_url")
 	fullRequestURL := fmt.Sprintf("%s%s", baseURL, requestURL)
@@ -227,6 +233,7 @@ func RelaySwapFace(c *gin.Context) *dto.MidjourneyResponse {
 				model.RecordConsumeLog(c, userId, channelId, 0, 0, modelName, tokenName,
 					quota, logContent, tokenId, userQuota, 0, false, group, other)
 				model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
+				service.RecordBudgetSpend(c, quota)
 				channelId := c.GetInt("channel_id")
 				model.UpdateChannelUsedQuota(channelId, quota)
 			}
@@ -252,6 +259,7 @@ func RelaySwapFace(c *gin.Context) *dto.MidjourneyResponse {
 		ChannelId:   c.GetInt("channel_id"),
 		Quota:       quota,
 	}
+	midjourneyTask.OrganizationId = c.GetInt("organization_id")
 	err = midjourneyTask.Insert()
 	if err != nil {
 		return service.MidjourneyErrorWrapper(constant.MjRequestError, "insert_midjourney_task_failed")
@@ -492,7 +500,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 	}
 	groupRatio := setting.GetGroupRatio(group)
 	ratio := modelPrice * groupRatio
-	userQuota, err := model.GetUserQuota(userId, false)
+	userQuota, err := model.GetBillingQuota(userId, c.GetInt("organization_id"))
 	if err != nil {
 		return &dto.MidjourneyResponse{
 			Code:        4,
@@ -507,6 +515,14 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 			Description: "quota_not_enough",
 		}
 	}
+	if consumeQuota {
+		if openaiErr := service.CheckBudget(c, quota); openaiErr != nil {
+			return &dto.MidjourneyResponse{
+				Code:        4,
+				Description: "budget_exceeded",
+			}
+		}
+	}
 
 	midjResponseWithStatus, responseBody, err := service.DoMidjourneyHttpRequest(c, time.Second*60, fullRequestURL)
 	if err != nil {
@@ -529,6 +545,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 				model.RecordConsumeLog(c, userId, channelId, 0, 0, modelName, tokenName,
 					quota, logContent, tokenId, userQuota, 0, false, group, other)
 				model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
+				service.RecordBudgetSpend(c, quota)
 				channelId := c.GetInt("channel_id")
 				model.UpdateChannelUsedQuota(channelId, quota)
 			}
@@ -561,6 +578,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 		ChannelId:   c.GetInt("channel_id"),
 		Quota:       quota,
 	}
+	midjourneyTask.OrganizationId = c.GetInt("organization_id")
 	if midjResponse.Code == 3 {
 		//无实例账号自动禁用渠道（No available account instance）
 		channel, err := model.GetChannelById(midjourneyTask.ChannelId, true)
@@ -249,7 +249,18 @@ func applyParamOverride(jsonData []byte, paramOverride map[string]interface{}) (
 
 func processResponse(c *gin.Context, httpResp *http.Response, relayInfo *relaycommon.RelayInfo) (*dto.Usage, *dto.OpenAIErrorWithStatusCode) {
 	adaptor := GetAdaptor(relayInfo.ApiType)
+	sensitiveWriter := service.SetupCompletionSensitiveCheck(c, relayInfo)
+	// 非 OpenAI 渠道返回的是 chat completions 格式，需要转换回 responses 格式
+	var responsesWriter *service.OpenAI2ResponsesWriter
+	if relayInfo.ResponsesConvertInfo != nil {
+		responsesWriter = service.NewOpenAI2ResponsesWriter(c, relayInfo)
+	}
 	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	if responsesWriter != nil {
+		textUsage, _ := usage.(*dto.Usage)
+		responsesWriter.Finish(textUsage, openaiErr)
+	}
+	sensitiveWriter.Finish()
 
 	if openaiErr != nil {
 		statusCodeMappingStr := c.GetString("status_code_mapping")
@@ -43,6 +43,7 @@ import (
 	"github.com/shopspring/decimal"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func getAndValidateTextRequest(c *gin.Context, relayInfo *relaycommon.RelayInfo) (*dto.GeneralOpenAIRequest, error) {
@@ -129,7 +130,10 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		promptTokens = value.(int)
 		relayInfo.PromptTokens = promptTokens
 	} else {
+		span := common.StartGinSpan(c, "token.count", attribute.String("relay.model", textRequest.Model))
 		promptTokens, err = getPromptTokens(textRequest, relayInfo)
+		span.SetAttributes(attribute.Int("tokens.prompt", promptTokens))
+		span.End()
 		// count messages token error 计算promptTokens错误
 		if err != nil {
 			return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
@@ -174,6 +178,13 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		relayInfo.ShouldIncludeUsage = true
 	}
 
+	cacheKey, cachedUsage := lookupResponseCache(c, relayInfo, textRequest)
+	if cachedUsage != nil {
+		applyResponseCacheRatio(&priceData)
+		postConsumeQuota(c, relayInfo, cachedUsage, preConsumedQuota, userQuota, priceData, "命中响应缓存")
+		return nil
+	}
+
 	streamSupport := ""
 	if v, ok := relayInfo.ChannelSetting[constant.ChannelSettingStreamSupport]; ok {
 		if str, ok2 := v.(string); ok2 {
@@ -237,11 +248,13 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 	}
 
 	var httpResp *http.Response
+	cacheWriter := service.SetupResponseCacheWriter(c, cacheKey)
 	resp, err := adaptor.DoRequest(c, relayInfo, requestBody)
 	if err != nil {
 		if pseudoStream && stopHeartbeat != nil {
 			stopHeartbeat()
 		}
+		cacheWriter.Finish(relayInfo, nil, false)
 		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
 
@@ -254,6 +267,7 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 			if pseudoStream && stopHeartbeat != nil {
 				stopHeartbeat()
 			}
+			cacheWriter.Finish(relayInfo, nil, false)
 			openaiErr = service.RelayErrorHandler(httpResp, false)
 			// reset status code 重置状态码
 			service.ResetStatusCode(openaiErr, statusCodeMappingStr)
@@ -262,6 +276,7 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 	}
 
 	var usage any
+	sensitiveWriter := service.SetupCompletionSensitiveCheck(c, relayInfo)
 	if pseudoStream {
 		switch relayInfo.ChannelType {
 		case common.ChannelTypeOpenAI:
@@ -274,7 +289,9 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 	} else {
 		usage, openaiErr = adaptor.DoResponse(c, httpResp, relayInfo)
 	}
+	sensitiveWriter.Finish()
 	if openaiErr != nil {
+		cacheWriter.Finish(relayInfo, nil, false)
 		if pseudoStream && stopHeartbeat != nil {
 			stopHeartbeat()
 		}
@@ -291,6 +308,7 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 	if pseudoStream && stopHeartbeat != nil {
 		stopHeartbeat()
 	}
+	cacheWriter.Finish(relayInfo, usage.(*dto.Usage), !relayInfo.IsStream || relayInfo.StreamCompleted)
 	return nil
 }
 
@@ -330,9 +348,13 @@ func checkRequestSensitive(textRequest *dto.GeneralOpenAIRequest, info *relaycom
 	return words, err
 }
 
-// 预扣费并返回用户剩余配额
+// 预扣费并返回用户剩余配额，所有 relay helper 共用
 func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommon.RelayInfo) (int, int, *dto.OpenAIErrorWithStatusCode) {
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	// 按 prompt tokens 预占 TPM/TPD 用量，结算时按实际用量修正；调用前各 helper 已设置 relayInfo.PromptTokens
+	if openaiErr := service.ReserveUsageLimitTokens(c, relayInfo.PromptTokens); openaiErr != nil {
+		return 0, 0, openaiErr
+	}
+	userQuota, err := model.GetBillingQuota(relayInfo.UserId, relayInfo.OrganizationId)
 	if err != nil {
 		return 0, 0, service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -343,6 +365,10 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 		return 0, 0, service.OpenAIErrorWrapperLocal(fmt.Errorf("chat pre-consumed quota failed, user quota: %s, need quota: %s", common.FormatQuota(userQuota), common.FormatQuota(preConsumedQuota)), "insufficient_user_quota", http.StatusForbidden)
 	}
 	relayInfo.UserQuota = userQuota
+	// 预算上限与余额不足使用不同的错误码，方便客户端区分
+	if openaiErr := service.CheckBudget(c, preConsumedQuota); openaiErr != nil {
+		return 0, 0, openaiErr
+	}
 	if userQuota > 100*preConsumedQuota {
 		// 用户额度充足，判断令牌额度是否充足
 		if !relayInfo.TokenUnlimited {
@@ -366,7 +392,7 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 		if err != nil {
 			return 0, 0, service.OpenAIErrorWrapperLocal(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
-		err = model.DecreaseUserQuota(relayInfo.UserId, preConsumedQuota)
+		err = model.DecreaseBillingQuota(relayInfo.UserId, relayInfo.OrganizationId, preConsumedQuota)
 		if err != nil {
 			return 0, 0, service.OpenAIErrorWrapperLocal(err, "decrease_user_quota_failed", http.StatusInternalServerError)
 		}
@@ -389,6 +415,8 @@ func returnPreConsumedQuota(c *gin.Context, relayInfo *relaycommon.RelayInfo, us
 
 func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	usage *dto.Usage, preConsumedQuota int, userQuota int, priceData helper.PriceData, extraContent string) {
+	span := service.StartQuotaSettleSpan(ctx, relayInfo)
+	defer span.End()
 	if usage == nil {
 		usage = &dto.Usage{
 			PromptTokens:     relayInfo.PromptTokens,
@@ -448,18 +476,27 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	} else {
 		logContent = fmt.Sprintf("模型价格 %.2f，分组倍率 %.2f", modelPrice, groupRatio)
 	}
+	if relayInfo.ClientCancelled {
+		logContent += "（客户端已断开）"
+	}
 
 	// record all the consume log even if quota is 0
 	if totalTokens == 0 {
 		// in this case, must be some error happened
 		// we cannot just return, because we may have to return the pre-consumed quota
 		quota = 0
-		logContent += fmt.Sprintf("（可能是上游超时）")
+		if !relayInfo.ClientCancelled {
+			logContent += fmt.Sprintf("（可能是上游超时）")
+		}
 		common.LogError(ctx, fmt.Sprintf("total tokens is 0, cannot consume quota, userId %d, channelId %d, "+
 			"tokenId %d, model %s， pre-consumed quota %d", relayInfo.UserId, relayInfo.ChannelId, relayInfo.TokenId, modelName, preConsumedQuota))
 	} else {
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
-		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		service.RecordBudgetSpend(ctx, quota)
+		// 命中响应缓存时没有实际请求渠道
+		if !ctx.GetBool(constant.ContextKeyResponseCacheHit) {
+			model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		}
 	}
 
 	quotaDelta := quota - preConsumedQuota
@@ -483,6 +520,9 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 		logContent += ", " + extraContent
 	}
 	other := service.GenerateTextOtherInfo(ctx, relayInfo, modelRatio, groupRatio, completionRatio, cacheTokens, cacheRatio, modelPrice)
+	span.SetAttributes(attribute.Int("quota", quota))
+	service.RecordRelayMetrics(ctx, relayInfo, promptTokens, completionTokens, quota)
+	service.SettleUsageLimitTokens(ctx, promptTokens+completionTokens)
 	model.RecordConsumeLog(ctx, relayInfo.UserId, relayInfo.ChannelId, promptTokens, completionTokens, logModel,
 		tokenName, quota, logContent, relayInfo.TokenId, userQuota, int(useTimeSeconds), relayInfo.IsStream, relayInfo.Group, other)
 }
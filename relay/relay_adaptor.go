@@ -17,6 +17,7 @@
 package relay
 
 import (
+	"veloera/common"
 	commonconstant "veloera/constant"
 	"veloera/relay/channel"
 	"veloera/relay/channel/ali"
@@ -37,6 +38,8 @@ import (
 	"veloera/relay/channel/palm"
 	"veloera/relay/channel/perplexity"
 	"veloera/relay/channel/siliconflow"
+	"veloera/relay/channel/task/kling"
+	"veloera/relay/channel/task/sora"
 	"veloera/relay/channel/task/suno"
 	"veloera/relay/channel/tencent"
 	"veloera/relay/channel/vertex"
@@ -116,6 +119,19 @@ func GetTaskAdaptor(platform commonconstant.TaskPlatform) channel.TaskAdaptor {
 	//	return &aiproxy.Adaptor{}
 	case commonconstant.TaskPlatformSuno:
 		return &suno.TaskAdaptor{}
+	case commonconstant.TaskPlatformSora:
+		return &sora.TaskAdaptor{}
+	case commonconstant.TaskPlatformKling:
+		return &kling.TaskAdaptor{}
 	}
 	return nil
 }
+
+// GetVideoTaskPlatform 视频任务根据所选渠道的类型确定平台，其余渠道按 OpenAI 兼容接口处理
+func GetVideoTaskPlatform(channelType int) commonconstant.TaskPlatform {
+	switch channelType {
+	case common.ChannelTypeKling:
+		return commonconstant.TaskPlatformKling
+	}
+	return commonconstant.TaskPlatformSora
+}
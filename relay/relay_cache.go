@@ -0,0 +1,109 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package relay
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/dto"
+	openai "veloera/relay/channel/openai"
+	relaycommon "veloera/relay/common"
+	relayconstant "veloera/relay/constant"
+	"veloera/relay/helper"
+	"veloera/service"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lookupResponseCache 查询响应缓存，命中时直接回放并返回缓存的用量；
+// 未命中时返回缓存键，用于记录本次响应
+func lookupResponseCache(c *gin.Context, info *relaycommon.RelayInfo, request any) (string, *dto.Usage) {
+	switch info.RelayMode {
+	case relayconstant.RelayModeChatCompletions, relayconstant.RelayModeCompletions, relayconstant.RelayModeEmbeddings:
+	default:
+		return "", nil
+	}
+	// 音频模型单独计费，不缓存
+	if strings.HasPrefix(info.OriginModelName, "gpt-4o-audio") {
+		return "", nil
+	}
+	if !service.ShouldUseResponseCache(c, info) {
+		return "", nil
+	}
+	key, err := service.ResponseCacheKey(info, request)
+	if err != nil {
+		common.LogError(c, "failed to generate response cache key: "+err.Error())
+		return "", nil
+	}
+	if entry := service.GetResponseCache(key); entry != nil && replayResponseCache(c, info, entry) {
+		common.LogInfo(c, "response cache hit: "+key)
+		c.Set(constant.ContextKeyResponseCacheHit, true)
+		return "", &entry.Usage
+	}
+	return key, nil
+}
+
+// applyResponseCacheRatio 命中缓存的请求按缓存计费倍率计费
+func applyResponseCacheRatio(priceData *helper.PriceData) {
+	priceData.GroupRatio *= operation_setting.GetResponseCacheSetting().BillingRatio
+}
+
+// replayResponseCache 按请求的 stream 参数回放缓存内容，无法转换格式时返回 false 视为未命中
+func replayResponseCache(c *gin.Context, info *relaycommon.RelayInfo, entry *service.ResponseCacheEntry) bool {
+	switch {
+	case entry.IsStream && info.IsStream:
+		info.SetFirstResponseTime()
+		helper.SetEventStreamHeaders(c)
+		c.Writer.Header().Set(service.ResponseCacheHeader, "HIT")
+		c.Status(http.StatusOK)
+		for _, event := range bytes.SplitAfter(entry.Body, []byte("\n\n")) {
+			if len(event) == 0 {
+				continue
+			}
+			_, _ = c.Writer.Write(event)
+			c.Writer.Flush()
+		}
+		return true
+	case !entry.IsStream && !info.IsStream:
+		info.SetFirstResponseTime()
+		c.Writer.Header().Set(service.ResponseCacheHeader, "HIT")
+		c.Data(http.StatusOK, entry.ContentType, entry.Body)
+		return true
+	case !entry.IsStream && info.IsStream && info.RelayMode == relayconstant.RelayModeChatCompletions:
+		// 非流式的缓存结果以 SSE 形式回放给流式请求
+		var textResponse dto.OpenAITextResponse
+		if err := common.DecodeJson(entry.Body, &textResponse); err != nil || len(textResponse.Choices) == 0 {
+			return false
+		}
+		info.SetFirstResponseTime()
+		helper.SetEventStreamHeaders(c)
+		c.Writer.Header().Set(service.ResponseCacheHeader, "HIT")
+		streamResp := openai.BuildStreamChunkFromTextResponse(&textResponse)
+		_ = helper.ObjectData(c, streamResp)
+		if info.ShouldIncludeUsage {
+			final := helper.GenerateFinalUsageResponse(textResponse.Id, textResponse.Created, textResponse.Model, entry.Usage)
+			_ = helper.ObjectData(c, final)
+		}
+		helper.Done(c)
+		return true
+	}
+	return false
+}
@@ -88,6 +88,13 @@ func EmbeddingHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 		}
 	}()
 
+	cacheKey, cachedUsage := lookupResponseCache(c, relayInfo, embeddingRequest)
+	if cachedUsage != nil {
+		applyResponseCacheRatio(&priceData)
+		postConsumeQuota(c, relayInfo, cachedUsage, preConsumedQuota, userQuota, priceData, "命中响应缓存")
+		return nil
+	}
+
 	adaptor := GetAdaptor(relayInfo.ApiType)
 	if adaptor == nil {
 		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
@@ -105,8 +112,10 @@ func EmbeddingHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 	}
 	requestBody := bytes.NewBuffer(jsonData)
 	statusCodeMappingStr := c.GetString("status_code_mapping")
+	cacheWriter := service.SetupResponseCacheWriter(c, cacheKey)
 	resp, err := adaptor.DoRequest(c, relayInfo, requestBody)
 	if err != nil {
+		cacheWriter.Finish(relayInfo, nil, false)
 		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
 
@@ -114,6 +123,7 @@ func EmbeddingHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 	if resp != nil {
 		httpResp = resp.(*http.Response)
 		if httpResp.StatusCode != http.StatusOK {
+			cacheWriter.Finish(relayInfo, nil, false)
 			openaiErr = service.RelayErrorHandler(httpResp, false)
 			// reset status code 重置状态码
 			service.ResetStatusCode(openaiErr, statusCodeMappingStr)
@@ -123,10 +133,12 @@ func EmbeddingHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 
 	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
 	if openaiErr != nil {
+		cacheWriter.Finish(relayInfo, nil, false)
 		// reset status code 重置状态码
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
 		return openaiErr
 	}
 	postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
+	cacheWriter.Finish(relayInfo, usage.(*dto.Usage), !relayInfo.IsStream || relayInfo.StreamCompleted)
 	return nil
 }
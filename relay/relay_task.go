@@ -30,6 +30,7 @@ import (
 	"veloera/model"
 	relaycommon "veloera/relay/common"
 	relayconstant "veloera/relay/constant"
+	"veloera/relay/helper"
 	"veloera/service"
 	"veloera/setting"
 	"veloera/setting/operation_setting"
@@ -41,6 +42,12 @@ Task 任务通过平台、Action 区分任务
 func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 	platform := constant.TaskPlatform(c.GetString("platform"))
 	relayInfo := relaycommon.GenTaskRelayInfo(c)
+	if relayMode == relayconstant.RelayModeVideoSubmit {
+		platform = GetVideoTaskPlatform(relayInfo.ChannelType)
+		if err := helper.ModelMappedHelper(c, relayInfo.RelayInfo); err != nil {
+			return service.TaskErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
+		}
+	}
 
 	adaptor := GetTaskAdaptor(platform)
 	if adaptor == nil {
@@ -54,6 +61,10 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 	}
 
 	modelName := service.CoverTaskActionToModelName(platform, relayInfo.Action)
+	if relayMode == relayconstant.RelayModeVideoSubmit {
+		// 视频任务按请求的模型计费
+		modelName = relayInfo.OriginModelName
+	}
 	modelPrice, success := operation_setting.GetModelPrice(modelName, true)
 	if !success {
 		defaultPrice, ok := operation_setting.GetDefaultModelRatioMap()[modelName]
@@ -63,11 +74,15 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 			modelPrice = defaultPrice
 		}
 	}
+	secondPrice, perSecond := operation_setting.GetVideoSecondPrice(modelName)
+	if relayMode == relayconstant.RelayModeVideoSubmit && perSecond {
+		modelPrice = secondPrice * float64(relayInfo.Duration)
+	}
 
 	// 预扣
 	groupRatio := setting.GetGroupRatio(relayInfo.Group)
 	ratio := modelPrice * groupRatio
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	userQuota, err := model.GetBillingQuota(relayInfo.UserId, relayInfo.OrganizationId)
 	if err != nil {
 		taskErr = service.TaskErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 		return
@@ -77,6 +92,10 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 		taskErr = service.TaskErrorWrapperLocal(errors.New("user quota is not enough"), "quota_not_enough", http.StatusForbidden)
 		return
 	}
+	if openaiErr := service.CheckBudget(c, quota); openaiErr != nil {
+		taskErr = service.TaskErrorWrapperLocal(errors.New(openaiErr.Error.Message), fmt.Sprintf("%v", openaiErr.Error.Code), openaiErr.StatusCode)
+		return
+	}
 
 	if relayInfo.OriginTaskID != "" {
 		originTask, exist, err := model.GetByTaskId(relayInfo.UserId, relayInfo.OriginTaskID)
@@ -139,9 +158,17 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 				other := make(map[string]interface{})
 				other["model_price"] = modelPrice
 				other["group_ratio"] = groupRatio
+				if relayMode == relayconstant.RelayModeVideoSubmit {
+					other["video_seconds"] = relayInfo.Duration
+					if perSecond {
+						logContent = fmt.Sprintf("按秒计费 %.4f/秒，时长 %d 秒，分组倍率 %.2f，操作 %s", secondPrice, relayInfo.Duration, groupRatio, relayInfo.Action)
+						other["second_price"] = secondPrice
+					}
+				}
 				model.RecordConsumeLog(c, relayInfo.UserId, relayInfo.ChannelId, 0, 0,
 					modelName, tokenName, quota, logContent, relayInfo.TokenId, userQuota, 0, false, relayInfo.Group, other)
 				model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
+				service.RecordBudgetSpend(c, quota)
 				model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
 			}
 		}
@@ -153,8 +180,10 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 	}
 	relayInfo.ConsumeQuota = true
 	// insert task
-	task := model.InitTask(constant.TaskPlatformSuno, relayInfo)
+	task := model.InitTask(platform, relayInfo)
 	task.TaskID = taskID
+	task.Action = relayInfo.Action
+	task.Properties.KeyHash = model.GetChannelKeyHash(relayInfo.ApiKey)
 	task.Quota = quota
 	task.Data = taskData
 	err = task.Insert()
@@ -0,0 +1,179 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/dto"
+	"veloera/model"
+	relayconstant "veloera/relay/constant"
+	"veloera/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+// RelayVideoFetch 处理 /v1/videos 的查询、列表与结果下载，数据均来自本地任务记录
+func RelayVideoFetch(c *gin.Context, relayMode int) *dto.TaskError {
+	switch relayMode {
+	case relayconstant.RelayModeVideoList:
+		return relayVideoList(c)
+	case relayconstant.RelayModeVideoContent:
+		return relayVideoContent(c)
+	}
+	task, taskErr := getUserVideoTask(c)
+	if taskErr != nil {
+		return taskErr
+	}
+	c.JSON(http.StatusOK, TaskModel2Video(task))
+	return nil
+}
+
+func getUserVideoTask(c *gin.Context) (*model.Task, *dto.TaskError) {
+	task, exist, err := model.GetByTaskId(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		return nil, service.TaskErrorWrapper(err, "get_task_failed", http.StatusInternalServerError)
+	}
+	if !exist || !lo.Contains(constant.VideoTaskPlatforms, task.Platform) {
+		return nil, service.TaskErrorWrapperLocal(errors.New("video not found"), "video_not_found", http.StatusNotFound)
+	}
+	return task, nil
+}
+
+func relayVideoList(c *gin.Context) *dto.TaskError {
+	userId := c.GetInt("id")
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	var afterId int64
+	if after := c.Query("after"); after != "" {
+		afterTask, exist, err := model.GetByTaskId(userId, after)
+		if err != nil {
+			return service.TaskErrorWrapper(err, "get_task_failed", http.StatusInternalServerError)
+		}
+		if exist {
+			afterId = afterTask.ID
+		}
+	}
+	// 多取一条用于判断是否还有更多数据
+	tasks, err := model.GetUserTasksByPlatforms(userId, constant.VideoTaskPlatforms, afterId, limit+1)
+	if err != nil {
+		return service.TaskErrorWrapper(err, "get_tasks_failed", http.StatusInternalServerError)
+	}
+	videoList := dto.OpenAIVideoList{
+		Object:  "list",
+		Data:    make([]*dto.OpenAIVideo, 0, len(tasks)),
+		HasMore: len(tasks) > limit,
+	}
+	if videoList.HasMore {
+		tasks = tasks[:limit]
+	}
+	for _, task := range tasks {
+		videoList.Data = append(videoList.Data, TaskModel2Video(task))
+	}
+	if len(videoList.Data) > 0 {
+		videoList.FirstId = videoList.Data[0].ID
+		videoList.LastId = videoList.Data[len(videoList.Data)-1].ID
+	}
+	c.JSON(http.StatusOK, videoList)
+	return nil
+}
+
+func relayVideoContent(c *gin.Context) *dto.TaskError {
+	task, taskErr := getUserVideoTask(c)
+	if taskErr != nil {
+		return taskErr
+	}
+	if task.Status != model.TaskStatusSuccess {
+		return service.TaskErrorWrapperLocal(errors.New("video is not ready"), "video_not_ready", http.StatusBadRequest)
+	}
+	// 优先使用本地缓存，客户端不会拿到上游的临时地址
+	if task.Properties.CacheFile != "" {
+		if _, err := os.Stat(task.Properties.CacheFile); err == nil {
+			c.Header("Content-Type", "video/mp4")
+			c.File(task.Properties.CacheFile)
+			return nil
+		}
+	}
+
+	channel, err := model.CacheGetChannel(task.ChannelId)
+	if err != nil {
+		return service.TaskErrorWrapperLocal(err, "channel_not_found", http.StatusInternalServerError)
+	}
+	adaptor := GetTaskAdaptor(task.Platform)
+	if adaptor == nil {
+		return service.TaskErrorWrapperLocal(fmt.Errorf("invalid api platform: %s", task.Platform), "invalid_api_platform", http.StatusBadRequest)
+	}
+	resp, err := adaptor.FetchTaskContent(c.Request.Context(), channel.GetBaseURL(), task.GetChannelKey(channel), task.TaskID, task.Properties.ResultURL)
+	if err != nil {
+		return service.TaskErrorWrapper(err, "fetch_content_failed", http.StatusInternalServerError)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return service.TaskErrorWrapper(fmt.Errorf("fetch content status code: %d", resp.StatusCode), "fetch_content_failed", resp.StatusCode)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = "video/mp4"
+	}
+	c.DataFromReader(http.StatusOK, resp.ContentLength, contentType, resp.Body, nil)
+	return nil
+}
+
+// TaskModel2Video 将任务记录转换为 OpenAI 风格的视频对象，状态与进度以轮询结果为准
+func TaskModel2Video(task *model.Task) *dto.OpenAIVideo {
+	video := &dto.OpenAIVideo{}
+	if len(task.Data) > 0 {
+		if err := json.Unmarshal(task.Data, video); err != nil {
+			common.SysError(fmt.Sprintf("unmarshal video task %s data failed: %v", task.TaskID, err))
+		}
+	}
+	video.ID = task.TaskID
+	video.Object = "video"
+	if video.CreatedAt == 0 {
+		video.CreatedAt = task.SubmitTime
+	}
+	video.Progress, _ = strconv.Atoi(strings.TrimSuffix(task.Progress, "%"))
+	video.Error = nil
+	switch task.Status {
+	case model.TaskStatusSuccess:
+		video.Status = dto.VideoStatusCompleted
+		video.Progress = 100
+		video.CompletedAt = task.FinishTime
+	case model.TaskStatusFailure:
+		video.Status = dto.VideoStatusFailed
+		video.CompletedAt = task.FinishTime
+		video.Error = &dto.OpenAIVideoError{
+			Code:    "video_generation_failed",
+			Message: task.FailReason,
+		}
+	case model.TaskStatusInProgress:
+		video.Status = dto.VideoStatusInProgress
+	default:
+		video.Status = dto.VideoStatusQueued
+	}
+	return video
+}
@@ -17,6 +17,7 @@
 package router
 
 import (
+	"veloera/constant"
 	"veloera/controller"
 	"veloera/middleware"
 
@@ -28,12 +29,21 @@ func SetApiRouter(router *gin.Engine) {
 	apiRouter := router.Group("/api")
 	apiRouter.Use(gzip.Gzip(gzip.DefaultCompression))
 	apiRouter.Use(middleware.GlobalAPIRateLimit())
+
+	// 细粒度权限：拥有写权限时同样可以读取
+	channelRead := middleware.PermissionAuth(constant.PermissionChannelsRead, constant.PermissionChannelsWrite)
+	channelWrite := middleware.PermissionAuth(constant.PermissionChannelsWrite)
+	usersManage := middleware.PermissionAuth(constant.PermissionUsersManage)
+	logsRead := middleware.PermissionAuth(constant.PermissionLogsRead)
+	logsWrite := middleware.PermissionAuth(constant.PermissionLogsWrite)
+	billingManage := middleware.PermissionAuth(constant.PermissionBillingManage)
+	optionsWrite := middleware.PermissionAuth(constant.PermissionOptionsWrite)
 	{
 		apiRouter.GET("/setup", controller.GetSetup)
 		apiRouter.POST("/setup", controller.PostSetup)
 		apiRouter.GET("/status", controller.GetStatus)
 		apiRouter.GET("/models", middleware.UserAuth(), controller.DashboardListModels)
-		apiRouter.GET("/status/test", middleware.AdminAuth(), controller.TestStatus)
+		apiRouter.GET("/status/test", middleware.PermissionAuth(constant.AllPermissions...), controller.TestStatus)
 		apiRouter.GET("/notice", controller.GetNotice)
 		apiRouter.GET("/about", controller.GetAbout)
 		//apiRouter.GET("/midjourney", controller.GetMidjourney)
@@ -56,6 +66,9 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			userRoute.POST("/register", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Register)
 			userRoute.POST("/login", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Login)
+			userRoute.POST("/login/2fa", middleware.CriticalRateLimit(), controller.LoginTwoFA)
+			userRoute.POST("/passkey/login/begin", middleware.CriticalRateLimit(), controller.PasskeyLoginBegin)
+			userRoute.POST("/passkey/login/finish", middleware.CriticalRateLimit(), controller.PasskeyLoginFinish)
 			//userRoute.POST("/tokenlog", middleware.CriticalRateLimit(), controller.TokenLog)
 			userRoute.GET("/logout", controller.Logout)
 			userRoute.GET("/epay/notify", controller.EpayNotify)
@@ -70,6 +83,15 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.PUT("/self", controller.UpdateSelf)
 				selfRoute.DELETE("/self", controller.DeleteSelf)
 				selfRoute.GET("/token", controller.GenerateAccessToken)
+				selfRoute.GET("/2fa/status", controller.GetTwoFAStatus)
+				selfRoute.POST("/2fa/setup", middleware.CriticalRateLimit(), controller.SetupTwoFA)
+				selfRoute.POST("/2fa/enable", middleware.CriticalRateLimit(), controller.EnableTwoFA)
+				selfRoute.POST("/2fa/disable", middleware.CriticalRateLimit(), controller.DisableTwoFA)
+				selfRoute.POST("/2fa/recovery_codes", middleware.CriticalRateLimit(), controller.RegenerateTwoFARecoveryCodes)
+				selfRoute.GET("/passkey", controller.GetPasskeys)
+				selfRoute.POST("/passkey/register/begin", middleware.CriticalRateLimit(), controller.PasskeyRegisterBegin)
+				selfRoute.POST("/passkey/register/finish", middleware.CriticalRateLimit(), controller.PasskeyRegisterFinish)
+				selfRoute.DELETE("/passkey/:id", controller.DeletePasskey)
 				selfRoute.GET("/aff", controller.GetAffCode)
 				selfRoute.POST("/topup", controller.TopUp)
 				selfRoute.POST("/pay", controller.RequestEpay)
@@ -81,7 +103,7 @@ func SetApiRouter(router *gin.Engine) {
 			}
 
 			adminRoute := userRoute.Group("/")
-			adminRoute.Use(middleware.AdminAuth())
+			adminRoute.Use(usersManage)
 			{
 				adminRoute.GET("/", controller.GetAllUsers)
 				adminRoute.GET("/search", controller.SearchUsers)
@@ -93,36 +115,52 @@ func SetApiRouter(router *gin.Engine) {
 			}
 		}
 		optionRoute := apiRouter.Group("/option")
-		optionRoute.Use(middleware.RootAuth())
+		optionRoute.Use(optionsWrite)
 		{
 			optionRoute.GET("/", controller.GetOptions)
 			optionRoute.PUT("/", controller.UpdateOption)
 			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
 		}
+		permissionRoute := apiRouter.Group("/permission")
+		{
+			permissionRoute.GET("/", usersManage, controller.GetAllPermissions)
+			permissionRoute.GET("/audit", usersManage, controller.GetPermissionAudit)
+			permissionRoute.PUT("/user", middleware.RootAuth(), controller.UpdateUserPermissions)
+		}
+		configRoute := apiRouter.Group("/config")
+		configRoute.Use(middleware.RootAuth())
+		{
+			configRoute.GET("/export", controller.ExportConfig)
+			configRoute.POST("/import", controller.ImportConfig)
+		}
 		channelRoute := apiRouter.Group("/channel")
-		channelRoute.Use(middleware.AdminAuth())
 		{
-			channelRoute.GET("/", controller.GetAllChannels)
-			channelRoute.GET("/search", controller.SearchChannels)
-			channelRoute.GET("/models", controller.ChannelListModels)
-			channelRoute.GET("/models_enabled", controller.EnabledListModels)
-			channelRoute.GET("/:id", controller.GetChannel)
-			channelRoute.GET("/test", controller.TestAllChannels)
-			channelRoute.GET("/test/:id", controller.TestChannel)
-			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
-			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
-			channelRoute.POST("/", controller.AddChannel)
-			channelRoute.PUT("/", controller.UpdateChannel)
-			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
-			channelRoute.POST("/tag/disabled", controller.DisableTagChannels)
-			channelRoute.POST("/tag/enabled", controller.EnableTagChannels)
-			channelRoute.PUT("/tag", controller.EditTagChannels)
-			channelRoute.DELETE("/:id", controller.DeleteChannel)
-			channelRoute.POST("/batch", controller.DeleteChannelBatch)
-			channelRoute.POST("/fix", controller.FixChannelsAbilities)
-			channelRoute.GET("/fetch_models/:id", controller.FetchUpstreamModels)
-			channelRoute.POST("/fetch_models", controller.FetchModels)
-			channelRoute.POST("/batch/tag", controller.BatchSetChannelTag)
+			channelRoute.GET("/", channelRead, controller.GetAllChannels)
+			channelRoute.GET("/search", channelRead, controller.SearchChannels)
+			channelRoute.GET("/models", channelRead, controller.ChannelListModels)
+			channelRoute.GET("/models_enabled", channelRead, controller.EnabledListModels)
+			channelRoute.GET("/health", channelRead, controller.GetChannelHealth)
+			channelRoute.DELETE("/health/:id", channelWrite, controller.ResetChannelHealth)
+			channelRoute.GET("/transports", channelRead, controller.GetHttpTransportStats)
+			channelRoute.GET("/:id", channelRead, controller.GetChannel)
+			channelRoute.GET("/:id/keys", channelWrite, controller.GetChannelKeys)
+			channelRoute.POST("/:id/keys/enable", channelWrite, controller.EnableChannelKeys)
+			channelRoute.GET("/test", channelWrite, controller.TestAllChannels)
+			channelRoute.GET("/test/:id", channelWrite, controller.TestChannel)
+			channelRoute.GET("/update_balance", channelWrite, controller.UpdateAllChannelsBalance)
+			channelRoute.GET("/update_balance/:id", channelWrite, controller.UpdateChannelBalance)
+			channelRoute.POST("/", channelWrite, controller.AddChannel)
+			channelRoute.PUT("/", channelWrite, controller.UpdateChannel)
+			channelRoute.DELETE("/disabled", channelWrite, controller.DeleteDisabledChannel)
+			channelRoute.POST("/tag/disabled", channelWrite, controller.DisableTagChannels)
+			channelRoute.POST("/tag/enabled", channelWrite, controller.EnableTagChannels)
+			channelRoute.PUT("/tag", channelWrite, controller.EditTagChannels)
+			channelRoute.DELETE("/:id", channelWrite, controller.DeleteChannel)
+			channelRoute.POST("/batch", channelWrite, controller.DeleteChannelBatch)
+			channelRoute.POST("/fix", channelWrite, controller.FixChannelsAbilities)
+			channelRoute.GET("/fetch_models/:id", channelRead, controller.FetchUpstreamModels)
+			channelRoute.POST("/fetch_models", channelRead, controller.FetchModels)
+			channelRoute.POST("/batch/tag", channelWrite, controller.BatchSetChannelTag)
 		}
 		tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
@@ -135,7 +173,7 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
 		}
 		redemptionRoute := apiRouter.Group("/redemption")
-		redemptionRoute.Use(middleware.AdminAuth())
+		redemptionRoute.Use(billingManage)
 		{
 			redemptionRoute.GET("/", controller.GetAllRedemptions)
 			redemptionRoute.GET("/search", controller.SearchRedemptions)
@@ -148,17 +186,40 @@ func SetApiRouter(router *gin.Engine) {
 			redemptionRoute.PUT("/", controller.UpdateRedemption)
 			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
 		}
+		organizationRoute := apiRouter.Group("/organization")
+		organizationRoute.GET("/all", usersManage, controller.GetAllOrganizations)
+		organizationRoute.PUT("/manage", usersManage, controller.ManageOrganization)
+		organizationRoute.Use(middleware.UserAuth())
+		{
+			organizationRoute.GET("/self", controller.GetSelfOrganizations)
+			organizationRoute.POST("/", controller.CreateOrganization)
+			organizationRoute.POST("/invitation/accept", controller.AcceptOrganizationInvitation)
+			organizationRoute.GET("/:id", controller.GetOrganization)
+			organizationRoute.PUT("/:id", controller.UpdateOrganization)
+			organizationRoute.DELETE("/:id", controller.DeleteOrganization)
+			organizationRoute.POST("/:id/transfer", controller.TransferOrganizationQuota)
+			organizationRoute.GET("/:id/member", controller.GetOrganizationMembers)
+			organizationRoute.PUT("/:id/member", controller.UpdateOrganizationMember)
+			organizationRoute.DELETE("/:id/member/:user_id", controller.DeleteOrganizationMember)
+			organizationRoute.GET("/:id/invitation", controller.GetOrganizationInvitations)
+			organizationRoute.POST("/:id/invitation", controller.InviteOrganizationMember)
+			organizationRoute.DELETE("/:id/invitation/:invitation_id", controller.DeleteOrganizationInvitation)
+			organizationRoute.GET("/:id/token", controller.GetOrganizationTokens)
+			organizationRoute.GET("/:id/log", controller.GetOrganizationLogs)
+			organizationRoute.GET("/:id/log/stat", controller.GetOrganizationLogsStat)
+			organizationRoute.GET("/:id/log/member", controller.GetOrganizationMemberUsage)
+		}
 		logRoute := apiRouter.Group("/log")
-		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
-		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
-		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/", logsRead, controller.GetAllLogs)
+		logRoute.DELETE("/", logsWrite, controller.DeleteHistoryLogs)
+		logRoute.GET("/stat", logsRead, controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
-		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/search", logsRead, controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
 
 		dataRoute := apiRouter.Group("/data")
-		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
+		dataRoute.GET("/", logsRead, controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
 
 		logRoute.Use(middleware.CORS())
@@ -167,18 +228,18 @@ func SetApiRouter(router *gin.Engine) {
 
 		}
 		groupRoute := apiRouter.Group("/group")
-		groupRoute.Use(middleware.AdminAuth())
+		groupRoute.Use(middleware.PermissionAuth(constant.PermissionChannelsRead, constant.PermissionChannelsWrite, constant.PermissionUsersManage))
 		{
 			groupRoute.GET("/", controller.GetGroups)
 		}
 		mjRoute := apiRouter.Group("/mj")
 		mjRoute.GET("/self", middleware.UserAuth(), controller.GetUserMidjourney)
-		mjRoute.GET("/", middleware.AdminAuth(), controller.GetAllMidjourney)
+		mjRoute.GET("/", logsRead, controller.GetAllMidjourney)
 
 		taskRoute := apiRouter.Group("/task")
 		{
 			taskRoute.GET("/self", middleware.UserAuth(), controller.GetUserTask)
-			taskRoute.GET("/", middleware.AdminAuth(), controller.GetAllTask)
+			taskRoute.GET("/", logsRead, controller.GetAllTask)
 		}
 	}
 }
@@ -37,30 +37,25 @@ func SetRelayRouter(router *gin.Engine) {
 	setupV1Router := func(v1Router *gin.RouterGroup) {
 		// WebSocket 路由
 		wsRouter := v1Router.Group("")
-		wsRouter.Use(middleware.Distribute())
+		wsRouter.Use(middleware.Distribute(), middleware.UsageLimit())
 		wsRouter.GET("/realtime", controller.WssRelay)
 
 		// HTTP 路由
 		httpRouter := v1Router.Group("")
-		httpRouter.Use(middleware.Distribute())
+		httpRouter.Use(middleware.Distribute(), middleware.UsageLimit())
 		httpRouter.POST("/messages", controller.RelayClaude)
 		httpRouter.POST("/completions", controller.Relay)
 		httpRouter.POST("/chat/completions", controller.Relay)
 		httpRouter.POST("/edits", controller.Relay)
 		httpRouter.POST("/images/generations", controller.Relay)
-		httpRouter.POST("/images/edits", controller.RelayNotImplemented)
-		httpRouter.POST("/images/variations", controller.RelayNotImplemented)
+		httpRouter.POST("/images/edits", controller.Relay)
+		httpRouter.POST("/images/variations", controller.Relay)
 		httpRouter.POST("/embeddings", controller.Relay)
 		httpRouter.POST("/engines/:model/embeddings", controller.Relay)
 		httpRouter.POST("/audio/transcriptions", controller.Relay)
 		httpRouter.POST("/audio/translations", controller.Relay)
 		httpRouter.POST("/audio/speech", controller.Relay)
 		httpRouter.POST("/responses", controller.Relay)
-		httpRouter.GET("/files", controller.RelayNotImplemented)
-		httpRouter.POST("/files", controller.RelayNotImplemented)
-		httpRouter.DELETE("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id/content", controller.RelayNotImplemented)
 		httpRouter.POST("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes/:id", controller.RelayNotImplemented)
@@ -69,20 +64,43 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.DELETE("/models/:model", controller.RelayNotImplemented)
 		httpRouter.POST("/moderations", controller.Relay)
 		httpRouter.POST("/rerank", controller.Relay)
+
+		// 视频生成异步任务，查询与下载只读取本地任务记录
+		videoRouter := v1Router.Group("/videos")
+		videoRouter.Use(middleware.Distribute())
+		videoRouter.POST("", middleware.UsageLimit(), controller.RelayTask)
+		videoRouter.GET("", controller.RelayTask)
+		videoRouter.GET("/:id", controller.RelayTask)
+		videoRouter.GET("/:id/content", controller.RelayTask)
+
+		// Files 和 Batch 路由，不需要选择渠道
+		batchRouter := v1Router.Group("")
+		batchRouter.GET("/files", controller.ListFiles)
+		batchRouter.POST("/files", controller.UploadFile)
+		batchRouter.DELETE("/files/:id", controller.DeleteFile)
+		batchRouter.GET("/files/:id", controller.RetrieveFile)
+		batchRouter.GET("/files/:id/content", controller.RetrieveFileContent)
+		batchRouter.POST("/batches", controller.CreateBatch)
+		batchRouter.GET("/batches", controller.ListBatches)
+		batchRouter.GET("/batches/:id", controller.RetrieveBatch)
+		batchRouter.POST("/batches/:id/cancel", controller.CancelBatch)
 	}
 
 	// 设置 /v1/models 路由
 	modelsRouter := router.Group("/v1/models")
+	modelsRouter.Use(middleware.Tracing())
 	modelsRouter.Use(middleware.TokenAuth())
 	setupModelsRouter(modelsRouter)
 
 	// 设置 /hf/v1/models 路由
 	hfModelsRouter := router.Group("/hf/v1/models")
+	hfModelsRouter.Use(middleware.Tracing())
 	hfModelsRouter.Use(middleware.TokenAuth())
 	setupModelsRouter(hfModelsRouter)
 
 	// 设置 /v1 路由组
 	relayV1Router := router.Group("/v1")
+	relayV1Router.Use(middleware.Tracing())
 	relayV1Router.Use(middleware.TokenAuth())
 	relayV1Router.Use(middleware.TokenRateLimit())
 	relayV1Router.Use(middleware.ModelRequestRateLimit())
@@ -90,13 +108,27 @@ func SetRelayRouter(router *gin.Engine) {
 
 	// 设置 /hf/v1 路由组
 	relayHfV1Router := router.Group("/hf/v1")
+	relayHfV1Router.Use(middleware.Tracing())
 	relayHfV1Router.Use(middleware.TokenAuth())
 	relayHfV1Router.Use(middleware.TokenRateLimit())
 	relayHfV1Router.Use(middleware.ModelRequestRateLimit())
 	setupV1Router(relayHfV1Router)
 
+	// 设置 /v1beta gemini 原生路由组
+	relayGeminiRouter := router.Group("/v1beta")
+	relayGeminiRouter.Use(middleware.Tracing())
+	relayGeminiRouter.Use(middleware.TokenAuth())
+	relayGeminiRouter.Use(middleware.TokenRateLimit())
+	relayGeminiRouter.Use(middleware.ModelRequestRateLimit())
+	relayGeminiRouter.Use(middleware.Distribute())
+	relayGeminiRouter.Use(middleware.UsageLimit())
+	{
+		// /v1beta/models/{model}:generateContent 和 :streamGenerateContent
+		relayGeminiRouter.POST("/models/*path", controller.RelayGemini)
+	}
+
 	playgroundRouter := router.Group("/pg")
-	playgroundRouter.Use(middleware.UserAuth())
+	playgroundRouter.Use(middleware.Tracing(), middleware.UserAuth())
 	{
 		playgroundRouter.POST("/chat/completions", controller.Playground)
 	}
@@ -109,7 +141,7 @@ func SetRelayRouter(router *gin.Engine) {
 	//relayMjRouter.Use()
 
 	relaySunoRouter := router.Group("/suno")
-	relaySunoRouter.Use(middleware.TokenAuth(), middleware.Distribute())
+	relaySunoRouter.Use(middleware.Tracing(), middleware.TokenAuth(), middleware.Distribute())
 	{
 		relaySunoRouter.POST("/submit/:action", controller.RelayTask)
 		relaySunoRouter.POST("/fetch", controller.RelayTask)
@@ -120,7 +152,7 @@ func SetRelayRouter(router *gin.Engine) {
 
 func registerMjRouterGroup(relayMjRouter *gin.RouterGroup) {
 	relayMjRouter.GET("/image/:id", relay.RelayMidjourneyImage)
-	relayMjRouter.Use(middleware.TokenAuth(), middleware.Distribute())
+	relayMjRouter.Use(middleware.Tracing(), middleware.TokenAuth(), middleware.Distribute())
 	{
 		relayMjRouter.POST("/submit/action", controller.RelayMidjourney)
 		relayMjRouter.POST("/submit/shorten", controller.RelayMidjourney)
@@ -0,0 +1,261 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/dto"
+	"veloera/model"
+	"veloera/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// 预算记录在周期结束后保留的天数，超过后清理
+const budgetUsageRetentionDays = 40
+
+type budgetPeriod struct {
+	name  string
+	label string
+	// start 返回 now 所在周期的起始时间（服务器本地时区）
+	start func(now time.Time) time.Time
+	// next 返回下一个周期的起始时间
+	next func(start time.Time) time.Time
+}
+
+var budgetPeriods = []budgetPeriod{
+	{
+		name:  "daily",
+		label: "每日",
+		start: func(now time.Time) time.Time {
+			return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		},
+		next: func(start time.Time) time.Time { return start.AddDate(0, 0, 1) },
+	},
+	{
+		name:  "weekly",
+		label: "每周",
+		start: func(now time.Time) time.Time {
+			// 每周从周一开始
+			offset := (int(now.Weekday()) + 6) % 7
+			return time.Date(now.Year(), now.Month(), now.Day()-offset, 0, 0, 0, 0, now.Location())
+		},
+		next: func(start time.Time) time.Time { return start.AddDate(0, 0, 7) },
+	},
+	{
+		name:  "monthly",
+		label: "每月",
+		start: func(now time.Time) time.Time {
+			return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		},
+		next: func(start time.Time) time.Time { return start.AddDate(0, 1, 0) },
+	},
+}
+
+type budgetRule struct {
+	scope  string
+	key    string
+	name   string
+	budget operation_setting.Budget
+}
+
+func (r budgetRule) periodLimit(period budgetPeriod) int {
+	switch period.name {
+	case "daily":
+		return r.budget.Daily
+	case "weekly":
+		return r.budget.Weekly
+	case "monthly":
+		return r.budget.Monthly
+	}
+	return 0
+}
+
+func budgetUsageId(rule budgetRule, period budgetPeriod, start time.Time) string {
+	return fmt.Sprintf("%s:%s:%s", rule.key, period.name, start.Format("20060102"))
+}
+
+func buildBudgetRules(c *gin.Context) []budgetRule {
+	var rules []budgetRule
+	if budget, ok := c.Value("token_budget").(operation_setting.Budget); ok && !budget.IsEmpty() {
+		rules = append(rules, budgetRule{
+			scope:  "token",
+			key:    "token:" + strconv.Itoa(c.GetInt("token_id")),
+			name:   fmt.Sprintf("令牌 %s", c.GetString("token_name")),
+			budget: budget,
+		})
+	}
+	if budget, ok := c.Value("user_budget").(operation_setting.Budget); ok && !budget.IsEmpty() {
+		rules = append(rules, budgetRule{
+			scope:  "user",
+			key:    "user:" + strconv.Itoa(c.GetInt("id")),
+			name:   "您的账户",
+			budget: budget,
+		})
+	}
+	if budget, ok := c.Value("organization_budget").(operation_setting.Budget); ok && !budget.IsEmpty() {
+		rules = append(rules, budgetRule{
+			scope:  "organization",
+			key:    "organization:" + strconv.Itoa(c.GetInt("organization_id")),
+			name:   fmt.Sprintf("组织 %s", c.GetString("organization_name")),
+			budget: budget,
+		})
+	}
+	group := c.GetString("group")
+	if budget, ok := operation_setting.GetGroupBudget(group); ok {
+		rules = append(rules, budgetRule{
+			scope:  "group",
+			key:    "group:" + group,
+			name:   fmt.Sprintf("分组 %s", group),
+			budget: budget,
+		})
+	}
+	return rules
+}
+
+// CheckBudget 检查令牌、用户与分组在当前周期内的消费是否已达到上限，quota 为本次请求预估的额度
+func CheckBudget(c *gin.Context, quota int) *dto.OpenAIErrorWithStatusCode {
+	now := time.Now()
+	for _, rule := range buildBudgetRules(c) {
+		for _, period := range budgetPeriods {
+			limit := rule.periodLimit(period)
+			if limit <= 0 {
+				continue
+			}
+			start := period.start(now)
+			used, err := model.GetBudgetUsage(budgetUsageId(rule, period, start))
+			if err != nil {
+				return OpenAIErrorWrapperLocal(err, "budget_check_failed", http.StatusInternalServerError)
+			}
+			if used >= int64(limit) || used+int64(quota) > int64(limit) {
+				return OpenAIErrorWrapperLocal(fmt.Errorf("%s budget exceeded for %s: limit %s, used %s, need %s, resets at %s",
+					period.name, rule.scope, common.FormatQuota(limit), common.FormatQuota(int(used)), common.FormatQuota(quota),
+					period.next(start).Format("2006-01-02 15:04:05")), "budget_exceeded", http.StatusTooManyRequests)
+			}
+		}
+	}
+	return nil
+}
+
+// RecordBudgetSpend 累加本次请求的实际消费，并在跨过提醒阈值时发送通知
+func RecordBudgetSpend(c *gin.Context, quota int) {
+	if quota <= 0 {
+		return
+	}
+	rules := buildBudgetRules(c)
+	if len(rules) == 0 {
+		return
+	}
+	userId := c.GetInt("id")
+	userEmail := c.GetString(constant.ContextKeyUserEmail)
+	userSetting := c.GetStringMap(constant.ContextKeyUserSetting)
+	organizationId := c.GetInt("organization_id")
+	gopool.Go(func() {
+		now := time.Now()
+		for _, rule := range rules {
+			for _, period := range budgetPeriods {
+				limit := rule.periodLimit(period)
+				if limit <= 0 {
+					continue
+				}
+				start := period.start(now)
+				used, err := model.IncreaseBudgetUsage(budgetUsageId(rule, period, start), int64(quota))
+				if err != nil {
+					common.SysError("failed to record budget usage: " + err.Error())
+					continue
+				}
+				threshold, crossed := crossedBudgetThreshold(used-int64(quota), used, int64(limit))
+				if !crossed {
+					continue
+				}
+				title := fmt.Sprintf("%s预算已使用 %d%%", period.label, threshold)
+				content := "{{value}}的{{value}}预算已使用 {{value}}%，当前周期已消费 {{value}}，预算为 {{value}}，将于 {{value}} 重置。"
+				values := []interface{}{rule.name, period.label, threshold, common.FormatQuota(int(used)), common.FormatQuota(limit),
+					period.next(start).Format("2006-01-02 15:04:05")}
+				switch rule.scope {
+				case "group":
+					NotifyRootUser(dto.NotifyTypeBudgetAlert, title, fmt.Sprintf("%s 的%s预算已使用 %d%%，当前周期已消费 %s，预算为 %s。",
+						rule.name, period.label, threshold, common.FormatQuota(int(used)), common.FormatQuota(limit)))
+				case "organization":
+					// 组织预算提醒发送给组织拥有者
+					notifyOrganizationOwner(organizationId, dto.NewNotify(dto.NotifyTypeBudgetAlert, title, content, values))
+				default:
+					err = NotifyUser(userId, userEmail, userSetting, dto.NewNotify(dto.NotifyTypeBudgetAlert, title, content, values))
+					if err != nil {
+						common.SysError(fmt.Sprintf("failed to send budget notify to user %d: %s", userId, err.Error()))
+					}
+				}
+			}
+		}
+	})
+}
+
+func notifyOrganizationOwner(organizationId int, data dto.Notify) {
+	org, err := model.GetOrganizationById(organizationId)
+	if err != nil {
+		common.SysError("failed to get organization: " + err.Error())
+		return
+	}
+	owner, err := model.GetUserById(org.OwnerId, false)
+	if err != nil {
+		common.SysError("failed to get organization owner: " + err.Error())
+		return
+	}
+	err = NotifyUser(owner.Id, owner.Email, owner.GetSetting(), data)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to send budget notify to organization %d owner: %s", organizationId, err.Error()))
+	}
+}
+
+// crossedBudgetThreshold 返回本次消费跨过的最高提醒阈值（百分比）
+func crossedBudgetThreshold(before int64, after int64, limit int64) (int, bool) {
+	thresholds := append([]int(nil), operation_setting.GetBudgetSetting().AlertThresholds...)
+	sort.Sort(sort.Reverse(sort.IntSlice(thresholds)))
+	for _, threshold := range thresholds {
+		if threshold <= 0 {
+			continue
+		}
+		target := limit * int64(threshold)
+		if before*100 < target && after*100 >= target {
+			return threshold, true
+		}
+	}
+	return 0, false
+}
+
+// StartBudgetUsageCleanup 定期清理已经结束的预算周期记录
+func StartBudgetUsageCleanup() {
+	gopool.Go(func() {
+		for {
+			target := time.Now().Add(-budgetUsageRetentionDays * 24 * time.Hour).Unix()
+			count, err := model.DeleteBudgetUsagesBefore(target)
+			if err != nil {
+				common.SysError("failed to clean up budget usages: " + err.Error())
+			} else if count > 0 {
+				common.SysLog(fmt.Sprintf("cleaned up %d budget usages", count))
+			}
+			time.Sleep(time.Hour)
+		}
+	})
+}
@@ -43,12 +43,101 @@ func DisableChannel(channelId int, channelName string, reason string) {
 func EnableChannel(channelId int, channelName string) {
 	success := model.UpdateChannelStatusById(channelId, common.ChannelStatusEnabled, "")
 	if success {
+		model.ResetChannelHealth(channelId)
 		subject := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 		content := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 		NotifyRootUser(formatNotifyType(channelId, common.ChannelStatusEnabled), subject, content)
 	}
 }
 
+// ProcessChannelKeyError 将错误归到多 key 渠道中具体的 key 上：429 使 key 冷却，需要禁用渠道的错误只禁用该 key，
+// 全部 key 都被禁用时才禁用整个渠道。返回 true 表示错误已在 key 级别处理
+func ProcessChannelKeyError(channelId int, keyHash string, err *dto.OpenAIErrorWithStatusCode) bool {
+	if keyHash == "" || err == nil || err.LocalError {
+		return false
+	}
+	channel, e := model.CacheGetChannel(channelId)
+	if e != nil {
+		return false
+	}
+	if err.StatusCode == http.StatusTooManyRequests {
+		cooldown := operation_setting.GetChannelHealthSetting().KeyCooldownSeconds
+		if cooldown <= 0 {
+			return false
+		}
+		until := common.GetTimestamp() + int64(cooldown)
+		if e := model.CoolDownChannelKey(channel.Id, keyHash, until, err.Error.Message); e != nil {
+			common.SysError(fmt.Sprintf("failed to cool down key of channel #%d: %s", channel.Id, e.Error()))
+		}
+		return true
+	}
+	if !ShouldDisableChannel(channel.Type, err) || !channel.GetAutoBan() {
+		return false
+	}
+	if e := model.DisableChannelKey(channel.Id, keyHash, err.Error.Message); e != nil {
+		common.SysError(fmt.Sprintf("failed to disable key of channel #%d: %s", channel.Id, e.Error()))
+		return false
+	}
+	common.SysLog(fmt.Sprintf("key %s of channel #%d disabled: %s", keyHash, channel.Id, err.Error.Message))
+	states := model.GetChannelKeyStates(channel.Id)
+	for _, key := range model.SplitChannelKeys(channel) {
+		if state, ok := states[model.GetChannelKeyHash(key)]; !ok || !state.Disabled {
+			return true
+		}
+	}
+	DisableChannel(channel.Id, channel.Name, model.ChannelKeysDisabledReason+err.Error.Message)
+	return true
+}
+
+// EnableChannelKeys 启用渠道中的 key，keyHashes 为空时启用全部 key。
+// 渠道因全部 key 被禁用而被自动禁用时，只要重新有可用的 key 就同时启用渠道
+func EnableChannelKeys(channelId int, keyHashes []string) error {
+	if err := model.EnableChannelKeys(channelId, keyHashes); err != nil {
+		return err
+	}
+	channel, err := model.GetChannelById(channelId, true)
+	if err != nil {
+		return err
+	}
+	if channel.Status != common.ChannelStatusAutoDisabled {
+		return nil
+	}
+	reason, _ := channel.GetOtherInfo()["status_reason"].(string)
+	if !strings.HasPrefix(reason, model.ChannelKeysDisabledReason) {
+		return nil
+	}
+	states := model.GetChannelKeyStates(channel.Id)
+	for _, key := range model.SplitChannelKeys(channel) {
+		if state, ok := states[model.GetChannelKeyHash(key)]; !ok || !state.Disabled {
+			EnableChannel(channel.Id, channel.Name)
+			return nil
+		}
+	}
+	return nil
+}
+
+// RecordChannelHealth 根据请求结果更新渠道健康度，本地错误和请求本身的错误不计入，但仍需归还探测名额
+func RecordChannelHealth(channelId int, modelName string, err *dto.OpenAIErrorWithStatusCode, latencyMs int64) {
+	result := model.ChannelResult{Success: true, LatencyMs: latencyMs}
+	if err != nil {
+		if err.LocalError {
+			model.ReleaseChannelHealth(channelId, modelName)
+			return
+		}
+		switch {
+		case err.StatusCode == http.StatusTooManyRequests:
+			result.RateLimited = true
+		case err.StatusCode/100 == 5, err.StatusCode == http.StatusUnauthorized,
+			err.StatusCode == http.StatusForbidden, err.StatusCode == http.StatusRequestTimeout:
+		default:
+			model.ReleaseChannelHealth(channelId, modelName)
+			return
+		}
+		result.Success = false
+	}
+	model.RecordChannelResult(channelId, modelName, result)
+}
+
 func ShouldDisableChannel(channelType int, err *dto.OpenAIErrorWithStatusCode) bool {
 	if !common.AutomaticDisableChannelEnabled {
 		return false
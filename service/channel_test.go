@@ -0,0 +1,77 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"testing"
+	"veloera/common"
+	"veloera/model"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// 渠道因全部 key 被禁用而被自动禁用后，重新启用 key 应同时恢复渠道
+func TestEnableChannelKeysReEnablesChannel(t *testing.T) {
+	common.RedisEnabled = false
+	common.MemoryCacheEnabled = false
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&model.User{}, &model.Channel{}, &model.Ability{}, &model.ChannelKey{}); err != nil {
+		t.Fatal(err)
+	}
+	model.DB = db
+	model.LOG_DB = db
+	channel := model.Channel{Id: 1, Name: "multi", Key: "sk-a,sk-b", Status: common.ChannelStatusEnabled, Group: "default", Models: "gpt-4o"}
+	if err = db.Create(&channel).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range model.SplitChannelKeys(&channel) {
+		if err = model.DisableChannelKey(channel.Id, model.GetChannelKeyHash(key), "invalid api key"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !model.UpdateChannelStatusById(channel.Id, common.ChannelStatusAutoDisabled, model.ChannelKeysDisabledReason+"invalid api key") {
+		t.Fatal("failed to disable channel")
+	}
+
+	hashes, err := model.GetChannelKeyHashes(&channel, []int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = EnableChannelKeys(channel.Id, hashes); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := model.GetChannelById(channel.Id, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Status != common.ChannelStatusEnabled {
+		t.Fatalf("expected channel to be re-enabled, got status %d", reloaded.Status)
+	}
+
+	// 其他原因导致的自动禁用不受影响
+	model.UpdateChannelStatusById(channel.Id, common.ChannelStatusAutoDisabled, "upstream error")
+	if err = EnableChannelKeys(channel.Id, nil); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, _ = model.GetChannelById(channel.Id, false); reloaded.Status != common.ChannelStatusAutoDisabled {
+		t.Fatalf("expected channel to stay disabled, got status %d", reloaded.Status)
+	}
+}
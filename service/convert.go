@@ -19,6 +19,7 @@ package service
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 	"veloera/common"
 	"veloera/dto"
@@ -31,6 +32,7 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 		MaxTokens:   claudeRequest.MaxTokens,
 		Temperature: claudeRequest.Temperature,
 		TopP:        claudeRequest.TopP,
+		TopK:        claudeRequest.TopK,
 		Stream:      claudeRequest.Stream,
 	}
 
@@ -62,7 +64,10 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 		}
 		openAITools = append(openAITools, openAITool)
 	}
-	openAIRequest.Tools = openAITools
+	if len(openAITools) > 0 {
+		openAIRequest.Tools = openAITools
+		openAIRequest.ToolChoice = toolChoiceClaude2OpenAI(claudeRequest.ToolChoice)
+	}
 
 	// Convert messages
 	openAIMessages := make([]dto.Message, 0)
@@ -107,6 +112,7 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 			}
 			contents := content
 			var toolCalls []dto.ToolCallRequest
+			var reasoningContent strings.Builder
 			mediaMessages := make([]dto.MediaContent, 0, len(contents))
 
 			for _, mediaMsg := range contents {
@@ -117,13 +123,15 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 						Text: mediaMsg.GetText(),
 					}
 					mediaMessages = append(mediaMessages, message)
+				case "thinking":
+					// thinking blocks of previous assistant turns are kept as reasoning content
+					reasoningContent.WriteString(mediaMsg.Thinking)
+				case "redacted_thinking":
+					// encrypted thinking cannot be replayed to a non-claude upstream
 				case "image":
-					// Handle image conversion (base64 to URL or keep as is)
-					imageData := fmt.Sprintf("data:%s;base64,%s", mediaMsg.Source.MediaType, mediaMsg.Source.Data)
-					//textContent += fmt.Sprintf("[Image: %s]", imageData)
 					mediaMessage := dto.MediaContent{
 						Type:     "image_url",
-						ImageUrl: &dto.MessageImageUrl{Url: imageData},
+						ImageUrl: &dto.MessageImageUrl{Url: claudeImageSource2Url(mediaMsg.Source)},
 					}
 					mediaMessages = append(mediaMessages, mediaMessage)
 				case "tool_use":
@@ -140,16 +148,15 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 					// Add tool result as a separate message
 					oaiToolMessage := dto.Message{
 						Role:       "tool",
-						Name:       &mediaMsg.Name,
 						ToolCallId: mediaMsg.ToolUseId,
 					}
-					//oaiToolMessage.SetStringContent(*mediaMsg.GetMediaContent().Text)
+					if mediaMsg.Name != "" {
+						oaiToolMessage.Name = &mediaMsg.Name
+					}
 					if mediaMsg.IsStringContent() {
 						oaiToolMessage.SetStringContent(mediaMsg.GetStringContent())
 					} else {
-						mediaContents := mediaMsg.ParseMediaContent()
-						encodeJson, _ := common.EncodeJson(mediaContents)
-						oaiToolMessage.SetStringContent(string(encodeJson))
+						oaiToolMessage.SetStringContent(claudeToolResultText(mediaMsg.ParseMediaContent()))
 					}
 					openAIMessages = append(openAIMessages, oaiToolMessage)
 				}
@@ -159,8 +166,21 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 				openAIMessage.SetToolCalls(toolCalls)
 			}
 
-			if len(mediaMessages) > 0 && len(toolCalls) == 0 {
-				openAIMessage.SetMediaContent(mediaMessages)
+			if reasoningContent.Len() > 0 && claudeMessage.Role == "assistant" {
+				openAIMessage.ReasoningContent = reasoningContent.String()
+			}
+
+			if len(mediaMessages) > 0 {
+				if len(toolCalls) > 0 || claudeMessage.Role == "assistant" {
+					// assistant messages only accept text content
+					var text strings.Builder
+					for _, mediaMessage := range mediaMessages {
+						text.WriteString(mediaMessage.Text)
+					}
+					openAIMessage.SetStringContent(text.String())
+				} else {
+					openAIMessage.SetMediaContent(mediaMessages)
+				}
 			}
 		}
 		if len(openAIMessage.ParseContent()) > 0 || len(openAIMessage.ToolCalls) > 0 {
@@ -173,6 +193,55 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 	return &openAIRequest, nil
 }
 
+// toolChoiceClaude2OpenAI maps claude tool_choice ({"type": "auto"|"any"|"tool"|"none"}) to openai tool_choice
+func toolChoiceClaude2OpenAI(toolChoice any) any {
+	choice, ok := toolChoice.(map[string]any)
+	if !ok {
+		return nil
+	}
+	switch choice["type"] {
+	case "auto":
+		return "auto"
+	case "any":
+		return "required"
+	case "none":
+		return "none"
+	case "tool":
+		name, _ := choice["name"].(string)
+		return map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name": name,
+			},
+		}
+	}
+	return nil
+}
+
+func claudeImageSource2Url(source *dto.ClaudeMessageSource) string {
+	if source == nil {
+		return ""
+	}
+	if source.Type == "url" {
+		return source.Url
+	}
+	return fmt.Sprintf("data:%s;base64,%s", source.MediaType, source.Data)
+}
+
+func claudeToolResultText(contents []dto.ClaudeMediaMessage) string {
+	var text strings.Builder
+	for _, content := range contents {
+		if content.Type == "text" {
+			text.WriteString(content.GetText())
+		}
+	}
+	if text.Len() == 0 && len(contents) > 0 {
+		encodeJson, _ := common.EncodeJson(contents)
+		return string(encodeJson)
+	}
+	return text.String()
+}
+
 func OpenAIErrorToClaudeError(openAIError *dto.OpenAIErrorWithStatusCode) *dto.ClaudeErrorWithStatusCode {
 	claudeError := dto.ClaudeError{
 		Type:    "veloera_error",
@@ -184,6 +253,31 @@ func OpenAIErrorToClaudeError(openAIError *dto.OpenAIErrorWithStatusCode) *dto.C
 	}
 }
 
+func OpenAIErrorToGeminiError(openAIError *dto.OpenAIErrorWithStatusCode) *dto.GeminiError {
+	status := "INTERNAL"
+	switch openAIError.StatusCode {
+	case http.StatusBadRequest:
+		status = "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		status = "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		status = "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		status = "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		status = "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		status = "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		status = "DEADLINE_EXCEEDED"
+	}
+	return &dto.GeminiError{
+		Code:    openAIError.StatusCode,
+		Message: openAIError.Error.Message,
+		Status:  status,
+	}
+}
+
 func ClaudeErrorToOpenAIError(claudeError *dto.ClaudeErrorWithStatusCode) *dto.OpenAIErrorWithStatusCode {
 	openAIError := dto.OpenAIError{
 		Message: claudeError.Error.Message,
@@ -202,6 +296,34 @@ func generateStopBlock(index int) *dto.ClaudeResponse {
 	}
 }
 
+// startClaudeBlock closes the current content block (if any) and opens a new one of the given type
+func startClaudeBlock(info *relaycommon.RelayInfo, messageType string, block *dto.ClaudeMediaMessage) []*dto.ClaudeResponse {
+	var claudeResponses []*dto.ClaudeResponse
+	if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeNone {
+		claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
+		info.ClaudeConvertInfo.Index++
+	}
+	info.ClaudeConvertInfo.LastMessagesType = messageType
+	claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+		Index:        common.GetPointer[int](info.ClaudeConvertInfo.Index),
+		Type:         "content_block_start",
+		ContentBlock: block,
+	})
+	return claudeResponses
+}
+
+func claudeUsageFromOpenAI(usage *dto.Usage) *dto.ClaudeUsage {
+	if usage == nil {
+		return nil
+	}
+	return &dto.ClaudeUsage{
+		InputTokens:              usage.PromptTokens - usage.PromptTokensDetails.CachedTokens,
+		CacheCreationInputTokens: usage.PromptTokensDetails.CachedCreationTokens,
+		CacheReadInputTokens:     usage.PromptTokensDetails.CachedTokens,
+		OutputTokens:             usage.CompletionTokens,
+	}
+}
+
 func StreamResponseOpenAI2Claude(openAIResponse *dto.ChatCompletionsStreamResponse, info *relaycommon.RelayInfo) []*dto.ClaudeResponse {
 	var claudeResponses []*dto.ClaudeResponse
 	if info.SendResponseCount == 1 {
@@ -215,148 +337,113 @@ func StreamResponseOpenAI2Claude(openAIResponse *dto.ChatCompletionsStreamRespon
 				OutputTokens: 0,
 			},
 		}
+		if msg.Model == "" {
+			msg.Model = info.UpstreamModelName
+		}
 		msg.SetContent(make([]any, 0))
 		claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
 			Type:    "message_start",
 			Message: msg,
 		})
-		claudeResponses = append(claudeResponses)
-		//claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-		//	Type: "ping",
-		//})
-		if openAIResponse.IsToolCall() {
-			resp := &dto.ClaudeResponse{
-				Type: "content_block_start",
-				ContentBlock: &dto.ClaudeMediaMessage{
-					Id:   openAIResponse.GetFirstToolCall().ID,
-					Type: "tool_use",
-					Name: openAIResponse.GetFirstToolCall().Function.Name,
-				},
-			}
-			resp.SetIndex(0)
-			claudeResponses = append(claudeResponses, resp)
-		} else {
-			//resp := &dto.ClaudeResponse{
-			//	Type: "content_block_start",
-			//	ContentBlock: &dto.ClaudeMediaMessage{
-			//		Type: "text",
-			//		Text: common.GetPointer[string](""),
-			//	},
-			//}
-			//resp.SetIndex(0)
-			//claudeResponses = append(claudeResponses, resp)
+	}
+
+	if info.Done {
+		if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeNone {
+			claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
+		}
+		stopReason := stopReasonOpenAI2Claude(info.FinishReason)
+		if stopReason == "" {
+			stopReason = "end_turn"
+		}
+		usage := claudeUsageFromOpenAI(info.ClaudeConvertInfo.Usage)
+		if usage == nil {
+			usage = &dto.ClaudeUsage{InputTokens: info.PromptTokens}
 		}
+		claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+			Type:  "message_delta",
+			Usage: usage,
+			Delta: &dto.ClaudeMediaMessage{
+				StopReason: common.GetPointer[string](stopReason),
+			},
+		})
+		claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+			Type: "message_stop",
+		})
 		return claudeResponses
 	}
 
 	if len(openAIResponse.Choices) == 0 {
-		// no choices
-		// TODO: handle this case
+		// usage only chunk
 		return claudeResponses
-	} else {
-		chosenChoice := openAIResponse.Choices[0]
-		if chosenChoice.FinishReason != nil && *chosenChoice.FinishReason != "" {
-			// should be done
-			info.FinishReason = *chosenChoice.FinishReason
-			return claudeResponses
+	}
+
+	chosenChoice := openAIResponse.Choices[0]
+	reasoning := chosenChoice.Delta.GetReasoningContent()
+	if reasoning != "" {
+		if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeThinking {
+			claudeResponses = append(claudeResponses, startClaudeBlock(info, relaycommon.LastMessageTypeThinking, &dto.ClaudeMediaMessage{
+				Type:     "thinking",
+				Thinking: "",
+			})...)
 		}
-		if info.Done {
-			claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-			if info.ClaudeConvertInfo.Usage != nil {
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Type: "message_delta",
-					Usage: &dto.ClaudeUsage{
-						InputTokens:  info.ClaudeConvertInfo.Usage.PromptTokens,
-						OutputTokens: info.ClaudeConvertInfo.Usage.CompletionTokens,
-					},
-					Delta: &dto.ClaudeMediaMessage{
-						StopReason: common.GetPointer[string](stopReasonOpenAI2Claude(info.FinishReason)),
-					},
-				})
+		claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+			Index: common.GetPointer[int](info.ClaudeConvertInfo.Index),
+			Type:  "content_block_delta",
+			Delta: &dto.ClaudeMediaMessage{
+				Type:     "thinking_delta",
+				Thinking: reasoning,
+			},
+		})
+	}
+
+	textContent := chosenChoice.Delta.GetContentString()
+	if textContent != "" {
+		if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeText {
+			claudeResponses = append(claudeResponses, startClaudeBlock(info, relaycommon.LastMessageTypeText, &dto.ClaudeMediaMessage{
+				Type: "text",
+				Text: common.GetPointer[string](""),
+			})...)
+		}
+		claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+			Index: common.GetPointer[int](info.ClaudeConvertInfo.Index),
+			Type:  "content_block_delta",
+			Delta: &dto.ClaudeMediaMessage{
+				Type: "text_delta",
+				Text: common.GetPointer[string](textContent),
+			},
+		})
+	}
+
+	for _, toolCall := range chosenChoice.Delta.ToolCalls {
+		// a tool call with an id (or the first tool delta) starts a new tool_use block
+		if toolCall.ID != "" || info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeTools {
+			toolId := toolCall.ID
+			if toolId == "" {
+				toolId = fmt.Sprintf("toolu_%s", common.GetUUID())
 			}
+			claudeResponses = append(claudeResponses, startClaudeBlock(info, relaycommon.LastMessageTypeTools, &dto.ClaudeMediaMessage{
+				Id:    toolId,
+				Type:  "tool_use",
+				Name:  toolCall.Function.Name,
+				Input: map[string]interface{}{},
+			})...)
+		}
+		if toolCall.Function.Arguments != "" {
 			claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-				Type: "message_stop",
-			})
-		} else {
-			var claudeResponse dto.ClaudeResponse
-			var isEmpty bool
-			claudeResponse.Type = "content_block_delta"
-			if len(chosenChoice.Delta.ToolCalls) > 0 {
-				if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeTools {
-					claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-					info.ClaudeConvertInfo.Index++
-					claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-						Index: &info.ClaudeConvertInfo.Index,
-						Type:  "content_block_start",
-						ContentBlock: &dto.ClaudeMediaMessage{
-							Id:    openAIResponse.GetFirstToolCall().ID,
-							Type:  "tool_use",
-							Name:  openAIResponse.GetFirstToolCall().Function.Name,
-							Input: map[string]interface{}{},
-						},
-					})
-				}
-				info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeTools
-				// tools delta
-				claudeResponse.Delta = &dto.ClaudeMediaMessage{
+				Index: common.GetPointer[int](info.ClaudeConvertInfo.Index),
+				Type:  "content_block_delta",
+				Delta: &dto.ClaudeMediaMessage{
 					Type:        "input_json_delta",
-					PartialJson: &chosenChoice.Delta.ToolCalls[0].Function.Arguments,
-				}
-			} else {
-				reasoning := chosenChoice.Delta.GetReasoningContent()
-				textContent := chosenChoice.Delta.GetContentString()
-				if reasoning != "" || textContent != "" {
-					if reasoning != "" {
-						if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeThinking {
-							//info.ClaudeConvertInfo.Index++
-							claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-								Index: &info.ClaudeConvertInfo.Index,
-								Type:  "content_block_start",
-								ContentBlock: &dto.ClaudeMediaMessage{
-									Type:     "thinking",
-									Thinking: "",
-								},
-							})
-						}
-						info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeThinking
-						// text delta
-						claudeResponse.Delta = &dto.ClaudeMediaMessage{
-							Type:     "thinking_delta",
-							Thinking: reasoning,
-						}
-					} else {
-						if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeText {
-							if info.LastMessagesType == relaycommon.LastMessageTypeThinking || info.LastMessagesType == relaycommon.LastMessageTypeTools {
-								claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-								info.ClaudeConvertInfo.Index++
-							}
-							claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-								Index: &info.ClaudeConvertInfo.Index,
-								Type:  "content_block_start",
-								ContentBlock: &dto.ClaudeMediaMessage{
-									Type: "text",
-									Text: common.GetPointer[string](""),
-								},
-							})
-						}
-						info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeText
-						// text delta
-						claudeResponse.Delta = &dto.ClaudeMediaMessage{
-							Type: "text_delta",
-							Text: common.GetPointer[string](textContent),
-						}
-					}
-				} else {
-					isEmpty = true
-				}
-			}
-			claudeResponse.Index = &info.ClaudeConvertInfo.Index
-			if !isEmpty {
-				claudeResponses = append(claudeResponses, &claudeResponse)
-			}
+					PartialJson: common.GetPointer[string](toolCall.Function.Arguments),
+				},
+			})
 		}
 	}
 
+	if chosenChoice.FinishReason != nil && *chosenChoice.FinishReason != "" {
+		info.FinishReason = *chosenChoice.FinishReason
+	}
+
 	return claudeResponses
 }
 
@@ -369,31 +456,47 @@ func ResponseOpenAI2Claude(openAIResponse *dto.OpenAITextResponse, info *relayco
 		Role:  "assistant",
 		Model: openAIResponse.Model,
 	}
+	if claudeResponse.Model == "" {
+		claudeResponse.Model = info.UpstreamModelName
+	}
 	for _, choice := range openAIResponse.Choices {
 		stopReason = stopReasonOpenAI2Claude(choice.FinishReason)
-		claudeContent := dto.ClaudeMediaMessage{}
-		if choice.FinishReason == "tool_calls" {
-			claudeContent.Type = "tool_use"
-			claudeContent.Id = choice.Message.ToolCallId
-			claudeContent.Name = choice.Message.ParseToolCalls()[0].Function.Name
+		reasoning := choice.Message.ReasoningContent
+		if reasoning == "" {
+			reasoning = choice.Message.Reasoning
+		}
+		if reasoning != "" {
+			contents = append(contents, dto.ClaudeMediaMessage{
+				Type:     "thinking",
+				Thinking: reasoning,
+			})
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			claudeContent := dto.ClaudeMediaMessage{Type: "text"}
+			claudeContent.SetText(text)
+			contents = append(contents, claudeContent)
+		}
+		for _, toolCall := range choice.Message.ParseToolCalls() {
+			claudeContent := dto.ClaudeMediaMessage{
+				Type: "tool_use",
+				Id:   toolCall.ID,
+				Name: toolCall.Function.Name,
+			}
 			var mapParams map[string]interface{}
-			if err := json.Unmarshal([]byte(choice.Message.ParseToolCalls()[0].Function.Arguments), &mapParams); err == nil {
+			if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &mapParams); err == nil {
 				claudeContent.Input = mapParams
 			} else {
-				claudeContent.Input = choice.Message.ParseToolCalls()[0].Function.Arguments
+				claudeContent.Input = map[string]interface{}{}
 			}
-		} else {
-			claudeContent.Type = "text"
-			claudeContent.SetText(choice.Message.StringContent())
+			contents = append(contents, claudeContent)
 		}
-		contents = append(contents, claudeContent)
+	}
+	if stopReason == "" {
+		stopReason = "end_turn"
 	}
 	claudeResponse.Content = contents
 	claudeResponse.StopReason = stopReason
-	claudeResponse.Usage = &dto.ClaudeUsage{
-		InputTokens:  openAIResponse.PromptTokens,
-		OutputTokens: openAIResponse.CompletionTokens,
-	}
+	claudeResponse.Usage = claudeUsageFromOpenAI(&openAIResponse.Usage)
 
 	return claudeResponse
 }
@@ -404,9 +507,9 @@ func stopReasonOpenAI2Claude(reason string) string {
 		return "end_turn"
 	case "stop_sequence":
 		return "stop_sequence"
-	case "max_tokens":
+	case "length", "max_tokens":
 		return "max_tokens"
-	case "tool_calls":
+	case "tool_calls", "function_call":
 		return "tool_use"
 	default:
 		return reason
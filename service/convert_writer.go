@@ -0,0 +1,202 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"veloera/common"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAI2ClaudeWriter replaces the gin response writer while an adaptor that only speaks the
+// openai chat completions format handles a /v1/messages request. Everything the adaptor writes
+// (a json body or an SSE stream) is translated into the claude messages format on the fly.
+type OpenAI2ClaudeWriter struct {
+	gin.ResponseWriter
+	c      *gin.Context
+	info   *relaycommon.RelayInfo
+	buffer bytes.Buffer
+	status int
+}
+
+func NewOpenAI2ClaudeWriter(c *gin.Context, info *relaycommon.RelayInfo) *OpenAI2ClaudeWriter {
+	if info.ClaudeConvertInfo == nil {
+		info.ClaudeConvertInfo = &relaycommon.ClaudeConvertInfo{
+			LastMessagesType: relaycommon.LastMessageTypeNone,
+		}
+	}
+	w := &OpenAI2ClaudeWriter{
+		ResponseWriter: c.Writer,
+		c:              c,
+		info:           info,
+		status:         http.StatusOK,
+	}
+	c.Writer = w
+	return w
+}
+
+func (w *OpenAI2ClaudeWriter) isStream() bool {
+	return strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+}
+
+func (w *OpenAI2ClaudeWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+	if w.isStream() {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *OpenAI2ClaudeWriter) WriteHeaderNow() {
+	if w.isStream() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *OpenAI2ClaudeWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if w.isStream() {
+		w.convertStreamLines(false)
+	}
+	return len(data), nil
+}
+
+func (w *OpenAI2ClaudeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *OpenAI2ClaudeWriter) Flush() {
+	if w.isStream() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// convertStreamLines converts every complete SSE line in the buffer, the trailing partial line is kept
+// until more data arrives (or flushed when all is true)
+func (w *OpenAI2ClaudeWriter) convertStreamLines(all bool) {
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// incomplete line, put it back
+			if !all {
+				rest := line + w.buffer.String()
+				w.buffer.Reset()
+				w.buffer.WriteString(rest)
+				return
+			}
+			if line != "" {
+				w.convertStreamLine(line)
+			}
+			return
+		}
+		w.convertStreamLine(line)
+	}
+}
+
+func (w *OpenAI2ClaudeWriter) convertStreamLine(line string) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, ":") {
+		// keep alive comments are sent as claude ping events
+		w.writeClaudeEvent(&dto.ClaudeResponse{Type: "ping"})
+		return
+	}
+	if !strings.HasPrefix(line, "data:") {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "" || strings.HasPrefix(data, "[DONE]") {
+		return
+	}
+	var streamResponse dto.ChatCompletionsStreamResponse
+	if err := common.DecodeJsonStr(data, &streamResponse); err != nil {
+		common.LogError(w.c, "error unmarshalling stream response: "+err.Error())
+		return
+	}
+	if ValidUsage(streamResponse.Usage) {
+		w.info.ClaudeConvertInfo.Usage = streamResponse.Usage
+	}
+	w.info.SendResponseCount++
+	for _, claudeResponse := range StreamResponseOpenAI2Claude(&streamResponse, w.info) {
+		w.writeClaudeEvent(claudeResponse)
+	}
+}
+
+func (w *OpenAI2ClaudeWriter) writeClaudeEvent(resp *dto.ClaudeResponse) {
+	jsonData, err := json.Marshal(resp)
+	if err != nil {
+		common.SysError("error marshalling claude response: " + err.Error())
+		return
+	}
+	_, _ = w.ResponseWriter.WriteString(fmt.Sprintf("event: %s\ndata: %s\n\n", resp.Type, jsonData))
+	w.ResponseWriter.Flush()
+}
+
+// Finish restores the original writer and emits whatever is still pending: the closing events of a
+// stream, or the converted body of a non-stream response. When the handler failed before writing
+// anything the original writer is restored untouched so the caller can render the error.
+func (w *OpenAI2ClaudeWriter) Finish(usage *dto.Usage, openaiErr *dto.OpenAIErrorWithStatusCode) {
+	w.c.Writer = w.ResponseWriter
+	if w.isStream() {
+		w.convertStreamLines(true)
+		if openaiErr != nil && w.info.SendResponseCount == 0 {
+			return
+		}
+		if w.info.SendResponseCount == 0 {
+			w.info.SendResponseCount = 1
+		}
+		if usage != nil {
+			w.info.ClaudeConvertInfo.Usage = usage
+		}
+		w.info.ClaudeConvertInfo.Done = true
+		for _, claudeResponse := range StreamResponseOpenAI2Claude(&dto.ChatCompletionsStreamResponse{}, w.info) {
+			w.writeClaudeEvent(claudeResponse)
+		}
+		return
+	}
+	if openaiErr != nil || w.buffer.Len() == 0 {
+		return
+	}
+
+	body := w.buffer.Bytes()
+	var openAIResponse dto.OpenAITextResponse
+	if err := common.DecodeJson(body, &openAIResponse); err != nil || w.status != http.StatusOK {
+		// not a chat completion, pass it through as is
+		w.ResponseWriter.WriteHeader(w.status)
+		_, _ = w.ResponseWriter.Write(body)
+		return
+	}
+	if usage != nil && openAIResponse.Usage.TotalTokens == 0 {
+		openAIResponse.Usage = *usage
+	}
+	claudeBody, err := json.Marshal(ResponseOpenAI2Claude(&openAIResponse, w.info))
+	if err != nil {
+		common.SysError("error marshalling claude response: " + err.Error())
+		return
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(claudeBody)
+}
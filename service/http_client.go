@@ -18,87 +18,271 @@ package service
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"golang.org/x/net/proxy"
 	"net"
 	"net/http"
 	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 	"veloera/common"
+	"veloera/constant"
+	"veloera/setting/operation_setting"
 )
 
-var httpClient *http.Client
 var impatientHTTPClient *http.Client
 
 func init() {
-	if common.RelayTimeout == 0 {
-		httpClient = &http.Client{}
-	} else {
-		httpClient = &http.Client{
-			Timeout: time.Duration(common.RelayTimeout) * time.Second,
-		}
-	}
-
 	impatientHTTPClient = &http.Client{
 		Timeout: 5 * time.Second,
 	}
 }
 
-func GetHttpClient() *http.Client {
-	return httpClient
+// TransportOptions 决定上游连接池的复用范围，选项相同的请求共享同一个 Transport
+type TransportOptions struct {
+	ProxyURL              string
+	InsecureSkipVerify    bool
+	DisableHTTP2          bool
+	ResponseHeaderTimeout int
 }
 
-func GetImpatientHttpClient() *http.Client {
-	return impatientHTTPClient
+type pooledTransport struct {
+	options   TransportOptions
+	transport *http.Transport
+	createdAt int64
+	lastUsed  atomic.Int64
+	requests  atomic.Int64
+	dials     atomic.Int64
+	openConns atomic.Int64
 }
 
-// NewProxyHttpClient 创建支持代理的 HTTP 客户端
-func NewProxyHttpClient(proxyURL string) (*http.Client, error) {
-	if proxyURL == "" {
-		return http.DefaultClient, nil
-	}
+func (p *pooledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p.requests.Add(1)
+	p.lastUsed.Store(common.GetTimestamp())
+	return p.transport.RoundTrip(req)
+}
+
+// countedConn 在连接关闭时更新所属 Transport 的连接数
+type countedConn struct {
+	net.Conn
+	pool      *pooledTransport
+	closeOnce sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.pool.openConns.Add(-1)
+	})
+	return c.Conn.Close()
+}
+
+var (
+	transportLock    sync.Mutex
+	transportCache   = make(map[TransportOptions]*pooledTransport)
+	transportSetting operation_setting.HttpClientSetting
+)
 
-	parsedURL, err := url.Parse(proxyURL)
+func getPooledTransport(options TransportOptions) (*pooledTransport, error) {
+	setting := *operation_setting.GetHttpClientSetting()
+	transportLock.Lock()
+	defer transportLock.Unlock()
+	if setting != transportSetting {
+		// 连接池配置变更后重建所有 Transport，旧 Transport 上进行中的请求不受影响
+		for _, pool := range transportCache {
+			pool.transport.CloseIdleConnections()
+		}
+		transportCache = make(map[TransportOptions]*pooledTransport)
+		transportSetting = setting
+	}
+	if pool, ok := transportCache[options]; ok {
+		return pool, nil
+	}
+	pool, err := newPooledTransport(options, setting)
 	if err != nil {
 		return nil, err
 	}
+	transportCache[options] = pool
+	return pool, nil
+}
+
+func newPooledTransport(options TransportOptions, setting operation_setting.HttpClientSetting) (*pooledTransport, error) {
+	pool := &pooledTransport{
+		options:   options,
+		createdAt: common.GetTimestamp(),
+	}
+	responseHeaderTimeout := setting.ResponseHeaderTimeout
+	if options.ResponseHeaderTimeout > 0 {
+		responseHeaderTimeout = options.ResponseHeaderTimeout
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		MaxIdleConns:          setting.MaxIdleConns,
+		MaxIdleConnsPerHost:   setting.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       setting.MaxConnsPerHost,
+		IdleConnTimeout:       time.Duration(setting.IdleConnTimeout) * time.Second,
+		TLSHandshakeTimeout:   time.Duration(setting.TLSHandshakeTimeout) * time.Second,
+		ResponseHeaderTimeout: time.Duration(responseHeaderTimeout) * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		ForceAttemptHTTP2:     setting.HTTP2Enabled && !options.DisableHTTP2,
+	}
+	if !transport.ForceAttemptHTTP2 {
+		// 非 nil 的空 TLSNextProto 会禁用 HTTP/2
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	if options.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(setting.DialTimeout) * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	dial := dialer.DialContext
+	if options.ProxyURL != "" {
+		parsedURL, err := url.Parse(options.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		switch parsedURL.Scheme {
+		case "http", "https":
+			transport.Proxy = http.ProxyURL(parsedURL)
+		case "socks5":
+			// 获取认证信息
+			var auth *proxy.Auth
+			if parsedURL.User != nil {
+				auth = &proxy.Auth{
+					User:     parsedURL.User.Username(),
+					Password: "",
+				}
+				if password, ok := parsedURL.User.Password(); ok {
+					auth.Password = password
+				}
+			}
 
-	switch parsedURL.Scheme {
-	case "http", "https":
-		return &http.Client{
-			Transport: &http.Transport{
-				Proxy: http.ProxyURL(parsedURL),
-			},
-		}, nil
-
-	case "socks5":
-		// 获取认证信息
-		var auth *proxy.Auth
-		if parsedURL.User != nil {
-			auth = &proxy.Auth{
-				User:     parsedURL.User.Username(),
-				Password: "",
+			// 创建 SOCKS5 代理拨号器
+			socksDialer, err := proxy.SOCKS5("tcp", parsedURL.Host, auth, dialer)
+			if err != nil {
+				return nil, err
 			}
-			if password, ok := parsedURL.User.Password(); ok {
-				auth.Password = password
+			transport.Proxy = nil
+			if contextDialer, ok := socksDialer.(proxy.ContextDialer); ok {
+				dial = contextDialer.DialContext
+			} else {
+				dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+					return socksDialer.Dial(network, addr)
+				}
 			}
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme: %s", parsedURL.Scheme)
 		}
-
-		// 创建 SOCKS5 代理拨号器
-		dialer, err := proxy.SOCKS5("tcp", parsedURL.Host, auth, proxy.Direct)
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		pool.dials.Add(1)
+		conn, err := dial(ctx, network, addr)
 		if err != nil {
 			return nil, err
 		}
+		pool.openConns.Add(1)
+		return &countedConn{Conn: conn, pool: pool}, nil
+	}
+	pool.transport = transport
+	return pool, nil
+}
+
+// NewPooledHttpClient 返回使用共享连接池的 HTTP 客户端，timeout 为 0 表示不限制
+func NewPooledHttpClient(options TransportOptions, timeout int) (*http.Client, error) {
+	pool, err := getPooledTransport(options)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: pool,
+		Timeout:   time.Duration(timeout) * time.Second,
+	}, nil
+}
 
-		return &http.Client{
-			Transport: &http.Transport{
-				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-					return dialer.Dial(network, addr)
-				},
-			},
-		}, nil
+func GetHttpClient() *http.Client {
+	client, err := NewPooledHttpClient(TransportOptions{}, common.RelayTimeout)
+	if err != nil {
+		common.SysError("failed to get pooled http client: " + err.Error())
+		return http.DefaultClient
+	}
+	return client
+}
 
-	default:
-		return nil, fmt.Errorf("unsupported proxy scheme: %s", parsedURL.Scheme)
+func GetImpatientHttpClient() *http.Client {
+	return impatientHTTPClient
+}
+
+// NewProxyHttpClient 创建支持代理的 HTTP 客户端
+func NewProxyHttpClient(proxyURL string) (*http.Client, error) {
+	return NewPooledHttpClient(TransportOptions{ProxyURL: proxyURL}, common.RelayTimeout)
+}
+
+// GetChannelHttpClient 根据渠道设置中的代理、TLS、HTTP/2 与超时配置返回 HTTP 客户端
+func GetChannelHttpClient(channelSetting map[string]interface{}) (*http.Client, error) {
+	options := TransportOptions{
+		ResponseHeaderTimeout: channelSettingInt(channelSetting, constant.ChannelSettingHeaderTimeout),
+	}
+	options.ProxyURL, _ = channelSetting[constant.ChanelSettingProxy].(string)
+	options.InsecureSkipVerify, _ = channelSetting[constant.ChannelSettingInsecureTLS].(bool)
+	options.DisableHTTP2, _ = channelSetting[constant.ChannelSettingDisableHTTP2].(bool)
+	timeout := common.RelayTimeout
+	if channelTimeout := channelSettingInt(channelSetting, constant.ChannelSettingTimeout); channelTimeout > 0 {
+		timeout = channelTimeout
+	}
+	return NewPooledHttpClient(options, timeout)
+}
+
+func channelSettingInt(channelSetting map[string]interface{}, key string) int {
+	switch v := channelSetting[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+type HttpTransportStat struct {
+	Proxy                 string `json:"proxy"`
+	InsecureSkipVerify    bool   `json:"insecure_skip_verify"`
+	DisableHTTP2          bool   `json:"disable_http2"`
+	ResponseHeaderTimeout int    `json:"response_header_timeout"`
+	OpenConns             int64  `json:"open_conns"`
+	TotalDials            int64  `json:"total_dials"`
+	Requests              int64  `json:"requests"`
+	CreatedAt             int64  `json:"created_at"`
+	LastUsedAt            int64  `json:"last_used_at"`
+}
+
+// GetHttpTransportStats 返回当前缓存的上游连接池统计，代理地址中的密码会被隐藏
+func GetHttpTransportStats() []HttpTransportStat {
+	transportLock.Lock()
+	defer transportLock.Unlock()
+	stats := make([]HttpTransportStat, 0, len(transportCache))
+	for options, pool := range transportCache {
+		proxyURL := options.ProxyURL
+		if parsedURL, err := url.Parse(proxyURL); err == nil {
+			proxyURL = parsedURL.Redacted()
+		}
+		stats = append(stats, HttpTransportStat{
+			Proxy:                 proxyURL,
+			InsecureSkipVerify:    options.InsecureSkipVerify,
+			DisableHTTP2:          options.DisableHTTP2,
+			ResponseHeaderTimeout: options.ResponseHeaderTimeout,
+			OpenConns:             pool.openConns.Load(),
+			TotalDials:            pool.dials.Load(),
+			Requests:              pool.requests.Load(),
+			CreatedAt:             pool.createdAt,
+			LastUsedAt:            pool.lastUsed.Load(),
+		})
 	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Requests > stats[j].Requests
+	})
+	return stats
 }
@@ -23,10 +23,12 @@ import (
 	"fmt"
 	"image"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"strings"
 	"veloera/common"
 	"veloera/constant"
+	"veloera/dto"
 
 	"golang.org/x/image/webp"
 )
@@ -186,3 +188,62 @@ func getImageConfig(reader io.Reader) (image.Config, string, error) {
 	}
 	return config, format, nil
 }
+
+// NormalizeImageResponse 按客户端请求的 response_format 统一图片的返回方式：
+// url 请求收到 base64 时返回 data URL，b64_json 请求收到链接时下载后转为 base64
+func NormalizeImageResponse(response *dto.ImageResponse, responseFormat string) error {
+	for i := range response.Data {
+		data := &response.Data[i]
+		switch responseFormat {
+		case "url":
+			if data.Url == "" && data.B64Json != "" {
+				mimeType := "image/png"
+				if response.OutputFormat != "" {
+					mimeType = "image/" + response.OutputFormat
+				}
+				data.Url = fmt.Sprintf("data:%s;base64,%s", mimeType, data.B64Json)
+				data.B64Json = ""
+			}
+		case "b64_json":
+			if data.B64Json == "" && data.Url != "" {
+				if strings.HasPrefix(data.Url, "data:") {
+					_, base64Data, err := DecodeBase64FileData(data.Url)
+					if err != nil {
+						return err
+					}
+					data.B64Json = base64Data
+				} else {
+					_, base64Data, err := GetImageFromUrl(data.Url)
+					if err != nil {
+						return err
+					}
+					data.B64Json = base64Data
+				}
+				data.Url = ""
+			}
+		}
+	}
+	return nil
+}
+
+// ReadImageFile 读取 multipart 上传的图片，未声明类型时根据内容识别
+func ReadImageFile(fileHeader *multipart.FileHeader) (*dto.ImageFile, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open image %s failed: %w", fileHeader.Filename, err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("read image %s failed: %w", fileHeader.Filename, err)
+	}
+	mimeType := fileHeader.Header.Get("Content-Type")
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = http.DetectContentType(data)
+	}
+	return &dto.ImageFile{
+		Filename: fileHeader.Filename,
+		MimeType: mimeType,
+		Data:     data,
+	}, nil
+}
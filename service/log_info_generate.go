@@ -18,8 +18,10 @@ package service
 
 import (
 	"veloera/common"
+	"veloera/constant"
 	"veloera/dto"
 	relaycommon "veloera/relay/common"
+	"veloera/setting/operation_setting"
 
 	"github.com/gin-gonic/gin"
 )
@@ -37,11 +39,34 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	if relayInfo.ReasoningEffort != "" {
 		other["reasoning_effort"] = relayInfo.ReasoningEffort
 	}
+	if ctx.GetBool(constant.ContextKeyBatchRequest) {
+		other["batch_discount_ratio"] = operation_setting.GetBatchSetting().DiscountRatio
+	}
+	if ctx.GetBool(constant.ContextKeyResponseCacheHit) {
+		other["cache_hit"] = true
+		other["response_cache_ratio"] = operation_setting.GetResponseCacheSetting().BillingRatio
+	}
+	if fallbackFrom := ctx.GetString(constant.ContextKeyFallbackFrom); fallbackFrom != "" {
+		other["model_fallback_from"] = fallbackFrom
+	}
+	if relayInfo.UsageSource != "" {
+		other["usage_source"] = relayInfo.UsageSource
+	}
+	if relayInfo.ClientCancelled {
+		other["client_cancelled"] = true
+	}
 	if relayInfo.IsModelMapped {
 		other["is_model_mapped"] = true
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
 
+	if relayInfo.Other != nil {
+		if words, exists := relayInfo.Other["completion_sensitive_words"]; exists {
+			other["completion_sensitive_words"] = words
+			other["completion_sensitive_action"] = relayInfo.Other["completion_sensitive_action"]
+		}
+	}
+
 	// 添加输入输出内容
 	if relayInfo.Other != nil && common.LogChatContentEnabled {
 		if inputContent, exists := relayInfo.Other["input_content"]; exists {
@@ -0,0 +1,128 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"veloera/common"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	relayconstant "veloera/relay/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+var relayModeMetricNames = map[int]string{
+	relayconstant.RelayModeChatCompletions:    "chat_completions",
+	relayconstant.RelayModeCompletions:        "completions",
+	relayconstant.RelayModeEmbeddings:         "embeddings",
+	relayconstant.RelayModeModerations:        "moderations",
+	relayconstant.RelayModeImagesGenerations:  "images_generations",
+	relayconstant.RelayModeImagesEdits:        "images_edits",
+	relayconstant.RelayModeImagesVariations:   "images_variations",
+	relayconstant.RelayModeEdits:              "edits",
+	relayconstant.RelayModeAudioSpeech:        "audio_speech",
+	relayconstant.RelayModeAudioTranscription: "audio_transcription",
+	relayconstant.RelayModeAudioTranslation:   "audio_translation",
+	relayconstant.RelayModeRerank:             "rerank",
+	relayconstant.RelayModeResponses:          "responses",
+	relayconstant.RelayModeRealtime:           "realtime",
+}
+
+// relayErrorMetricCodes 错误码指标标签的取值范围，上游返回的错误码不受控制，其余统一记为 other，避免标签基数无限增长
+var relayErrorMetricCodes = map[string]bool{
+	"rate_limit_exceeded":            true,
+	"insufficient_quota":             true,
+	"invalid_api_key":                true,
+	"context_length_exceeded":        true,
+	"model_not_found":                true,
+	"content_filter":                 true,
+	"content_policy_violation":       true,
+	"server_error":                   true,
+	"upstream_error":                 true,
+	"bad_response_status_code":       true,
+	"do_request_failed":              true,
+	"read_response_body_failed":      true,
+	"unmarshal_response_body_failed": true,
+}
+
+// metricErrorCode 把错误码映射为固定取值的指标标签
+func metricErrorCode(code any) string {
+	if code == nil {
+		return ""
+	}
+	value := fmt.Sprintf("%v", code)
+	if value == "" || relayErrorMetricCodes[value] {
+		return value
+	}
+	return "other"
+}
+
+// metricRelayMode 返回指标中使用的 relay_mode 标签，claude / gemini 原生接口按路径区分
+func metricRelayMode(c *gin.Context, relayMode int) string {
+	if name, ok := relayModeMetricNames[relayMode]; ok {
+		return name
+	}
+	path := c.Request.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/v1/messages"):
+		return "claude_messages"
+	case strings.HasPrefix(path, "/v1beta/"):
+		return "gemini"
+	}
+	return "unknown"
+}
+
+// RecordRelayMetrics 在结算配额时记录请求次数、耗时、首字延迟、token 与配额消耗
+func RecordRelayMetrics(c *gin.Context, relayInfo *relaycommon.RelayInfo, promptTokens int, completionTokens int, quota int) {
+	labels := common.RelayMetricLabels{
+		ChannelId:   relayInfo.ChannelId,
+		ChannelType: relayInfo.ChannelType,
+		Model:       relayInfo.OriginModelName,
+		Group:       relayInfo.Group,
+		RelayMode:   metricRelayMode(c, relayInfo.RelayMode),
+	}
+	var firstResponse time.Duration
+	if relayInfo.FirstResponseTime.After(relayInfo.StartTime) {
+		firstResponse = relayInfo.FirstResponseTime.Sub(relayInfo.StartTime)
+	}
+	common.RecordRelaySuccess(labels, time.Since(relayInfo.StartTime), firstResponse, promptTokens, completionTokens, quota)
+}
+
+func channelMetricLabels(c *gin.Context, channelId int, channelType int) common.RelayMetricLabels {
+	return common.RelayMetricLabels{
+		ChannelId:   channelId,
+		ChannelType: channelType,
+		Model:       c.GetString("original_model"),
+		Group:       c.GetString("group"),
+		RelayMode:   metricRelayMode(c, relayconstant.Path2RelayMode(c.Request.URL.Path)),
+	}
+}
+
+// RecordRelayErrorMetrics 记录上游错误，本地错误不计入
+func RecordRelayErrorMetrics(c *gin.Context, channelId int, channelType int, err *dto.OpenAIErrorWithStatusCode) {
+	if err == nil || err.LocalError {
+		return
+	}
+	common.RecordRelayError(channelMetricLabels(c, channelId, channelType), err.StatusCode, metricErrorCode(err.Error.Code))
+}
+
+func RecordRelayRetryMetrics(c *gin.Context, channelId int, channelType int) {
+	common.RecordRelayRetry(channelMetricLabels(c, channelId, channelType))
+}
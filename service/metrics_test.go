@@ -0,0 +1,38 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import "testing"
+
+// 未知的上游错误码统一记为 other，避免指标标签无限增长
+func TestMetricErrorCode(t *testing.T) {
+	for _, tc := range []struct {
+		code any
+		want string
+	}{
+		{nil, ""},
+		{"", ""},
+		{"rate_limit_exceeded", "rate_limit_exceeded"},
+		{"do_request_failed", "do_request_failed"},
+		{"req_8f3a9c1d_quota", "other"},
+		{429, "other"},
+	} {
+		if got := metricErrorCode(tc.code); got != tc.want {
+			t.Errorf("metricErrorCode(%v) = %q, want %q", tc.code, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"veloera/common"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ResponseCacheHeader = "X-Veloera-Cache"
+
+// ResponseCacheEntry 缓存的上游响应，Body 为写给客户端的原始内容
+type ResponseCacheEntry struct {
+	Body        []byte    `json:"body"`
+	ContentType string    `json:"content_type"`
+	IsStream    bool      `json:"is_stream"`
+	Usage       dto.Usage `json:"usage"`
+	CreatedAt   int64     `json:"created_at"`
+}
+
+// ShouldUseResponseCache 判断当前请求是否启用响应缓存，客户端可通过 Cache-Control: no-cache 跳过
+func ShouldUseResponseCache(c *gin.Context, info *relaycommon.RelayInfo) bool {
+	if !operation_setting.ShouldUseResponseCache(c.GetBool("token_response_cache"), info.Group) {
+		return false
+	}
+	cacheControl := strings.ToLower(c.GetHeader("Cache-Control"))
+	return !strings.Contains(cacheControl, "no-cache") && !strings.Contains(cacheControl, "no-store")
+}
+
+// ResponseCacheKey 根据归一化的请求体与上游模型生成缓存键，stream 相关字段不参与计算，
+// 缓存按用户隔离
+func ResponseCacheKey(info *relaycommon.RelayInfo, request any) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var object map[string]any
+	if err = decoder.Decode(&object); err != nil {
+		return "", err
+	}
+	delete(object, "stream")
+	delete(object, "stream_options")
+	// map 序列化时按键排序，得到稳定的请求体
+	normalized, err := json.Marshal(object)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(fmt.Sprintf("%d|%d|%s|", info.UserId, info.RelayMode, info.UpstreamModelName)))
+	h.Write(normalized)
+	return "response_cache:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func GetResponseCache(key string) *ResponseCacheEntry {
+	if common.RedisEnabled {
+		value, err := common.RedisGet(key)
+		if err != nil {
+			return nil
+		}
+		var entry ResponseCacheEntry
+		if err = json.Unmarshal([]byte(value), &entry); err != nil {
+			return nil
+		}
+		return &entry
+	}
+	return responseMemoryCache.get(key)
+}
+
+func SetResponseCache(key string, entry *ResponseCacheEntry) {
+	setting := operation_setting.GetResponseCacheSetting()
+	ttl := time.Duration(setting.TTLSeconds) * time.Second
+	if ttl <= 0 {
+		return
+	}
+	if common.RedisEnabled {
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		if err = common.RedisSet(key, string(value), ttl); err != nil {
+			common.SysError("failed to set response cache: " + err.Error())
+		}
+		return
+	}
+	responseMemoryCache.set(key, entry, ttl, setting.MaxEntries)
+}
+
+type responseCacheItem struct {
+	key      string
+	entry    *ResponseCacheEntry
+	expireAt time.Time
+}
+
+// responseLRU 未启用 Redis 时使用的内存 LRU 缓存
+type responseLRU struct {
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+var responseMemoryCache = &responseLRU{
+	ll:    list.New(),
+	items: make(map[string]*list.Element),
+}
+
+func (l *responseLRU) get(key string) *ResponseCacheEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elem, ok := l.items[key]
+	if !ok {
+		return nil
+	}
+	item := elem.Value.(*responseCacheItem)
+	if time.Now().After(item.expireAt) {
+		l.ll.Remove(elem)
+		delete(l.items, key)
+		return nil
+	}
+	l.ll.MoveToFront(elem)
+	return item.entry
+}
+
+func (l *responseLRU) set(key string, entry *ResponseCacheEntry, ttl time.Duration, maxEntries int) {
+	if maxEntries <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elem, ok := l.items[key]; ok {
+		item := elem.Value.(*responseCacheItem)
+		item.entry = entry
+		item.expireAt = time.Now().Add(ttl)
+		l.ll.MoveToFront(elem)
+		return
+	}
+	l.items[key] = l.ll.PushFront(&responseCacheItem{key: key, entry: entry, expireAt: time.Now().Add(ttl)})
+	for l.ll.Len() > maxEntries {
+		oldest := l.ll.Back()
+		l.ll.Remove(oldest)
+		delete(l.items, oldest.Value.(*responseCacheItem).key)
+	}
+}
+
+// ResponseCacheWriter 在写给客户端的同时记录响应内容，请求成功后写入缓存
+type ResponseCacheWriter struct {
+	gin.ResponseWriter
+	c        *gin.Context
+	key      string
+	limit    int
+	mu       sync.Mutex
+	buffer   bytes.Buffer
+	overflow bool
+}
+
+// SetupResponseCacheWriter 替换 c.Writer 以记录响应，需要在其他 writer 之前安装以记录最终输出
+func SetupResponseCacheWriter(c *gin.Context, key string) *ResponseCacheWriter {
+	if key == "" {
+		return nil
+	}
+	w := &ResponseCacheWriter{
+		ResponseWriter: c.Writer,
+		c:              c,
+		key:            key,
+		limit:          operation_setting.GetResponseCacheSetting().MaxBodyKB * 1024,
+	}
+	c.Writer = w
+	return w
+}
+
+func (w *ResponseCacheWriter) record(data []byte) {
+	// 伪流式请求的心跳会在其他 goroutine 中写入
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.overflow {
+		return
+	}
+	if w.buffer.Len()+len(data) > w.limit {
+		w.overflow = true
+		w.buffer.Reset()
+		return
+	}
+	w.buffer.Write(data)
+}
+
+func (w *ResponseCacheWriter) Write(data []byte) (int, error) {
+	w.record(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *ResponseCacheWriter) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Finish 恢复原来的 writer，请求成功且响应未被屏蔽词拦截时写入缓存，客户端中途断开的响应不缓存
+func (w *ResponseCacheWriter) Finish(info *relaycommon.RelayInfo, usage *dto.Usage, success bool) {
+	if w == nil {
+		return
+	}
+	w.c.Writer = w.ResponseWriter
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !success || info.ClientCancelled || w.overflow || w.buffer.Len() == 0 || w.Status() != http.StatusOK || usage == nil {
+		return
+	}
+	if info.Other != nil {
+		if _, blocked := info.Other["completion_sensitive_action"]; blocked {
+			return
+		}
+	}
+	contentType := w.Header().Get("Content-Type")
+	SetResponseCache(w.key, &ResponseCacheEntry{
+		Body:        bytes.Clone(w.buffer.Bytes()),
+		ContentType: contentType,
+		IsStream:    strings.HasPrefix(contentType, "text/event-stream"),
+		Usage:       *usage,
+		CreatedAt:   common.GetTimestamp(),
+	})
+}
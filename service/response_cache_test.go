@@ -0,0 +1,100 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	"veloera/relay/helper"
+
+	"github.com/gin-gonic/gin"
+)
+
+func runCachedStream(t *testing.T, key string, cancelAfterFirst bool) *relaycommon.RelayInfo {
+	t.Helper()
+	common.RedisEnabled = false
+	oldTimeout := constant.StreamingTimeout
+	constant.StreamingTimeout = 5
+	t.Cleanup(func() { constant.StreamingTimeout = oldTimeout })
+
+	gin.SetMode(gin.TestMode)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil).WithContext(ctx)
+
+	reader, writer := io.Pipe()
+	resp := &http.Response{StatusCode: http.StatusOK, Body: reader}
+	info := &relaycommon.RelayInfo{IsStream: true}
+	cacheWriter := SetupResponseCacheWriter(c, key)
+
+	go func() {
+		_, _ = io.WriteString(writer, "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"},\"finish_reason\":null}]}\n")
+		if cancelAfterFirst {
+			return
+		}
+		_, _ = io.WriteString(writer, "data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\n")
+		_, _ = io.WriteString(writer, "data: [DONE]\n")
+		_ = writer.Close()
+	}()
+	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
+		if err := helper.StringData(c, data); err != nil {
+			return false
+		}
+		if cancelAfterFirst {
+			// 客户端在收到第一段内容后断开
+			cancel()
+		}
+		return true
+	})
+	_ = writer.Close()
+
+	// 按 relay 层的旧写法传入 success=true，确认 Finish 自身也会拒绝缓存
+	cacheWriter.Finish(info, &dto.Usage{TotalTokens: 1}, true)
+	return info
+}
+
+// 客户端中途断开时不应缓存已下发的部分流式响应
+func TestResponseCacheSkipsClientCancelledStream(t *testing.T) {
+	info := runCachedStream(t, "test:stream-cancelled", true)
+	if !info.ClientCancelled {
+		t.Fatal("expected client cancellation to be recorded")
+	}
+	if info.StreamCompleted {
+		t.Fatal("cancelled stream must not be marked as completed")
+	}
+	if entry := GetResponseCache("test:stream-cancelled"); entry != nil {
+		t.Fatalf("partial stream was cached: %q", entry.Body)
+	}
+}
+
+func TestResponseCacheStoresCompletedStream(t *testing.T) {
+	info := runCachedStream(t, "test:stream-completed", false)
+	if !info.StreamCompleted {
+		t.Fatal("expected stream to be marked as completed")
+	}
+	if entry := GetResponseCache("test:stream-completed"); entry == nil || !entry.IsStream {
+		t.Fatal("completed stream should be cached")
+	}
+}
@@ -0,0 +1,488 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/dto"
+	"veloera/model"
+	relaycommon "veloera/relay/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 回溯 previous_response_id 的最大深度，防止异常数据导致的无限循环
+const maxResponsesHistoryDepth = 100
+
+// ResponsesToOpenAIRequest 把 /v1/responses 请求转换为 chat completions 请求，previous_response_id 对应的
+// 历史会话会拼接在前面，本轮输入保存在 info 中，上游返回后再一起保存
+func ResponsesToOpenAIRequest(request dto.OpenAIResponsesRequest, info *relaycommon.RelayInfo) (*dto.GeneralOpenAIRequest, error) {
+	openAIRequest := dto.GeneralOpenAIRequest{
+		Model:     request.Model,
+		Stream:    request.Stream,
+		MaxTokens: request.MaxOutputTokens,
+		TopP:      request.TopP,
+		User:      request.User,
+	}
+	if request.Temperature != 0 {
+		openAIRequest.Temperature = common.GetPointer[float64](request.Temperature)
+	}
+	if request.Reasoning != nil && request.Reasoning.Effort != "" {
+		openAIRequest.ReasoningEffort = request.Reasoning.Effort
+	}
+
+	messages := make([]dto.Message, 0)
+	var instructions string
+	if len(request.Instructions) > 0 && json.Unmarshal(request.Instructions, &instructions) == nil && instructions != "" {
+		systemMessage := dto.Message{Role: "system"}
+		systemMessage.SetStringContent(instructions)
+		messages = append(messages, systemMessage)
+	}
+	if request.PreviousResponseID != "" {
+		history, err := loadResponsesHistory(info.UserId, request.PreviousResponseID)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, history...)
+	}
+	inputMessages, err := responsesInputToMessages(request.Input)
+	if err != nil {
+		return nil, err
+	}
+	openAIRequest.Messages = append(messages, inputMessages...)
+
+	for _, tool := range request.Tools {
+		if tool.Type != "function" {
+			return nil, fmt.Errorf("built-in tool %s is not supported on this channel", tool.Type)
+		}
+		openAITool := dto.ToolCallRequest{
+			Type: "function",
+			Function: dto.FunctionRequest{
+				Name:        tool.Name,
+				Description: tool.Description,
+			},
+		}
+		if len(tool.Parameters) > 0 {
+			openAITool.Function.Parameters = tool.Parameters
+		}
+		openAIRequest.Tools = append(openAIRequest.Tools, openAITool)
+	}
+	if len(request.ToolChoice) > 0 {
+		openAIRequest.ToolChoice = responsesToolChoiceToOpenAI(request.ToolChoice)
+	}
+	if len(request.Text) > 0 {
+		openAIRequest.ResponseFormat = responsesTextToResponseFormat(request.Text)
+	}
+
+	info.ResponsesConvertInfo = &relaycommon.ResponsesConvertInfo{
+		ResponseId:    "resp_" + common.GetUUID(),
+		Request:       &request,
+		InputMessages: inputMessages,
+	}
+	return &openAIRequest, nil
+}
+
+func loadResponsesHistory(userId int, responseId string) ([]dto.Message, error) {
+	turns := make([][]dto.Message, 0)
+	for id := responseId; id != "" && len(turns) < maxResponsesHistoryDepth; {
+		stored, err := model.GetUserStoredResponse(userId, id)
+		if err != nil {
+			if len(turns) == 0 {
+				return nil, fmt.Errorf("previous response with id '%s' not found", responseId)
+			}
+			// 更早的会话已被清理，从这里截断
+			break
+		}
+		var messages []dto.Message
+		if err = common.DecodeJsonStr(stored.Messages, &messages); err != nil {
+			return nil, fmt.Errorf("stored response %s is corrupted: %w", id, err)
+		}
+		turns = append(turns, messages)
+		id = stored.PreviousResponseId
+	}
+	history := make([]dto.Message, 0)
+	for i := len(turns) - 1; i >= 0; i-- {
+		history = append(history, turns[i]...)
+	}
+	return history, nil
+}
+
+func responsesInputToMessages(input json.RawMessage) ([]dto.Message, error) {
+	var text string
+	if json.Unmarshal(input, &text) == nil {
+		message := dto.Message{Role: "user"}
+		message.SetStringContent(text)
+		return []dto.Message{message}, nil
+	}
+	var items []dto.ResponsesInputItem
+	if err := json.Unmarshal(input, &items); err != nil {
+		return nil, errors.New("input must be a string or an array of input items")
+	}
+	messages := make([]dto.Message, 0, len(items))
+	for _, item := range items {
+		switch item.Type {
+		case "", "message":
+			message, err := responsesInputMessage(item)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, message)
+		case "function_call":
+			toolCall := dto.ToolCallRequest{
+				ID:   item.CallId,
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			}
+			// 连续的 function_call 合并到同一条 assistant 消息中
+			if len(messages) > 0 && messages[len(messages)-1].Role == "assistant" {
+				last := &messages[len(messages)-1]
+				last.SetToolCalls(append(last.ParseToolCalls(), toolCall))
+			} else {
+				message := dto.Message{Role: "assistant"}
+				message.SetToolCalls([]dto.ToolCallRequest{toolCall})
+				messages = append(messages, message)
+			}
+		case "function_call_output":
+			message := dto.Message{Role: "tool", ToolCallId: item.CallId}
+			var output string
+			if json.Unmarshal(item.Output, &output) == nil {
+				message.SetStringContent(output)
+			} else {
+				message.SetStringContent(string(item.Output))
+			}
+			messages = append(messages, message)
+		case "reasoning":
+			// chat completions 无法回传推理内容，直接丢弃
+		default:
+			return nil, fmt.Errorf("input item type %s is not supported on this channel", item.Type)
+		}
+	}
+	return messages, nil
+}
+
+func responsesInputMessage(item dto.ResponsesInputItem) (dto.Message, error) {
+	role := item.Role
+	if role == "developer" {
+		role = "system"
+	}
+	message := dto.Message{Role: role}
+	var text string
+	if json.Unmarshal(item.Content, &text) == nil {
+		message.SetStringContent(text)
+		return message, nil
+	}
+	var contents []dto.ResponsesInputContent
+	if err := json.Unmarshal(item.Content, &contents); err != nil {
+		return message, errors.New("message content must be a string or an array of content parts")
+	}
+	textOnly := true
+	mediaContents := make([]dto.MediaContent, 0, len(contents))
+	for _, content := range contents {
+		switch content.Type {
+		case "input_text", "output_text", "text":
+			mediaContents = append(mediaContents, dto.MediaContent{Type: dto.ContentTypeText, Text: content.Text})
+		case "refusal":
+			mediaContents = append(mediaContents, dto.MediaContent{Type: dto.ContentTypeText, Text: content.Refusal})
+		case "input_image":
+			textOnly = false
+			detail := content.Detail
+			if detail == "" {
+				detail = "auto"
+			}
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type:     dto.ContentTypeImageURL,
+				ImageUrl: &dto.MessageImageUrl{Url: content.ImageUrl, Detail: detail},
+			})
+		case "input_file":
+			textOnly = false
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeFile,
+				File: &dto.MessageFile{FileName: content.Filename, FileData: content.FileData, FileId: content.FileId},
+			})
+		default:
+			return message, fmt.Errorf("content type %s is not supported on this channel", content.Type)
+		}
+	}
+	if textOnly {
+		textBuilder := strings.Builder{}
+		for _, content := range mediaContents {
+			textBuilder.WriteString(content.Text)
+		}
+		message.SetStringContent(textBuilder.String())
+	} else {
+		message.SetMediaContent(mediaContents)
+	}
+	return message, nil
+}
+
+func responsesToolChoiceToOpenAI(toolChoice json.RawMessage) any {
+	var choice string
+	if json.Unmarshal(toolChoice, &choice) == nil {
+		return choice
+	}
+	var functionChoice struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(toolChoice, &functionChoice) == nil && functionChoice.Type == "function" {
+		return map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name": functionChoice.Name,
+			},
+		}
+	}
+	return nil
+}
+
+func responsesTextToResponseFormat(text json.RawMessage) *dto.ResponseFormat {
+	var textConfig struct {
+		Format *struct {
+			Type        string `json:"type"`
+			Name        string `json:"name"`
+			Description string `json:"description"`
+			Schema      any    `json:"schema"`
+			Strict      any    `json:"strict"`
+		} `json:"format"`
+	}
+	if json.Unmarshal(text, &textConfig) != nil || textConfig.Format == nil {
+		return nil
+	}
+	switch textConfig.Format.Type {
+	case "json_schema":
+		return &dto.ResponseFormat{
+			Type: "json_schema",
+			JsonSchema: &dto.FormatJsonSchema{
+				Name:        textConfig.Format.Name,
+				Description: textConfig.Format.Description,
+				Schema:      textConfig.Format.Schema,
+				Strict:      textConfig.Format.Strict,
+			},
+		}
+	case "json_object":
+		return &dto.ResponseFormat{Type: "json_object"}
+	}
+	return nil
+}
+
+// newResponsesResponse 根据原始请求生成 responses 响应的公共字段
+func newResponsesResponse(info *relaycommon.RelayInfo, status string) *dto.OpenAIResponsesResponse {
+	convertInfo := info.ResponsesConvertInfo
+	request := convertInfo.Request
+	response := &dto.OpenAIResponsesResponse{
+		ID:                 convertInfo.ResponseId,
+		Object:             "response",
+		CreatedAt:          int(info.StartTime.Unix()),
+		Status:             status,
+		MaxOutputTokens:    int(request.MaxOutputTokens),
+		Model:              info.UpstreamModelName,
+		Output:             make([]dto.ResponsesOutput, 0),
+		ParallelToolCalls:  request.ParallelToolCalls,
+		PreviousResponseID: request.PreviousResponseID,
+		Reasoning:          request.Reasoning,
+		Store:              shouldStoreResponse(info),
+		Temperature:        request.Temperature,
+		ToolChoice:         "auto",
+		Tools:              make([]interface{}, 0, len(request.Tools)),
+		TopP:               request.TopP,
+		Truncation:         request.Truncation,
+		Metadata:           request.Metadata,
+	}
+	_ = json.Unmarshal(request.Instructions, &response.Instructions)
+	_ = json.Unmarshal(request.ToolChoice, &response.ToolChoice)
+	for _, tool := range request.Tools {
+		response.Tools = append(response.Tools, tool)
+	}
+	if request.User != "" {
+		response.User, _ = json.Marshal(request.User)
+	}
+	return response
+}
+
+func shouldStoreResponse(info *relaycommon.RelayInfo) bool {
+	request := info.ResponsesConvertInfo.Request
+	return request.Store == nil || *request.Store
+}
+
+// finishResponsesResponse 根据 chat 的 finish_reason 设置最终状态
+func finishResponsesResponse(response *dto.OpenAIResponsesResponse, finishReason string, usage *dto.Usage) {
+	switch finishReason {
+	case "length":
+		response.Status = "incomplete"
+		response.IncompleteDetails = &dto.IncompleteDetails{Reason: "max_output_tokens"}
+	case "content_filter":
+		response.Status = "incomplete"
+		response.IncompleteDetails = &dto.IncompleteDetails{Reason: "content_filter"}
+	default:
+		response.Status = "completed"
+	}
+	if usage != nil {
+		response.Usage = &dto.Usage{
+			InputTokens:            usage.PromptTokens,
+			OutputTokens:           usage.CompletionTokens,
+			TotalTokens:            usage.TotalTokens,
+			PromptTokensDetails:    usage.PromptTokensDetails,
+			CompletionTokenDetails: usage.CompletionTokenDetails,
+		}
+	}
+}
+
+func newResponsesMessageItem(text string) dto.ResponsesOutput {
+	return dto.ResponsesOutput{
+		Type:   "message",
+		ID:     "msg_" + common.GetUUID(),
+		Status: "completed",
+		Role:   "assistant",
+		Content: []dto.ResponsesOutputContent{{
+			Type:        "output_text",
+			Text:        text,
+			Annotations: []interface{}{},
+		}},
+	}
+}
+
+func newResponsesReasoningItem(text string) dto.ResponsesOutput {
+	return dto.ResponsesOutput{
+		Type: "reasoning",
+		ID:   "rs_" + common.GetUUID(),
+		Summary: []dto.ResponsesOutputContent{{
+			Type: "summary_text",
+			Text: text,
+		}},
+	}
+}
+
+func newResponsesFunctionCallItem(callId string, name string, arguments string) dto.ResponsesOutput {
+	if callId == "" {
+		callId = "call_" + common.GetUUID()
+	}
+	return dto.ResponsesOutput{
+		Type:      "function_call",
+		ID:        "fc_" + common.GetUUID(),
+		Status:    "completed",
+		CallId:    callId,
+		Name:      name,
+		Arguments: arguments,
+	}
+}
+
+// ResponseOpenAI2Responses 把非流式的 chat completions 响应转换为 /v1/responses 响应
+func ResponseOpenAI2Responses(openAIResponse *dto.OpenAITextResponse, info *relaycommon.RelayInfo) *dto.OpenAIResponsesResponse {
+	response := newResponsesResponse(info, "completed")
+	finishReason := ""
+	// responses 只有一个候选，取第一个 choice
+	if len(openAIResponse.Choices) > 0 {
+		choice := openAIResponse.Choices[0]
+		reasoning := choice.Message.ReasoningContent
+		if reasoning == "" {
+			reasoning = choice.Message.Reasoning
+		}
+		if reasoning != "" {
+			response.Output = append(response.Output, newResponsesReasoningItem(reasoning))
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			response.Output = append(response.Output, newResponsesMessageItem(text))
+		}
+		for _, toolCall := range choice.Message.ParseToolCalls() {
+			response.Output = append(response.Output, newResponsesFunctionCallItem(toolCall.ID, toolCall.Function.Name, toolCall.Function.Arguments))
+		}
+		finishReason = choice.FinishReason
+	}
+	finishResponsesResponse(response, finishReason, &openAIResponse.Usage)
+	return response
+}
+
+// SaveResponsesConversation 保存本轮的输入与输出，之后的请求可以通过 previous_response_id 继续会话
+func SaveResponsesConversation(info *relaycommon.RelayInfo, output []dto.ResponsesOutput) {
+	convertInfo := info.ResponsesConvertInfo
+	if convertInfo == nil || !shouldStoreResponse(info) {
+		return
+	}
+	messages := append([]dto.Message{}, convertInfo.InputMessages...)
+	assistantMessage := dto.Message{Role: "assistant"}
+	textBuilder := strings.Builder{}
+	toolCalls := make([]dto.ToolCallRequest, 0)
+	for _, item := range output {
+		switch item.Type {
+		case "message":
+			for _, content := range item.Content {
+				textBuilder.WriteString(content.Text)
+			}
+		case "function_call":
+			toolCalls = append(toolCalls, dto.ToolCallRequest{
+				ID:   item.CallId,
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			})
+		}
+	}
+	if textBuilder.Len() > 0 {
+		assistantMessage.SetStringContent(textBuilder.String())
+	}
+	if len(toolCalls) > 0 {
+		assistantMessage.SetToolCalls(toolCalls)
+	}
+	if textBuilder.Len() > 0 || len(toolCalls) > 0 {
+		messages = append(messages, assistantMessage)
+	}
+	messagesJson, err := json.Marshal(messages)
+	if err != nil {
+		common.SysError("error marshalling responses conversation: " + err.Error())
+		return
+	}
+	stored := &model.StoredResponse{
+		Id:                 convertInfo.ResponseId,
+		UserId:             info.UserId,
+		PreviousResponseId: convertInfo.Request.PreviousResponseID,
+		Model:              info.OriginModelName,
+		Messages:           string(messagesJson),
+	}
+	if err = stored.Insert(); err != nil {
+		common.SysError("failed to store response " + stored.Id + ": " + err.Error())
+	}
+}
+
+// StartResponsesStoreCleanup 定期清理过期的 responses 会话
+func StartResponsesStoreCleanup() {
+	if constant.ResponsesStoreDays <= 0 {
+		return
+	}
+	gopool.Go(func() {
+		for {
+			target := time.Now().Add(-time.Duration(constant.ResponsesStoreDays) * 24 * time.Hour).Unix()
+			count, err := model.DeleteStoredResponsesBefore(target)
+			if err != nil {
+				common.SysError("failed to clean up stored responses: " + err.Error())
+			} else if count > 0 {
+				common.SysLog(fmt.Sprintf("cleaned up %d stored responses", count))
+			}
+			time.Sleep(time.Hour)
+		}
+	})
+}
@@ -0,0 +1,448 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"veloera/common"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	"veloera/relay/helper"
+
+	"github.com/gin-gonic/gin"
+)
+
+type responsesStreamCall struct {
+	item        dto.ResponsesOutput
+	outputIndex int
+	arguments   strings.Builder
+}
+
+// OpenAI2ResponsesWriter 在只支持 chat completions 格式的渠道处理 /v1/responses 请求时替换 gin 的 writer，
+// json 响应转换为 response 对象，SSE 流转换为 response.* 事件
+type OpenAI2ResponsesWriter struct {
+	gin.ResponseWriter
+	c      *gin.Context
+	out    *gin.Context // 写入原始 writer，用于输出转换后的事件
+	info   *relaycommon.RelayInfo
+	buffer bytes.Buffer
+	status int
+
+	// 流式转换状态
+	started        bool
+	sequence       int
+	output         []dto.ResponsesOutput
+	reasoning      *dto.ResponsesOutput
+	reasoningIndex int
+	reasoningText  strings.Builder
+	message        *dto.ResponsesOutput
+	messageIndex   int
+	messageText    strings.Builder
+	calls          []*responsesStreamCall
+	callIndexes    map[int]*responsesStreamCall
+	finishReason   string
+	usage          *dto.Usage
+}
+
+func NewOpenAI2ResponsesWriter(c *gin.Context, info *relaycommon.RelayInfo) *OpenAI2ResponsesWriter {
+	w := &OpenAI2ResponsesWriter{
+		ResponseWriter: c.Writer,
+		c:              c,
+		out:            &gin.Context{Writer: c.Writer},
+		info:           info,
+		status:         http.StatusOK,
+		output:         make([]dto.ResponsesOutput, 0),
+		callIndexes:    make(map[int]*responsesStreamCall),
+	}
+	c.Writer = w
+	return w
+}
+
+func (w *OpenAI2ResponsesWriter) isStream() bool {
+	return strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+}
+
+func (w *OpenAI2ResponsesWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+	if w.isStream() {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *OpenAI2ResponsesWriter) WriteHeaderNow() {
+	if w.isStream() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *OpenAI2ResponsesWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if w.isStream() {
+		w.convertStreamLines(false)
+	}
+	return len(data), nil
+}
+
+func (w *OpenAI2ResponsesWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *OpenAI2ResponsesWriter) Flush() {
+	if w.isStream() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// convertStreamLines 转换缓冲区中所有完整的 SSE 行，末尾不完整的行保留到后续数据到达，all 为 true 时一并处理
+func (w *OpenAI2ResponsesWriter) convertStreamLines(all bool) {
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			if !all {
+				rest := line + w.buffer.String()
+				w.buffer.Reset()
+				w.buffer.WriteString(rest)
+				return
+			}
+			if line != "" {
+				w.convertStreamLine(line)
+			}
+			return
+		}
+		w.convertStreamLine(line)
+	}
+}
+
+func (w *OpenAI2ResponsesWriter) convertStreamLine(line string) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, ":") {
+		// keep alive 注释原样转发
+		_, _ = w.ResponseWriter.WriteString(line + "\n\n")
+		w.ResponseWriter.Flush()
+		return
+	}
+	if !strings.HasPrefix(line, "data:") {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "" || strings.HasPrefix(data, "[DONE]") {
+		return
+	}
+	var streamResponse dto.ChatCompletionsStreamResponse
+	if err := common.DecodeJsonStr(data, &streamResponse); err != nil {
+		common.LogError(w.c, "error unmarshalling stream response: "+err.Error())
+		return
+	}
+	w.info.SendResponseCount++
+	w.handleStreamResponse(&streamResponse)
+}
+
+func (w *OpenAI2ResponsesWriter) handleStreamResponse(streamResponse *dto.ChatCompletionsStreamResponse) {
+	w.start()
+	if ValidUsage(streamResponse.Usage) {
+		w.usage = streamResponse.Usage
+	}
+	if len(streamResponse.Choices) == 0 {
+		return
+	}
+	choice := streamResponse.Choices[0]
+	if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+		w.appendReasoning(reasoning)
+	}
+	if text := choice.Delta.GetContentString(); text != "" {
+		w.appendText(text)
+	}
+	for _, toolCall := range choice.Delta.ToolCalls {
+		w.appendToolCall(toolCall)
+	}
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		w.finishReason = *choice.FinishReason
+	}
+}
+
+func (w *OpenAI2ResponsesWriter) emit(event dto.ResponsesStreamResponse) {
+	event.SequenceNumber = w.sequence
+	w.sequence++
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		common.SysError("error marshalling responses event: " + err.Error())
+		return
+	}
+	helper.ResponseChunkData(w.out, event, string(jsonData))
+}
+
+func (w *OpenAI2ResponsesWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+	w.emit(dto.ResponsesStreamResponse{
+		Type:     "response.created",
+		Response: newResponsesResponse(w.info, "in_progress"),
+	})
+	w.emit(dto.ResponsesStreamResponse{
+		Type:     "response.in_progress",
+		Response: newResponsesResponse(w.info, "in_progress"),
+	})
+}
+
+func (w *OpenAI2ResponsesWriter) addItem(item dto.ResponsesOutput) int {
+	w.output = append(w.output, item)
+	index := len(w.output) - 1
+	w.emit(dto.ResponsesStreamResponse{
+		Type:        dto.ResponsesOutputTypeItemAdded,
+		OutputIndex: common.GetPointer[int](index),
+		Item:        &item,
+	})
+	return index
+}
+
+func (w *OpenAI2ResponsesWriter) doneItem(index int, item dto.ResponsesOutput) {
+	w.output[index] = item
+	w.emit(dto.ResponsesStreamResponse{
+		Type:        dto.ResponsesOutputTypeItemDone,
+		OutputIndex: common.GetPointer[int](index),
+		Item:        &item,
+	})
+}
+
+func (w *OpenAI2ResponsesWriter) appendReasoning(text string) {
+	if w.reasoning == nil {
+		w.closeMessage()
+		w.closeCalls()
+		item := newResponsesReasoningItem("")
+		item.Summary = nil
+		w.reasoning = &item
+		w.reasoningIndex = w.addItem(item)
+		w.emit(dto.ResponsesStreamResponse{
+			Type:         "response.reasoning_summary_part.added",
+			ItemId:       item.ID,
+			OutputIndex:  common.GetPointer[int](w.reasoningIndex),
+			SummaryIndex: common.GetPointer[int](0),
+			Part:         &dto.ResponsesOutputContent{Type: "summary_text"},
+		})
+	}
+	w.reasoningText.WriteString(text)
+	w.emit(dto.ResponsesStreamResponse{
+		Type:         "response.reasoning_summary_text.delta",
+		ItemId:       w.reasoning.ID,
+		OutputIndex:  common.GetPointer[int](w.reasoningIndex),
+		SummaryIndex: common.GetPointer[int](0),
+		Delta:        text,
+	})
+}
+
+func (w *OpenAI2ResponsesWriter) closeReasoning() {
+	if w.reasoning == nil {
+		return
+	}
+	item := *w.reasoning
+	text := w.reasoningText.String()
+	part := dto.ResponsesOutputContent{Type: "summary_text", Text: text}
+	w.emit(dto.ResponsesStreamResponse{
+		Type:         "response.reasoning_summary_text.done",
+		ItemId:       item.ID,
+		OutputIndex:  common.GetPointer[int](w.reasoningIndex),
+		SummaryIndex: common.GetPointer[int](0),
+		Text:         text,
+	})
+	w.emit(dto.ResponsesStreamResponse{
+		Type:         "response.reasoning_summary_part.done",
+		ItemId:       item.ID,
+		OutputIndex:  common.GetPointer[int](w.reasoningIndex),
+		SummaryIndex: common.GetPointer[int](0),
+		Part:         &part,
+	})
+	item.Summary = []dto.ResponsesOutputContent{part}
+	w.doneItem(w.reasoningIndex, item)
+	w.reasoning = nil
+	w.reasoningText.Reset()
+}
+
+func (w *OpenAI2ResponsesWriter) appendText(text string) {
+	if w.message == nil {
+		w.closeReasoning()
+		w.closeCalls()
+		item := newResponsesMessageItem("")
+		item.Status = "in_progress"
+		item.Content = nil
+		w.message = &item
+		w.messageIndex = w.addItem(item)
+		w.emit(dto.ResponsesStreamResponse{
+			Type:         "response.content_part.added",
+			ItemId:       item.ID,
+			OutputIndex:  common.GetPointer[int](w.messageIndex),
+			ContentIndex: common.GetPointer[int](0),
+			Part:         &dto.ResponsesOutputContent{Type: "output_text", Annotations: []interface{}{}},
+		})
+	}
+	w.messageText.WriteString(text)
+	w.emit(dto.ResponsesStreamResponse{
+		Type:         "response.output_text.delta",
+		ItemId:       w.message.ID,
+		OutputIndex:  common.GetPointer[int](w.messageIndex),
+		ContentIndex: common.GetPointer[int](0),
+		Delta:        text,
+	})
+}
+
+func (w *OpenAI2ResponsesWriter) closeMessage() {
+	if w.message == nil {
+		return
+	}
+	item := *w.message
+	text := w.messageText.String()
+	part := dto.ResponsesOutputContent{Type: "output_text", Text: text, Annotations: []interface{}{}}
+	w.emit(dto.ResponsesStreamResponse{
+		Type:         "response.output_text.done",
+		ItemId:       item.ID,
+		OutputIndex:  common.GetPointer[int](w.messageIndex),
+		ContentIndex: common.GetPointer[int](0),
+		Text:         text,
+	})
+	w.emit(dto.ResponsesStreamResponse{
+		Type:         "response.content_part.done",
+		ItemId:       item.ID,
+		OutputIndex:  common.GetPointer[int](w.messageIndex),
+		ContentIndex: common.GetPointer[int](0),
+		Part:         &part,
+	})
+	item.Status = "completed"
+	item.Content = []dto.ResponsesOutputContent{part}
+	w.doneItem(w.messageIndex, item)
+	w.message = nil
+	w.messageText.Reset()
+}
+
+func (w *OpenAI2ResponsesWriter) appendToolCall(toolCall dto.ToolCallResponse) {
+	var call *responsesStreamCall
+	if toolCall.Index != nil {
+		call = w.callIndexes[*toolCall.Index]
+	} else if toolCall.ID == "" && len(w.calls) > 0 {
+		call = w.calls[len(w.calls)-1]
+	}
+	// 同一个 index 上出现了新的调用 id，视为新的调用
+	if call != nil && toolCall.ID != "" && call.item.CallId != toolCall.ID {
+		call = nil
+	}
+	if call == nil {
+		w.closeReasoning()
+		w.closeMessage()
+		item := newResponsesFunctionCallItem(toolCall.ID, toolCall.Function.Name, "")
+		item.Status = "in_progress"
+		call = &responsesStreamCall{item: item}
+		call.outputIndex = w.addItem(item)
+		w.calls = append(w.calls, call)
+		if toolCall.Index != nil {
+			w.callIndexes[*toolCall.Index] = call
+		}
+	}
+	if call.item.Name == "" {
+		call.item.Name = toolCall.Function.Name
+	}
+	if toolCall.Function.Arguments != "" {
+		call.arguments.WriteString(toolCall.Function.Arguments)
+		w.emit(dto.ResponsesStreamResponse{
+			Type:        "response.function_call_arguments.delta",
+			ItemId:      call.item.ID,
+			OutputIndex: common.GetPointer[int](call.outputIndex),
+			Delta:       toolCall.Function.Arguments,
+		})
+	}
+}
+
+func (w *OpenAI2ResponsesWriter) closeCalls() {
+	for _, call := range w.calls {
+		item := call.item
+		item.Arguments = call.arguments.String()
+		item.Status = "completed"
+		w.emit(dto.ResponsesStreamResponse{
+			Type:        "response.function_call_arguments.done",
+			ItemId:      item.ID,
+			OutputIndex: common.GetPointer[int](call.outputIndex),
+			Arguments:   item.Arguments,
+		})
+		w.doneItem(call.outputIndex, item)
+	}
+	w.calls = nil
+	w.callIndexes = make(map[int]*responsesStreamCall)
+}
+
+// Finish 恢复原来的 writer 并输出尚未下发的内容：流式响应的结束事件，或转换后的非流式响应，
+// 成功的会话会保存以便通过 previous_response_id 继续；处理函数在写入前失败时只恢复 writer，由调用方返回错误
+func (w *OpenAI2ResponsesWriter) Finish(usage *dto.Usage, openaiErr *dto.OpenAIErrorWithStatusCode) {
+	w.c.Writer = w.ResponseWriter
+	if w.isStream() {
+		w.convertStreamLines(true)
+		if openaiErr != nil && !w.started {
+			return
+		}
+		w.start()
+		w.closeReasoning()
+		w.closeMessage()
+		w.closeCalls()
+		if usage != nil {
+			w.usage = usage
+		}
+		response := newResponsesResponse(w.info, "failed")
+		response.Output = w.output
+		if openaiErr != nil {
+			response.Error = &openaiErr.Error
+			w.emit(dto.ResponsesStreamResponse{Type: "response.failed", Response: response})
+			return
+		}
+		finishResponsesResponse(response, w.finishReason, w.usage)
+		eventType := "response.completed"
+		if response.Status == "incomplete" {
+			eventType = "response.incomplete"
+		}
+		w.emit(dto.ResponsesStreamResponse{Type: eventType, Response: response})
+		SaveResponsesConversation(w.info, response.Output)
+		return
+	}
+	if openaiErr != nil || w.buffer.Len() == 0 {
+		return
+	}
+
+	body := w.buffer.Bytes()
+	var openAIResponse dto.OpenAITextResponse
+	if err := common.DecodeJson(body, &openAIResponse); err != nil || w.status != http.StatusOK {
+		// 不是 chat completions 响应，原样返回
+		w.ResponseWriter.WriteHeader(w.status)
+		_, _ = w.ResponseWriter.Write(body)
+		return
+	}
+	if usage != nil && openAIResponse.Usage.TotalTokens == 0 {
+		openAIResponse.Usage = *usage
+	}
+	response := ResponseOpenAI2Responses(&openAIResponse, w.info)
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		common.SysError("error marshalling responses response: " + err.Error())
+		return
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(responseBody)
+	SaveResponsesConversation(w.info, response.Output)
+}
@@ -20,9 +20,14 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 	"veloera/dto"
 	"veloera/setting"
+
+	goahocorasick "github.com/anknown/ahocorasick"
 )
 
 func CheckSensitiveMessages(messages []dto.Message) ([]string, error) {
@@ -93,28 +98,97 @@ func SensitiveWordContains(text string) (bool, []string) {
 
 // SensitiveWordReplace 敏感词替换，返回是否包含敏感词和替换后的文本
 func SensitiveWordReplace(text string, returnImmediately bool) (bool, []string, string) {
-	if len(setting.SensitiveWords) == 0 {
+	if len(setting.SensitiveWords) == 0 && len(setting.RegexSensitiveWords) == 0 {
 		return false, nil, text
 	}
-	checkText := strings.ToLower(text)
-	m := InitAc(setting.SensitiveWords)
-	hits := m.MultiPatternSearch([]rune(checkText), returnImmediately)
-	if len(hits) > 0 {
-		words := make([]string, 0, len(hits))
-		var builder strings.Builder
-		builder.Grow(len(text))
-		lastPos := 0
+	ranges, words := sensitiveWordRanges(InitAc(setting.SensitiveWords), []rune(text), returnImmediately)
+	if len(ranges) == 0 {
+		return false, nil, text
+	}
+	return true, words, replaceSensitivePieces([]string{text}, ranges)[0]
+}
+
+// sensitiveWordRanges 返回文本中屏蔽词命中的位置，位置按 rune 计算，区间为 [start, end)
+func sensitiveWordRanges(m *goahocorasick.Machine, runes []rune, returnImmediately bool) ([][2]int, []string) {
+	if len(runes) == 0 {
+		return nil, nil
+	}
+	// 逐个 rune 转小写，保证位置与原文一致
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	var ranges [][2]int
+	var words []string
+	if m != nil {
+		for _, hit := range m.MultiPatternSearch(lower, returnImmediately) {
+			ranges = append(ranges, [2]int{hit.Pos, hit.Pos + len(hit.Word)})
+			words = append(words, string(hit.Word))
+		}
+		if returnImmediately && len(ranges) > 0 {
+			return ranges, words
+		}
+	}
+	lowerText := string(lower)
+	for _, pattern := range setting.RegexSensitiveWords {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+		for _, loc := range re.FindAllStringIndex(lowerText, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			start := utf8.RuneCountInString(lowerText[:loc[0]])
+			ranges = append(ranges, [2]int{start, start + utf8.RuneCountInString(lowerText[loc[0]:loc[1]])})
+			words = append(words, pattern)
+			if returnImmediately {
+				return ranges, words
+			}
+		}
+	}
+	return ranges, RemoveDuplicate(words)
+}
 
-		for _, hit := range hits {
-			pos := hit.Pos
-			word := string(hit.Word)
-			builder.WriteString(text[lastPos:pos])
-			builder.WriteString("**###**")
-			lastPos = pos + len(word)
-			words = append(words, word)
+// replaceSensitivePieces 将命中的屏蔽词替换为 **###**，pieces 按顺序拼接后即为检查的文本，
+// 跨越多段的屏蔽词只在起始段写入替换符号
+func replaceSensitivePieces(pieces []string, ranges [][2]int) []string {
+	total := 0
+	for _, piece := range pieces {
+		total += utf8.RuneCountInString(piece)
+	}
+	masked := make([]bool, total)
+	starts := make([]bool, total)
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i][0] < ranges[j][0]
+	})
+	for _, r := range ranges {
+		if r[0] < 0 || r[1] > total || r[0] >= r[1] {
+			continue
+		}
+		// 重叠的命中合并为一个替换符号
+		if !masked[r[0]] {
+			starts[r[0]] = true
+		}
+		for i := r[0]; i < r[1]; i++ {
+			masked[i] = true
+		}
+	}
+	result := make([]string, len(pieces))
+	pos := 0
+	for i, piece := range pieces {
+		var builder strings.Builder
+		builder.Grow(len(piece))
+		for _, r := range piece {
+			if starts[pos] {
+				builder.WriteString("**###**")
+			}
+			if !masked[pos] {
+				builder.WriteRune(r)
+			}
+			pos++
 		}
-		builder.WriteString(text[lastPos:])
-		return true, words, builder.String()
+		result[i] = builder.String()
 	}
-	return false, nil, text
+	return result
 }
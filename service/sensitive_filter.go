@@ -0,0 +1,450 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"veloera/common"
+	"veloera/constant"
+	relaycommon "veloera/relay/common"
+	"veloera/relay/helper"
+	"veloera/setting"
+
+	goahocorasick "github.com/anknown/ahocorasick"
+	"github.com/gin-gonic/gin"
+)
+
+// completionTextKeys 各家响应格式中承载生成文本的字段
+// openai: content / reasoning_content / text / refusal，claude: text / thinking，gemini: text，
+// responses api: delta / text，dify: answer
+var completionTextKeys = map[string]bool{
+	"content":           true,
+	"reasoning_content": true,
+	"reasoning":         true,
+	"text":              true,
+	"thinking":          true,
+	"refusal":           true,
+	"delta":             true,
+	"answer":            true,
+}
+
+type completionTextRef struct {
+	parent map[string]any
+	key    string
+}
+
+// collectCompletionTexts 按固定顺序收集 json 中所有生成文本字段的引用
+func collectCompletionTexts(node any, refs []completionTextRef) []completionTextRef {
+	switch v := node.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if _, ok := v[key].(string); ok {
+				if completionTextKeys[key] {
+					refs = append(refs, completionTextRef{parent: v, key: key})
+				}
+				continue
+			}
+			refs = collectCompletionTexts(v[key], refs)
+		}
+	case []any:
+		for _, item := range v {
+			refs = collectCompletionTexts(item, refs)
+		}
+	}
+	return refs
+}
+
+func decodeCompletionJson(data []byte) map[string]any {
+	var object map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return nil
+	}
+	return object
+}
+
+func encodeCompletionJson(object any) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(object); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buffer.Bytes(), "\n"), nil
+}
+
+// checkCompletionTexts 检查引用的文本，命中时按设置替换文本，返回命中的屏蔽词
+func checkCompletionTexts(m *goahocorasick.Machine, refs []completionTextRef, replace bool) []string {
+	if len(refs) == 0 {
+		return nil
+	}
+	pieces := make([]string, len(refs))
+	for i, ref := range refs {
+		pieces[i] = ref.parent[ref.key].(string)
+	}
+	ranges, words := sensitiveWordRanges(m, []rune(strings.Join(pieces, "")), !replace)
+	if len(ranges) == 0 {
+		return nil
+	}
+	if replace {
+		for i, piece := range replaceSensitivePieces(pieces, ranges) {
+			refs[i].parent[refs[i].key] = piece
+		}
+	}
+	return words
+}
+
+// blockCompletionObject 清空生成文本并将结束原因改为内容过滤
+func blockCompletionObject(node any) {
+	switch v := node.(type) {
+	case map[string]any:
+		for key, value := range v {
+			switch key {
+			case "finish_reason":
+				v[key] = constant.FinishReasonContentFilter
+			case "stop_reason":
+				v[key] = "refusal"
+			case "finishReason":
+				v[key] = "SAFETY"
+			default:
+				if _, ok := value.(string); ok {
+					if completionTextKeys[key] {
+						v[key] = ""
+					}
+					continue
+				}
+				blockCompletionObject(value)
+			}
+		}
+		if v["object"] == "response" {
+			v["status"] = "incomplete"
+			v["incomplete_details"] = map[string]any{"reason": constant.FinishReasonContentFilter}
+		}
+	case []any:
+		for _, item := range v {
+			blockCompletionObject(item)
+		}
+	}
+}
+
+func recordCompletionSensitive(c *gin.Context, info *relaycommon.RelayInfo, words []string, stop bool) {
+	action := "replace"
+	if stop {
+		action = "stop"
+	}
+	if info.Other == nil {
+		info.Other = make(map[string]interface{})
+	}
+	if previous, ok := info.Other["completion_sensitive_words"].([]string); ok {
+		words = RemoveDuplicate(append(previous, words...))
+	}
+	info.Other["completion_sensitive_words"] = words
+	info.Other["completion_sensitive_action"] = action
+	common.LogWarn(c, fmt.Sprintf("completion sensitive words detected, action: %s, words: %s", action, strings.Join(words, ", ")))
+}
+
+// SetupCompletionSensitiveCheck 开启补全内容检查时安装过滤：流式响应在 StreamScannerHandler 中按缓存队列检查，
+// 非流式响应由返回的 SensitiveResponseWriter 缓冲后检查，调用方在 DoResponse 之后调用 Finish
+func SetupCompletionSensitiveCheck(c *gin.Context, info *relaycommon.RelayInfo) *SensitiveResponseWriter {
+	if !setting.ShouldCheckCompletionSensitiveWithGroup(c.GetString("token_group")) {
+		return nil
+	}
+	if len(setting.SensitiveWords) == 0 && len(setting.RegexSensitiveWords) == 0 {
+		return nil
+	}
+	machine := InitAc(setting.SensitiveWords)
+	if info.IsStream {
+		queueLength := setting.StreamCacheQueueLength
+		if queueLength < 0 {
+			queueLength = 0
+		}
+		c.Set(constant.ContextKeyStreamDataFilter, helper.StreamDataFilter(&sensitiveStreamFilter{
+			c:           c,
+			info:        info,
+			machine:     machine,
+			queueLength: queueLength,
+			stop:        setting.StopOnSensitiveEnabled,
+		}))
+	}
+	w := &SensitiveResponseWriter{
+		ResponseWriter: c.Writer,
+		c:              c,
+		info:           info,
+		machine:        machine,
+		status:         http.StatusOK,
+	}
+	c.Writer = w
+	return w
+}
+
+type sensitiveStreamChunk struct {
+	data   string
+	object map[string]any
+	refs   []completionTextRef
+}
+
+// sensitiveStreamFilter 缓存最近 queueLength 条上游数据组成滑动窗口，跨数据块的屏蔽词也能被检查到
+type sensitiveStreamFilter struct {
+	c           *gin.Context
+	info        *relaycommon.RelayInfo
+	machine     *goahocorasick.Machine
+	queueLength int
+	stop        bool
+	queue       []*sensitiveStreamChunk
+	lastObject  map[string]any
+	response    map[string]any
+	stopped     bool
+}
+
+func (f *sensitiveStreamFilter) Filter(data string) ([]string, bool) {
+	if f.stopped {
+		return nil, true
+	}
+	chunk := &sensitiveStreamChunk{data: data}
+	if object := decodeCompletionJson([]byte(data)); object != nil {
+		chunk.object = object
+		chunk.refs = collectCompletionTexts(object, nil)
+		f.lastObject = object
+		if response, ok := object["response"].(map[string]any); ok {
+			f.response = response
+		}
+	}
+	f.queue = append(f.queue, chunk)
+
+	var refs []completionTextRef
+	for _, item := range f.queue {
+		refs = append(refs, item.refs...)
+	}
+	if f.stop {
+		if words := checkCompletionTexts(f.machine, refs, false); len(words) > 0 {
+			recordCompletionSensitive(f.c, f.info, words, true)
+			f.stopped = true
+			f.queue = nil
+			return f.stopData(), true
+		}
+	} else {
+		before := make([]string, len(refs))
+		for i, ref := range refs {
+			before[i] = ref.parent[ref.key].(string)
+		}
+		if words := checkCompletionTexts(f.machine, refs, true); len(words) > 0 {
+			recordCompletionSensitive(f.c, f.info, words, false)
+			changed := make(map[*sensitiveStreamChunk]bool)
+			i := 0
+			for _, item := range f.queue {
+				for range item.refs {
+					if refs[i].parent[refs[i].key].(string) != before[i] {
+						changed[item] = true
+					}
+					i++
+				}
+			}
+			for item := range changed {
+				if encoded, err := encodeCompletionJson(item.object); err == nil {
+					item.data = string(encoded)
+				}
+			}
+		}
+	}
+
+	var ready []string
+	for len(f.queue) > f.queueLength {
+		ready = append(ready, f.queue[0].data)
+		f.queue = f.queue[1:]
+	}
+	return ready, false
+}
+
+func (f *sensitiveStreamFilter) Flush() []string {
+	if f.stopped {
+		return nil
+	}
+	ready := make([]string, 0, len(f.queue))
+	for _, item := range f.queue {
+		ready = append(ready, item.data)
+	}
+	f.queue = nil
+	return ready
+}
+
+// stopData 按上游的数据格式构造结束数据，交给原有的 dataHandler 处理，使客户端收到正确的结束原因
+func (f *sensitiveStreamFilter) stopData() []string {
+	last := f.lastObject
+	if last == nil {
+		return nil
+	}
+	var objects []map[string]any
+	eventType, _ := last["type"].(string)
+	switch {
+	case last["choices"] != nil:
+		chunk := make(map[string]any)
+		for _, key := range []string{"id", "object", "created", "model", "system_fingerprint"} {
+			if value, ok := last[key]; ok {
+				chunk[key] = value
+			}
+		}
+		choice := map[string]any{
+			"index":         0,
+			"finish_reason": constant.FinishReasonContentFilter,
+		}
+		if last["object"] == "text_completion" {
+			choice["text"] = ""
+		} else {
+			choice["delta"] = map[string]any{}
+		}
+		chunk["choices"] = []any{choice}
+		objects = append(objects, chunk)
+	case last["candidates"] != nil:
+		chunk := map[string]any{
+			"candidates": []any{map[string]any{
+				"index": 0,
+				"content": map[string]any{
+					"role":  "model",
+					"parts": []any{map[string]any{"text": ""}},
+				},
+				"finishReason": "SAFETY",
+			}},
+		}
+		for _, key := range []string{"usageMetadata", "modelVersion"} {
+			if value, ok := last[key]; ok {
+				chunk[key] = value
+			}
+		}
+		objects = append(objects, chunk)
+	case strings.HasPrefix(eventType, "response."):
+		response := map[string]any{"object": "response"}
+		for key, value := range f.response {
+			response[key] = value
+		}
+		response["status"] = "incomplete"
+		response["incomplete_details"] = map[string]any{"reason": constant.FinishReasonContentFilter}
+		objects = append(objects, map[string]any{"type": "response.incomplete", "response": response})
+	case strings.HasPrefix(eventType, "message_") || strings.HasPrefix(eventType, "content_block_") || eventType == "ping":
+		if eventType == "content_block_start" || eventType == "content_block_delta" {
+			objects = append(objects, map[string]any{"type": "content_block_stop", "index": last["index"]})
+		}
+		// output_tokens 为 0 时按已下发的文本计算用量
+		objects = append(objects,
+			map[string]any{
+				"type":  "message_delta",
+				"delta": map[string]any{"stop_reason": "refusal", "stop_sequence": nil},
+				"usage": map[string]any{"output_tokens": 0},
+			},
+			map[string]any{"type": "message_stop"},
+		)
+	}
+	data := make([]string, 0, len(objects))
+	for _, object := range objects {
+		if encoded, err := encodeCompletionJson(object); err == nil {
+			data = append(data, string(encoded))
+		}
+	}
+	return data
+}
+
+// SensitiveResponseWriter 缓冲非流式响应，检查其中的生成文本后再写回客户端，流式响应直接透传
+type SensitiveResponseWriter struct {
+	gin.ResponseWriter
+	c       *gin.Context
+	info    *relaycommon.RelayInfo
+	machine *goahocorasick.Machine
+	buffer  bytes.Buffer
+	status  int
+}
+
+func (w *SensitiveResponseWriter) isStream() bool {
+	return strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+}
+
+func (w *SensitiveResponseWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+	if w.isStream() {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *SensitiveResponseWriter) WriteHeaderNow() {
+	if w.isStream() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *SensitiveResponseWriter) Write(data []byte) (int, error) {
+	if w.isStream() {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.buffer.Write(data)
+}
+
+func (w *SensitiveResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *SensitiveResponseWriter) Flush() {
+	if w.isStream() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// Finish 恢复原来的 writer，检查并写出缓冲的响应
+func (w *SensitiveResponseWriter) Finish() {
+	if w == nil {
+		return
+	}
+	w.c.Writer = w.ResponseWriter
+	if w.info.IsStream {
+		w.c.Set(constant.ContextKeyStreamDataFilter, nil)
+	}
+	if w.buffer.Len() == 0 {
+		return
+	}
+	body := w.buffer.Bytes()
+	if w.status == http.StatusOK {
+		if object := decodeCompletionJson(body); object != nil {
+			refs := collectCompletionTexts(object, nil)
+			stop := setting.StopOnSensitiveEnabled
+			if words := checkCompletionTexts(w.machine, refs, !stop); len(words) > 0 {
+				recordCompletionSensitive(w.c, w.info, words, stop)
+				if stop {
+					blockCompletionObject(object)
+				}
+				if encoded, err := encodeCompletionJson(object); err == nil {
+					body = encoded
+				}
+			}
+		}
+	}
+	if w.Header().Get("Content-Length") != "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(body)
+}
@@ -18,6 +18,12 @@ package service
 
 import (
 	"veloera/dto"
+	relaycommon "veloera/relay/common"
+)
+
+const (
+	UsageSourceUpstream  = "upstream"
+	UsageSourceEstimated = "estimated"
 )
 
 //func GetPromptTokens(textRequest dto.GeneralOpenAIRequest, relayMode int) (int, error) {
@@ -44,3 +50,30 @@ func ResponseText2Usage(responseText string, modeName string, promptTokens int)
 func ValidUsage(usage *dto.Usage) bool {
 	return usage != nil && (usage.PromptTokens != 0 || usage.CompletionTokens != 0)
 }
+
+// SettleStreamUsage 结算流式响应的 usage，上游未返回 usage 或 usage 明显异常时，
+// 使用已下发的文本（含推理内容与工具调用参数）按模型 tokenizer 估算补全 tokens
+func SettleStreamUsage(info *relaycommon.RelayInfo, usage *dto.Usage, responseText string, toolCount int) *dto.Usage {
+	if usage == nil {
+		usage = &dto.Usage{}
+	}
+	estimated := false
+	if usage.PromptTokens == 0 && info.PromptTokens > 0 {
+		usage.PromptTokens = info.PromptTokens
+		estimated = true
+	}
+	if usage.CompletionTokens == 0 && (responseText != "" || toolCount > 0) {
+		completionTokens, _ := CountTextToken(responseText, info.UpstreamModelName)
+		usage.CompletionTokens = completionTokens + toolCount*7
+		estimated = true
+	}
+	if estimated || usage.TotalTokens < usage.PromptTokens+usage.CompletionTokens {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	if estimated {
+		info.UsageSource = UsageSourceEstimated
+	} else {
+		info.UsageSource = UsageSourceUpstream
+	}
+	return usage
+}
@@ -0,0 +1,372 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/dto"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// 并发计数在 Redis 中的兜底过期时间，防止实例异常退出后计数无法归还
+const usageLimitConcurrencyExpiration = time.Hour
+
+type usageLimitWindow struct {
+	name    string
+	label   string
+	seconds int64
+}
+
+var usageLimitWindows = []usageLimitWindow{
+	{name: "tpm", label: "tokens per min (TPM)", seconds: 60},
+	{name: "tpd", label: "tokens per day (TPD)", seconds: 24 * 60 * 60},
+}
+
+type usageLimitRule struct {
+	scope string
+	key   string
+	limit operation_setting.UsageLimit
+}
+
+func (r usageLimitRule) windowLimit(window usageLimitWindow) int64 {
+	switch window.name {
+	case "tpm":
+		return int64(r.limit.TPM)
+	case "tpd":
+		return int64(r.limit.TPD)
+	}
+	return 0
+}
+
+// usageLimitState 单个请求的限流状态，记录已占用的并发名额和按 prompt tokens 预占的用量
+type usageLimitState struct {
+	mutex    sync.Mutex
+	rules    []usageLimitRule
+	acquired []string
+	reserved int64
+	settled  bool
+}
+
+var usageLimitMemory = struct {
+	sync.Mutex
+	counters map[string]*usageLimitCounter
+	inflight map[string]int
+}{
+	counters: make(map[string]*usageLimitCounter),
+	inflight: make(map[string]int),
+}
+
+type usageLimitCounter struct {
+	windowStart int64
+	used        int64
+}
+
+func buildUsageLimitRules(c *gin.Context) []usageLimitRule {
+	var rules []usageLimitRule
+	userId := strconv.Itoa(c.GetInt("id"))
+	tokenLimit := operation_setting.UsageLimit{
+		TPM:            c.GetInt("token_tpm_limit"),
+		TPD:            c.GetInt("token_tpd_limit"),
+		MaxConcurrency: c.GetInt("token_max_concurrency"),
+	}
+	if !tokenLimit.IsEmpty() {
+		rules = append(rules, usageLimitRule{
+			scope: "token",
+			key:   "token:" + strconv.Itoa(c.GetInt("token_id")),
+			limit: tokenLimit,
+		})
+	}
+	group := c.GetString("group")
+	if limit, ok := operation_setting.GetGroupUsageLimit(group); ok {
+		rules = append(rules, usageLimitRule{
+			scope: "group",
+			key:   "group:" + group + ":" + userId,
+			limit: limit,
+		})
+	}
+	modelName := c.GetString("original_model")
+	if limit, ok := operation_setting.GetModelUsageLimit(modelName); ok {
+		rules = append(rules, usageLimitRule{
+			scope: "model",
+			key:   "model:" + modelName + ":" + userId,
+			limit: limit,
+		})
+	}
+	return rules
+}
+
+func getUsageLimitState(c *gin.Context) *usageLimitState {
+	value, ok := c.Get(constant.ContextKeyUsageLimit)
+	if !ok {
+		return nil
+	}
+	state, _ := value.(*usageLimitState)
+	return state
+}
+
+// AcquireUsageLimit 检查当前窗口内的 token 用量并占用并发名额，
+// 成功后需要在请求结束时调用 ReleaseUsageLimit
+func AcquireUsageLimit(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
+	rules := buildUsageLimitRules(c)
+	if len(rules) == 0 {
+		return nil
+	}
+	state := &usageLimitState{rules: rules}
+	c.Set(constant.ContextKeyUsageLimit, state)
+
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if openaiErr := state.checkTokens(c, 0); openaiErr != nil {
+		return openaiErr
+	}
+	for _, rule := range rules {
+		if rule.limit.MaxConcurrency <= 0 {
+			continue
+		}
+		key := "usageLimit:concurrency:" + rule.key
+		ok, err := acquireUsageConcurrency(key, rule.limit.MaxConcurrency)
+		if err != nil {
+			return OpenAIErrorWrapperLocal(err, "usage_limit_check_failed", http.StatusInternalServerError)
+		}
+		if !ok {
+			return usageLimitError(fmt.Sprintf("Rate limit reached for concurrent requests on %s: Limit %d.",
+				rule.scope, rule.limit.MaxConcurrency), "requests")
+		}
+		state.acquired = append(state.acquired, key)
+	}
+	return nil
+}
+
+// ReserveUsageLimitTokens 按 prompt tokens 预占用量，重试时不会重复预占
+func ReserveUsageLimitTokens(c *gin.Context, promptTokens int) *dto.OpenAIErrorWithStatusCode {
+	state := getUsageLimitState(c)
+	if state == nil || promptTokens <= 0 {
+		return nil
+	}
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if state.reserved > 0 || state.settled {
+		return nil
+	}
+	if openaiErr := state.checkTokens(c, int64(promptTokens)); openaiErr != nil {
+		return openaiErr
+	}
+	state.addUsage(int64(promptTokens))
+	state.reserved = int64(promptTokens)
+	return nil
+}
+
+// SettleUsageLimitTokens 结算时按实际用量修正预占的 token 数
+func SettleUsageLimitTokens(c *gin.Context, totalTokens int) {
+	state := getUsageLimitState(c)
+	if state == nil {
+		return
+	}
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if state.settled {
+		return
+	}
+	state.addUsage(int64(totalTokens) - state.reserved)
+	state.reserved = 0
+	state.settled = true
+}
+
+// ReleaseUsageLimit 归还并发名额，未结算的请求会退回预占的 token 数
+func ReleaseUsageLimit(c *gin.Context) {
+	state := getUsageLimitState(c)
+	if state == nil {
+		return
+	}
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if !state.settled && state.reserved > 0 {
+		state.addUsage(-state.reserved)
+		state.reserved = 0
+	}
+	for _, key := range state.acquired {
+		releaseUsageConcurrency(key)
+	}
+	state.acquired = nil
+}
+
+// checkTokens 检查加上 requested 后是否超出各窗口的限制，并设置 x-ratelimit-* 响应头
+func (s *usageLimitState) checkTokens(c *gin.Context, requested int64) *dto.OpenAIErrorWithStatusCode {
+	headerSet := false
+	var minRemaining int64
+	for _, rule := range s.rules {
+		for _, window := range usageLimitWindows {
+			limit := rule.windowLimit(window)
+			if limit <= 0 {
+				continue
+			}
+			used, reset, err := getUsageLimitUsage(usageLimitCounterKey(rule, window), window)
+			if err != nil {
+				return OpenAIErrorWrapperLocal(err, "usage_limit_check_failed", http.StatusInternalServerError)
+			}
+			remaining := limit - used - requested
+			if remaining < 0 {
+				remaining = 0
+			}
+			if !headerSet || remaining < minRemaining {
+				headerSet = true
+				minRemaining = remaining
+				setUsageLimitHeaders(c, limit, remaining, reset)
+			}
+			if used >= limit || used+requested > limit {
+				return usageLimitError(fmt.Sprintf("Rate limit reached for %s on %s: Limit %d, Used %d, Requested %d. Please try again in %s.",
+					window.label, rule.scope, limit, used, requested, reset), "tokens")
+			}
+		}
+	}
+	return nil
+}
+
+func (s *usageLimitState) addUsage(delta int64) {
+	if delta == 0 {
+		return
+	}
+	for _, rule := range s.rules {
+		for _, window := range usageLimitWindows {
+			if rule.windowLimit(window) <= 0 {
+				continue
+			}
+			if err := addUsageLimitUsage(usageLimitCounterKey(rule, window), window, delta); err != nil {
+				common.SysError("failed to record usage limit: " + err.Error())
+			}
+		}
+	}
+}
+
+func usageLimitCounterKey(rule usageLimitRule, window usageLimitWindow) string {
+	return "usageLimit:" + window.name + ":" + rule.key
+}
+
+func usageLimitWindowStart(window usageLimitWindow) (int64, time.Duration) {
+	now := time.Now().Unix()
+	start := now - now%window.seconds
+	return start, time.Duration(start+window.seconds-now) * time.Second
+}
+
+func getUsageLimitUsage(key string, window usageLimitWindow) (int64, time.Duration, error) {
+	start, reset := usageLimitWindowStart(window)
+	if common.RedisEnabled {
+		used, err := common.RDB.Get(context.Background(), fmt.Sprintf("%s:%d", key, start)).Int64()
+		if errors.Is(err, redis.Nil) {
+			return 0, reset, nil
+		}
+		return used, reset, err
+	}
+	usageLimitMemory.Lock()
+	defer usageLimitMemory.Unlock()
+	counter, ok := usageLimitMemory.counters[key]
+	if !ok || counter.windowStart != start {
+		return 0, reset, nil
+	}
+	return counter.used, reset, nil
+}
+
+func addUsageLimitUsage(key string, window usageLimitWindow, delta int64) error {
+	start, reset := usageLimitWindowStart(window)
+	if common.RedisEnabled {
+		ctx := context.Background()
+		redisKey := fmt.Sprintf("%s:%d", key, start)
+		if err := common.RDB.IncrBy(ctx, redisKey, delta).Err(); err != nil {
+			return err
+		}
+		return common.RDB.Expire(ctx, redisKey, reset+time.Minute).Err()
+	}
+	usageLimitMemory.Lock()
+	defer usageLimitMemory.Unlock()
+	counter, ok := usageLimitMemory.counters[key]
+	if !ok || counter.windowStart != start {
+		counter = &usageLimitCounter{windowStart: start}
+		usageLimitMemory.counters[key] = counter
+	}
+	counter.used += delta
+	if counter.used < 0 {
+		counter.used = 0
+	}
+	return nil
+}
+
+func acquireUsageConcurrency(key string, maxConcurrency int) (bool, error) {
+	if common.RedisEnabled {
+		ctx := context.Background()
+		count, err := common.RDB.Incr(ctx, key).Result()
+		if err != nil {
+			return false, err
+		}
+		common.RDB.Expire(ctx, key, usageLimitConcurrencyExpiration)
+		if count > int64(maxConcurrency) {
+			common.RDB.Decr(ctx, key)
+			return false, nil
+		}
+		return true, nil
+	}
+	usageLimitMemory.Lock()
+	defer usageLimitMemory.Unlock()
+	if usageLimitMemory.inflight[key] >= maxConcurrency {
+		return false, nil
+	}
+	usageLimitMemory.inflight[key]++
+	return true, nil
+}
+
+func releaseUsageConcurrency(key string) {
+	if common.RedisEnabled {
+		if err := common.RDB.Decr(context.Background(), key).Err(); err != nil {
+			common.SysError("failed to release usage concurrency: " + err.Error())
+		}
+		return
+	}
+	usageLimitMemory.Lock()
+	defer usageLimitMemory.Unlock()
+	usageLimitMemory.inflight[key]--
+	if usageLimitMemory.inflight[key] <= 0 {
+		delete(usageLimitMemory.inflight, key)
+	}
+}
+
+func setUsageLimitHeaders(c *gin.Context, limit int64, remaining int64, reset time.Duration) {
+	c.Header("x-ratelimit-limit-tokens", strconv.FormatInt(limit, 10))
+	c.Header("x-ratelimit-remaining-tokens", strconv.FormatInt(remaining, 10))
+	c.Header("x-ratelimit-reset-tokens", reset.String())
+}
+
+func usageLimitError(message string, errType string) *dto.OpenAIErrorWithStatusCode {
+	return &dto.OpenAIErrorWithStatusCode{
+		Error: dto.OpenAIError{
+			Message: message,
+			Type:    errType,
+			Code:    "rate_limit_exceeded",
+		},
+		StatusCode: http.StatusTooManyRequests,
+		LocalError: true,
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"veloera/common"
+	"veloera/dto"
+	"veloera/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// GetVideoRequest 解析视频生成请求，multipart 请求可以通过 input_reference 上传参考图片
+func GetVideoRequest(c *gin.Context) (*dto.VideoRequest, error) {
+	if request, ok := c.Get("task_request"); ok {
+		if videoRequest, ok := request.(*dto.VideoRequest); ok {
+			return videoRequest, nil
+		}
+	}
+	videoRequest := &dto.VideoRequest{}
+	if strings.HasPrefix(c.Request.Header.Get("Content-Type"), "multipart/form-data") {
+		form, err := c.MultipartForm()
+		if err != nil {
+			return nil, fmt.Errorf("parse multipart form failed: %w", err)
+		}
+		formValue := func(key string) string {
+			if values := form.Value[key]; len(values) > 0 {
+				return values[0]
+			}
+			return ""
+		}
+		videoRequest.Model = formValue("model")
+		videoRequest.Prompt = formValue("prompt")
+		videoRequest.NegativePrompt = formValue("negative_prompt")
+		videoRequest.Seconds = json.Number(formValue("seconds"))
+		videoRequest.Size = formValue("size")
+		videoRequest.Image = formValue("image")
+		if files := form.File["input_reference"]; len(files) > 0 {
+			videoRequest.InputReference, err = ReadImageFile(files[0])
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		if err := common.UnmarshalBodyReusable(c, videoRequest); err != nil {
+			return nil, err
+		}
+	}
+	if videoRequest.Prompt == "" && !videoRequest.HasImage() {
+		return nil, errors.New("prompt is required")
+	}
+	if _, err := videoRequest.GetSeconds(0); err != nil {
+		return nil, err
+	}
+	c.Set("task_request", videoRequest)
+	return videoRequest, nil
+}
+
+// GetVideoReferenceImage 获取图生视频的参考图片，image 字段可以是 url 或 base64
+func GetVideoReferenceImage(request *dto.VideoRequest) (*dto.ImageFile, error) {
+	if request.InputReference != nil {
+		return request.InputReference, nil
+	}
+	var mimeType, data string
+	var err error
+	if strings.HasPrefix(request.Image, "http://") || strings.HasPrefix(request.Image, "https://") {
+		mimeType, data, err = GetImageFromUrl(request.Image)
+	} else {
+		mimeType, data, err = DecodeBase64FileData(request.Image)
+	}
+	if err != nil {
+		return nil, err
+	}
+	imageData, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode image failed: %w", err)
+	}
+	return &dto.ImageFile{
+		Filename: "reference." + strings.TrimPrefix(mimeType, "image/"),
+		MimeType: mimeType,
+		Data:     imageData,
+	}, nil
+}
+
+// GetVideoCachePath 获取任务结果在本地缓存中的路径
+func GetVideoCachePath(taskID string) string {
+	// 任务 id 来自上游，去掉路径分隔符避免写出缓存目录
+	name := strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(taskID)
+	return filepath.Join(operation_setting.GetVideoSetting().CacheDir, name+".mp4")
+}
+
+// SaveVideoCache 将任务结果写入本地缓存，超过大小限制时放弃缓存
+func SaveVideoCache(taskID string, body io.Reader) (string, error) {
+	videoSetting := operation_setting.GetVideoSetting()
+	if err := os.MkdirAll(videoSetting.CacheDir, 0755); err != nil {
+		return "", err
+	}
+	path := GetVideoCachePath(taskID)
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return "", err
+	}
+	maxSize := videoSetting.MaxCacheSize * 1024 * 1024
+	written, err := io.Copy(file, io.LimitReader(body, maxSize+1))
+	_ = file.Close()
+	if err == nil && written > maxSize {
+		err = fmt.Errorf("video is larger than %d MB", videoSetting.MaxCacheSize)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return "", err
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", err
+	}
+	return path, nil
+}
+
+// StartVideoCacheCleanup 定期清理视频结果缓存，删除超过保留天数的文件，并把缓存目录控制在总大小上限以内
+// 缓存文件被删除后，下载请求会回退到上游地址
+func StartVideoCacheCleanup() {
+	gopool.Go(func() {
+		for {
+			count, err := CleanupVideoCache(time.Now())
+			if err != nil {
+				common.SysError("failed to clean up video cache: " + err.Error())
+			} else if count > 0 {
+				common.SysLog(fmt.Sprintf("cleaned up %d cached videos", count))
+			}
+			time.Sleep(time.Hour)
+		}
+	})
+}
+
+// CleanupVideoCache 按保留天数与总大小上限清理缓存目录，返回删除的文件数
+func CleanupVideoCache(now time.Time) (int, error) {
+	videoSetting := operation_setting.GetVideoSetting()
+	entries, err := os.ReadDir(videoSetting.CacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	type cacheFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cacheFile
+	var totalSize int64
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, cacheFile{
+			path:    filepath.Join(videoSetting.CacheDir, entry.Name()),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		totalSize += info.Size()
+	}
+	// 从最早的文件开始清理
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	expireBefore := now.Add(-time.Duration(videoSetting.CacheRetentionDays) * 24 * time.Hour)
+	maxTotalSize := videoSetting.MaxCacheTotalSize * 1024 * 1024
+	count := 0
+	for _, file := range files {
+		expired := videoSetting.CacheRetentionDays > 0 && file.modTime.Before(expireBefore)
+		oversize := maxTotalSize > 0 && totalSize > maxTotalSize
+		if !expired && !oversize {
+			break
+		}
+		// 正在写入的临时文件只按保留天数清理
+		if !expired && strings.HasSuffix(file.path, ".tmp") {
+			continue
+		}
+		if err := os.Remove(file.path); err != nil {
+			common.SysError("failed to remove cached video: " + err.Error())
+			continue
+		}
+		totalSize -= file.size
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"veloera/setting/operation_setting"
+)
+
+// 过期文件与超出总大小上限的最早文件会被清理
+func TestCleanupVideoCache(t *testing.T) {
+	videoSetting := operation_setting.GetVideoSetting()
+	old := *videoSetting
+	t.Cleanup(func() { *videoSetting = old })
+	videoSetting.CacheDir = t.TempDir()
+	videoSetting.CacheRetentionDays = 7
+	videoSetting.MaxCacheTotalSize = 1
+
+	now := time.Now()
+	files := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{"expired.mp4", 1, 8 * 24 * time.Hour},
+		{"oldest.mp4", 512 * 1024, 3 * time.Hour},
+		{"middle.mp4", 512 * 1024, 2 * time.Hour},
+		{"newest.mp4", 512 * 1024, time.Hour},
+	}
+	for _, file := range files {
+		path := filepath.Join(videoSetting.CacheDir, file.name)
+		if err := os.WriteFile(path, make([]byte, file.size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(-file.age)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count, err := CleanupVideoCache(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("removed %d files, want 2", count)
+	}
+	for name, want := range map[string]bool{"expired.mp4": false, "oldest.mp4": false, "middle.mp4": true, "newest.mp4": true} {
+		_, err := os.Stat(filepath.Join(videoSetting.CacheDir, name))
+		if exists := err == nil; exists != want {
+			t.Errorf("%s exists = %v, want %v", name, exists, want)
+		}
+	}
+}
@@ -17,6 +17,9 @@
 package model_setting
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"veloera/setting/config"
 )
 
@@ -28,6 +31,8 @@ type GlobalSettings struct {
 	RateLimitExemptGroup         string `json:"rate_limit_exempt_group"`
 	SafeCheckExemptEnabled       bool   `json:"safe_check_exempt_enabled"`
 	SafeCheckExemptGroup         string `json:"safe_check_exempt_group"`
+	// ModelFallbacks 模型降级链，模型的所有渠道都失败后依次尝试列表中的模型
+	ModelFallbacks map[string][]string `json:"model_fallbacks"`
 }
 
 // 默认配置
@@ -39,6 +44,7 @@ var defaultOpenaiSettings = GlobalSettings{
 	RateLimitExemptGroup:         "bulk-ok",
 	SafeCheckExemptEnabled:       false,
 	SafeCheckExemptGroup:         "nsfw-ok",
+	ModelFallbacks:               map[string][]string{},
 }
 
 // 全局实例
@@ -60,3 +66,75 @@ func ShouldBypassRateLimit(group string) bool {
 func ShouldBypassSafeCheck(group string) bool {
 	return globalSettings.SafeCheckExemptEnabled && group == globalSettings.SafeCheckExemptGroup
 }
+
+// GetModelFallbacks 返回 requestModel 的降级链
+func GetModelFallbacks(requestModel string) []string {
+	return globalSettings.ModelFallbacks[requestModel]
+}
+
+// GetNextFallbackModel 返回降级链中 currentModel 之后的模型，没有时返回空字符串
+func GetNextFallbackModel(requestModel string, currentModel string) string {
+	chain := globalSettings.ModelFallbacks[requestModel]
+	if currentModel == requestModel {
+		if len(chain) > 0 {
+			return chain[0]
+		}
+		return ""
+	}
+	for i, fallbackModel := range chain {
+		if fallbackModel == currentModel && i+1 < len(chain) {
+			return chain[i+1]
+		}
+	}
+	return ""
+}
+
+// CheckModelFallbacks 校验降级链配置：链中不能包含请求模型本身、不能有重复或空的模型，各降级链之间也不能形成环
+func CheckModelFallbacks(jsonStr string) error {
+	fallbacks := make(map[string][]string)
+	if strings.TrimSpace(jsonStr) == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &fallbacks); err != nil {
+		return err
+	}
+	for requestModel, chain := range fallbacks {
+		seen := make(map[string]bool, len(chain))
+		for _, fallbackModel := range chain {
+			switch {
+			case fallbackModel == "":
+				return fmt.Errorf("模型 %s 的降级链包含空模型名", requestModel)
+			case fallbackModel == requestModel:
+				return fmt.Errorf("模型 %s 的降级链不能包含自身", requestModel)
+			case seen[fallbackModel]:
+				return fmt.Errorf("模型 %s 的降级链中 %s 重复", requestModel, fallbackModel)
+			}
+			seen[fallbackModel] = true
+		}
+	}
+	// 0 未访问，1 访问中，2 已完成；访问中的模型再次被访问说明存在环
+	state := make(map[string]int, len(fallbacks))
+	var visit func(model string) error
+	visit = func(model string) error {
+		switch state[model] {
+		case 1:
+			return fmt.Errorf("模型 %s 的降级链形成了循环", model)
+		case 2:
+			return nil
+		}
+		state[model] = 1
+		for _, fallbackModel := range fallbacks[model] {
+			if err := visit(fallbackModel); err != nil {
+				return err
+			}
+		}
+		state[model] = 2
+		return nil
+	}
+	for model := range fallbacks {
+		if err := visit(model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
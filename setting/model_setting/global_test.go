@@ -0,0 +1,41 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package model_setting
+
+import "testing"
+
+func TestCheckModelFallbacks(t *testing.T) {
+	cases := []struct {
+		value string
+		valid bool
+	}{
+		{``, true},
+		{`{"gpt-4o":["gpt-4o-mini","gpt-4.1-mini"]}`, true},
+		{`{"gpt-4o":["gpt-4o-mini"],"gpt-4o-mini":["gpt-4.1-mini"]}`, true},
+		{`{"gpt-4o":["gpt-4o"]}`, false},
+		{`{"gpt-4o":["gpt-4o-mini","gpt-4o-mini"]}`, false},
+		{`{"gpt-4o":[""]}`, false},
+		{`{"a":["b"],"b":["c"],"c":["a"]}`, false},
+		{`not json`, false},
+	}
+	for _, tc := range cases {
+		err := CheckModelFallbacks(tc.value)
+		if (err == nil) != tc.valid {
+			t.Errorf("CheckModelFallbacks(%q) error = %v, want valid = %v", tc.value, err, tc.valid)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package operation_setting
+
+import "veloera/setting/config"
+
+type BatchSetting struct {
+	// DiscountRatio 批处理请求的计费倍率，与分组倍率相乘
+	DiscountRatio float64 `json:"discount_ratio"`
+	// Concurrency 单个批处理任务同时执行的请求数
+	Concurrency int `json:"concurrency"`
+	// MaxRequests 单个批处理任务允许的最大请求数
+	MaxRequests int `json:"max_requests"`
+}
+
+// 默认配置
+var batchSetting = BatchSetting{
+	DiscountRatio: 0.5,
+	Concurrency:   4,
+	MaxRequests:   50000,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("batch_setting", &batchSetting)
+}
+
+func GetBatchSetting() *BatchSetting {
+	return &batchSetting
+}
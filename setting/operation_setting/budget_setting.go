@@ -0,0 +1,57 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package operation_setting
+
+import "veloera/setting/config"
+
+// Budget 按自然日/周/月重置的消费上限，单位为额度，0 表示不限制
+type Budget struct {
+	Daily   int `json:"daily"`
+	Weekly  int `json:"weekly"`
+	Monthly int `json:"monthly"`
+}
+
+func (b Budget) IsEmpty() bool {
+	return b.Daily <= 0 && b.Weekly <= 0 && b.Monthly <= 0
+}
+
+type BudgetSetting struct {
+	// GroupBudgets 按用户分组配置，分组内所有用户共享同一份预算
+	GroupBudgets map[string]Budget `json:"group_budgets"`
+	// AlertThresholds 预算使用比例达到这些百分比时发送提醒
+	AlertThresholds []int `json:"alert_thresholds"`
+}
+
+// 默认配置
+var budgetSetting = BudgetSetting{
+	GroupBudgets:    map[string]Budget{},
+	AlertThresholds: []int{50, 80, 100},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("budget_setting", &budgetSetting)
+}
+
+func GetBudgetSetting() *BudgetSetting {
+	return &budgetSetting
+}
+
+func GetGroupBudget(group string) (Budget, bool) {
+	budget, ok := budgetSetting.GroupBudgets[group]
+	return budget, ok && !budget.IsEmpty()
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package operation_setting
+
+import "veloera/setting/config"
+
+type ChannelHealthSetting struct {
+	// Enabled 是否根据渠道健康度选择渠道并启用熔断
+	Enabled bool `json:"enabled"`
+	// WindowSeconds 统计健康度的滑动窗口长度
+	WindowSeconds int `json:"window_seconds"`
+	// MinRequests 窗口内请求数达到该值后才会按错误率熔断
+	MinRequests int `json:"min_requests"`
+	// ErrorRateThreshold 窗口内错误率达到该值时熔断
+	ErrorRateThreshold float64 `json:"error_rate_threshold"`
+	// ConsecutiveFailures 连续失败达到该次数时熔断
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	// RateLimitPenalty 429 错误在计算错误率时的权重
+	RateLimitPenalty float64 `json:"rate_limit_penalty"`
+	// OpenSeconds 熔断后首次探测前的等待时间，再次熔断时翻倍
+	OpenSeconds int `json:"open_seconds"`
+	// MaxOpenSeconds 熔断等待时间的上限
+	MaxOpenSeconds int `json:"max_open_seconds"`
+	// HalfOpenProbes 半开状态下同时放行的探测请求数
+	HalfOpenProbes int `json:"half_open_probes"`
+	// HalfOpenSuccesses 半开状态下连续成功该次数后恢复
+	HalfOpenSuccesses int `json:"half_open_successes"`
+	// SlowLatencyMs 平均延迟超过该值时按比例降低健康分，0 表示不考虑延迟
+	SlowLatencyMs int `json:"slow_latency_ms"`
+	// KeyCooldownSeconds 多 key 渠道中的 key 返回 429 后暂停使用的时间
+	KeyCooldownSeconds int `json:"key_cooldown_seconds"`
+}
+
+// 默认配置
+var channelHealthSetting = ChannelHealthSetting{
+	Enabled:             false,
+	WindowSeconds:       60,
+	MinRequests:         10,
+	ErrorRateThreshold:  0.5,
+	ConsecutiveFailures: 5,
+	RateLimitPenalty:    0.5,
+	OpenSeconds:         30,
+	MaxOpenSeconds:      600,
+	HalfOpenProbes:      1,
+	HalfOpenSuccesses:   2,
+	SlowLatencyMs:       0,
+	KeyCooldownSeconds:  60,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_health_setting", &channelHealthSetting)
+}
+
+func GetChannelHealthSetting() *ChannelHealthSetting {
+	return &channelHealthSetting
+}
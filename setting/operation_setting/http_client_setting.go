@@ -0,0 +1,59 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package operation_setting
+
+import "veloera/setting/config"
+
+type HttpClientSetting struct {
+	// MaxIdleConns 所有上游主机共享的最大空闲连接数
+	MaxIdleConns int `json:"max_idle_conns"`
+	// MaxIdleConnsPerHost 每个上游主机的最大空闲连接数
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host"`
+	// MaxConnsPerHost 每个上游主机的最大连接数，0 表示不限制
+	MaxConnsPerHost int `json:"max_conns_per_host"`
+	// IdleConnTimeout 空闲连接的保持时间（秒）
+	IdleConnTimeout int `json:"idle_conn_timeout"`
+	// DialTimeout 建立 TCP 连接的超时时间（秒）
+	DialTimeout int `json:"dial_timeout"`
+	// TLSHandshakeTimeout TLS 握手的超时时间（秒）
+	TLSHandshakeTimeout int `json:"tls_handshake_timeout"`
+	// ResponseHeaderTimeout 等待上游响应头的超时时间（秒），0 表示不限制
+	ResponseHeaderTimeout int `json:"response_header_timeout"`
+	// HTTP2Enabled 是否尝试使用 HTTP/2 连接上游
+	HTTP2Enabled bool `json:"http2_enabled"`
+}
+
+// 默认配置
+var httpClientSetting = HttpClientSetting{
+	MaxIdleConns:          500,
+	MaxIdleConnsPerHost:   100,
+	MaxConnsPerHost:       0,
+	IdleConnTimeout:       90,
+	DialTimeout:           30,
+	TLSHandshakeTimeout:   10,
+	ResponseHeaderTimeout: 0,
+	HTTP2Enabled:          true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("http_client_setting", &httpClientSetting)
+}
+
+func GetHttpClientSetting() *HttpClientSetting {
+	return &httpClientSetting
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package operation_setting
+
+import "veloera/setting/config"
+
+// ImagePriceSetting 图片请求按尺寸与品质调整单张价格，模型名 "*" 的配置对所有模型生效
+type ImagePriceSetting struct {
+	// SizeRatios 模型 -> 尺寸 -> 价格倍率
+	SizeRatios map[string]map[string]float64 `json:"size_ratios"`
+	// QualityRatios 模型 -> 品质 -> 价格倍率，键也可以写作 "品质@尺寸" 以单独配置某个尺寸
+	QualityRatios map[string]map[string]float64 `json:"quality_ratios"`
+}
+
+// 默认配置
+var imagePriceSetting = ImagePriceSetting{
+	SizeRatios: map[string]map[string]float64{
+		"*": {
+			"256x256":   0.4,
+			"512x512":   0.45,
+			"1024x1024": 1,
+			"1024x1792": 2,
+			"1792x1024": 2,
+		},
+		"gpt-image-1": {
+			"1024x1024": 1,
+			"1024x1536": 1.5,
+			"1536x1024": 1.5,
+		},
+	},
+	QualityRatios: map[string]map[string]float64{
+		"dall-e-3": {
+			"hd":           2,
+			"hd@1024x1792": 1.5,
+			"hd@1792x1024": 1.5,
+		},
+		"gpt-image-1": {
+			"low":    0.25,
+			"medium": 1,
+			"high":   4,
+		},
+	},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("image_price_setting", &imagePriceSetting)
+}
+
+func GetImagePriceSetting() *ImagePriceSetting {
+	return &imagePriceSetting
+}
+
+// GetImageSizeRatio 返回模型在指定尺寸下的价格倍率，未配置时为 1
+func GetImageSizeRatio(modelName, size string) float64 {
+	for _, name := range []string{modelName, "*"} {
+		if ratio, ok := imagePriceSetting.SizeRatios[name][size]; ok {
+			return ratio
+		}
+	}
+	return 1
+}
+
+// GetImageQualityRatio 返回模型在指定品质与尺寸下的价格倍率，未配置时为 1
+func GetImageQualityRatio(modelName, quality, size string) float64 {
+	for _, name := range []string{modelName, "*"} {
+		ratios := imagePriceSetting.QualityRatios[name]
+		if ratio, ok := ratios[quality+"@"+size]; ok {
+			return ratio
+		}
+		if ratio, ok := ratios[quality]; ok {
+			return ratio
+		}
+	}
+	return 1
+}
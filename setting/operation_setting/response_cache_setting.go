@@ -0,0 +1,64 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package operation_setting
+
+import (
+	"slices"
+	"veloera/setting/config"
+)
+
+type ResponseCacheSetting struct {
+	// Enabled 响应缓存总开关，开启后仍需令牌或分组启用才会生效
+	Enabled bool `json:"enabled"`
+	// EnabledGroups 对该分组下的所有令牌启用缓存
+	EnabledGroups []string `json:"enabled_groups"`
+	// TTLSeconds 缓存有效期
+	TTLSeconds int `json:"ttl_seconds"`
+	// BillingRatio 命中缓存时的计费倍率，与分组倍率相乘
+	BillingRatio float64 `json:"billing_ratio"`
+	// MaxEntries 未启用 Redis 时内存 LRU 缓存的最大条目数
+	MaxEntries int `json:"max_entries"`
+	// MaxBodyKB 超过该大小的响应不缓存
+	MaxBodyKB int `json:"max_body_kb"`
+}
+
+// 默认配置
+var responseCacheSetting = ResponseCacheSetting{
+	Enabled:       false,
+	EnabledGroups: []string{},
+	TTLSeconds:    3600,
+	BillingRatio:  0.1,
+	MaxEntries:    1000,
+	MaxBodyKB:     1024,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("response_cache_setting", &responseCacheSetting)
+}
+
+func GetResponseCacheSetting() *ResponseCacheSetting {
+	return &responseCacheSetting
+}
+
+// ShouldUseResponseCache 令牌显式启用或所属分组启用时使用响应缓存
+func ShouldUseResponseCache(tokenEnabled bool, group string) bool {
+	if !responseCacheSetting.Enabled {
+		return false
+	}
+	return tokenEnabled || slices.Contains(responseCacheSetting.EnabledGroups, group)
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package operation_setting
+
+import "veloera/setting/config"
+
+// UsageLimit token 用量与并发限制，0 表示不限制
+type UsageLimit struct {
+	// TPM 每分钟 token 数上限
+	TPM int `json:"tpm"`
+	// TPD 每天 token 数上限
+	TPD int `json:"tpd"`
+	// MaxConcurrency 同时进行中的请求数上限
+	MaxConcurrency int `json:"max_concurrency"`
+}
+
+func (l UsageLimit) IsEmpty() bool {
+	return l.TPM <= 0 && l.TPD <= 0 && l.MaxConcurrency <= 0
+}
+
+type UsageLimitSetting struct {
+	// GroupLimits 按用户分组配置，分组内每个用户单独计数
+	GroupLimits map[string]UsageLimit `json:"group_limits"`
+	// ModelLimits 按模型配置，每个用户在该模型上单独计数
+	ModelLimits map[string]UsageLimit `json:"model_limits"`
+}
+
+// 默认配置
+var usageLimitSetting = UsageLimitSetting{
+	GroupLimits: map[string]UsageLimit{},
+	ModelLimits: map[string]UsageLimit{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("usage_limit_setting", &usageLimitSetting)
+}
+
+func GetUsageLimitSetting() *UsageLimitSetting {
+	return &usageLimitSetting
+}
+
+func GetGroupUsageLimit(group string) (UsageLimit, bool) {
+	limit, ok := usageLimitSetting.GroupLimits[group]
+	return limit, ok && !limit.IsEmpty()
+}
+
+func GetModelUsageLimit(modelName string) (UsageLimit, bool) {
+	limit, ok := usageLimitSetting.ModelLimits[modelName]
+	return limit, ok && !limit.IsEmpty()
+}
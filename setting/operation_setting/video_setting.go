@@ -0,0 +1,62 @@
+// Copyright (c) 2025 Tethys Plex
+//
+// This file is part of Veloera.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+package operation_setting
+
+import "veloera/setting/config"
+
+// VideoSetting 视频生成任务的计费与结果缓存配置
+type VideoSetting struct {
+	// SecondPrices 按秒计费的模型价格（美元/秒），未配置的模型按条使用模型固定价格计费
+	SecondPrices map[string]float64 `json:"second_prices"`
+	// CacheEnabled 任务完成后将结果下载到本地，避免客户端拿到会过期的上游地址
+	CacheEnabled bool   `json:"cache_enabled"`
+	CacheDir     string `json:"cache_dir"`
+	// MaxCacheSize 单个结果文件的最大缓存大小（MB）
+	MaxCacheSize int64 `json:"max_cache_size"`
+	// CacheRetentionDays 缓存文件保留天数，0 表示不按时间清理
+	CacheRetentionDays int `json:"cache_retention_days"`
+	// MaxCacheTotalSize 缓存目录的总大小上限（MB），超出时从最早的文件开始删除，0 表示不限制
+	MaxCacheTotalSize int64 `json:"max_cache_total_size"`
+}
+
+// 默认配置
+var videoSetting = VideoSetting{
+	SecondPrices: map[string]float64{
+		"sora-2":     0.1,
+		"sora-2-pro": 0.3,
+	},
+	CacheEnabled:       true,
+	CacheDir:           "./data/videos",
+	MaxCacheSize:       500,
+	CacheRetentionDays: 7,
+	MaxCacheTotalSize:  10240,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("video_setting", &videoSetting)
+}
+
+func GetVideoSetting() *VideoSetting {
+	return &videoSetting
+}
+
+// GetVideoSecondPrice 获取模型的按秒价格，未配置时返回 false
+func GetVideoSecondPrice(model string) (float64, bool) {
+	price, ok := videoSetting.SecondPrices[model]
+	return price, ok
+}
@@ -27,7 +27,8 @@ var CheckSensitiveOnPromptEnabled = true
 var SafeCheckExemptEnabled = false
 var SafeCheckExemptGroup = "nsfw-ok"
 
-//var CheckSensitiveOnCompletionEnabled = true
+// CheckSensitiveOnCompletionEnabled 是否检查上游返回的补全内容
+var CheckSensitiveOnCompletionEnabled = false
 
 // StopOnSensitiveEnabled 如果检测到敏感词，是否立刻停止生成，否则替换敏感词
 var StopOnSensitiveEnabled = true
@@ -102,6 +103,13 @@ func ShouldCheckPromptSensitiveWithGroup(group string) bool {
 	return ShouldCheckPromptSensitive()
 }
 
-//func ShouldCheckCompletionSensitive() bool {
-//	return CheckSensitiveEnabled && CheckSensitiveOnCompletionEnabled
-//}
+func ShouldCheckCompletionSensitive() bool {
+	return CheckSensitiveEnabled && CheckSensitiveOnCompletionEnabled
+}
+
+func ShouldCheckCompletionSensitiveWithGroup(group string) bool {
+	if SafeCheckExemptEnabled && group == SafeCheckExemptGroup {
+		return false
+	}
+	return ShouldCheckCompletionSensitive()
+}
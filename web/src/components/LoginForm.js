@@ -22,6 +22,8 @@ import { UserContext } from '../context/User';
 import {
   API,
   getLogo,
+  getPasskeyAssertion,
+  isPasskeySupported,
   showError,
   showInfo,
   showSuccess,
@@ -69,6 +71,8 @@ const LoginForm = () => {
   let navigate = useNavigate();
   const [status, setStatus] = useState({});
   const [showWeChatLoginModal, setShowWeChatLoginModal] = useState(false);
+  const [showTwoFAModal, setShowTwoFAModal] = useState(false);
+  const [twoFACode, setTwoFACode] = useState('');
   const { t } = useTranslation();
 
   const logo = getLogo();
@@ -82,6 +86,9 @@ const LoginForm = () => {
     if (searchParams.get('expired')) {
       showError(t('未登录或登录已过期，请重新登录'));
     }
+    if (searchParams.get('require_2fa')) {
+      setShowTwoFAModal(true);
+    }
     let status = localStorage.getItem('status');
     if (status) {
       status = JSON.parse(status);
@@ -107,13 +114,17 @@ const LoginForm = () => {
     );
     const { success, message, data } = res.data;
     if (success) {
+      setShowWeChatLoginModal(false);
+      if (data && data.require_2fa) {
+        setShowTwoFAModal(true);
+        return;
+      }
       userDispatch({ type: 'login', payload: data });
       localStorage.setItem('user', JSON.stringify(data));
       setUserData(data);
       updateAPI();
       navigate(searchParams.get('returnTo') || '/');
       showSuccess('登录成功！');
-      setShowWeChatLoginModal(false);
     } else {
       showError(message);
     }
@@ -139,6 +150,10 @@ const LoginForm = () => {
       );
       const { success, message, data } = res.data;
       if (success) {
+        if (data && data.require_2fa) {
+          setShowTwoFAModal(true);
+          return;
+        }
         userDispatch({ type: 'login', payload: data });
         setUserData(data);
         updateAPI();
@@ -159,6 +174,63 @@ const LoginForm = () => {
     }
   }
 
+  // 密码或第三方登录通过后，提交两步验证码完成登录
+  const onSubmitTwoFACode = async () => {
+    if (!twoFACode) {
+      showInfo(t('请输入验证码或恢复码'));
+      return;
+    }
+    const res = await API.post('/api/user/login/2fa', { code: twoFACode });
+    const { success, message, data } = res.data;
+    if (success) {
+      userDispatch({ type: 'login', payload: data });
+      localStorage.setItem('user', JSON.stringify(data));
+      setUserData(data);
+      updateAPI();
+      setShowTwoFAModal(false);
+      setTwoFACode('');
+      showSuccess('登录成功！');
+      navigate(searchParams.get('returnTo') || '/token');
+    } else {
+      showError(message);
+    }
+  };
+
+  const onPasskeyLoginClicked = async () => {
+    const res = await API.post('/api/user/passkey/login/begin');
+    const { success, message, data } = res.data;
+    if (!success) {
+      showError(message);
+      return;
+    }
+    let assertion;
+    try {
+      assertion = await getPasskeyAssertion(data);
+    } catch (e) {
+      showError(t('通行密钥验证已取消或失败'));
+      return;
+    }
+    const finishRes = await API.post(
+      '/api/user/passkey/login/finish',
+      assertion,
+    );
+    const result = finishRes.data;
+    if (result.success) {
+      if (result.data && result.data.require_2fa) {
+        setShowTwoFAModal(true);
+        return;
+      }
+      userDispatch({ type: 'login', payload: result.data });
+      localStorage.setItem('user', JSON.stringify(result.data));
+      setUserData(result.data);
+      updateAPI();
+      showSuccess('登录成功！');
+      navigate(searchParams.get('returnTo') || '/token');
+    } else {
+      showError(result.message);
+    }
+  };
+
   // 添加Telegram登录处理函数
   const onTelegramLoginClicked = async (response) => {
     const fields = [
@@ -180,6 +252,10 @@ const LoginForm = () => {
     const res = await API.get(`/api/oauth/telegram/login`, { params });
     const { success, message, data } = res.data;
     if (success) {
+      if (data && data.require_2fa) {
+        setShowTwoFAModal(true);
+        return;
+      }
       userDispatch({ type: 'login', payload: data });
       localStorage.setItem('user', JSON.stringify(data));
       showSuccess('登录成功！');
@@ -235,6 +311,17 @@ const LoginForm = () => {
                   >
                     {t('登录')}
                   </Button>
+                  {status.passkey_login && isPasskeySupported() ? (
+                    <Button
+                      style={{ width: '100%', marginTop: 10 }}
+                      size='large'
+                      onClick={onPasskeyLoginClicked}
+                    >
+                      {t('使用通行密钥登录')}
+                    </Button>
+                  ) : (
+                    <></>
+                  )}
                 </Form>
                 <div
                   style={{
@@ -373,6 +460,36 @@ const LoginForm = () => {
                     />
                   </Form>
                 </Modal>
+                <Modal
+                  title={t('两步验证')}
+                  visible={showTwoFAModal}
+                  maskClosable={false}
+                  onOk={onSubmitTwoFACode}
+                  onCancel={() => {
+                    setShowTwoFAModal(false);
+                    setTwoFACode('');
+                  }}
+                  okText={t('验证')}
+                  size={'small'}
+                  centered={true}
+                >
+                  <div style={{ marginBottom: 12 }}>
+                    <Text>
+                      {t(
+                        '请输入身份验证器中的 6 位验证码，或使用一个恢复码',
+                      )}
+                    </Text>
+                  </div>
+                  <Form size='large'>
+                    <Form.Input
+                      field={'two_fa_code'}
+                      placeholder={t('验证码或恢复码')}
+                      noLabel
+                      value={twoFACode}
+                      onChange={(value) => setTwoFACode(value)}
+                    />
+                  </Form>
+                </Modal>
               </Card>
               {turnstileEnabled ? (
                 <div
@@ -991,6 +991,12 @@ const LogsTable = () => {
             value: other.upstream_model_name,
           });
         }
+        if (other?.model_fallback_from) {
+          expandDataLocal.push({
+            key: t('降级前模型'),
+            value: other.model_fallback_from,
+          });
+        }
         let content = '';
         if (other?.ws || other?.audio) {
           content = renderAudioModelPrice(
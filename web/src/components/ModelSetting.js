@@ -42,6 +42,7 @@ const ModelSetting = () => {
     'global.rate_limit_exempt_group': 'bulk-ok',
     'global.safe_check_exempt_enabled': false,
     'global.safe_check_exempt_group': 'nsfw-ok',
+    'global.model_fallbacks': '',
     'general_setting.ping_interval_enabled': false,
     'general_setting.ping_interval_seconds': 60,
     'gemini.thinking_adapter_enabled': false,
@@ -63,7 +64,8 @@ const ModelSetting = () => {
           item.key === 'claude.model_headers_settings' ||
           item.key === 'claude.default_max_tokens' ||
           item.key === 'gemini.supported_imagine_models' ||
-          item.key === 'gemini.models_supported_thinking_budget'
+          item.key === 'gemini.models_supported_thinking_budget' ||
+          item.key === 'global.model_fallbacks'
         ) {
           item.value = JSON.stringify(JSON.parse(item.value), null, 2);
         }
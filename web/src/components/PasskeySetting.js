@@ -0,0 +1,207 @@
+/*
+Copyright (c) 2025 Tethys Plex
+
+This file is part of Veloera.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+import React, { useEffect, useState } from 'react';
+import {
+  API,
+  createPasskeyCredential,
+  isPasskeySupported,
+  showError,
+  showSuccess,
+  timestamp2string,
+} from '../helpers';
+import {
+  Button,
+  Card,
+  Input,
+  List,
+  Modal,
+  Popconfirm,
+  Space,
+  Typography,
+} from '@douyinfe/semi-ui';
+import { useTranslation } from 'react-i18next';
+
+// 通行密钥管理：注册新的通行密钥、查看与删除已注册的通行密钥
+const PasskeySetting = () => {
+  const { t } = useTranslation();
+  const [passkeys, setPasskeys] = useState([]);
+  const [name, setName] = useState('');
+  const [loading, setLoading] = useState(false);
+  // 添加通行密钥前需要再次验证身份：启用两步验证时输入验证码，否则输入当前密码
+  const [reauthVisible, setReauthVisible] = useState(false);
+  const [twoFAEnabled, setTwoFAEnabled] = useState(false);
+  const [credential, setCredential] = useState('');
+
+  const loadPasskeys = async () => {
+    const res = await API.get('/api/user/passkey');
+    const { success, message, data } = res.data;
+    if (success) {
+      setPasskeys(data || []);
+    } else {
+      showError(message);
+    }
+  };
+
+  const loadTwoFAStatus = async () => {
+    const res = await API.get('/api/user/2fa/status');
+    const { success, data } = res.data;
+    if (success) {
+      setTwoFAEnabled(data.enabled);
+    }
+  };
+
+  useEffect(() => {
+    loadPasskeys().then();
+  }, []);
+
+  const closeReauth = () => {
+    setReauthVisible(false);
+    setCredential('');
+  };
+
+  const registerPasskey = async () => {
+    setLoading(true);
+    try {
+      const res = await API.post(
+        '/api/user/passkey/register/begin',
+        twoFAEnabled ? { code: credential } : { password: credential },
+      );
+      const { success, message, data } = res.data;
+      if (!success) {
+        showError(message);
+        return;
+      }
+      closeReauth();
+      let passkeyCredential;
+      try {
+        passkeyCredential = await createPasskeyCredential(data);
+      } catch (e) {
+        showError(t('通行密钥注册已取消或失败'));
+        return;
+      }
+      const finishRes = await API.post(
+        `/api/user/passkey/register/finish?name=${encodeURIComponent(name)}`,
+        passkeyCredential,
+      );
+      if (finishRes.data.success) {
+        showSuccess(t('通行密钥已添加'));
+        setName('');
+        await loadPasskeys();
+      } else {
+        showError(finishRes.data.message);
+      }
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const deletePasskey = async (id) => {
+    const res = await API.delete(`/api/user/passkey/${id}`);
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess(t('通行密钥已删除'));
+      await loadPasskeys();
+    } else {
+      showError(message);
+    }
+  };
+
+  return (
+    <Card style={{ marginTop: 10 }}>
+      <Typography.Title heading={6}>{t('通行密钥')}</Typography.Title>
+      <List
+        dataSource={passkeys}
+        emptyContent={t('暂无通行密钥')}
+        renderItem={(item) => (
+          <List.Item
+            main={
+              <div>
+                <Typography.Text strong>{item.name}</Typography.Text>
+                <br />
+                <Typography.Text type='secondary' size='small'>
+                  {t('添加时间')}: {timestamp2string(item.created_time)}
+                  {item.last_used_time
+                    ? ` · ${t('最后使用')}: ${timestamp2string(item.last_used_time)}`
+                    : ''}
+                </Typography.Text>
+              </div>
+            }
+            extra={
+              <Popconfirm
+                title={t('确定要删除该通行密钥吗？')}
+                okType={'danger'}
+                onConfirm={() => deletePasskey(item.id)}
+              >
+                <Button type='danger' theme='light'>
+                  {t('删除')}
+                </Button>
+              </Popconfirm>
+            }
+          />
+        )}
+      />
+      <Space style={{ marginTop: 10 }}>
+        <Input
+          placeholder={t('通行密钥名称（可选）')}
+          value={name}
+          onChange={(value) => setName(value)}
+        />
+        <Button
+          loading={loading}
+          disabled={!isPasskeySupported()}
+          onClick={() => {
+            // 两步验证状态可能在本页面被修改，打开前重新获取
+            loadTwoFAStatus().then();
+            setReauthVisible(true);
+          }}
+        >
+          {isPasskeySupported()
+            ? t('添加通行密钥')
+            : t('当前浏览器不支持通行密钥')}
+        </Button>
+      </Space>
+      <Modal
+        title={t('验证身份')}
+        visible={reauthVisible}
+        onOk={registerPasskey}
+        onCancel={closeReauth}
+        confirmLoading={loading}
+        size={'small'}
+        centered={true}
+      >
+        {twoFAEnabled ? (
+          <Input
+            placeholder={t('验证码或恢复码')}
+            value={credential}
+            onChange={(value) => setCredential(value)}
+          />
+        ) : (
+          <Input
+            type='password'
+            placeholder={t('当前密码')}
+            value={credential}
+            onChange={(value) => setCredential(value)}
+          />
+        )}
+      </Modal>
+    </Card>
+  );
+};
+
+export default PasskeySetting;
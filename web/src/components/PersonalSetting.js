@@ -63,6 +63,8 @@ import {
   stringToColor,
 } from '../helpers/render';
 import TelegramLoginButton from 'react-telegram-login';
+import TwoFASetting from './TwoFASetting';
+import PasskeySetting from './PasskeySetting';
 import { useTranslation } from 'react-i18next';
 
 const PersonalSetting = () => {
@@ -91,6 +93,8 @@ const PersonalSetting = () => {
   const [countdown, setCountdown] = useState(30);
   const [affLink, setAffLink] = useState('');
   const [systemToken, setSystemToken] = useState('');
+  const [showTokenTwoFAModal, setShowTokenTwoFAModal] = useState(false);
+  const [tokenTwoFACode, setTokenTwoFACode] = useState('');
   const [models, setModels] = useState([]);
   const [openTransfer, setOpenTransfer] = useState(false);
   const [transferAmount, setTransferAmount] = useState(0);
@@ -177,13 +181,18 @@ const PersonalSetting = () => {
     setInputs((inputs) => ({ ...inputs, [name]: value }));
   };
 
-  const generateAccessToken = async () => {
-    const res = await API.get('/api/user/token');
+  const generateAccessToken = async (code = '') => {
+    const res = await API.get('/api/user/token', { params: { code } });
     const { success, message, data } = res.data;
     if (success) {
+      setShowTokenTwoFAModal(false);
+      setTokenTwoFACode('');
       setSystemToken(data);
       await copy(data);
       showSuccess(t('令牌已重置并已复制到剪贴板'));
+    } else if (data && data.require_2fa && !showTokenTwoFAModal) {
+      // 已启用两步验证，需要输入验证码后再生成
+      setShowTokenTwoFAModal(true);
     } else {
       showError(message);
     }
@@ -859,7 +868,7 @@ const PersonalSetting = () => {
               </div>
               <div style={{ marginTop: 10 }}>
                 <Space>
-                  <Button onClick={generateAccessToken}>
+                  <Button onClick={() => generateAccessToken()}>
                     {t('生成系统访问令牌')}
                   </Button>
                   <Button
@@ -887,6 +896,23 @@ const PersonalSetting = () => {
                     style={{ marginTop: '10px' }}
                   />
                 )}
+                <Modal
+                  title={t('两步验证')}
+                  onCancel={() => {
+                    setShowTokenTwoFAModal(false);
+                    setTokenTwoFACode('');
+                  }}
+                  onOk={() => generateAccessToken(tokenTwoFACode)}
+                  visible={showTokenTwoFAModal}
+                  size={'small'}
+                  centered={true}
+                >
+                  <Input
+                    placeholder={t('验证码或恢复码')}
+                    value={tokenTwoFACode}
+                    onChange={(value) => setTokenTwoFACode(value)}
+                  />
+                </Modal>
                 <Modal
                   onCancel={() => setShowWeChatBindModal(false)}
                   visible={showWeChatBindModal}
@@ -912,6 +938,8 @@ const PersonalSetting = () => {
                 </Modal>
               </div>
             </Card>
+            <TwoFASetting />
+            <PasskeySetting />
             <Card style={{ marginTop: 10 }}>
               <Tabs type="line" defaultActiveKey="notification">
                 <TabPane tab={t('通知设置')} itemKey="notification">
@@ -42,6 +42,7 @@ const SystemSetting = () => {
   let [inputs, setInputs] = useState({
     PasswordLoginEnabled: '',
     PasswordRegisterEnabled: '',
+    PasskeyLoginEnabled: '',
     EmailVerificationEnabled: '',
     GitHubOAuthEnabled: '',
     GitHubClientId: '',
@@ -78,6 +79,7 @@ const SystemSetting = () => {
     TurnstileSiteKey: '',
     TurnstileSecretKey: '',
     RegisterEnabled: '',
+    AdminTwoFARequiredEnabled: '',
     EmailDomainRestrictionEnabled: '',
     EmailAliasRestrictionEnabled: '',
     SMTPSSLEnabled: '',
@@ -117,11 +119,13 @@ const SystemSetting = () => {
             break;
           case 'PasswordLoginEnabled':
           case 'PasswordRegisterEnabled':
+          case 'PasskeyLoginEnabled':
           case 'EmailVerificationEnabled':
           case 'GitHubOAuthEnabled':
           case 'WeChatAuthEnabled':
           case 'TelegramOAuthEnabled':
           case 'RegisterEnabled':
+          case 'AdminTwoFARequiredEnabled':
           case 'TurnstileCheckEnabled':
           case 'EmailDomainRestrictionEnabled':
           case 'EmailAliasRestrictionEnabled':
@@ -678,6 +682,15 @@ const SystemSetting = () => {
                       >
                         允许通过密码进行登录
                       </Form.Checkbox>
+                      <Form.Checkbox
+                        field='PasskeyLoginEnabled'
+                        noLabel
+                        onChange={(e) =>
+                          handleCheckboxChange('PasskeyLoginEnabled', e)
+                        }
+                      >
+                        允许通过通行密钥进行登录
+                      </Form.Checkbox>
                       <Form.Checkbox
                         field='PasswordRegisterEnabled'
                         noLabel
@@ -714,6 +727,15 @@ const SystemSetting = () => {
                       >
                         启用 Turnstile 用户校验
                       </Form.Checkbox>
+                      <Form.Checkbox
+                        field='AdminTwoFARequiredEnabled'
+                        noLabel
+                        onChange={(e) =>
+                          handleCheckboxChange('AdminTwoFARequiredEnabled', e)
+                        }
+                      >
+                        要求管理员启用两步验证
+                      </Form.Checkbox>
                     </Col>
                     <Col xs={24} sm={24} md={12} lg={12} xl={12}>
                       <Form.Checkbox
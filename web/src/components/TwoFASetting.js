@@ -0,0 +1,235 @@
+/*
+Copyright (c) 2025 Tethys Plex
+
+This file is part of Veloera.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+import React, { useEffect, useState } from 'react';
+import { API, copy, showError, showSuccess } from '../helpers';
+import {
+  Banner,
+  Button,
+  Card,
+  Image,
+  Input,
+  Modal,
+  Space,
+  Tag,
+  Typography,
+} from '@douyinfe/semi-ui';
+import { useTranslation } from 'react-i18next';
+
+// 两步验证（TOTP）设置：绑定身份验证器、查看与重新生成恢复码、关闭两步验证
+const TwoFASetting = () => {
+  const { t } = useTranslation();
+  const [twoFAStatus, setTwoFAStatus] = useState({
+    enabled: false,
+    required: false,
+    recovery_codes_remaining: 0,
+  });
+  const [setupData, setSetupData] = useState(null);
+  const [code, setCode] = useState('');
+  const [recoveryCodes, setRecoveryCodes] = useState([]);
+  // action: 'disable' | 'recovery_codes'，需要输入验证码确认的操作
+  const [action, setAction] = useState('');
+  const [loading, setLoading] = useState(false);
+
+  const loadStatus = async () => {
+    const res = await API.get('/api/user/2fa/status');
+    const { success, message, data } = res.data;
+    if (success) {
+      setTwoFAStatus(data);
+    } else {
+      showError(message);
+    }
+  };
+
+  useEffect(() => {
+    loadStatus().then();
+  }, []);
+
+  const startSetup = async () => {
+    setLoading(true);
+    const res = await API.post('/api/user/2fa/setup');
+    const { success, message, data } = res.data;
+    if (success) {
+      setSetupData(data);
+      setCode('');
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  const enableTwoFA = async () => {
+    if (!code) {
+      showError(t('请输入验证码'));
+      return;
+    }
+    setLoading(true);
+    const res = await API.post('/api/user/2fa/enable', { code });
+    const { success, message, data } = res.data;
+    if (success) {
+      showSuccess(t('两步验证已启用'));
+      setSetupData(null);
+      setCode('');
+      setRecoveryCodes(data.recovery_codes);
+      await loadStatus();
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  const submitAction = async () => {
+    if (!code) {
+      showError(t('请输入验证码或恢复码'));
+      return;
+    }
+    setLoading(true);
+    const res = await API.post(`/api/user/2fa/${action}`, { code });
+    const { success, message, data } = res.data;
+    if (success) {
+      if (action === 'disable') {
+        showSuccess(t('两步验证已关闭'));
+      } else {
+        setRecoveryCodes(data.recovery_codes);
+      }
+      setAction('');
+      setCode('');
+      await loadStatus();
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  return (
+    <Card style={{ marginTop: 10 }}>
+      <Typography.Title heading={6}>
+        {t('两步验证')}{' '}
+        {twoFAStatus.enabled ? (
+          <Tag color='green'>{t('已启用')}</Tag>
+        ) : (
+          <Tag color='grey'>{t('未启用')}</Tag>
+        )}
+      </Typography.Title>
+      {twoFAStatus.required && !twoFAStatus.enabled && (
+        <Banner
+          type='warning'
+          description={t('管理员要求启用两步验证，启用前将无法访问管理功能')}
+          closeIcon={null}
+          style={{ marginBottom: 10 }}
+        />
+      )}
+      {twoFAStatus.enabled ? (
+        <>
+          <Typography.Text type='secondary'>
+            {t('剩余恢复码')}: {twoFAStatus.recovery_codes_remaining}
+          </Typography.Text>
+          <div style={{ marginTop: 10 }}>
+            <Space>
+              <Button onClick={() => setAction('recovery_codes')}>
+                {t('重新生成恢复码')}
+              </Button>
+              <Button
+                type='danger'
+                disabled={twoFAStatus.required}
+                onClick={() => setAction('disable')}
+              >
+                {t('关闭两步验证')}
+              </Button>
+            </Space>
+          </div>
+        </>
+      ) : setupData ? (
+        <div>
+          <Typography.Text>
+            {t('使用身份验证器扫描二维码，然后输入 6 位验证码完成绑定')}
+          </Typography.Text>
+          <div style={{ marginTop: 10 }}>
+            <Image src={setupData.qr_code} width={200} height={200} />
+          </div>
+          <Typography.Text type='secondary' copyable>
+            {setupData.secret}
+          </Typography.Text>
+          <Space style={{ marginTop: 10 }}>
+            <Input
+              placeholder={t('验证码')}
+              value={code}
+              onChange={(value) => setCode(value)}
+            />
+            <Button type='primary' loading={loading} onClick={enableTwoFA}>
+              {t('启用')}
+            </Button>
+          </Space>
+        </div>
+      ) : (
+        <Button loading={loading} onClick={startSetup}>
+          {t('设置两步验证')}
+        </Button>
+      )}
+      <Modal
+        title={
+          action === 'disable' ? t('关闭两步验证') : t('重新生成恢复码')
+        }
+        visible={action !== ''}
+        onOk={submitAction}
+        onCancel={() => {
+          setAction('');
+          setCode('');
+        }}
+        confirmLoading={loading}
+        size={'small'}
+        centered={true}
+      >
+        <Input
+          placeholder={t('验证码或恢复码')}
+          value={code}
+          onChange={(value) => setCode(value)}
+        />
+      </Modal>
+      <Modal
+        title={t('恢复码')}
+        visible={recoveryCodes.length > 0}
+        onOk={() => setRecoveryCodes([])}
+        onCancel={() => setRecoveryCodes([])}
+        hasCancel={false}
+        size={'small'}
+        centered={true}
+      >
+        <Banner
+          type='warning'
+          description={t(
+            '恢复码只会显示一次，每个恢复码只能使用一次，请妥善保存',
+          )}
+          closeIcon={null}
+        />
+        <pre style={{ marginTop: 10 }}>{recoveryCodes.join('\n')}</pre>
+        <Button
+          onClick={async () => {
+            if (await copy(recoveryCodes.join('\n'))) {
+              showSuccess(t('已复制到剪贴板'));
+            }
+          }}
+        >
+          {t('复制')}
+        </Button>
+      </Modal>
+    </Card>
+  );
+};
+
+export default TwoFASetting;
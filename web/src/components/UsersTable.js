@@ -17,7 +17,7 @@ You should have received a copy of the GNU General Public License
 along with this program. If not, see <https://www.gnu.org/licenses/>.
 */
 import React, { useEffect, useState } from 'react';
-import { API, showError, showSuccess } from '../helpers';
+import { API, isRoot, showError, showSuccess } from '../helpers';
 import {
   Button,
   Form,
@@ -31,6 +31,8 @@ import { ITEMS_PER_PAGE } from '../constants';
 import { renderGroup, renderNumber, renderQuota } from '../helpers/render';
 import AddUser from '../pages/User/AddUser';
 import EditUser from '../pages/User/EditUser';
+import EditUserPermission from '../pages/User/EditUserPermission';
+import PermissionAudit from '../pages/User/PermissionAudit';
 import { useTranslation } from 'react-i18next';
 
 const UsersTable = () => {
@@ -217,6 +219,36 @@ const UsersTable = () => {
                   {t('启用')}
                 </Button>
               )}
+              {isRoot() && record.role === 10 ? (
+                <Button
+                  theme='light'
+                  type='tertiary'
+                  style={{ marginRight: 1 }}
+                  onClick={() => {
+                    setEditingUser(record);
+                    setShowEditPermission(true);
+                  }}
+                >
+                  {t('权限')}
+                </Button>
+              ) : (
+                <></>
+              )}
+              <Popconfirm
+                title={t('确定要重置该用户的两步验证吗？')}
+                okType={'warning'}
+                onConfirm={() => {
+                  manageUser(record.id, 'reset_2fa', record);
+                }}
+              >
+                <Button
+                  theme='light'
+                  type='tertiary'
+                  style={{ marginRight: 1 }}
+                >
+                  {t('重置两步验证')}
+                </Button>
+              </Popconfirm>
               <Button
                 theme='light'
                 type='tertiary'
@@ -261,6 +293,8 @@ const UsersTable = () => {
   const [userCount, setUserCount] = useState(ITEMS_PER_PAGE);
   const [showAddUser, setShowAddUser] = useState(false);
   const [showEditUser, setShowEditUser] = useState(false);
+  const [showEditPermission, setShowEditPermission] = useState(false);
+  const [showPermissionAudit, setShowPermissionAudit] = useState(false);
   const [editingUser, setEditingUser] = useState({
     id: undefined,
   });
@@ -451,6 +485,16 @@ const UsersTable = () => {
         handleClose={closeEditUser}
         editingUser={editingUser}
       ></EditUser>
+      <EditUserPermission
+        refresh={refresh}
+        visible={showEditPermission}
+        handleClose={() => setShowEditPermission(false)}
+        editingUser={editingUser}
+      ></EditUserPermission>
+      <PermissionAudit
+        visible={showPermissionAudit}
+        handleClose={() => setShowPermissionAudit(false)}
+      ></PermissionAudit>
       <Form
         onSubmit={() => {
           searchUsers(activePage, pageSize, searchKeyword, searchGroup);
@@ -500,6 +544,15 @@ const UsersTable = () => {
             >
               {t('添加用户')}
             </Button>
+            <Button
+              theme='light'
+              type='tertiary'
+              onClick={() => {
+                setShowPermissionAudit(true);
+              }}
+            >
+              {t('权限审计')}
+            </Button>
           </Space>
         </div>
       </Form>
@@ -33,6 +33,11 @@ export const CHANNEL_OPTIONS = [
     color: 'purple',
     label: 'Suno API',
   },
+  {
+    value: 50,
+    color: 'purple',
+    label: '可灵 Kling',
+  },
   { value: 4, color: 'grey', label: 'Ollama' },
   {
     value: 14,
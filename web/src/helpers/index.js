@@ -20,3 +20,4 @@ export * from './history';
 export * from './auth-header';
 export * from './utils';
 export * from './api';
+export * from './passkey';
@@ -0,0 +1,113 @@
+/*
+Copyright (c) 2025 Tethys Plex
+
+This file is part of Veloera.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+// WebAuthn 的二进制字段在后端以 base64url 字符串传输，调用浏览器 API 前后需要转换
+
+export function isPasskeySupported() {
+  return (
+    typeof window !== 'undefined' &&
+    window.PublicKeyCredential !== undefined &&
+    navigator.credentials !== undefined
+  );
+}
+
+function base64UrlToBuffer(value) {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+  const padded = base64 + '='.repeat((4 - (base64.length % 4)) % 4);
+  const binary = atob(padded);
+  const bytes = new Uint8Array(binary.length);
+  for (let i = 0; i < binary.length; i++) {
+    bytes[i] = binary.charCodeAt(i);
+  }
+  return bytes.buffer;
+}
+
+function bufferToBase64Url(buffer) {
+  const bytes = new Uint8Array(buffer);
+  let binary = '';
+  for (let i = 0; i < bytes.length; i++) {
+    binary += String.fromCharCode(bytes[i]);
+  }
+  return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+function convertCredentialDescriptors(descriptors) {
+  return (descriptors || []).map((descriptor) => ({
+    ...descriptor,
+    id: base64UrlToBuffer(descriptor.id),
+  }));
+}
+
+// 注册通行密钥，options 为 /api/user/passkey/register/begin 返回的数据
+export async function createPasskeyCredential(options) {
+  const publicKey = {
+    ...options.publicKey,
+    challenge: base64UrlToBuffer(options.publicKey.challenge),
+    user: {
+      ...options.publicKey.user,
+      id: base64UrlToBuffer(options.publicKey.user.id),
+    },
+    excludeCredentials: convertCredentialDescriptors(
+      options.publicKey.excludeCredentials,
+    ),
+  };
+  const credential = await navigator.credentials.create({ publicKey });
+  return {
+    id: credential.id,
+    rawId: bufferToBase64Url(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: bufferToBase64Url(credential.response.clientDataJSON),
+      attestationObject: bufferToBase64Url(
+        credential.response.attestationObject,
+      ),
+      transports: credential.response.getTransports
+        ? credential.response.getTransports()
+        : [],
+    },
+    clientExtensionResults: credential.getClientExtensionResults(),
+  };
+}
+
+// 使用通行密钥登录，options 为 /api/user/passkey/login/begin 返回的数据
+export async function getPasskeyAssertion(options) {
+  const publicKey = {
+    ...options.publicKey,
+    challenge: base64UrlToBuffer(options.publicKey.challenge),
+    allowCredentials: convertCredentialDescriptors(
+      options.publicKey.allowCredentials,
+    ),
+  };
+  const credential = await navigator.credentials.get({ publicKey });
+  return {
+    id: credential.id,
+    rawId: bufferToBase64Url(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: bufferToBase64Url(credential.response.clientDataJSON),
+      authenticatorData: bufferToBase64Url(
+        credential.response.authenticatorData,
+      ),
+      signature: bufferToBase64Url(credential.response.signature),
+      userHandle: credential.response.userHandle
+        ? bufferToBase64Url(credential.response.userHandle)
+        : null,
+    },
+    clientExtensionResults: credential.getClientExtensionResults(),
+  };
+}
@@ -258,6 +258,8 @@ function type2secretPrompt(type) {
       return '按照如下格式输入：AppId|SecretId|SecretKey，多个密钥使用英文逗号分隔';
     case 33:
       return '按照如下格式输入：Ak|Sk|Region，多个密钥使用英文逗号分隔';
+    case 50:
+      return '按照如下格式输入：AccessKey|SecretKey，多个密钥使用英文逗号分隔';
     default:
       return '请输入渠道对应的鉴权密钥，多个密钥使用英文逗号分隔';
   }
@@ -277,6 +279,8 @@ const EditChannel = (props) => {
   const [loading, setLoading] = useState(isEdit);
   const [showKey, setShowKey] = useState(false);
   const [initialKey, setInitialKey] = useState('');
+  // 编辑时默认不加载密钥，只有点击显示密钥时才向后端请求
+  const [keyRevealed, setKeyRevealed] = useState(false);
   const [keyList, setKeyList] = useState([]);
   const [useKeyListMode, setUseKeyListMode] = useState(false);
   const [disableMultiKeyView, setDisableMultiKeyView] = useState(false);
@@ -490,6 +494,9 @@ const EditChannel = (props) => {
         case 36:
           localModels = ['suno_music', 'suno_lyrics'];
           break;
+        case 50:
+          localModels = ['kling-v1', 'kling-v1-6', 'kling-v2-master', 'kling-v2-1-master'];
+          break;
         default:
           localModels = getChannelModels(value);
           break;
@@ -501,6 +508,41 @@ const EditChannel = (props) => {
     }
   };
 
+  // 处理密钥
+  const applyLoadedKey = (key, type) => {
+    if (key && supportsMultiKeyView(type)) {
+       const keys = key.split(',').map(k => k.trim()).filter(k => k.length > 0);
+       if (keys.length > 1) {
+         setUseKeyListMode(true);
+         setShowKey(true); // Ensure showKey is true for list mode
+         setKeyList(keys);
+       } else {
+         setUseKeyListMode(false);
+         setKeyList([]); // Clear keyList if not in list mode
+       }
+    } else {
+      setUseKeyListMode(false);
+      setKeyList([]);
+    }
+    setInitialKey(key); // Store initial key for single input mode placeholder
+  };
+
+  const revealKey = async () => {
+    const res = await API.get(`/api/channel/${channelId}?with_key=true`);
+    if (res === undefined) {
+      return;
+    }
+    const { success, message, data } = res.data;
+    if (!success) {
+      showError(message);
+      return;
+    }
+    applyLoadedKey(data.key, inputs.type);
+    setInputs((inputs) => ({ ...inputs, key: data.key }));
+    setKeyRevealed(true);
+    setShowKey(true);
+  };
+
   const loadChannel = async () => {
     setLoading(true);
     let res = await API.get(`/api/channel/${channelId}`);
@@ -557,23 +599,11 @@ const EditChannel = (props) => {
       }
 
 
-      // 处理密钥
-      if (data.key && supportsMultiKeyView(data.type)) {
-         const keys = data.key.split(',').map(k => k.trim()).filter(k => k.length > 0);
-         if (keys.length > 1) {
-           setUseKeyListMode(true);
-           setShowKey(true); // Ensure showKey is true for list mode
-           setKeyList(keys);
-         } else {
-           setUseKeyListMode(false);
-           setKeyList([]); // Clear keyList if not in list mode
-         }
-      } else {
-        setUseKeyListMode(false);
-        setKeyList([]);
-      }
-       setInitialKey(data.key); // Store initial key for single input mode placeholder
-
+      // 密钥不随渠道详情返回，留空提交时保持原密钥不变
+      data.key = '';
+      applyLoadedKey(data.key, data.type);
+      setKeyRevealed(false);
+      setShowKey(false);
 
       setInputs(data);
       if (data.auto_ban === 0) {
@@ -959,18 +989,30 @@ const EditChannel = (props) => {
     // 多行文本框类型的渠道 (type 41)
     if (inputs.type === 41) {
       return (
-        <TextArea
-          label={t('密钥')}
-          name='key'
-          required
-          placeholder={t(type2secretPrompt(inputs.type))}
-          onChange={(value) => {
-            handleInputChange('key', value);
-          }}
-          value={inputs.key}
-          autoComplete='new-password'
-          autosize={{ minRows: 2 }}
-        />
+        <>
+          <TextArea
+            label={t('密钥')}
+            name='key'
+            required
+            placeholder={isEdit && !keyRevealed ? t('密钥已隐藏，留空则保持不变') : t(type2secretPrompt(inputs.type))}
+            onChange={(value) => {
+              handleInputChange('key', value);
+            }}
+            value={inputs.key}
+            autoComplete='new-password'
+            autosize={{ minRows: 2 }}
+          />
+          {isEdit && !keyRevealed && (
+            <Button
+              theme='borderless'
+              icon={<IconEyeOpened />}
+              onClick={() => revealKey().then()}
+              style={{ marginTop: 8 }}
+            >
+              {t('显示密钥')}
+            </Button>
+          )}
+        </>
       );
     }
 
@@ -1042,7 +1084,7 @@ const EditChannel = (props) => {
         name='key'
         required
         type={showKey ? 'text' : 'password'}
-        placeholder={t(type2secretPrompt(inputs.type))}
+        placeholder={isEdit && !keyRevealed ? t('密钥已隐藏，留空则保持不变') : t(type2secretPrompt(inputs.type))}
         onChange={(value) => {
           handleInputChange('key', value);
         }}
@@ -1097,7 +1139,14 @@ const EditChannel = (props) => {
             <Button
               theme="borderless"
               icon={showKey ? <IconEyeClosedSolid /> : <IconEyeOpened />}
-              onClick={() => setShowKey(!showKey)}
+              onClick={() => {
+                // 尚未输入新密钥时，点击才向后端请求原密钥
+                if (isEdit && !keyRevealed && !inputs.key) {
+                  revealKey().then();
+                } else {
+                  setShowKey(!showKey);
+                }
+              }}
               style={{ padding: '0 4px' }}
             />
           </Space>
@@ -1711,15 +1760,21 @@ const EditChannel = (props) => {
                   cursor: 'pointer',
                 }}
                 onClick={() => {
+                  const settingTemplate =
+                    inputs.type === 33
+                      ? {
+                          aws_model_ids: {
+                            'llama3-3-70b': 'us.meta.llama3-3-70b-instruct-v1:0',
+                            'nova-pro':
+                              'arn:aws:bedrock:us-east-1:123456789012:inference-profile/us.amazon.nova-pro-v1:0',
+                          },
+                        }
+                      : {
+                          force_format: true,
+                        };
                   handleInputChange(
                     'setting',
-                    JSON.stringify(
-                      {
-                        force_format: true,
-                      },
-                      null,
-                      2,
-                    ),
+                    JSON.stringify(settingTemplate, null, 2),
                   );
                 }}
               >
@@ -28,6 +28,10 @@ import {
 } from '../../../helpers';
 import { useTranslation } from 'react-i18next';
 
+const MODEL_FALLBACKS_EXAMPLE = {
+  'gpt-4o': ['gpt-4o-mini'],
+};
+
 export default function SettingGlobalModel(props) {
   const { t } = useTranslation();
 
@@ -40,6 +44,7 @@ export default function SettingGlobalModel(props) {
     'global.rate_limit_exempt_group': 'bulk-ok',
     'global.safe_check_exempt_enabled': false,
     'global.safe_check_exempt_group': 'nsfw-ok',
+    'global.model_fallbacks': '',
     'general_setting.ping_interval_enabled': false,
     'general_setting.ping_interval_seconds': 60,
   });
@@ -201,6 +206,37 @@ export default function SettingGlobalModel(props) {
               </Row>
             </Form.Section>
 
+            <Form.Section text={t('模型降级设置')}>
+              <Row>
+                <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                  <Form.TextArea
+                    label={t('模型降级链')}
+                    placeholder={
+                      t('为一个 JSON 文本，例如：') +
+                      '\n' +
+                      JSON.stringify(MODEL_FALLBACKS_EXAMPLE, null, 2)
+                    }
+                    field={'global.model_fallbacks'}
+                    extraText={t(
+                      '模型的所有渠道都失败后，依次使用列表中的模型重试，并按实际使用的模型计费',
+                    )}
+                    autosize={{ minRows: 6, maxRows: 12 }}
+                    trigger='blur'
+                    stopValidateWithError
+                    rules={[
+                      {
+                        validator: (rule, value) => verifyJSON(value),
+                        message: t('不是合法的 JSON 字符串'),
+                      },
+                    ]}
+                    onChange={(value) =>
+                      setInputs({ ...inputs, 'global.model_fallbacks': value })
+                    }
+                  />
+                </Col>
+              </Row>
+            </Form.Section>
+
             <Form.Section text={t('连接保活设置')}>
               <Row style={{ marginTop: 10 }}>
                 <Col span={24}>
@@ -61,6 +61,13 @@ const EditToken = (props) => {
     model_limits: [],
     allow_ips: '',
     group: '',
+    response_cache: false,
+    tpm_limit: 0,
+    tpd_limit: 0,
+    max_concurrency: 0,
+    daily_budget: 0,
+    weekly_budget: 0,
+    monthly_budget: 0,
   };
   const [inputs, setInputs] = useState(originInputs);
   const {
@@ -76,6 +83,13 @@ const EditToken = (props) => {
     model_limits,
     allow_ips,
     group,
+    response_cache,
+    tpm_limit,
+    tpd_limit,
+    max_concurrency,
+    daily_budget,
+    weekly_budget,
+    monthly_budget,
   } = inputs;
   // const [visible, setVisible] = useState(false);
   const [models, setModels] = useState([]);
@@ -472,6 +486,72 @@ const EditToken = (props) => {
               </div>
             </>
           )}
+          <div style={{ marginTop: 8 }}>
+            <label htmlFor='tpm_limit'>{t('每分钟 Token 限制（TPM，0 为不限制）')}</label>
+            <InputNumber
+              id='tpm_limit'
+              name='tpm_limit'
+              min={0}
+              onChange={(v) => handleInputChange('tpm_limit', v)}
+              value={tpm_limit}
+              style={{ width: '100%', marginTop: '4px' }}
+            />
+          </div>
+          <div style={{ marginTop: 8 }}>
+            <label htmlFor='tpd_limit'>{t('每天 Token 限制（TPD，0 为不限制）')}</label>
+            <InputNumber
+              id='tpd_limit'
+              name='tpd_limit'
+              min={0}
+              onChange={(v) => handleInputChange('tpd_limit', v)}
+              value={tpd_limit}
+              style={{ width: '100%', marginTop: '4px' }}
+            />
+          </div>
+          <div style={{ marginTop: 8 }}>
+            <label htmlFor='max_concurrency'>{t('最大并发请求数（0 为不限制）')}</label>
+            <InputNumber
+              id='max_concurrency'
+              name='max_concurrency'
+              min={0}
+              onChange={(v) => handleInputChange('max_concurrency', v)}
+              value={max_concurrency}
+              style={{ width: '100%', marginTop: '4px' }}
+            />
+          </div>
+          <div style={{ marginTop: 8 }}>
+            <label htmlFor='daily_budget'>{t('每日消费上限（额度，0 为不限制）')}</label>
+            <InputNumber
+              id='daily_budget'
+              name='daily_budget'
+              min={0}
+              onChange={(v) => handleInputChange('daily_budget', v)}
+              value={daily_budget}
+              style={{ width: '100%', marginTop: '4px' }}
+            />
+          </div>
+          <div style={{ marginTop: 8 }}>
+            <label htmlFor='weekly_budget'>{t('每周消费上限（额度，0 为不限制）')}</label>
+            <InputNumber
+              id='weekly_budget'
+              name='weekly_budget'
+              min={0}
+              onChange={(v) => handleInputChange('weekly_budget', v)}
+              value={weekly_budget}
+              style={{ width: '100%', marginTop: '4px' }}
+            />
+          </div>
+          <div style={{ marginTop: 8 }}>
+            <label htmlFor='monthly_budget'>{t('每月消费上限（额度，0 为不限制）')}</label>
+            <InputNumber
+              id='monthly_budget'
+              name='monthly_budget'
+              min={0}
+              onChange={(v) => handleInputChange('monthly_budget', v)}
+              value={monthly_budget}
+              style={{ width: '100%', marginTop: '4px' }}
+            />
+          </div>
           <Divider />
           <div style={{ marginTop: 10 }}>
             <Typography.Text>
@@ -544,6 +624,19 @@ const EditToken = (props) => {
               disabled={true}
             />
           )}
+          <div style={{ marginTop: 10, display: 'flex' }}>
+            <Space>
+              <Checkbox
+                name='response_cache'
+                checked={response_cache}
+                onChange={(e) =>
+                  handleInputChange('response_cache', e.target.checked)
+                }
+              >
+                {t('启用响应缓存（相同请求直接返回缓存结果）')}
+              </Checkbox>
+            </Space>
+          </div>
         </Spin>
       </SideSheet>
     </>
@@ -25,6 +25,7 @@ import {
   Button,
   Divider,
   Input,
+  InputNumber,
   Modal,
   Select,
   SideSheet,
@@ -49,6 +50,9 @@ const EditUser = (props) => {
     email: '',
     quota: 0,
     group: 'default',
+    daily_budget: 0,
+    weekly_budget: 0,
+    monthly_budget: 0,
   });
   const [groupOptions, setGroupOptions] = useState([]);
   const {
@@ -62,6 +66,9 @@ const EditUser = (props) => {
     email,
     quota,
     group,
+    daily_budget,
+    weekly_budget,
+    monthly_budget,
   } = inputs;
   const handleInputChange = (name, value) => {
     setInputs((inputs) => ({ ...inputs, [name]: value }));
@@ -241,6 +248,39 @@ const EditUser = (props) => {
                 />
                 <Button onClick={openAddQuotaModal}>{t('添加额度')}</Button>
               </Space>
+              <div style={{ marginTop: 8 }}>
+                <label htmlFor='daily_budget'>{t('每日消费上限（额度，0 为不限制）')}</label>
+                <InputNumber
+                  id='daily_budget'
+                  name='daily_budget'
+                  min={0}
+                  onChange={(v) => handleInputChange('daily_budget', v)}
+                  value={daily_budget}
+                  style={{ width: '100%', marginTop: '4px' }}
+                />
+              </div>
+              <div style={{ marginTop: 8 }}>
+                <label htmlFor='weekly_budget'>{t('每周消费上限（额度，0 为不限制）')}</label>
+                <InputNumber
+                  id='weekly_budget'
+                  name='weekly_budget'
+                  min={0}
+                  onChange={(v) => handleInputChange('weekly_budget', v)}
+                  value={weekly_budget}
+                  style={{ width: '100%', marginTop: '4px' }}
+                />
+              </div>
+              <div style={{ marginTop: 8 }}>
+                <label htmlFor='monthly_budget'>{t('每月消费上限（额度，0 为不限制）')}</label>
+                <InputNumber
+                  id='monthly_budget'
+                  name='monthly_budget'
+                  min={0}
+                  onChange={(v) => handleInputChange('monthly_budget', v)}
+                  value={monthly_budget}
+                  style={{ width: '100%', marginTop: '4px' }}
+                />
+              </div>
             </>
           )}
           <Divider style={{ marginTop: 20 }}>{t('以下信息不可修改')}</Divider>
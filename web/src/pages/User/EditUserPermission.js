@@ -0,0 +1,126 @@
+/*
+Copyright (c) 2025 Tethys Plex
+
+This file is part of Veloera.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+import React, { useEffect, useState } from 'react';
+import { API, showError, showSuccess } from '../../helpers';
+import { Banner, Checkbox, Modal, Radio, RadioGroup } from '@douyinfe/semi-ui';
+import { useTranslation } from 'react-i18next';
+
+export const PERMISSION_LABELS = {
+  'channels:read': '查看渠道',
+  'channels:write': '管理渠道',
+  'users:manage': '管理用户',
+  'logs:read': '查看日志',
+  'logs:write': '清理日志',
+  'billing:manage': '管理兑换码',
+  'options:write': '修改系统设置',
+};
+
+// 为用户单独分配管理权限，未单独分配时使用角色默认权限
+const EditUserPermission = (props) => {
+  const { t } = useTranslation();
+  const { visible, handleClose, editingUser } = props;
+  const [allPermissions, setAllPermissions] = useState([]);
+  const [custom, setCustom] = useState(false);
+  const [selected, setSelected] = useState([]);
+  const [loading, setLoading] = useState(false);
+
+  useEffect(() => {
+    if (!visible) {
+      return;
+    }
+    API.get('/api/permission/').then((res) => {
+      const { success, message, data } = res.data;
+      if (success) {
+        setAllPermissions(data.permissions);
+      } else {
+        showError(message);
+      }
+    });
+    let permissions = [];
+    try {
+      permissions = editingUser.permissions
+        ? JSON.parse(editingUser.permissions)
+        : [];
+    } catch (e) {
+      permissions = [];
+    }
+    setCustom(!!editingUser.permissions);
+    setSelected(permissions);
+  }, [visible, editingUser]);
+
+  const submit = async () => {
+    setLoading(true);
+    const res = await API.put('/api/permission/user', {
+      id: editingUser.id,
+      permissions: custom ? selected : null,
+    });
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess(t('权限已更新'));
+      props.refresh();
+      handleClose();
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  return (
+    <Modal
+      title={`${t('权限设置')} - ${editingUser.username || ''}`}
+      visible={visible}
+      onOk={submit}
+      onCancel={handleClose}
+      confirmLoading={loading}
+      centered={true}
+    >
+      <RadioGroup
+        value={custom ? 'custom' : 'default'}
+        onChange={(e) => setCustom(e.target.value === 'custom')}
+      >
+        <Radio value='default'>{t('使用角色默认权限')}</Radio>
+        <Radio value='custom'>{t('单独分配权限')}</Radio>
+      </RadioGroup>
+      {custom ? (
+        <Checkbox.Group
+          style={{ marginTop: 16 }}
+          value={selected}
+          onChange={(values) => setSelected(values)}
+        >
+          {allPermissions.map((permission) => (
+            <Checkbox key={permission} value={permission}>
+              {t(PERMISSION_LABELS[permission] || permission)} ({permission})
+            </Checkbox>
+          ))}
+        </Checkbox.Group>
+      ) : (
+        <Banner
+          style={{ marginTop: 16 }}
+          type='info'
+          description={t(
+            '管理员默认拥有除修改系统设置外的全部管理权限，普通用户默认没有管理权限',
+          )}
+          closeIcon={null}
+        />
+      )}
+    </Modal>
+  );
+};
+
+export default EditUserPermission;
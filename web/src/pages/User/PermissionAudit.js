@@ -0,0 +1,99 @@
+/*
+Copyright (c) 2025 Tethys Plex
+
+This file is part of Veloera.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+import React, { useEffect, useState } from 'react';
+import { API, showError } from '../../helpers';
+import { Modal, Table, Tag } from '@douyinfe/semi-ui';
+import { useTranslation } from 'react-i18next';
+import { PERMISSION_LABELS } from './EditUserPermission';
+
+// 权限审计：列出所有拥有管理权限的用户及其实际权限
+const PermissionAudit = (props) => {
+  const { t } = useTranslation();
+  const { visible, handleClose } = props;
+  const [holders, setHolders] = useState([]);
+  const [loading, setLoading] = useState(false);
+
+  useEffect(() => {
+    if (!visible) {
+      return;
+    }
+    setLoading(true);
+    API.get('/api/permission/audit').then((res) => {
+      const { success, message, data } = res.data;
+      if (success) {
+        setHolders(data);
+      } else {
+        showError(message);
+      }
+      setLoading(false);
+    });
+  }, [visible]);
+
+  const columns = [
+    {
+      title: 'ID',
+      dataIndex: 'id',
+    },
+    {
+      title: t('用户名'),
+      dataIndex: 'username',
+    },
+    {
+      title: t('来源'),
+      dataIndex: 'custom',
+      render: (custom) =>
+        custom ? (
+          <Tag color='blue'>{t('单独分配')}</Tag>
+        ) : (
+          <Tag>{t('角色默认')}</Tag>
+        ),
+    },
+    {
+      title: t('权限'),
+      dataIndex: 'permissions',
+      render: (permissions) =>
+        permissions.map((permission) => (
+          <Tag key={permission} style={{ margin: 2 }}>
+            {t(PERMISSION_LABELS[permission] || permission)}
+          </Tag>
+        )),
+    },
+  ];
+
+  return (
+    <Modal
+      title={t('权限审计')}
+      visible={visible}
+      onCancel={handleClose}
+      footer={null}
+      width={800}
+      centered={true}
+    >
+      <Table
+        rowKey='id'
+        columns={columns}
+        dataSource={holders}
+        loading={loading}
+        pagination={false}
+      />
+    </Modal>
+  );
+};
+
+export default PermissionAudit;